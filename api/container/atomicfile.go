@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// ---------- Atomic File Writes ----------
+//
+// Downloads and cache entries are written to a uniquely named temp file next
+// to the destination and renamed into place only once complete. Readers of a
+// path (including a concurrent writer's retry, or another job reading a
+// shared cache entry) therefore see either the previous file or a whole new
+// one, never an interleaved or truncated body.
+
+// tempSeq disambiguates temp names created in the same nanosecond
+var tempSeq atomic.Uint64
+
+// uniqueTempPath returns an unused sibling path of path for a temp file
+func uniqueTempPath(path string) string {
+	return fmt.Sprintf("%s.%d.%d.tmp", path, os.Getpid(), tempSeq.Add(1))
+}
+
+// atomicWrite creates a temp file beside destPath, lets fill write it, and
+// renames it over destPath if fill succeeds. On any error the temp file is
+// removed and destPath is left untouched.
+func atomicWrite(destPath string, fill func(f *os.File) (int64, error)) (written int64, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(destPath), filepath.Base(destPath)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("create file failed: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	written, err = fill(tmp)
+	if err != nil {
+		return written, err
+	}
+	if err = tmp.Close(); err != nil {
+		return written, fmt.Errorf("close file failed: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), destPath); err != nil {
+		return written, fmt.Errorf("rename file failed: %w", err)
+	}
+	return written, nil
+}
+
+// partialSuffix marks an FFmpeg output that may still be incomplete
+const partialSuffix = ".part"
+
+// partialOutputArgs points FFmpeg's single-file output at path+".part". The
+// muxer is named explicitly because the extension no longer implies it.
+func partialOutputArgs(path string) []string {
+	return []string{"-f", "mp3", "-y", path + partialSuffix}
+}
+
+// commitPartialOutput moves a finished .part output to path. Call it only
+// after FFmpeg exited 0, so an interrupted encode never reaches upload.
+func commitPartialOutput(path string) error {
+	return os.Rename(path+partialSuffix, path)
+}
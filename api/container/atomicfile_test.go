@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentDownloadsToSamePath(t *testing.T) {
+	// Each request gets a distinct body, streamed slowly enough that the
+	// writers overlap; half of them are cut short.
+	var n atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := n.Add(1)
+		body := bytes.Repeat([]byte{byte('a' + id)}, 64*1024)
+		w.Header().Set("Content-Length", "65536")
+		flusher := w.(http.Flusher)
+		for off := 0; off < len(body); off += 8 * 1024 {
+			if id%2 == 0 && off >= 32*1024 {
+				panic(http.ErrAbortHandler) // truncated response
+			}
+			w.Write(body[off : off+8*1024])
+			flusher.Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "segment.mp3")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			downloadFile(context.Background(), server.URL, dest)
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 64*1024 || !bytes.Equal(data, bytes.Repeat(data[:1], len(data))) {
+		t.Errorf("destination holds a partial or interleaved body (%d bytes)", len(data))
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %d entries", len(entries))
+	}
+}
+
+func TestAtomicWriteKeepsOldFileOnError(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out.mp3")
+	os.WriteFile(dest, []byte("old"), 0644)
+
+	_, err := atomicWrite(dest, func(f *os.File) (int64, error) {
+		f.WriteString("partial")
+		return 7, errSegmentTooLarge
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "old" {
+		t.Errorf("destination = %q, want untouched", data)
+	}
+}
+
+func TestPartialOutput(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "output.mp3")
+	args := partialOutputArgs(out)
+	if got := args[len(args)-1]; got != out+".part" {
+		t.Fatalf("output arg = %q, want %q", got, out+".part")
+	}
+
+	// FFmpeg never finished: nothing to commit and no output.mp3
+	if err := commitPartialOutput(out); err == nil {
+		t.Error("expected error without a .part file")
+	}
+
+	os.WriteFile(out+".part", []byte("audio"), 0644)
+	if err := commitPartialOutput(out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out + ".part"); !os.IsNotExist(err) {
+		t.Error(".part file still present after commit")
+	}
+	if data, _ := os.ReadFile(out); string(data) != "audio" {
+		t.Errorf("output = %q", data)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "test-secret"
+	body := []byte(`{"episode_id":"ep-1"}`)
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	valid := signBody(secret, ts, body)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{"valid", ts, valid, body, false},
+		{"valid with prefix", ts, "sha256=" + valid, body, false},
+		{"missing signature", ts, "", body, true},
+		{"missing timestamp", "", valid, body, true},
+		{"tampered body", ts, valid, []byte(`{"episode_id":"ep-2"}`), true},
+		{"wrong secret", ts, signBody("other", ts, body), body, true},
+		{"stale timestamp", strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10), valid, body, true},
+		{"not hex", ts, "zz", body, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.timestamp != "" {
+				header.Set("X-Timestamp", tt.timestamp)
+			}
+			if tt.signature != "" {
+				header.Set("X-Signature", tt.signature)
+			}
+			err := verifySignature(header, tt.body, secret, 5*time.Minute, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleConcatRejectsUnsignedRequest(t *testing.T) {
+	config.HMACSecret = "test-secret"
+	config.HMACMaxSkew = 5 * time.Minute
+	defer func() { config = Config{} }()
+
+	req := httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(`{"segments":["x"],"output_url":"y"}`))
+	rec := httptest.NewRecorder()
+	handleConcat(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestReadAuthorizedBodyLimit(t *testing.T) {
+	config.MaxRequestBodyBytes = 16
+	defer func() { config = Config{} }()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(strings.Repeat("x", 17)))
+	if _, ok := readAuthorizedBody(rec, req); ok || rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: ok = %v, status = %d; want 413", ok, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(strings.Repeat("x", 16)))
+	if body, ok := readAuthorizedBody(rec, req); !ok || len(body) != 16 {
+		t.Errorf("body at the limit: ok = %v, %d bytes", ok, len(body))
+	}
+}
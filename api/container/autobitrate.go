@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ---------- Auto Bitrate ----------
+//
+// A library that mixes talk shows with music programs either wastes
+// storage on voice or starves music at a single bitrate. With auto_bitrate
+// each input is measured before the encode and the output's CBR bitrate is
+// picked from a ladder of three content classes:
+//
+//	speech  mono or dual-mono, little energy above 5 kHz   AUTO_BITRATE_SPEECH_KBPS (64)
+//	mixed   stereo or wideband, but not both                AUTO_BITRATE_MIXED_KBPS (96)
+//	music   stereo and wideband                             AUTO_BITRATE_MUSIC_KBPS (192)
+//
+// One astats pass per input measures three channels derived from the
+// source: mid (L+R), side (L-R) and mid high-passed at 5 kHz. An input is
+// stereo when side is within AUTO_BITRATE_STEREO_DB of mid, and wideband
+// when the band above 5 kHz is within AUTO_BITRATE_HIGH_BAND_DB of mid;
+// voice carries little energy up there, while cymbals and strings do. An
+// output forced to mono (channel_layout "mono" or an auto_mono downmix)
+// never counts as stereo.
+//
+// The episode takes the highest class heard in at least
+// AUTO_BITRATE_MIN_SHARE_PERCENT of the audio, by sample count, so a short
+// jingle doesn't lift a talk episode but a music bed under it does. An
+// explicit bitrate_kbps overrides the choice.
+
+const (
+	contentSpeech = "speech"
+	contentMixed  = "mixed"
+	contentMusic  = "music"
+
+	// contentAnalysisFilter turns any input into mid, side and high-passed
+	// mid channels for astats
+	contentAnalysisFilter = "aresample=44100,aformat=channel_layouts=stereo," +
+		"pan=3.0|FL=0.5*c0+0.5*c1|FR=0.5*c0-0.5*c1|FC=0.5*c0+0.5*c1," +
+		"highpass=f=5000:c=FC,astats"
+)
+
+// contentClasses are in ascending bitrate order
+var contentClasses = []string{contentSpeech, contentMixed, contentMusic}
+
+// AutoBitrateDecision reports the bitrate auto_bitrate chose and why
+type AutoBitrateDecision struct {
+	BitrateKbps int    `json:"bitrate_kbps"`
+	Content     string `json:"content,omitempty"` // speech, mixed or music; empty when not measured
+	Reason      string `json:"reason"`
+}
+
+// validateAutoBitrate rejects auto_bitrate with a non-CBR mode
+func validateAutoBitrate(req *ConcatRequest) error {
+	if req.AutoBitrate && req.BitrateMode == bitrateVBR {
+		return errors.New(`auto_bitrate picks a CBR bitrate and can't be combined with bitrate_mode "vbr"`)
+	}
+	return nil
+}
+
+// contentLevels are an input's analysis levels in dB, and its length
+type contentLevels struct {
+	Mid, Side, High float64
+	Samples         int64
+}
+
+// class returns the input's content class
+func (l contentLevels) class(mono bool) string {
+	// A silent input gives -inf - -inf = NaN, which counts as neither
+	stereo := !mono && l.Side-l.Mid >= float64(config.AutoBitrateStereoDB)
+	wideband := l.High-l.Mid >= float64(config.AutoBitrateHighBandDB)
+	switch {
+	case stereo && wideband:
+		return contentMusic
+	case stereo || wideband:
+		return contentMixed
+	}
+	return contentSpeech
+}
+
+// contentBitrate returns the ladder rung for class, kept within the
+// encoder's range
+func contentBitrate(class string) int {
+	kbps := config.AutoBitrateSpeechKbps
+	switch class {
+	case contentMixed:
+		kbps = config.AutoBitrateMixedKbps
+	case contentMusic:
+		kbps = config.AutoBitrateMusicKbps
+	}
+	return min(max(kbps, minBitrateKbps), maxBitrateKbps)
+}
+
+// measureContent runs the analysis pass on one input
+func measureContent(ctx context.Context, in concatInput) (contentLevels, error) {
+	in.GainDB = 0
+	args := append([]string{"-hide_banner", "-nostats"}, singleInputArgs(in, contentAnalysisFilter)...)
+	args = append(args, "-f", "null", "-")
+	cmd := ffmpegCommand(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return contentLevels{}, fmt.Errorf("content analysis failed: %v", err)
+	}
+	return parseContentLevels(stderr.String())
+}
+
+// parseContentLevels reads the mid, side and high band RMS levels and the
+// per-channel sample count from the analysis pass's astats log
+func parseContentLevels(log string) (contentLevels, error) {
+	levels, err := parseChannelRMS(log)
+	if err != nil {
+		return contentLevels{}, err
+	}
+	if len(levels) != 3 {
+		return contentLevels{}, fmt.Errorf("expected 3 analysis channels, astats reported %d", len(levels))
+	}
+	samples, err := parseSampleCount(log)
+	if err != nil {
+		return contentLevels{}, err
+	}
+	return contentLevels{Mid: levels[0], Side: levels[1], High: levels[2], Samples: samples}, nil
+}
+
+// parseSampleCount returns the first "Number of samples" astats logs,
+// which is per channel
+func parseSampleCount(log string) (int64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, rest, ok := strings.Cut(line, "] "); ok {
+			line = rest
+		}
+		if value, ok := strings.CutPrefix(line, "Number of samples:"); ok {
+			return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	return 0, errors.New("no sample count in astats output")
+}
+
+// decideAutoBitrate measures inputs and picks the output bitrate, unless
+// the request set one. indexes maps inputs to their positions in the
+// request's segments.
+func decideAutoBitrate(ctx context.Context, req ConcatRequest, inputs []concatInput, indexes []int) AutoBitrateDecision {
+	if req.BitrateKbps != 0 {
+		return AutoBitrateDecision{BitrateKbps: req.BitrateKbps, Reason: "bitrate_kbps set explicitly"}
+	}
+	mono := req.ChannelLayout == "mono" || req.monoDownmix
+	measured := make([]contentLevels, len(inputs))
+	for i, in := range inputs {
+		levels, err := measureContent(ctx, in)
+		if err != nil {
+			return AutoBitrateDecision{
+				BitrateKbps: defaultBitrateKbps,
+				Reason:      fmt.Sprintf("segment %d not measured, using the default: %v", indexes[i], err),
+			}
+		}
+		measured[i] = levels
+	}
+	return chooseContentBitrate(measured, indexes, mono)
+}
+
+// chooseContentBitrate picks the highest class that, together with the
+// classes above it, makes up the minimum share of the samples
+func chooseContentBitrate(measured []contentLevels, indexes []int, mono bool) AutoBitrateDecision {
+	samples := map[string]int64{}
+	segments := map[string][]string{}
+	var total int64
+	for i, levels := range measured {
+		class := levels.class(mono)
+		samples[class] += levels.Samples
+		segments[class] = append(segments[class], strconv.Itoa(indexes[i]))
+		total += levels.Samples
+	}
+
+	var above int64
+	var aboveSegments []string
+	for i := len(contentClasses) - 1; i > 0; i-- {
+		class := contentClasses[i]
+		above += samples[class]
+		aboveSegments = append(aboveSegments, segments[class]...)
+		if total == 0 || samples[class] == 0 {
+			continue
+		}
+		if share := float64(above) / float64(total); share*100 >= float64(config.AutoBitrateMinShare) {
+			return AutoBitrateDecision{
+				BitrateKbps: contentBitrate(class),
+				Content:     class,
+				Reason:      fmt.Sprintf("%s or richer content in %.0f%% of the audio (segments %s)", class, math.Floor(share*100), strings.Join(aboveSegments, ", ")),
+			}
+		}
+	}
+	reason := "no stereo or wideband content"
+	if above > 0 {
+		reason = fmt.Sprintf("stereo or wideband content in under %d%% of the audio", config.AutoBitrateMinShare)
+	}
+	return AutoBitrateDecision{BitrateKbps: contentBitrate(contentSpeech), Content: contentSpeech, Reason: reason}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseContentLevels(t *testing.T) {
+	log := `[Parsed_astats_4 @ 0x1] Channel: 1
+[Parsed_astats_4 @ 0x1] RMS level dB: -20.000000
+[Parsed_astats_4 @ 0x1] Number of samples: 441000
+[Parsed_astats_4 @ 0x1] Channel: 2
+[Parsed_astats_4 @ 0x1] RMS level dB: -inf
+[Parsed_astats_4 @ 0x1] Number of samples: 441000
+[Parsed_astats_4 @ 0x1] Channel: 3
+[Parsed_astats_4 @ 0x1] RMS level dB: -52.250000
+[Parsed_astats_4 @ 0x1] Number of samples: 441000
+[Parsed_astats_4 @ 0x1] Overall
+[Parsed_astats_4 @ 0x1] RMS level dB: -24.510000
+`
+	levels, err := parseContentLevels(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels.Mid != -20 || !math.IsInf(levels.Side, -1) || levels.High != -52.25 || levels.Samples != 441000 {
+		t.Errorf("levels = %+v", levels)
+	}
+
+	if _, err := parseContentLevels("[Parsed_astats_0 @ 0x1] RMS level dB: -20\n"); err == nil {
+		t.Error("expected an error for a log with one channel")
+	}
+}
+
+func TestContentClass(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config = loadConfig()
+
+	tests := []struct {
+		name   string
+		levels contentLevels
+		mono   bool
+		want   string
+	}{
+		{"dual-mono voice", contentLevels{Mid: -20, Side: math.Inf(-1), High: -50}, false, contentSpeech},
+		{"stereo voice", contentLevels{Mid: -20, Side: -30, High: -50}, false, contentMixed},
+		{"mono music", contentLevels{Mid: -18, Side: math.Inf(-1), High: -30}, false, contentMixed},
+		{"stereo music", contentLevels{Mid: -14, Side: -24, High: -28}, false, contentMusic},
+		{"stereo music forced to mono", contentLevels{Mid: -14, Side: -24, High: -28}, true, contentMixed},
+		{"narrow stereo image", contentLevels{Mid: -14, Side: -40, High: -50}, false, contentSpeech},
+		{"silence", contentLevels{Mid: math.Inf(-1), Side: math.Inf(-1), High: math.Inf(-1)}, false, contentSpeech},
+	}
+	for _, tt := range tests {
+		if got := tt.levels.class(tt.mono); got != tt.want {
+			t.Errorf("%s: class = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChooseContentBitrate(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config = loadConfig()
+	speech := func(samples int64) contentLevels {
+		return contentLevels{Mid: -20, Side: math.Inf(-1), High: -50, Samples: samples}
+	}
+	music := func(samples int64) contentLevels {
+		return contentLevels{Mid: -14, Side: -24, High: -28, Samples: samples}
+	}
+	mixed := func(samples int64) contentLevels {
+		return contentLevels{Mid: -18, Side: math.Inf(-1), High: -30, Samples: samples}
+	}
+
+	tests := []struct {
+		name     string
+		measured []contentLevels
+		want     int
+		content  string
+	}{
+		{"talk", []contentLevels{speech(1000), speech(2000)}, 64, contentSpeech},
+		{"short jingle", []contentLevels{music(50), speech(2000)}, 64, contentSpeech},
+		{"music bed", []contentLevels{music(400), speech(2000)}, 192, contentMusic},
+		{"music counts toward mixed", []contentLevels{music(100), mixed(150), speech(2000)}, 96, contentMixed},
+		{"all music", []contentLevels{music(1000)}, 192, contentMusic},
+	}
+	for _, tt := range tests {
+		indexes := make([]int, len(tt.measured))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		d := chooseContentBitrate(tt.measured, indexes, false)
+		if d.BitrateKbps != tt.want || d.Content != tt.content {
+			t.Errorf("%s: decision = %+v, want %d kbps %s", tt.name, d, tt.want, tt.content)
+		}
+	}
+
+	// Ladder rungs are kept within the encoder's range
+	config.AutoBitrateMusicKbps = 500
+	if d := chooseContentBitrate([]contentLevels{music(1)}, []int{0}, false); d.BitrateKbps != maxBitrateKbps {
+		t.Errorf("clamped rung = %d, want %d", d.BitrateKbps, maxBitrateKbps)
+	}
+}
+
+func TestValidateAutoBitrate(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AutoBitrate: true}
+	if err := validateRequest(req); err != nil || req.BitrateKbps != 0 {
+		t.Errorf("auto: err = %v, bitrate_kbps = %d; want it left for the measurement", err, req.BitrateKbps)
+	}
+	if d := decideAutoBitrate(context.Background(), ConcatRequest{AutoBitrate: true, BitrateKbps: 160}, nil, nil); d.BitrateKbps != 160 || d.Content != "" {
+		t.Errorf("explicit bitrate: decision = %+v", d)
+	}
+
+	quality := 2
+	req = &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AutoBitrate: true, BitrateMode: bitrateVBR, VBRQuality: &quality}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected auto_bitrate with vbr to be rejected")
+	}
+	req = &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AutoBitrate: true, BitrateKbps: 500}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected an explicit bitrate out of range to be rejected")
+	}
+}
+
+// TestDecideAutoBitrate measures generated voice-like and music-like files;
+// it is skipped without FFmpeg
+func TestDecideAutoBitrate(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	defer func(c Config) { config = c }(config)
+	config = loadConfig()
+	dir := t.TempDir()
+	generate := func(name, source string) concatInput {
+		path := filepath.Join(dir, name)
+		if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", source, "-t", "2",
+			"-c:a", "pcm_s16le", "-y", path).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg: %v: %s", err, out)
+		}
+		return concatInput{Path: path}
+	}
+	// Band-limited mono noise stands in for voice; independent full-band
+	// noise per channel for music
+	voice := generate("voice.wav", "anoisesrc=color=pink:amplitude=0.3,lowpass=f=3000,lowpass=f=3000")
+	music := generate("music.wav", "anoisesrc=color=white:amplitude=0.3:seed=1[l];anoisesrc=color=white:amplitude=0.3:seed=2[r];[l][r]amerge=inputs=2[out0]")
+
+	ctx := context.Background()
+	if d := decideAutoBitrate(ctx, ConcatRequest{}, []concatInput{voice}, []int{0}); d.Content != contentSpeech {
+		t.Errorf("voice: %+v", d)
+	}
+	d := decideAutoBitrate(ctx, ConcatRequest{}, []concatInput{music}, []int{0})
+	if d.Content != contentMusic || !strings.Contains(d.Reason, "segments 0") {
+		t.Errorf("music: %+v", d)
+	}
+	if d := decideAutoBitrate(ctx, ConcatRequest{ChannelLayout: "mono"}, []concatInput{music}, []int{0}); d.Content != contentMixed {
+		t.Errorf("music to mono: %+v", d)
+	}
+}
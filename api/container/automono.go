@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ---------- Auto Mono ----------
+//
+// A single microphone recorded into a stereo interface often yields one
+// live channel and one silent one. Encoding that as stereo spends half the
+// bitrate on silence, and listeners on headphones hear the voice in one ear.
+// With auto_mono each input's per-channel RMS is measured with astats
+// before the encode. If every stereo input has one channel below
+// auto_mono_threshold_db while the other is at least monoImbalanceDB
+// louder, the joined audio is downmixed to mono.
+//
+// The downmix sums the channels (pan c0=c0+c1) rather than averaging them,
+// so the live channel keeps its level and the dead one adds next to
+// nothing. Any stereo input with two live channels keeps the output stereo;
+// the check is deliberately conservative, since collapsing real stereo
+// can't be undone downstream.
+
+const (
+	defaultMonoThresholdDB = -60.0
+	// monoImbalanceDB is how much louder the live channel must be
+	monoImbalanceDB = 30.0
+	// monoDownmixFilter sums both channels into one
+	monoDownmixFilter = "pan=mono|c0=c0+c1"
+)
+
+// AutoMonoDecision reports what auto_mono found
+type AutoMonoDecision struct {
+	Downmixed bool   `json:"downmixed"`
+	Reason    string `json:"reason"`
+}
+
+// validateAutoMono fills the default threshold
+func validateAutoMono(req *ConcatRequest) error {
+	if !req.AutoMono {
+		if req.AutoMonoThresholdDB != nil {
+			return errors.New("auto_mono_threshold_db requires auto_mono")
+		}
+		return nil
+	}
+	if req.AppendToURL != "" {
+		return errors.New("auto_mono is not supported with append_to_url; the existing output's channels can't change")
+	}
+	if req.AutoMonoThresholdDB == nil {
+		threshold := defaultMonoThresholdDB
+		req.AutoMonoThresholdDB = &threshold
+	}
+	if t := *req.AutoMonoThresholdDB; t < -90 || t > -20 {
+		return errors.New("auto_mono_threshold_db must be between -90 and -20")
+	}
+	return nil
+}
+
+// channelRMS returns the RMS level in dB of each channel of in
+func channelRMS(ctx context.Context, in concatInput) ([]float64, error) {
+	in.GainDB = 0
+	args := append([]string{"-hide_banner", "-nostats"}, singleInputArgs(in, "astats")...)
+	args = append(args, "-f", "null", "-")
+	cmd := ffmpegCommand(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("astats failed: %v", err)
+	}
+	return parseChannelRMS(stderr.String())
+}
+
+// parseChannelRMS reads the per-channel "RMS level dB" values that astats
+// logs before its Overall section. Digital silence is logged as -inf.
+func parseChannelRMS(log string) ([]float64, error) {
+	var levels []float64
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, rest, ok := strings.Cut(line, "] "); ok {
+			line = rest
+		}
+		if strings.TrimSpace(line) == "Overall" {
+			break
+		}
+		value, ok := strings.CutPrefix(line, "RMS level dB:")
+		if !ok {
+			continue
+		}
+		level, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse RMS level %q: %w", value, err)
+		}
+		levels = append(levels, level)
+	}
+	if len(levels) == 0 {
+		return nil, errors.New("no per-channel RMS levels in astats output")
+	}
+	return levels, nil
+}
+
+// channelImbalanced reports whether a stereo input has one dead channel
+func channelImbalanced(levels []float64, thresholdDB float64) bool {
+	if len(levels) != 2 {
+		return false
+	}
+	quiet, loud := math.Min(levels[0], levels[1]), math.Max(levels[0], levels[1])
+	return quiet < thresholdDB && loud-quiet >= monoImbalanceDB
+}
+
+// decideAutoMono measures inputs and decides whether to downmix. indexes
+// maps inputs to their positions in the request's segments.
+func decideAutoMono(ctx context.Context, inputs []concatInput, indexes []int, thresholdDB float64) AutoMonoDecision {
+	imbalanced := 0
+	for i, in := range inputs {
+		levels, err := channelRMS(ctx, in)
+		if err != nil {
+			return AutoMonoDecision{Reason: fmt.Sprintf("segment %d not measured: %v", indexes[i], err)}
+		}
+		switch {
+		case len(levels) == 1:
+			// Already mono; doesn't argue either way
+		case channelImbalanced(levels, thresholdDB):
+			imbalanced++
+		default:
+			return AutoMonoDecision{Reason: fmt.Sprintf("segment %d has two live channels", indexes[i])}
+		}
+	}
+	if imbalanced == 0 {
+		return AutoMonoDecision{Reason: "no stereo input with a silent channel"}
+	}
+	return AutoMonoDecision{Downmixed: true, Reason: fmt.Sprintf("%d stereo segments have a channel below %g dB", imbalanced, thresholdDB)}
+}
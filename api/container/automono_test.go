@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseChannelRMS(t *testing.T) {
+	log := `[Parsed_astats_0 @ 0x1] Channel: 1
+[Parsed_astats_0 @ 0x1] RMS level dB: -21.500000
+[Parsed_astats_0 @ 0x1] Channel: 2
+[Parsed_astats_0 @ 0x1] RMS level dB: -inf
+[Parsed_astats_0 @ 0x1] Overall
+[Parsed_astats_0 @ 0x1] RMS level dB: -24.510000
+`
+	levels, err := parseChannelRMS(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 || levels[0] != -21.5 || !math.IsInf(levels[1], -1) {
+		t.Errorf("levels = %v, want [-21.5 -Inf]", levels)
+	}
+	if _, err := parseChannelRMS("[Parsed_astats_0 @ 0x1] Overall\n"); err == nil {
+		t.Error("expected error without per-channel levels")
+	}
+}
+
+func TestChannelImbalanced(t *testing.T) {
+	tests := []struct {
+		levels []float64
+		want   bool
+	}{
+		{[]float64{-20, math.Inf(-1)}, true},
+		{[]float64{-72, -22}, true},
+		{[]float64{-20, -23}, false}, // Real stereo
+		{[]float64{-65, -70}, false}, // Both quiet: silence, not a dead channel
+		{[]float64{-40, -62}, false}, // Not far enough apart
+		{[]float64{-20}, false},      // Mono
+	}
+	for _, tt := range tests {
+		if got := channelImbalanced(tt.levels, defaultMonoThresholdDB); got != tt.want {
+			t.Errorf("channelImbalanced(%v) = %v, want %v", tt.levels, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAutoMono(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AutoMono: true}
+	if err := validateRequest(req); err != nil || req.AutoMonoThresholdDB == nil || *req.AutoMonoThresholdDB != defaultMonoThresholdDB {
+		t.Errorf("default: err = %v, threshold = %v", err, req.AutoMonoThresholdDB)
+	}
+
+	threshold := -10.0
+	for name, req := range map[string]*ConcatRequest{
+		"threshold range":    {Segments: segmentURLs("a"), OutputURL: "b", AutoMono: true, AutoMonoThresholdDB: &threshold},
+		"threshold only":     {Segments: segmentURLs("a"), OutputURL: "b", AutoMonoThresholdDB: &threshold},
+		"with append_to_url": {Segments: segmentURLs("a"), OutputURL: "b", AutoMono: true, AppendToURL: "c"},
+	} {
+		if err := validateRequest(req); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	chain := audioFilterChain(ConcatRequest{monoDownmix: true})
+	if want := monoDownmixFilter + "," + podcastLoudnorm; chain != want {
+		t.Errorf("chain = %q, want %q", chain, want)
+	}
+}
+
+// TestDecideAutoMono measures generated stereo files; it is skipped without
+// FFmpeg
+func TestDecideAutoMono(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	dir := t.TempDir()
+	generate := func(name, pan string) concatInput {
+		path := filepath.Join(dir, name)
+		if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=frequency=440:duration=1",
+			"-af", pan, "-c:a", "pcm_s16le", "-y", path).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg: %v: %s", err, out)
+		}
+		return concatInput{Path: path}
+	}
+	deadRight := generate("dead_right.wav", "pan=stereo|c0=c0|c1=0*c0")
+	deadLeft := generate("dead_left.wav", "pan=stereo|c0=0*c0|c1=c0")
+	stereo := generate("stereo.wav", "pan=stereo|c0=c0|c1=c0")
+
+	ctx := context.Background()
+	if d := decideAutoMono(ctx, []concatInput{deadRight, deadLeft}, []int{0, 1}, defaultMonoThresholdDB); !d.Downmixed {
+		t.Errorf("dead channels not downmixed: %s", d.Reason)
+	}
+	if d := decideAutoMono(ctx, []concatInput{deadRight, stereo}, []int{0, 1}, defaultMonoThresholdDB); d.Downmixed {
+		t.Errorf("real stereo downmixed: %s", d.Reason)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ---------- Input Bitrate Check ----------
+//
+// A 48 kbps source stays a 48 kbps-quality recording no matter how high the
+// output bitrate, so callers doing quality control want to catch it before
+// it ships. With min_input_bitrate_kbps every downloaded segment's audio
+// bitrate is probed before the encode. In "warn" mode (the default) the
+// offending segments are listed in low_bitrate_segments and the job goes on;
+// in "strict" mode the job fails with 422 before anything is encoded.
+//
+// The stream's bit_rate is used when ffprobe reports one. VBR MP3s often
+// report N/A there, so the container's average bit_rate is the fallback.
+
+const (
+	bitrateCheckWarn   = "warn"
+	bitrateCheckStrict = "strict"
+)
+
+// LowBitrateSegment is a segment below min_input_bitrate_kbps
+type LowBitrateSegment struct {
+	Index       int `json:"index"`        // Position in segments
+	BitrateKbps int `json:"bitrate_kbps"` // Probed audio bitrate
+}
+
+// validateMinInputBitrate checks the threshold and fills the default mode
+func validateMinInputBitrate(req *ConcatRequest) error {
+	if req.MinInputBitrateKbps == 0 {
+		if req.MinInputBitrateMode != "" {
+			return errors.New("min_input_bitrate_mode requires min_input_bitrate_kbps")
+		}
+		return nil
+	}
+	if req.MinInputBitrateKbps < 0 || req.MinInputBitrateKbps > maxBitrateKbps {
+		return fmt.Errorf("min_input_bitrate_kbps must be between 1 and %d", maxBitrateKbps)
+	}
+	switch req.MinInputBitrateMode {
+	case "":
+		req.MinInputBitrateMode = bitrateCheckWarn
+	case bitrateCheckWarn, bitrateCheckStrict:
+	default:
+		return fmt.Errorf("min_input_bitrate_mode must be %q or %q", bitrateCheckWarn, bitrateCheckStrict)
+	}
+	return nil
+}
+
+// probeBitrate returns the audio bitrate of path in kbps
+func probeBitrate(ctx context.Context, path string) (int, error) {
+	output, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=bit_rate:format=bit_rate",
+		"-of", "default=noprint_wrappers=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseBitrate(string(output))
+}
+
+// parseBitrate reads ffprobe's bit_rate lines, preferring the stream's
+// value (printed first) over the container average
+func parseBitrate(output string) (int, error) {
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		if key != "bit_rate" {
+			continue
+		}
+		bps, err := strconv.ParseFloat(value, 64)
+		if err != nil || bps <= 0 {
+			continue // N/A for VBR streams
+		}
+		return int(math.Round(bps / 1000)), nil
+	}
+	return 0, errors.New("no bitrate reported")
+}
+
+// checkInputBitrates lists inputs below minKbps. indexes maps inputs back
+// to positions in segments; probe failures become warnings.
+func checkInputBitrates(ctx context.Context, inputs []concatInput, indexes []int, minKbps int) ([]LowBitrateSegment, []string) {
+	var low []LowBitrateSegment
+	var warnings []string
+	for i, in := range inputs {
+		kbps, err := probeBitrate(ctx, in.Path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("bitrate check skipped for segment %d: %v", indexes[i], err))
+			continue
+		}
+		if kbps < minKbps {
+			low = append(low, LowBitrateSegment{Index: indexes[i], BitrateKbps: kbps})
+		}
+	}
+	return low, warnings
+}
+
+// describeLowBitrate lists offending segments for messages
+func describeLowBitrate(low []LowBitrateSegment) string {
+	parts := make([]string, len(low))
+	for i, s := range low {
+		parts[i] = fmt.Sprintf("%d (%d kbps)", s.Index, s.BitrateKbps)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMinInputBitrate(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", MinInputBitrateKbps: 96}
+	if err := validateRequest(req); err != nil || req.MinInputBitrateMode != bitrateCheckWarn {
+		t.Fatalf("mode = %q, err = %v", req.MinInputBitrateMode, err)
+	}
+
+	for name, req := range map[string]*ConcatRequest{
+		"negative":          {Segments: segmentURLs("a"), OutputURL: "b", MinInputBitrateKbps: -1},
+		"too high":          {Segments: segmentURLs("a"), OutputURL: "b", MinInputBitrateKbps: 500},
+		"unknown mode":      {Segments: segmentURLs("a"), OutputURL: "b", MinInputBitrateKbps: 96, MinInputBitrateMode: "fail"},
+		"mode without kbps": {Segments: segmentURLs("a"), OutputURL: "b", MinInputBitrateMode: "strict"},
+	} {
+		if err := validateRequest(req); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestParseBitrate(t *testing.T) {
+	for output, want := range map[string]int{
+		"bit_rate=128000\nbit_rate=128344\n": 128,
+		"bit_rate=N/A\nbit_rate=95600\n":     96, // VBR: container average
+		"bit_rate=63999\n":                   64,
+	} {
+		got, err := parseBitrate(output)
+		if err != nil || got != want {
+			t.Errorf("parseBitrate(%q) = %d, %v; want %d", output, got, err, want)
+		}
+	}
+	if _, err := parseBitrate("bit_rate=N/A\nbit_rate=N/A\n"); err == nil {
+		t.Error("expected an error without any bitrate")
+	}
+}
+
+func TestDescribeLowBitrate(t *testing.T) {
+	got := describeLowBitrate([]LowBitrateSegment{{Index: 2, BitrateKbps: 64}, {Index: 5, BitrateKbps: 48}})
+	if want := "2 (64 kbps), 5 (48 kbps)"; got != want {
+		t.Errorf("describeLowBitrate = %q, want %q", got, want)
+	}
+}
+
+// TestCheckInputBitrates probes real files; it is skipped without FFmpeg
+func TestCheckInputBitrates(t *testing.T) {
+	requireFFmpegTools(t)
+	dir := t.TempDir()
+	var inputs []concatInput
+	for _, kbps := range []string{"128k", "48k"} {
+		path := filepath.Join(dir, kbps+".mp3")
+		if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=duration=2",
+			"-c:a", "libmp3lame", "-b:a", kbps, "-y", path).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg: %v: %s", err, out)
+		}
+		inputs = append(inputs, concatInput{Path: path})
+	}
+
+	low, warnings := checkInputBitrates(context.Background(), inputs, []int{0, 3}, 96)
+	if len(warnings) != 0 {
+		t.Fatalf("warnings = %v", warnings)
+	}
+	if want := []LowBitrateSegment{{Index: 3, BitrateKbps: 48}}; !reflect.DeepEqual(low, want) {
+		t.Errorf("low = %+v, want %+v", low, want)
+	}
+}
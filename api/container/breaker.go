@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ---------- Upload Circuit Breaker ----------
+//
+// When output storage is down, every job would download and encode in full
+// only to fail at upload. The breaker counts consecutive transient upload
+// failures per storage host. At UPLOAD_BREAKER_THRESHOLD it opens, and for
+// UPLOAD_BREAKER_COOLDOWN_SECONDS new jobs targeting that host are refused
+// with 503 before any work is done. After the cooldown the next job is let
+// through as the only probe, and the host keeps refusing other jobs while
+// it runs: a successful upload closes the breaker, another failure reopens
+// it for a fresh cooldown. A probe that ends without uploading (it failed
+// earlier, or was refused on another host) hands the probe to the next job.
+//
+// Only retryable failures (5xx, 429, network errors) count, after
+// retryTransfer has given up. A 403 from one bad presigned URL says nothing
+// about the host.
+
+// hostBreaker is the state for one storage host
+type hostBreaker struct {
+	failures  int
+	openUntil time.Time // Zero until the breaker first opens
+	probe     uint64    // Nonzero while a job is probing the host
+}
+
+// BreakerState is a host's breaker as reported in /status
+type BreakerState struct {
+	Host                string     `json:"host"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"` // Set while new jobs are refused
+	Probing             bool       `json:"probing,omitempty"`    // A job is testing the host after the cooldown
+}
+
+var (
+	uploadBreakers   = map[string]*hostBreaker{}
+	uploadBreakersMu sync.Mutex
+	lastProbe        uint64 // Source of probe IDs, under uploadBreakersMu
+)
+
+// breakerHost returns the host a breaker is keyed on, or "" if rawURL has none
+func breakerHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// recordUpload updates the breaker for rawURL's host with an upload outcome
+func recordUpload(rawURL string, err error, now time.Time) {
+	host := breakerHost(rawURL)
+	if config.UploadBreakerThreshold <= 0 || host == "" {
+		return
+	}
+
+	uploadBreakersMu.Lock()
+	defer uploadBreakersMu.Unlock()
+	if err == nil {
+		delete(uploadBreakers, host)
+		return
+	}
+	if !isRetryable(err) {
+		return
+	}
+
+	b := uploadBreakers[host]
+	if b == nil {
+		b = &hostBreaker{}
+		uploadBreakers[host] = b
+	}
+	b.failures++
+	if b.failures >= config.UploadBreakerThreshold {
+		b.openUntil = now.Add(config.UploadBreakerCooldown)
+		b.probe = 0
+	}
+}
+
+// openBreaker returns the first of rawURLs' hosts that refuses new jobs and
+// how long to wait before retrying. Otherwise the job may proceed, possibly
+// as the probe for hosts past their cooldown; the caller must call done when
+// the job ends so an unfinished probe is handed on.
+func openBreaker(rawURLs []string, now time.Time) (host string, wait time.Duration, done func()) {
+	uploadBreakersMu.Lock()
+	defer uploadBreakersMu.Unlock()
+	claimed := map[*hostBreaker]uint64{}
+	release := func() {
+		for b, id := range claimed {
+			if b.probe == id {
+				b.probe = 0
+			}
+		}
+	}
+	for _, rawURL := range rawURLs {
+		host := breakerHost(rawURL)
+		b := uploadBreakers[host]
+		if b == nil || b.openUntil.IsZero() || claimed[b] != 0 {
+			continue
+		}
+		switch {
+		case now.Before(b.openUntil):
+			release()
+			return host, b.openUntil.Sub(now), func() {}
+		case b.probe != 0:
+			// The probe's outcome isn't known yet; it can't take longer to
+			// arrive than another cooldown is worth waiting
+			release()
+			return host, config.UploadBreakerCooldown, func() {}
+		}
+		lastProbe++
+		b.probe = lastProbe
+		claimed[b] = lastProbe
+	}
+	return "", 0, func() {
+		uploadBreakersMu.Lock()
+		defer uploadBreakersMu.Unlock()
+		release()
+	}
+}
+
+// breakerStates lists every host with recent failures, sorted by host
+func breakerStates(now time.Time) []BreakerState {
+	uploadBreakersMu.Lock()
+	defer uploadBreakersMu.Unlock()
+	states := make([]BreakerState, 0, len(uploadBreakers))
+	for host, b := range uploadBreakers {
+		state := BreakerState{Host: host, ConsecutiveFailures: b.failures, Probing: b.probe != 0}
+		if now.Before(b.openUntil) {
+			openUntil := b.openUntil
+			state.OpenUntil = &openUntil
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+	return states
+}
+
+// uploadTargets returns the URLs a request's primary output is written to
+func uploadTargets(req ConcatRequest) []string {
+	var targets []string
+	for _, u := range []string{req.OutputURL, req.OutputURLTemplate} {
+		if u != "" {
+			targets = append(targets, u)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func resetBreakers() {
+	uploadBreakersMu.Lock()
+	uploadBreakers = map[string]*hostBreaker{}
+	uploadBreakersMu.Unlock()
+}
+
+func TestUploadBreaker(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.UploadBreakerThreshold = 2
+	config.UploadBreakerCooldown = time.Minute
+	resetBreakers()
+	defer resetBreakers()
+
+	now := time.Now()
+	out := "https://storage.example.com/ep/out.mp3"
+	serverErr := statusError("PUT", http.StatusBadGateway, nil)
+
+	// Client errors don't count; one server error isn't enough
+	recordUpload(out, statusError("PUT", http.StatusForbidden, nil), now)
+	recordUpload(out, serverErr, now)
+	if host, _, _ := openBreaker([]string{out}, now); host != "" {
+		t.Fatalf("breaker open after one failure")
+	}
+
+	recordUpload(out, serverErr, now)
+	host, wait, _ := openBreaker([]string{"https://other.example.com/x", out}, now)
+	if host != "storage.example.com" || wait != time.Minute {
+		t.Fatalf("openBreaker = %q, %v", host, wait)
+	}
+	states := breakerStates(now)
+	if len(states) != 1 || states[0].ConsecutiveFailures != 2 || states[0].OpenUntil == nil {
+		t.Errorf("states = %+v", states)
+	}
+
+	// After the cooldown one probe is let through, and success clears the host
+	later := now.Add(time.Minute)
+	host, _, done := openBreaker([]string{out}, later)
+	if host != "" {
+		t.Fatalf("breaker still open after cooldown")
+	}
+	if host, _, _ := openBreaker([]string{out}, later); host != "storage.example.com" {
+		t.Errorf("a second job was let through while the probe runs")
+	}
+	recordUpload(out, nil, later)
+	done()
+	if states := breakerStates(later); len(states) != 0 {
+		t.Errorf("states after success = %+v", states)
+	}
+}
+
+func TestUploadBreakerProbe(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.UploadBreakerThreshold = 1
+	config.UploadBreakerCooldown = time.Minute
+	resetBreakers()
+	defer resetBreakers()
+
+	now := time.Now()
+	out := "https://storage.example.com/ep/out.mp3"
+	serverErr := statusError("PUT", http.StatusBadGateway, nil)
+	recordUpload(out, serverErr, now)
+	later := now.Add(time.Minute)
+
+	// A probe that ends before uploading hands the probe to the next job
+	_, _, done := openBreaker([]string{out}, later)
+	if states := breakerStates(later); len(states) != 1 || !states[0].Probing {
+		t.Errorf("states while probing = %+v", states)
+	}
+	done()
+	host, _, done := openBreaker([]string{out}, later)
+	if host != "" {
+		t.Fatal("probe not handed on after the first one ended without an upload")
+	}
+
+	// A failed probe reopens the breaker for a fresh cooldown
+	recordUpload(out, serverErr, later)
+	done()
+	if host, wait, _ := openBreaker([]string{out}, later); host == "" || wait != time.Minute {
+		t.Errorf("after a failed probe: openBreaker = %q, %v", host, wait)
+	}
+
+	// A job refused on one host doesn't keep the probe it took on another
+	other := "https://other.example.com/out.mp3"
+	recordUpload(other, serverErr, later)
+	evenLater := later.Add(30 * time.Second)
+	recordUpload(out, serverErr, evenLater) // out reopens until evenLater+1m
+	probeTime := later.Add(time.Minute)     // other's cooldown is over, out's isn't
+	if host, _, _ := openBreaker([]string{other, out}, probeTime); host != "storage.example.com" {
+		t.Fatalf("openBreaker = %q, want storage.example.com", host)
+	}
+	if host, _, _ := openBreaker([]string{other}, probeTime); host != "" {
+		t.Error("the refused job kept its probe on other.example.com")
+	}
+}
+
+func TestHandleConcatBreakerOpen(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.UploadBreakerThreshold = 1
+	config.UploadBreakerCooldown = time.Minute
+	resetBreakers()
+	defer resetBreakers()
+
+	recordUpload("https://storage.example.com/a.mp3", statusError("PUT", http.StatusServiceUnavailable, nil), time.Now())
+
+	body := `{"segments":["https://cdn.example.com/s.mp3"],"output_url":"https://storage.example.com/ep/out.mp3"}`
+	rec := httptest.NewRecorder()
+	handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(body)))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("code = %d, Retry-After = %q: %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), string(codeUnavailable)) {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ---------- Clipping Detection ----------
+//
+// Normalization can lower a clipped recording but can't restore the peaks
+// that were flattened, so editors want to know which clips to re-record.
+// With detect_clipping each downloaded segment gets an extra decode pass
+// through astats before the encode, and segments whose peak reaches full
+// scale are listed in the response. The pass costs a decode per segment,
+// which is why it is opt-in.
+//
+// astats reports a peak level and how often that peak occurs. A peak within
+// clippingThresholdDB of 0 dBFS that occurs more than once is treated as
+// clipping: a single full-scale sample is usually a legitimately hot
+// transient, while flattened waveforms sit at the ceiling repeatedly.
+
+// clippingThresholdDB is the peak level, in dBFS, counted as full scale
+const clippingThresholdDB = -0.1
+
+// ClippingReport describes one clipped segment
+type ClippingReport struct {
+	Index       int     `json:"index"`        // Position in segments
+	PeakDB      float64 `json:"peak_db"`      // Highest sample level, dBFS
+	ClippedRuns int64   `json:"clipped_runs"` // Times the peak level was reached
+}
+
+// astatsOverall is the part of astats' summary the check needs
+type astatsOverall struct {
+	PeakDB    float64
+	PeakCount int64
+}
+
+// clipped reports whether the stats indicate clipping
+func (a astatsOverall) clipped() bool {
+	return a.PeakDB >= clippingThresholdDB && a.PeakCount > 1
+}
+
+// measurePeaks decodes in (trim applied, gain not) through astats
+func measurePeaks(ctx context.Context, in concatInput) (astatsOverall, error) {
+	in.GainDB = 0
+	args := append([]string{"-hide_banner", "-nostats"}, singleInputArgs(in, "astats")...)
+	args = append(args, "-f", "null", "-")
+	cmd := ffmpegCommand(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return astatsOverall{}, fmt.Errorf("astats failed: %v", err)
+	}
+	return parseAstatsOverall(stderr.String())
+}
+
+// parseAstatsOverall reads the Overall section of astats' log output
+func parseAstatsOverall(log string) (astatsOverall, error) {
+	var stats astatsOverall
+	var inOverall, havePeak bool
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Lines look like "[Parsed_astats_0 @ 0x...] Peak level dB: -0.000000"
+		if _, rest, ok := strings.Cut(line, "] "); ok {
+			line = rest
+		}
+		if strings.TrimSpace(line) == "Overall" {
+			inOverall = true
+			continue
+		}
+		if !inOverall {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Peak level dB":
+			peak, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return stats, fmt.Errorf("parse peak level %q: %w", value, err)
+			}
+			stats.PeakDB = peak
+			havePeak = true
+		case "Peak count":
+			// Overall averages the channels, so it may be fractional
+			count, _ := strconv.ParseFloat(value, 64)
+			stats.PeakCount = int64(count)
+		}
+	}
+	if !havePeak {
+		return stats, fmt.Errorf("no Overall peak level in astats output")
+	}
+	return stats, nil
+}
+
+// detectClipping measures each input and returns reports for the clipped
+// ones. indexes maps inputs to their positions in the request's segments.
+// Segments that can't be measured become warnings.
+func detectClipping(ctx context.Context, inputs []concatInput, indexes []int) ([]ClippingReport, []string) {
+	var reports []ClippingReport
+	var warnings []string
+	for i, in := range inputs {
+		stats, err := measurePeaks(ctx, in)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("clipping check skipped for segment %d: %v", indexes[i], err))
+			continue
+		}
+		if stats.clipped() {
+			reports = append(reports, ClippingReport{Index: indexes[i], PeakDB: stats.PeakDB, ClippedRuns: stats.PeakCount})
+		}
+	}
+	return reports, warnings
+}
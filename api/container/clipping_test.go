@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const astatsLog = `[Parsed_astats_0 @ 0x5581] Channel: 1
+[Parsed_astats_0 @ 0x5581] Peak level dB: -0.000000
+[Parsed_astats_0 @ 0x5581] Peak count: 14
+[Parsed_astats_0 @ 0x5581] Channel: 2
+[Parsed_astats_0 @ 0x5581] Peak level dB: -0.500000
+[Parsed_astats_0 @ 0x5581] Peak count: 2
+[Parsed_astats_0 @ 0x5581] Overall
+[Parsed_astats_0 @ 0x5581] DC offset: 0.000012
+[Parsed_astats_0 @ 0x5581] Peak level dB: -0.000000
+[Parsed_astats_0 @ 0x5581] Peak count: 8.000000
+[Parsed_astats_0 @ 0x5581] Number of samples: 44100
+`
+
+func TestParseAstatsOverall(t *testing.T) {
+	stats, err := parseAstatsOverall(astatsLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PeakDB != 0 || stats.PeakCount != 8 {
+		t.Errorf("stats = %+v, want the Overall values", stats)
+	}
+	if !stats.clipped() {
+		t.Error("repeated full-scale peaks should count as clipping")
+	}
+
+	if _, err := parseAstatsOverall("[Parsed_astats_0 @ 0x1] Channel: 1\n"); err == nil {
+		t.Error("expected error without an Overall section")
+	}
+}
+
+func TestAstatsClipped(t *testing.T) {
+	tests := []struct {
+		stats astatsOverall
+		want  bool
+	}{
+		{astatsOverall{PeakDB: -3, PeakCount: 50}, false},
+		{astatsOverall{PeakDB: -0.05, PeakCount: 1}, false},
+		{astatsOverall{PeakDB: -0.05, PeakCount: 2}, true},
+		{astatsOverall{PeakDB: 0.4, PeakCount: 12}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.stats.clipped(); got != tt.want {
+			t.Errorf("%+v clipped = %v, want %v", tt.stats, got, tt.want)
+		}
+	}
+}
+
+// TestDetectClipping measures generated clean and clipped tones; it is
+// skipped without FFmpeg
+func TestDetectClipping(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	dir := t.TempDir()
+	var inputs []concatInput
+	for _, gain := range []string{"-12dB", "24dB"} {
+		path := filepath.Join(dir, "tone"+gain+".wav")
+		if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=frequency=440:duration=1",
+			"-af", "volume="+gain, "-c:a", "pcm_s16le", "-y", path).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg: %v: %s", err, out)
+		}
+		inputs = append(inputs, concatInput{Path: path})
+	}
+
+	reports, warnings := detectClipping(context.Background(), inputs, []int{3, 7})
+	if len(warnings) != 0 {
+		t.Fatalf("warnings = %v", warnings)
+	}
+	if len(reports) != 1 || reports[0].Index != 7 {
+		t.Errorf("reports = %+v, want only segment 7", reports)
+	}
+}
+
+// TestClippingKeepsEarlierWarnings runs a job whose filter chain dry run
+// times out and that also detects clipping; both must be reported. It is
+// skipped without FFmpeg.
+func TestClippingKeepsEarlierWarnings(t *testing.T) {
+	requireFFmpegTools(t)
+	defer func(available bool) { ffmpegAvailable.Store(available) }(ffmpegAvailable.Load())
+	ffmpegAvailable.Store(true)
+	defer func(d time.Duration) { filterCheckTimeout = d }(filterCheckTimeout)
+	filterCheckTimeout = time.Nanosecond
+
+	segment := filepath.Join(t.TempDir(), "clipped.mp3")
+	if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=frequency=440:duration=1",
+		"-af", "volume=24dB", "-c:a", "libmp3lame", "-y", segment).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+	segmentData, _ := os.ReadFile(segment)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write(segmentData)
+		}
+	}))
+	defer server.Close()
+
+	body, _ := json.Marshal(ConcatRequest{
+		EpisodeID:           "ep-clipping-warnings",
+		Segments:            segmentURLs(server.URL + "/a.mp3"),
+		OutputURL:           server.URL + "/out.mp3",
+		ValidateFilterChain: true,
+		DetectClipping:      true,
+	})
+	rec := httptest.NewRecorder()
+	handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ConcatResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if !strings.Contains(strings.Join(resp.Warnings, "\n"), "filter chain not validated") {
+		t.Errorf("warnings = %v, want the filter chain warning kept", resp.Warnings)
+	}
+	if len(resp.Clipping) != 1 {
+		t.Errorf("clipping = %+v, want the clipped segment", resp.Clipping)
+	}
+}
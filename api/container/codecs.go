@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ---------- Input Codecs ----------
+//
+// The concat demuxer joins packets without decoding, which only works when
+// every input is MP3 with the same sample rate and channel count. Sources
+// are sometimes AAC (ADTS or M4A) or Opus; byte-joining those yields a
+// broken or silent output. When ffprobe is available the downloaded inputs
+// are probed before the encode, and auto switches to the concat filter,
+// which decodes each input separately, whenever they don't qualify.
+
+// audioStreamInfo is the first audio stream's format as reported by ffprobe
+type audioStreamInfo struct {
+	Codec      string
+	SampleRate string
+	Channels   string
+}
+
+func (a audioStreamInfo) String() string {
+	return fmt.Sprintf("%s %s Hz %sch", a.Codec, a.SampleRate, a.Channels)
+}
+
+// probeAudioStream reads codec, sample rate, and channels of path
+func probeAudioStream(ctx context.Context, path string) (audioStreamInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,sample_rate,channels",
+		"-of", "default=noprint_wrappers=1",
+		path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return audioStreamInfo{}, fmt.Errorf("ffprobe failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseAudioStreamInfo(string(output))
+}
+
+// parseAudioStreamInfo parses ffprobe's key=value stream output
+func parseAudioStreamInfo(output string) (audioStreamInfo, error) {
+	var info audioStreamInfo
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "codec_name":
+			info.Codec = value
+		case "sample_rate":
+			info.SampleRate = value
+		case "channels":
+			info.Channels = value
+		}
+	}
+	if info.Codec == "" {
+		return info, fmt.Errorf("no audio stream found")
+	}
+	return info, nil
+}
+
+// demuxerMismatch returns why the concat demuxer can't join inputs with
+// these stream formats, or "" if it can
+func demuxerMismatch(names []string, streams []audioStreamInfo) string {
+	for i, s := range streams {
+		if s.Codec != "mp3" {
+			return fmt.Sprintf("%s is %s, not mp3", names[i], s.Codec)
+		}
+		if s != streams[0] {
+			return fmt.Sprintf("%s is %v but %s is %v", names[i], s, names[0], streams[0])
+		}
+	}
+	return ""
+}
+
+// checkDemuxerInputs probes every input and reports a demuxer mismatch
+// along with the probed formats. A probe failure is returned as an error;
+// the caller keeps its method.
+func checkDemuxerInputs(ctx context.Context, inputs []concatInput) (string, []audioStreamInfo, error) {
+	names := make([]string, len(inputs))
+	streams := make([]audioStreamInfo, len(inputs))
+	for i, in := range inputs {
+		info, err := probeAudioStream(ctx, in.Path)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", filepath.Base(in.Path), err)
+		}
+		names[i] = filepath.Base(in.Path)
+		streams[i] = info
+	}
+	return demuxerMismatch(names, streams), streams, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseAudioStreamInfo(t *testing.T) {
+	info, err := parseAudioStreamInfo("codec_name=aac\nsample_rate=48000\nchannels=2\n")
+	if err != nil || info != (audioStreamInfo{"aac", "48000", "2"}) {
+		t.Errorf("info = %+v, err = %v", info, err)
+	}
+	if _, err := parseAudioStreamInfo(""); err == nil {
+		t.Error("expected error without an audio stream")
+	}
+}
+
+func TestDemuxerMismatch(t *testing.T) {
+	mp3 := audioStreamInfo{"mp3", "44100", "2"}
+	names := []string{"segment_0000.mp3", "segment_0001.mp3"}
+	tests := []struct {
+		name    string
+		streams []audioStreamInfo
+		want    string // Substring of the reason, "" = compatible
+	}{
+		{"all mp3", []audioStreamInfo{mp3, mp3}, ""},
+		{"aac", []audioStreamInfo{mp3, {"aac", "44100", "2"}}, "segment_0001.mp3 is aac"},
+		{"opus", []audioStreamInfo{{"opus", "48000", "2"}, mp3}, "segment_0000.mp3 is opus"},
+		{"sample rate", []audioStreamInfo{mp3, {"mp3", "48000", "2"}}, "48000 Hz"},
+		{"channels", []audioStreamInfo{mp3, {"mp3", "44100", "1"}}, "1ch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := demuxerMismatch(names, tt.streams)
+			if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+				t.Errorf("demuxerMismatch = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConcatAACAndOpusToMP3 encodes real AAC and Opus inputs; it needs
+// ffmpeg and ffprobe and is skipped without them
+func TestConcatAACAndOpusToMP3(t *testing.T) {
+	for _, bin := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not installed", bin)
+		}
+	}
+	dir := t.TempDir()
+	sources := []struct{ name, codec string }{
+		{"segment_0000.mp3", "libmp3lame"},
+		{"segment_0001.m4a", "aac"},
+		{"segment_0002.ogg", "libopus"},
+	}
+	var inputs []concatInput
+	for _, src := range sources {
+		path := filepath.Join(dir, src.name)
+		out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=frequency=440:duration=1",
+			"-c:a", src.codec, "-y", path).CombinedOutput()
+		if err != nil {
+			t.Skipf("can't encode %s test input: %v: %s", src.codec, err, out)
+		}
+		inputs = append(inputs, concatInput{Path: path})
+	}
+
+	ctx := context.Background()
+	mismatch, _, err := checkDemuxerInputs(ctx, inputs)
+	if err != nil || mismatch == "" {
+		t.Fatalf("checkDemuxerInputs = %q, %v; want a mismatch", mismatch, err)
+	}
+
+	output := filepath.Join(dir, "output.mp3")
+	args := concatInputArgs(concatFilter, "", inputs, podcastLoudnorm, false)
+	args = append(args, encoderArgs(ConcatRequest{})...)
+	args = append(args, "-y", output)
+	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+
+	info, err := probeAudioStream(ctx, output)
+	if err != nil || info.Codec != "mp3" {
+		t.Errorf("output stream = %+v, err = %v", info, err)
+	}
+	if d, err := getDuration(output); err != nil || d < 2.9 || d > 3.2 {
+		t.Errorf("output duration = %v, err = %v; want ~3s", d, err)
+	}
+}
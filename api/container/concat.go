@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ---------- Concat Method ----------
+//
+// The concat demuxer reads list.txt and joins the inputs at the packet level
+// before decoding. It opens one input at a time, so it is fast and cheap even
+// for thousands of segments, but it assumes every segment shares codec,
+// sample rate, and channel layout.
+//
+// The concat filter opens every segment as its own input and joins decoded
+// audio inside a filter graph. It tolerates mixed input parameters and is the
+// only path where per-input filters (crossfades, gaps) can be inserted, at the
+// cost of one decoder per segment held open for the whole encode.
+//
+// When auto is left with exactly one input there is nothing to join: the
+// file is read directly with -i and only filtered and re-encoded, which
+// skips the list file and the demuxer's per-file bookkeeping. This is the
+// common post-process case of an already assembled episode that just needs
+// normalization and tags.
+
+const (
+	concatAuto    = "auto"
+	concatDemuxer = "demuxer"
+	concatFilter  = "filter"
+	concatSingle  = "single" // Resolved only, never requested
+)
+
+// resolveConcatMethod turns the requested method into demuxer or filter.
+// Auto picks the filter only when a requested feature needs it: a generated
+// preamble or an appended earlier output won't match the segments' codec
+// parameters, so they must be decoded and joined in the filter graph, and
+// per-segment gain is a filter on each input.
+func resolveConcatMethod(req ConcatRequest) string {
+	if req.ConcatMethod == concatDemuxer || req.ConcatMethod == concatFilter {
+		return req.ConcatMethod
+	}
+	if hasPreamble(req) || req.AppendToURL != "" || hasSegmentGain(req.Segments) {
+		return concatFilter
+	}
+	return concatDemuxer
+}
+
+// singleInputMethod switches auto to the single-input fast path once the
+// final input list is known; explicit methods are left alone
+func singleInputMethod(req ConcatRequest, method string, inputs []concatInput) string {
+	if req.ConcatMethod == concatAuto && len(inputs) == 1 {
+		return concatSingle
+	}
+	return method
+}
+
+// concatInput is one file to join, optionally trimmed to [Start, End) seconds
+type concatInput struct {
+	Path   string
+	Start  float64 // 0 = from the beginning
+	End    float64 // 0 = to the end
+	GainDB float64 // Concat filter only
+}
+
+// trimmedDuration returns how much of a file lasting duration the input keeps
+func (in concatInput) trimmedDuration(duration float64) float64 {
+	end := duration
+	if in.End > 0 && in.End < duration {
+		end = in.End
+	}
+	return max(end-in.Start, 0)
+}
+
+// concatInputArgs returns the FFmpeg input and filter arguments for method.
+// audioFilter is applied to the joined stream: as -af for the demuxer, or
+// appended to the filter graph for the concat filter. safe keeps the
+// demuxer's path checks on, which requires relative list entries.
+func concatInputArgs(method, listFile string, inputs []concatInput, audioFilter string, safe bool) []string {
+	if method == concatSingle {
+		return singleInputArgs(inputs[0], audioFilter)
+	}
+	if method != concatFilter {
+		safeFlag := "0"
+		if safe {
+			safeFlag = "1"
+		}
+		args := []string{
+			"-f", "concat",
+			"-safe", safeFlag,
+			"-i", listFile,
+		}
+		if audioFilter != "" {
+			args = append(args, "-af", audioFilter)
+		}
+		return args
+	}
+
+	var args []string
+	var gains, graph strings.Builder
+	for i, in := range inputs {
+		if in.Start > 0 {
+			args = append(args, "-ss", formatFloat(in.Start))
+		}
+		if in.End > 0 {
+			args = append(args, "-to", formatFloat(in.End))
+		}
+		args = append(args, "-i", in.Path)
+		if in.GainDB != 0 {
+			fmt.Fprintf(&gains, "[%d:a]volume=%sdB[g%d];", i, formatFloat(in.GainDB), i)
+			fmt.Fprintf(&graph, "[g%d]", i)
+		} else {
+			fmt.Fprintf(&graph, "[%d:a]", i)
+		}
+	}
+	fmt.Fprintf(&graph, "concat=n=%d:v=0:a=1", len(inputs))
+	if audioFilter != "" {
+		graph.WriteString("," + audioFilter)
+	}
+	graph.WriteString("[out]")
+
+	return append(args, "-filter_complex", gains.String()+graph.String(), "-map", "[out]")
+}
+
+// singleInputArgs reads one input directly, with its trim and gain applied
+// ahead of audioFilter
+func singleInputArgs(in concatInput, audioFilter string) []string {
+	var args []string
+	if in.Start > 0 {
+		args = append(args, "-ss", formatFloat(in.Start))
+	}
+	if in.End > 0 {
+		args = append(args, "-to", formatFloat(in.End))
+	}
+	args = append(args, "-i", in.Path)
+
+	var chain []string
+	if in.GainDB != 0 {
+		chain = append(chain, fmt.Sprintf("volume=%sdB", formatFloat(in.GainDB)))
+	}
+	if audioFilter != "" {
+		chain = append(chain, audioFilter)
+	}
+	if len(chain) > 0 {
+		args = append(args, "-af", strings.Join(chain, ","))
+	}
+	return args
+}
+
+// concatList renders the concat demuxer list. Each entry needs a 'file'
+// directive; trims become inpoint/outpoint.
+func concatList(inputs []concatInput) string {
+	var list strings.Builder
+	for _, in := range inputs {
+		fmt.Fprintf(&list, "file '%s'\n", in.Path)
+		if in.Start > 0 {
+			fmt.Fprintf(&list, "inpoint %s\n", formatFloat(in.Start))
+		}
+		if in.End > 0 {
+			fmt.Fprintf(&list, "outpoint %s\n", formatFloat(in.End))
+		}
+	}
+	return list.String()
+}
+
+// maxListLineLength caps one list.txt line, PATH_MAX plus the directive
+const maxListLineLength = 4096 + len("file ''")
+
+// checkConcatInputs verifies every input before FFmpeg sees the list: the
+// path must pass checkInputPaths and name a non-empty regular file. FFmpeg
+// would otherwise fail with an opaque concat error for a download that
+// silently produced nothing.
+func checkConcatInputs(inputs []concatInput) error {
+	if err := checkInputPaths(inputs); err != nil {
+		return err
+	}
+	for i, in := range inputs {
+		info, err := os.Stat(in.Path)
+		switch {
+		case err != nil:
+			return listEntryError(i, in, "does not exist")
+		case !info.Mode().IsRegular():
+			return listEntryError(i, in, "is not a regular file")
+		case info.Size() == 0:
+			return listEntryError(i, in, "is empty")
+		}
+	}
+	return nil
+}
+
+// checkInputPaths verifies that every input path can be written into the
+// list as is: absolute, safe to quote, and short enough
+func checkInputPaths(inputs []concatInput) error {
+	for i, in := range inputs {
+		switch {
+		case !filepath.IsAbs(in.Path):
+			return listEntryError(i, in, "is not an absolute path")
+		case strings.ContainsAny(in.Path, "'\n\r"):
+			return listEntryError(i, in, "contains a quote or line break")
+		case len("file ''")+len(in.Path) > maxListLineLength:
+			return listEntryError(i, in, fmt.Sprintf("is longer than %d characters", maxListLineLength))
+		}
+	}
+	return nil
+}
+
+// listEntryError describes a problem with input i
+func listEntryError(i int, in concatInput, reason string) error {
+	return fmt.Errorf("list entry %d (%s) %s", i, in.Path, reason)
+}
+
+// relativeInputs replaces each path with its file name, for use relative to
+// the work dir
+func relativeInputs(inputs []concatInput) []concatInput {
+	rel := make([]concatInput, len(inputs))
+	for i, in := range inputs {
+		rel[i] = in
+		rel[i].Path = filepath.Base(in.Path)
+	}
+	return rel
+}
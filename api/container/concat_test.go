@@ -0,0 +1,223 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveConcatMethod(t *testing.T) {
+	tests := map[string]string{
+		"":            concatDemuxer,
+		concatAuto:    concatDemuxer,
+		concatDemuxer: concatDemuxer,
+		concatFilter:  concatFilter,
+	}
+	for requested, want := range tests {
+		if got := resolveConcatMethod(ConcatRequest{ConcatMethod: requested}); got != want {
+			t.Errorf("resolveConcatMethod(%q) = %q, want %q", requested, got, want)
+		}
+	}
+}
+
+func TestConcatInputArgs(t *testing.T) {
+	segments := []concatInput{{Path: "/w/segment_0000.mp3"}, {Path: "/w/segment_0001.mp3"}}
+
+	got := concatInputArgs(concatDemuxer, "/w/list.txt", segments, "loudnorm", false)
+	want := []string{"-f", "concat", "-safe", "0", "-i", "/w/list.txt", "-af", "loudnorm"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("demuxer args = %v, want %v", got, want)
+	}
+
+	got = concatInputArgs(concatFilter, "/w/list.txt", segments, "loudnorm", false)
+	want = []string{
+		"-i", "/w/segment_0000.mp3",
+		"-i", "/w/segment_0001.mp3",
+		"-filter_complex", "[0:a][1:a]concat=n=2:v=0:a=1,loudnorm[out]",
+		"-map", "[out]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filter args = %v, want %v", got, want)
+	}
+}
+
+func TestValidateRequestConcatMethod(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b"}
+	if err := validateRequest(req); err != nil || req.ConcatMethod != concatAuto {
+		t.Errorf("default: err = %v, ConcatMethod = %q", err, req.ConcatMethod)
+	}
+
+	req = &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", ConcatMethod: "copy"}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected error for unknown concat_method")
+	}
+}
+
+func TestValidateRequestAppendToURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ConcatRequest
+		wantErr bool
+	}{
+		{"append", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c"}, false},
+		{"with split", ConcatRequest{Segments: segmentURLs("a"), AppendToURL: "c", SplitDurationSeconds: 60, OutputURLTemplate: "p{part}"}, true},
+		{"with preamble", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c", PreambleSilenceSeconds: 1}, true},
+		{"with speed_factor", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c", SpeedFactor: 1.25}, true},
+		{"with speed_factor 1", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c", SpeedFactor: 1}, false},
+		{"with gain_db", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c", GainDB: 3}, true},
+		{"with eq_bands", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c", EQBands: []EQBand{{FrequencyHz: 100, GainDB: 3}}}, true},
+		{"with noise_gate", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c", NoiseGate: &NoiseGate{}}, true},
+		{"with custom_audio_filter", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", AppendToURL: "c", CustomAudioFilter: "volume=2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			if err := validateRequest(&req); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The same options without append_to_url are fine, so the rejection
+	// above is the append check and not a range error
+	req := ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", SpeedFactor: 1.25, GainDB: 3}
+	if err := validateRequest(&req); err != nil {
+		t.Errorf("without append_to_url: %v", err)
+	}
+	req.AppendToURL = "c"
+	if err := validateRequest(&req); err == nil || !strings.Contains(err.Error(), "speed_factor, gain_db") {
+		t.Errorf("with append_to_url: err = %v", err)
+	}
+
+	if got := resolveConcatMethod(ConcatRequest{ConcatMethod: concatAuto, AppendToURL: "c"}); got != concatFilter {
+		t.Errorf("auto with append_to_url = %q, want %q", got, concatFilter)
+	}
+}
+
+func TestConcatSafeMode(t *testing.T) {
+	names := relativeInputs([]concatInput{{Path: "/w/preamble.mp3"}, {Path: "/w/segment_0000.mp3"}})
+	if want := []concatInput{{Path: "preamble.mp3"}, {Path: "segment_0000.mp3"}}; !reflect.DeepEqual(names, want) {
+		t.Errorf("relativeInputs = %v, want %v", names, want)
+	}
+	if got, want := concatList(names), "file 'preamble.mp3'\nfile 'segment_0000.mp3'\n"; got != want {
+		t.Errorf("concatList = %q, want %q", got, want)
+	}
+
+	args := concatInputArgs(concatDemuxer, "list.txt", names, "loudnorm", true)
+	if args[3] != "1" || args[5] != "list.txt" {
+		t.Errorf("safe demuxer args = %v", args)
+	}
+}
+
+func TestCheckConcatInputs(t *testing.T) {
+	dir := t.TempDir()
+	present := filepath.Join(dir, "segment_0000.mp3")
+	os.WriteFile(present, []byte("audio"), 0644)
+	empty := filepath.Join(dir, "segment_0001.mp3")
+	os.WriteFile(empty, nil, 0644)
+	missing := filepath.Join(dir, "segment_0002.mp3")
+
+	if err := checkConcatInputs([]concatInput{{Path: present}}); err != nil {
+		t.Errorf("valid list: %v", err)
+	}
+	tests := []struct {
+		name   string
+		inputs []concatInput
+		want   string
+	}{
+		{"missing file", []concatInput{{Path: present}, {Path: missing}}, "list entry 1 (" + missing + ") does not exist"},
+		{"empty file", []concatInput{{Path: empty}}, "is empty"},
+		{"relative", []concatInput{{Path: "segment_0000.mp3"}}, "not an absolute path"},
+		{"directory", []concatInput{{Path: dir}}, "not a regular file"},
+		{"quote", []concatInput{{Path: filepath.Join(dir, "it's.mp3")}}, "quote"},
+		{"too long", []concatInput{{Path: "/" + strings.Repeat("a", maxListLineLength)}}, "longer than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConcatInputs(tt.inputs)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcatTrimmedInputs(t *testing.T) {
+	inputs := []concatInput{
+		{Path: "/w/segment_0000.mp3", Start: 3},
+		{Path: "/w/segment_0001.mp3"},
+		{Path: "/w/segment_0002.mp3", Start: 1.5, End: 10},
+	}
+
+	wantList := "file '/w/segment_0000.mp3'\ninpoint 3\n" +
+		"file '/w/segment_0001.mp3'\n" +
+		"file '/w/segment_0002.mp3'\ninpoint 1.5\noutpoint 10\n"
+	if got := concatList(inputs); got != wantList {
+		t.Errorf("concatList = %q, want %q", got, wantList)
+	}
+
+	got := concatInputArgs(concatFilter, "/w/list.txt", inputs, "loudnorm", false)
+	want := []string{
+		"-ss", "3", "-i", "/w/segment_0000.mp3",
+		"-i", "/w/segment_0001.mp3",
+		"-ss", "1.5", "-to", "10", "-i", "/w/segment_0002.mp3",
+		"-filter_complex", "[0:a][1:a][2:a]concat=n=3:v=0:a=1,loudnorm[out]",
+		"-map", "[out]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filter args = %v, want %v", got, want)
+	}
+
+	if d := inputs[2].trimmedDuration(60); d != 8.5 {
+		t.Errorf("trimmedDuration = %v, want 8.5", d)
+	}
+	if d := inputs[0].trimmedDuration(60); d != 57 {
+		t.Errorf("trimmedDuration = %v, want 57", d)
+	}
+}
+
+func TestConcatSegmentGain(t *testing.T) {
+	inputs := []concatInput{{Path: "/w/segment_0000.mp3"}, {Path: "/w/segment_0001.mp3", GainDB: -3.5}}
+	got := concatInputArgs(concatFilter, "/w/list.txt", inputs, "loudnorm", false)
+	want := []string{
+		"-i", "/w/segment_0000.mp3",
+		"-i", "/w/segment_0001.mp3",
+		"-filter_complex", "[1:a]volume=-3.5dB[g1];[0:a][g1]concat=n=2:v=0:a=1,loudnorm[out]",
+		"-map", "[out]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filter args = %v, want %v", got, want)
+	}
+
+	segments := []Segment{{URL: "a"}, {URL: "b", GainDB: 2}}
+	if got := resolveConcatMethod(ConcatRequest{ConcatMethod: concatAuto, Segments: segments}); got != concatFilter {
+		t.Errorf("auto with segment gain = %q, want %q", got, concatFilter)
+	}
+	req := &ConcatRequest{Segments: segments, OutputURL: "o", ConcatMethod: concatDemuxer}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected error for segment gain with the demuxer")
+	}
+}
+
+func TestSingleInputFastPath(t *testing.T) {
+	inputs := []concatInput{{Path: "/w/segment_0000.mp3", Start: 2, GainDB: -3}}
+
+	auto := ConcatRequest{ConcatMethod: concatAuto}
+	if got := singleInputMethod(auto, concatDemuxer, inputs); got != concatSingle {
+		t.Errorf("auto with one input = %q, want %q", got, concatSingle)
+	}
+	if got := singleInputMethod(auto, concatDemuxer, append(inputs, concatInput{Path: "b"})); got != concatDemuxer {
+		t.Errorf("auto with two inputs = %q, want %q", got, concatDemuxer)
+	}
+	if got := singleInputMethod(ConcatRequest{ConcatMethod: concatFilter}, concatFilter, inputs); got != concatFilter {
+		t.Errorf("explicit filter = %q, want %q", got, concatFilter)
+	}
+
+	got := concatInputArgs(concatSingle, "/w/list.txt", inputs, "loudnorm", false)
+	want := []string{"-ss", "2", "-i", "/w/segment_0000.mp3", "-af", "volume=-3dB,loudnorm"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("single args = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDownloadGzipContentEncoding(t *testing.T) {
+	mp3 := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 4096)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(mp3)
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxBytes int64
+		wantErr  string // Empty: the file on disk must be the plain MP3
+	}{
+		{name: "gzip", encoding: "gzip", body: gz.Bytes()},
+		{name: "x-gzip", encoding: "x-gzip", body: gz.Bytes()},
+		{name: "upper case", encoding: "GZIP", body: gz.Bytes()},
+		{name: "mislabeled plain file", encoding: "gzip", body: mp3},
+		{name: "identity", encoding: "identity", body: mp3},
+		{name: "brotli", encoding: "br", body: mp3, wantErr: `Content-Encoding "br"`},
+		{name: "truncated gzip", encoding: "gzip", body: gz.Bytes()[:gz.Len()/2], wantErr: "gzip Content-Encoding"},
+		{name: "decoded size over the cap", encoding: "gzip", body: gz.Bytes(), maxBytes: int64(len(mp3)) - 1, wantErr: errSegmentTooLarge.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != "identity" {
+					t.Errorf("Accept-Encoding = %q, want identity", got)
+				}
+				w.Header().Set("Content-Type", "audio/mpeg")
+				w.Header().Set("Content-Encoding", tt.encoding)
+				w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			dest := filepath.Join(t.TempDir(), "segment.mp3")
+			written, err := downloadFileLimit(context.Background(), server.URL, dest, tt.maxBytes)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if _, statErr := os.Stat(dest); !errors.Is(statErr, os.ErrNotExist) {
+					t.Error("a failed download left a file behind")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(dest)
+			if written != int64(len(mp3)) || !bytes.Equal(got, mp3) {
+				t.Errorf("wrote %d bytes, file matches = %v; want the %d byte MP3", written, bytes.Equal(got, mp3), len(mp3))
+			}
+		})
+	}
+}
+
+func TestDecodeContentEncodingNotRetryable(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Encoding": {"zstd"}}, Body: http.NoBody}
+	if _, _, err := decodeContentEncoding(resp); err == nil || isRetryable(err) {
+		t.Errorf("err = %v, want a non-retryable error", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- CPU Budget ----------
+//
+// jobTimeout bounds wall time, but a pathological input can keep FFmpeg
+// spinning on every core for most of an hour and starve the other jobs on a
+// shared container long before that. With MAX_CPU_SECONDS set, the encode's
+// CPU time (user plus system, summed over its threads) is polled from
+// /proc/<pid>/stat and the process is killed once it passes the budget. The
+// measured CPU time is also read from rusage after every run, budget or
+// not, and logged in the job summary.
+
+// cpuPollInterval is how often a running encode's CPU time is checked
+var cpuPollInterval = time.Second
+
+// errCPUBudgetExceeded is returned when an encode is killed for its CPU use
+var errCPUBudgetExceeded = errors.New("CPU time budget exceeded")
+
+// clockTicks is USER_HZ, the unit of /proc/<pid>/stat times; the kernel
+// fixes it at 100 for every architecture we run on
+const clockTicks = 100
+
+// runWithCPUBudget runs cmd, killing it if its CPU time passes budget
+// (0 = unlimited), and returns the CPU time it used
+func runWithCPUBudget(cmd *exec.Cmd, budget time.Duration) (time.Duration, error) {
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	exceeded := make(chan time.Duration, 1)
+	done := make(chan struct{})
+	var poller sync.WaitGroup
+	if budget > 0 {
+		interval := cpuPollInterval
+		poller.Add(1)
+		go func() {
+			defer poller.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+				}
+				used, err := processCPUTime(cmd.Process.Pid)
+				if err == nil && used > budget {
+					exceeded <- used
+					cmd.Process.Kill()
+					return
+				}
+			}
+		}()
+	}
+
+	err := cmd.Wait()
+	// The poller must be gone before returning, not just told to stop
+	close(done)
+	poller.Wait()
+	var used time.Duration
+	if cmd.ProcessState != nil {
+		used = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	select {
+	case <-exceeded:
+		return used, fmt.Errorf("%w: used %s of %s", errCPUBudgetExceeded, used.Round(time.Millisecond), budget)
+	default:
+	}
+	return used, err
+}
+
+// processCPUTime reads a running process's user plus system time
+func processCPUTime(pid int) (time.Duration, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	return parseProcStatCPU(string(data))
+}
+
+// parseProcStatCPU extracts utime + stime from a /proc/<pid>/stat line. The
+// command name in parentheses may contain spaces, so fields are counted
+// from the last ')'.
+func parseProcStatCPU(stat string) (time.Duration, error) {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, errors.New("malformed /proc stat")
+	}
+	// Fields after the name start at 3 (state); utime and stime are 14 and 15
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return 0, errors.New("malformed /proc stat")
+	}
+	utime, err1 := strconv.ParseInt(fields[11], 10, 64)
+	stime, err2 := strconv.ParseInt(fields[12], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, errors.New("malformed /proc stat")
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestParseProcStatCPU(t *testing.T) {
+	stat := "4242 (ffmpeg worker) R 1 4242 4242 0 -1 4194560 1200 0 0 0 250 37 0 0 20 0 9 0 12345 0 0\n"
+	got, err := parseProcStatCPU(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2870 * time.Millisecond; got != want {
+		t.Errorf("cpu = %s, want %s", got, want)
+	}
+	for _, bad := range []string{"", "4242 (ffmpeg) R 1 2", "4242 (ffmpeg) R 1 4242 4242 0 -1 0 0 0 0 0 x 37 0"} {
+		if _, err := parseProcStatCPU(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestRunWithCPUBudget(t *testing.T) {
+	defer func(d time.Duration) { cpuPollInterval = d }(cpuPollInterval)
+	cpuPollInterval = 20 * time.Millisecond
+
+	// A busy loop passes a small budget and is killed
+	start := time.Now()
+	used, err := runWithCPUBudget(exec.Command("sh", "-c", "while :; do :; done"), 200*time.Millisecond)
+	if !errors.Is(err, errCPUBudgetExceeded) {
+		t.Fatalf("err = %v, want errCPUBudgetExceeded", err)
+	}
+	if used < 200*time.Millisecond {
+		t.Errorf("used = %s, want more than the budget", used)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("took %s to kill the loop", elapsed)
+	}
+
+	// Sleeping uses no CPU, so the budget never fires
+	if _, err := runWithCPUBudget(exec.Command("sh", "-c", "sleep 0.2"), 100*time.Millisecond); err != nil {
+		t.Errorf("idle command: %v", err)
+	}
+
+	// Without a budget the exit status comes through unchanged
+	if _, err := runWithCPUBudget(exec.Command("sh", "-c", "exit 3"), 0); err == nil || errors.Is(err, errCPUBudgetExceeded) {
+		t.Errorf("failing command: err = %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ---------- Custom Audio Filter ----------
+//
+// custom_audio_filter is a power-user escape hatch: a raw FFmpeg filter chain
+// spliced into -af. It is only accepted when ALLOW_CUSTOM_FILTERS is set and
+// is NOT sanitized beyond the basic checks below, so only enable it for
+// trusted callers. The checks keep the value a single linear chain and
+// reject filters and options that touch files, load plugins, or accept
+// runtime commands.
+
+const (
+	customFilterAppend  = "append"  // Default: run after loudnorm
+	customFilterReplace = "replace" // Run instead of loudnorm
+)
+
+// maxCustomFilterLength caps custom_audio_filter
+const maxCustomFilterLength = 1024
+
+// blockedFilterPattern matches filters that read or write files, load
+// external code, or take commands at runtime, plus any file/filename option
+var blockedFilterPattern = regexp.MustCompile(`(?i)\b(a?movie|a?sendcmd|a?zmq|ladspa|lv2|lavfi)\b|\b\w*file(name)?\s*=`)
+
+// validateCustomFilter checks custom_audio_filter and its mode
+func validateCustomFilter(req *ConcatRequest) error {
+	if req.CustomAudioFilter == "" {
+		if req.CustomFilterMode != "" {
+			return errors.New("custom_filter_mode requires custom_audio_filter")
+		}
+		return nil
+	}
+	if !config.AllowCustomFilters {
+		return errors.New("custom_audio_filter is disabled on this server")
+	}
+
+	switch req.CustomFilterMode {
+	case "":
+		req.CustomFilterMode = customFilterAppend
+	case customFilterAppend, customFilterReplace:
+	default:
+		return fmt.Errorf("custom_filter_mode must be %q or %q", customFilterAppend, customFilterReplace)
+	}
+
+	filter := req.CustomAudioFilter
+	if len(filter) > maxCustomFilterLength {
+		return fmt.Errorf("custom_audio_filter must be at most %d characters", maxCustomFilterLength)
+	}
+	// Labels and ';' would let the value escape the linear chain into a graph
+	if strings.ContainsAny(filter, "[];") {
+		return errors.New("custom_audio_filter must be a single filter chain without labels or ';'")
+	}
+	for _, r := range filter {
+		if r < 0x20 || r == 0x7f {
+			return errors.New("custom_audio_filter must not contain control characters")
+		}
+	}
+	if m := blockedFilterPattern.FindString(filter); m != "" {
+		return fmt.Errorf("custom_audio_filter uses a disallowed filter or option: %q", m)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCustomFilter(t *testing.T) {
+	config.AllowCustomFilters = true
+	defer func() { config.AllowCustomFilters = false }()
+
+	tests := []struct {
+		name    string
+		filter  string
+		mode    string
+		wantErr bool
+	}{
+		{"unset", "", "", false},
+		{"mode without filter", "", "replace", true},
+		{"append", "highpass=f=80,lowpass=f=12000", "", false},
+		{"replace", "dynaudnorm", "replace", false},
+		{"unknown mode", "dynaudnorm", "prepend", true},
+		{"too long", strings.Repeat("a", maxCustomFilterLength+1), "", true},
+		{"graph labels", "[0:a]volume=2[x]", "", true},
+		{"second chain", "volume=2;amovie=/etc/passwd", "", true},
+		{"newline", "volume=2\nvolume=3", "", true},
+		{"movie source", "amovie=/etc/passwd", "", true},
+		{"runtime commands", "asendcmd=c='0 volume volume 0'", "", true},
+		{"file option", "ametadata=mode=print:file=/tmp/x", "", true},
+		{"plugin", "ladspa=file=cmt:amp_mono", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &ConcatRequest{CustomAudioFilter: tt.filter, CustomFilterMode: tt.mode}
+			if err := validateCustomFilter(req); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomFilterDisabled(t *testing.T) {
+	req := &ConcatRequest{CustomAudioFilter: "volume=2"}
+	if err := validateCustomFilter(req); err == nil {
+		t.Error("expected custom_audio_filter to be rejected without ALLOW_CUSTOM_FILTERS")
+	}
+}
+
+func TestCustomFilterChain(t *testing.T) {
+	got := audioFilterChain(ConcatRequest{CustomAudioFilter: "highpass=f=80", CustomFilterMode: customFilterAppend})
+	if want := podcastLoudnorm + ",highpass=f=80"; got != want {
+		t.Errorf("append chain = %q, want %q", got, want)
+	}
+
+	got = audioFilterChain(ConcatRequest{SpeedFactor: 1.1, CustomAudioFilter: "dynaudnorm", CustomFilterMode: customFilterReplace})
+	if want := "atempo=1.1,dynaudnorm"; got != want {
+		t.Errorf("replace chain = %q, want %q", got, want)
+	}
+}
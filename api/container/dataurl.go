@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+)
+
+// ---------- data: URL Segments ----------
+//
+// Small generated clips (beeps, stingers) can be embedded directly in the
+// segment list as data:audio/mpeg;base64,... instead of being uploaded first.
+
+// maxDataURLBytes caps the decoded size of an inline segment; anything larger
+// belongs in object storage
+const maxDataURLBytes = 1 << 20
+
+// isDataURL reports whether url uses the data: scheme
+func isDataURL(url string) bool {
+	return len(url) >= 5 && strings.EqualFold(url[:5], "data:")
+}
+
+// decodeDataURL writes the payload of a base64 audio data: URL to destPath
+func decodeDataURL(url, destPath string) (int64, error) {
+	header, payload, ok := strings.Cut(url[len("data:"):], ",")
+	if !ok {
+		return 0, errors.New("malformed data URL: missing ','")
+	}
+
+	params := strings.Split(header, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	if _, _, err := mime.ParseMediaType(mediaType); err != nil || !strings.HasPrefix(mediaType, "audio/") {
+		return 0, fmt.Errorf("data URL media type %q is not audio", params[0])
+	}
+	if !strings.EqualFold(params[len(params)-1], "base64") {
+		return 0, errors.New("data URL must be base64 encoded")
+	}
+
+	limit := int64(maxDataURLBytes)
+	if config.MaxSegmentBytes > 0 && config.MaxSegmentBytes < limit {
+		limit = config.MaxSegmentBytes
+	}
+	if int64(base64.StdEncoding.DecodedLen(len(payload))) > limit+2 {
+		return 0, fmt.Errorf("%w: data URL payload over %d bytes", errSegmentTooLarge, limit)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, fmt.Errorf("decode data URL: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return 0, fmt.Errorf("%w: data URL payload over %d bytes", errSegmentTooLarge, limit)
+	}
+	if len(data) == 0 {
+		return 0, errors.New("data URL payload is empty")
+	}
+
+	// Through a temp file like downloads, so destPath is never partial
+	return atomicWrite(destPath, func(out *os.File) (int64, error) {
+		n, err := out.Write(data)
+		if err != nil {
+			return int64(n), fmt.Errorf("write failed: %w", err)
+		}
+		return int64(n), nil
+	})
+}
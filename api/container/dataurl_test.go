@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFileDataURL(t *testing.T) {
+	clip := []byte{0xff, 0xfb, 0x90, 0x64, 0x00}
+	url := "data:audio/mpeg;base64," + base64.StdEncoding.EncodeToString(clip)
+
+	dest := filepath.Join(t.TempDir(), "segment.mp3")
+	written, err := downloadFile(context.Background(), url, dest)
+	if err != nil {
+		t.Fatalf("downloadFile: %v", err)
+	}
+	if written != int64(len(clip)) {
+		t.Errorf("written = %d, want %d", written, len(clip))
+	}
+	got, _ := os.ReadFile(dest)
+	if !bytes.Equal(got, clip) {
+		t.Errorf("content = %x, want %x", got, clip)
+	}
+	// Written through a temp file that is renamed into place
+	if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 1 {
+		t.Errorf("work dir holds %d files, want only the segment", len(entries))
+	}
+}
+
+func TestDecodeDataURLRejects(t *testing.T) {
+	payload := base64.StdEncoding.EncodeToString([]byte("abc"))
+	tests := map[string]string{
+		"not audio":   "data:text/html;base64," + payload,
+		"not base64":  "data:audio/mpeg,abc",
+		"no comma":    "data:audio/mpeg;base64",
+		"bad payload": "data:audio/mpeg;base64,!!!",
+		"empty":       "data:audio/mpeg;base64,",
+	}
+	for name, url := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeDataURL(url, filepath.Join(t.TempDir(), "x.mp3")); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestDecodeDataURLSizeLimit(t *testing.T) {
+	config.MaxSegmentBytes = 10
+	defer func() { config.MaxSegmentBytes = 0 }()
+
+	url := "data:audio/mpeg;base64," + base64.StdEncoding.EncodeToString(make([]byte, 64))
+	_, err := decodeDataURL(url, filepath.Join(t.TempDir(), "x.mp3"))
+	if !errors.Is(err, errSegmentTooLarge) {
+		t.Errorf("err = %v, want errSegmentTooLarge", err)
+	}
+}
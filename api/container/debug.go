@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// ---------- Debug Logging ----------
+//
+// With debug set, the encode runs at -loglevel verbose and its full stderr
+// is kept: uploaded to debug_log_url when given, otherwise returned in the
+// response (truncated to the tail). The default encode keeps FFmpeg's info
+// level, which the ffprobe-less duration fallback parses.
+
+// maxInlineDebugLog caps the ffmpeg_log returned in the response body
+const maxInlineDebugLog = 64 << 10
+
+// debugLogArgs returns the global FFmpeg options for a debug encode
+func debugLogArgs(debug bool) []string {
+	if !debug {
+		return nil
+	}
+	return []string{"-loglevel", "verbose"}
+}
+
+// inlineDebugLog returns the tail of log that fits in the response
+func inlineDebugLog(log string) string {
+	if len(log) <= maxInlineDebugLog {
+		return log
+	}
+	return fmt.Sprintf("[truncated %d bytes]\n", len(log)-maxInlineDebugLog) + log[len(log)-maxInlineDebugLog:]
+}
+
+// uploadDebugLog writes the FFmpeg log to path and uploads it to url
+func uploadDebugLog(ctx context.Context, log, path, url string) error {
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		return err
+	}
+	return uploadWithRetry(ctx, path, url, "text/plain; charset=utf-8")
+}
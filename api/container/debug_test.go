@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebugLogArgs(t *testing.T) {
+	if args := debugLogArgs(false); args != nil {
+		t.Errorf("non-debug args = %v, want none", args)
+	}
+	if args := debugLogArgs(true); strings.Join(args, " ") != "-loglevel verbose" {
+		t.Errorf("debug args = %v", args)
+	}
+}
+
+func TestInlineDebugLog(t *testing.T) {
+	if got := inlineDebugLog("short log"); got != "short log" {
+		t.Errorf("short log changed: %q", got)
+	}
+
+	log := strings.Repeat("a", 100) + strings.Repeat("b", maxInlineDebugLog)
+	got := inlineDebugLog(log)
+	if !strings.HasPrefix(got, "[truncated 100 bytes]\n") || !strings.HasSuffix(got, "b") || strings.Contains(got, "a\n") {
+		t.Errorf("truncated log starts %q", got[:40])
+	}
+}
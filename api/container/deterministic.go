@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+// ---------- Deterministic Output ----------
+//
+// FFmpeg writes its own version into the output: a TSSE (encoder) ID3 frame
+// such as "Lavf61.7.100" and a "Lavc61.19" string in the Xing/LAME header.
+// It also carries tags over from the first input. Outputs built from the same
+// inputs therefore differ between hosts and FFmpeg releases, which breaks
+// hash-based caching and tests that assert on output hashes.
+//
+// With deterministic set the job normalizes:
+//
+//	input tags     -> dropped (-map_metadata -1); only request metadata is written
+//	encoder tag    -> omitted (-fflags +bitexact)
+//	codec version  -> omitted from the Xing/LAME header (-flags:a +bitexact)
+//	sidecar time   -> created_at fixed at the Unix epoch
+//
+// The same flags apply to the tag remux in tagverify.go. Byte-identical
+// output still assumes the same FFmpeg and LAME builds; the flags only
+// remove the fields that vary from run to run.
+
+// deterministicEpoch replaces wall-clock timestamps in deterministic jobs
+var deterministicEpoch = time.Unix(0, 0).UTC()
+
+// deterministicArgs returns the output options that strip inherited tags
+// and version strings
+func deterministicArgs() []string {
+	return []string{"-map_metadata", "-1", "-fflags", "+bitexact", "-flags:a", "+bitexact"}
+}
+
+// jobTimestamp returns now, or the fixed epoch for deterministic jobs
+func jobTimestamp(req ConcatRequest, now time.Time) time.Time {
+	if req.Deterministic {
+		return deterministicEpoch
+	}
+	return now.UTC()
+}
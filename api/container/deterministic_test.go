@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeterministicArgs(t *testing.T) {
+	want := []string{"-map_metadata", "-1", "-fflags", "+bitexact", "-flags:a", "+bitexact"}
+	if got := deterministicArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("deterministicArgs = %v, want %v", got, want)
+	}
+}
+
+func TestJobTimestamp(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	if got := jobTimestamp(ConcatRequest{}, now); !got.Equal(now) || got.Location() != time.UTC {
+		t.Errorf("jobTimestamp = %v, want %v in UTC", got, now)
+	}
+	if got := jobTimestamp(ConcatRequest{Deterministic: true}, now); !got.Equal(time.Unix(0, 0)) {
+		t.Errorf("deterministic jobTimestamp = %v, want the epoch", got)
+	}
+}
+
+// TestDeterministicOutputHashes runs the same /concat job twice and checks
+// the uploads are byte-identical; it is skipped without FFmpeg
+func TestDeterministicOutputHashes(t *testing.T) {
+	requireFFmpegTools(t)
+
+	dir := t.TempDir()
+	segment := filepath.Join(dir, "segment.mp3")
+	if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=duration=2",
+		"-c:a", "libmp3lame", "-ar", "44100", "-metadata", "comment=from the source", "-y", segment).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+	segmentData, _ := os.ReadFile(segment)
+
+	uploads := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			uploads[r.URL.Path], _ = io.ReadAll(r.Body)
+			return
+		}
+		w.Write(segmentData)
+	}))
+	defer server.Close()
+
+	run := func(name string) [32]byte {
+		body, _ := json.Marshal(ConcatRequest{
+			EpisodeID:     "ep-deterministic-" + name,
+			Segments:      segmentURLs(server.URL+"/a.mp3", server.URL+"/b.mp3"),
+			OutputURL:     server.URL + "/" + name + ".mp3",
+			SidecarURL:    server.URL + "/" + name + ".json",
+			Metadata:      ConcatMetadata{Title: "Deterministic", Episode: 7},
+			Deterministic: true,
+		})
+		rec := httptest.NewRecorder()
+		handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: code = %d: %s", name, rec.Code, rec.Body.String())
+		}
+		return sha256.Sum256(uploads["/"+name+".mp3"])
+	}
+	first := run("first")
+	time.Sleep(1100 * time.Millisecond) // Cross a second boundary between runs
+	if second := run("second"); first != second {
+		t.Errorf("output hashes differ: %x vs %x", first, second)
+	}
+
+	var sidecar Sidecar
+	if err := json.Unmarshal(uploads["/first.json"], &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if !sidecar.CreatedAt.Equal(deterministicEpoch) {
+		t.Errorf("sidecar created_at = %v, want the epoch", sidecar.CreatedAt)
+	}
+}
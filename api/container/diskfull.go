@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ---------- Disk Full ----------
+//
+// A job that fills the work dir volume used to fail as ffmpeg_failed (with
+// FFmpeg's "No space left on device" buried in the stderr) or as a failed
+// segment download. Both are now reported as disk_full with 507, and the
+// job's work dir is emptied straight away instead of at the deferred
+// cleanup, so jobs running next to it get the space back before this one
+// has finished writing its response.
+
+// diskFullStderr is how FFmpeg reports ENOSPC on stderr
+const diskFullStderr = "No space left on device"
+
+// diskFullGuidance tells the operator what to change
+const diskFullGuidance = "the work dir volume (TMPDIR) is full; give it more space, " +
+	"lower MAX_CONCURRENT_JOBS, or split very long episodes"
+
+// isDiskFull reports whether a failure was caused by running out of disk,
+// from the error itself or from FFmpeg's stderr
+func isDiskFull(err error, stderr string) bool {
+	return errors.Is(err, syscall.ENOSPC) || strings.Contains(stderr, diskFullStderr)
+}
+
+// emptyWorkDir removes everything in a job's work dir, leaving the dir for
+// the deferred cleanup, and returns how many bytes were freed
+func emptyWorkDir(dir string) int64 {
+	entries, _ := os.ReadDir(dir)
+	var freed int64
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		size := int64(0)
+		filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if info, err := d.Info(); err == nil {
+					size += info.Size()
+				}
+			}
+			return nil
+		})
+		if os.RemoveAll(path) == nil {
+			freed += size
+		}
+	}
+	return freed
+}
+
+// diskFullMessage describes a disk-full failure during step, after the
+// work dir has been emptied
+func diskFullMessage(step string, freed int64) string {
+	return fmt.Sprintf("%s: no space left on device; %s (freed %d bytes of this job's files)", step, diskFullGuidance, freed)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestIsDiskFull(t *testing.T) {
+	write := &os.PathError{Op: "write", Path: "/tmp/concat-1/segment.mp3", Err: syscall.ENOSPC}
+	tests := []struct {
+		name   string
+		err    error
+		stderr string
+		want   bool
+	}{
+		{"download write", networkError("copy failed", write), "", true},
+		{"ffmpeg stderr", errors.New("exit status 1"), "[out#0/mp3] Error writing trailer: No space left on device\n", true},
+		{"other ffmpeg failure", errors.New("exit status 1"), "Invalid data found when processing input\n", false},
+		{"permission", &os.PathError{Op: "open", Path: "/tmp/x", Err: syscall.EACCES}, "", false},
+		{"nil", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDiskFull(tt.err, tt.stderr); got != tt.want {
+				t.Errorf("isDiskFull = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "segment_0000.mp3"), make([]byte, 300), 0644)
+	os.Mkdir(filepath.Join(dir, "hls"), 0755)
+	os.WriteFile(filepath.Join(dir, "hls", "hls_000.ts"), make([]byte, 200), 0644)
+
+	if freed := emptyWorkDir(dir); freed != 500 {
+		t.Errorf("freed = %d, want 500", freed)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("work dir still has %d entries", len(entries))
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("work dir itself was removed: %v", err)
+	}
+
+	if msg := diskFullMessage("encode", 500); !strings.Contains(msg, "MAX_CONCURRENT_JOBS") || !strings.Contains(msg, "freed 500 bytes") {
+		t.Errorf("message = %q", msg)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// ---------- Drain ----------
+//
+// SIGTERM cancels shutdownCtx, which both refuses new work and cancels
+// every job in flight. POST /drain gives operators the same control without
+// depending on when the orchestrator delivers the signal. A plain drain only
+// stops accepting work: /concat and /reupload return 503, /readyz reports
+// not_draining false, and running and queued jobs finish normally. With
+// force=true it cancels shutdownCtx, exactly as SIGTERM would, and every
+// running or queued job fails with 503 cancelled. Neither can be undone
+// short of a restart.
+
+// drainRequested is set by a plain POST /drain
+var drainRequested atomic.Bool
+
+// acceptingJobs reports whether new work may start
+func acceptingJobs() bool {
+	return !drainRequested.Load() && shutdownCtx.Err() == nil
+}
+
+// DrainResponse is the response body for /drain
+type DrainResponse struct {
+	SchemaVersion int  `json:"schema_version"`
+	Force         bool `json:"force"`
+	RunningJobs   int  `json:"running_jobs"` // Holding a slot when the drain began
+	QueuedJobs    int  `json:"queued_jobs"`  // Waiting for a slot when the drain began
+	Cancelled     int  `json:"cancelled"`    // Jobs cancelled by force; 0 for a plain drain
+}
+
+// handleDrain serves POST /drain[?force=true]
+func handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, codeMethodNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := readAuthorizedBody(w, r); !ok {
+		return
+	}
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			sendError(w, codeInvalidRequest, "force must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	drainRequested.Store(true)
+	queueMu.Lock()
+	queued := len(jobQueue)
+	queueMu.Unlock()
+	resp := DrainResponse{
+		SchemaVersion: schemaVersion,
+		Force:         force,
+		RunningJobs:   int(activeJobs.Load()),
+		QueuedJobs:    queued,
+	}
+	if force && shutdownCtx.Err() == nil {
+		resp.Cancelled = resp.RunningJobs + resp.QueuedJobs
+		shutdownCancel()
+	}
+	fmt.Printf("Drain requested (force=%t): %d running, %d queued, %d cancelled\n", force, resp.RunningJobs, resp.QueuedJobs, resp.Cancelled)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postDrain(t *testing.T, query string) (int, DrainResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleDrain(rec, httptest.NewRequest(http.MethodPost, "/drain"+query, nil))
+	var resp DrainResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp
+}
+
+func TestDrain(t *testing.T) {
+	defer drainRequested.Store(false)
+
+	acquireJobSlot()
+	code, resp := postDrain(t, "")
+	releaseJobSlot()
+	if code != http.StatusOK || resp.Force || resp.RunningJobs != 1 || resp.Cancelled != 0 {
+		t.Fatalf("drain = %d %+v", code, resp)
+	}
+	if shutdownCtx.Err() != nil {
+		t.Fatal("a plain drain must not cancel running jobs")
+	}
+
+	rec := httptest.NewRecorder()
+	handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(`{"segments":["x"],"output_url":"y"}`)))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("/concat while draining = %d, want 503 with Retry-After", rec.Code)
+	}
+	if readinessChecks()["not_draining"] {
+		t.Error("readiness should report draining")
+	}
+}
+
+func TestDrainForce(t *testing.T) {
+	defer func() { shutdownCtx, shutdownCancel = context.WithCancel(context.Background()) }()
+	defer drainRequested.Store(false)
+
+	acquireJobSlot()
+	defer releaseJobSlot()
+	jobCtx, cancel := context.WithCancel(shutdownCtx)
+	defer cancel()
+
+	code, resp := postDrain(t, "?force=true")
+	if code != http.StatusOK || !resp.Force || resp.Cancelled != 1 {
+		t.Fatalf("forced drain = %d %+v", code, resp)
+	}
+	if jobCtx.Err() == nil {
+		t.Error("forced drain should cancel job contexts")
+	}
+
+	// Nothing is left to cancel the second time
+	if _, resp := postDrain(t, "?force=true"); resp.Cancelled != 0 {
+		t.Errorf("repeated forced drain cancelled %d", resp.Cancelled)
+	}
+}
+
+func TestDrainBadRequests(t *testing.T) {
+	defer drainRequested.Store(false)
+	if code, _ := postDrain(t, "?force=maybe"); code != http.StatusBadRequest {
+		t.Errorf("bad force = %d, want 400", code)
+	}
+	rec := httptest.NewRecorder()
+	handleDrain(rec, httptest.NewRequest(http.MethodGet, "/drain", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /drain = %d, want 405", rec.Code)
+	}
+	if !acceptingJobs() {
+		t.Error("rejected requests must not start a drain")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+// ---------- Empty Output ----------
+//
+// A single zero-length segment, or segments that add up to nothing, encode
+// without complaint into a file with tags and no audio, and the job used to
+// report success and upload it. Once the output has been probed, a result
+// shorter than emptyOutputSeconds fails with 422 empty_output before
+// anything is uploaded. allow_empty opts out for callers that really want
+// the file; they get a warning instead. When the duration couldn't be
+// measured at all (ffprobe failed, or no usable FFmpeg log), the check is
+// skipped rather than guessing.
+
+// emptyOutputSeconds is the shortest output counted as having audio: less
+// than a handful of MP3 frames, well under anything audible
+const emptyOutputSeconds = 0.1
+
+// checkEmptyOutput returns an error for a measured duration too short to
+// publish; known is false when the duration couldn't be measured
+func checkEmptyOutput(duration float64, known bool) error {
+	if !known || duration >= emptyOutputSeconds {
+		return nil
+	}
+	return fmt.Errorf("output is empty: probed duration %.3fs is under %.1fs", duration, emptyOutputSeconds)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckEmptyOutput(t *testing.T) {
+	cases := []struct {
+		duration float64
+		known    bool
+		wantErr  bool
+	}{
+		{0, true, true},
+		{0.05, true, true},
+		{0.1, true, false},
+		{1800, true, false},
+		{0, false, false}, // Unmeasured: don't guess
+	}
+	for _, c := range cases {
+		if err := checkEmptyOutput(c.duration, c.known); (err != nil) != c.wantErr {
+			t.Errorf("checkEmptyOutput(%v, %t) = %v, want error %t", c.duration, c.known, err, c.wantErr)
+		}
+	}
+}
+
+// TestEmptyOutputSilentInput encodes a near-zero silent input the way a job
+// would and checks its probed duration is caught; it is skipped without
+// FFmpeg
+func TestEmptyOutputSilentInput(t *testing.T) {
+	requireFFmpegTools(t)
+	dir := t.TempDir()
+	in := filepath.Join(dir, "blip.wav")
+	if output, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "0.01", "-y", in).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, output)
+	}
+	out := filepath.Join(dir, "output.mp3")
+	if output, err := exec.Command("ffmpeg", "-v", "error", "-i", in, "-c:a", "libmp3lame", "-b:a", "128k", "-y", out).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, output)
+	}
+
+	duration, err := getDuration(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEmptyOutput(duration, true); err == nil {
+		t.Errorf("probed duration %.3fs passed the empty output check", duration)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ---------- Encoder Settings ----------
+
+const (
+	bitrateCBR = "cbr"
+	bitrateVBR = "vbr"
+
+	defaultBitrateKbps = 128
+	defaultVBRQuality  = 4 // LAME's own default, roughly 165 kbps for stereo
+
+	minBitrateKbps = 32
+	maxBitrateKbps = 320
+)
+
+// validateBitrate checks the bitrate mode and fills the default for it.
+// CBR takes bitrate_kbps and VBR takes vbr_quality; supplying the other
+// mode's setting is an error rather than being silently ignored.
+func validateBitrate(req *ConcatRequest) error {
+	switch req.BitrateMode {
+	case "", bitrateCBR:
+		req.BitrateMode = bitrateCBR
+		if req.VBRQuality != nil {
+			return errors.New("vbr_quality requires bitrate_mode \"vbr\"")
+		}
+		// auto_bitrate leaves it unset until the inputs are measured
+		if req.BitrateKbps == 0 && !req.AutoBitrate {
+			req.BitrateKbps = defaultBitrateKbps
+		}
+		if req.BitrateKbps != 0 && (req.BitrateKbps < minBitrateKbps || req.BitrateKbps > maxBitrateKbps) {
+			return fmt.Errorf("bitrate_kbps must be between %d and %d", minBitrateKbps, maxBitrateKbps)
+		}
+	case bitrateVBR:
+		if req.BitrateKbps != 0 {
+			return errors.New("bitrate_kbps cannot be combined with bitrate_mode \"vbr\"; use vbr_quality")
+		}
+		if req.VBRQuality == nil {
+			q := defaultVBRQuality
+			req.VBRQuality = &q
+		}
+		if *req.VBRQuality < 0 || *req.VBRQuality > 9 {
+			return errors.New("vbr_quality must be between 0 and 9")
+		}
+	default:
+		return fmt.Errorf("bitrate_mode must be %q or %q", bitrateCBR, bitrateVBR)
+	}
+	return nil
+}
+
+// encoderSampleFormats lists the -sample_fmt values each encoder accepts.
+// libmp3lame only takes planar formats.
+var encoderSampleFormats = map[string][]string{
+	"libmp3lame": {"s16p", "s32p", "fltp"},
+}
+
+// validateSampleFormat checks sample_fmt against the encoder's formats;
+// empty leaves FFmpeg's choice intact
+func validateSampleFormat(req *ConcatRequest) error {
+	if req.SampleFormat == "" {
+		return nil
+	}
+	supported := encoderSampleFormats["libmp3lame"]
+	for _, f := range supported {
+		if req.SampleFormat == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("sample_format must be one of %s for libmp3lame", strings.Join(supported, ", "))
+}
+
+// channelLayoutCounts maps each accepted channel_layout to its -ac count
+var channelLayoutCounts = map[string]int{
+	"mono":   1,
+	"stereo": 2,
+	"5.1":    6,
+}
+
+// codecChannelLayouts lists the layouts each output encoder can write.
+// MP3 has no multichannel mode beyond stereo; AAC (HLS output) does.
+var codecChannelLayouts = map[string][]string{
+	"libmp3lame": {"mono", "stereo"},
+	"aac":        {"mono", "stereo", "5.1"},
+}
+
+// validateChannelLayout checks channel_layout against the output encoder;
+// empty keeps the input layout
+func validateChannelLayout(req *ConcatRequest, hls bool) error {
+	if req.ChannelLayout == "" {
+		return nil
+	}
+	if _, ok := channelLayoutCounts[req.ChannelLayout]; !ok {
+		return errors.New(`channel_layout must be "mono", "stereo", or "5.1"`)
+	}
+	encoder, format := "libmp3lame", "MP3"
+	if hls {
+		encoder, format = "aac", "HLS (AAC)"
+	}
+	for _, layout := range codecChannelLayouts[encoder] {
+		if req.ChannelLayout == layout {
+			return nil
+		}
+	}
+	return fmt.Errorf("channel_layout %q is not supported by %s output; use one of %s",
+		req.ChannelLayout, format, strings.Join(codecChannelLayouts[encoder], ", "))
+}
+
+// channelArgs returns -ac for a validated layout, or nothing to keep the
+// input layout. FFmpeg picks the standard layout for the channel count and
+// remixes to it after the filter chain.
+func channelArgs(layout string) []string {
+	if layout == "" {
+		return nil
+	}
+	return []string{"-ac", strconv.Itoa(channelLayoutCounts[layout])}
+}
+
+// encoderArgs returns the codec, rate control, and sample rate arguments
+func encoderArgs(req ConcatRequest) []string {
+	args := []string{"-c:a", "libmp3lame"}
+	if req.BitrateMode == bitrateVBR && req.VBRQuality != nil {
+		args = append(args, "-q:a", strconv.Itoa(*req.VBRQuality))
+	} else {
+		kbps := req.BitrateKbps
+		if kbps == 0 {
+			kbps = defaultBitrateKbps
+		}
+		args = append(args, "-b:a", strconv.Itoa(kbps)+"k")
+	}
+	args = append(args, "-ar", "44100")
+	args = append(args, channelArgs(req.ChannelLayout)...)
+	if req.SampleFormat != "" {
+		args = append(args, "-sample_fmt", req.SampleFormat)
+	}
+	return args
+}
+
+// defaultID3Version matches the mp3 muxer's own default
+const defaultID3Version = 4
+
+// id3Args selects the ID3v2 version written by the mp3 muxer. The segment
+// muxer doesn't accept mp3 options directly, so split output passes it
+// through -segment_format_options instead.
+func id3Args(version int, split bool) []string {
+	if version == 0 {
+		version = defaultID3Version
+	}
+	if split {
+		return []string{"-segment_format_options", "id3v2_version=" + strconv.Itoa(version)}
+	}
+	return []string{"-id3v2_version", strconv.Itoa(version)}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestEncoderArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		req  ConcatRequest
+		want []string
+	}{
+		{"default", ConcatRequest{}, []string{"-c:a", "libmp3lame", "-b:a", "128k", "-ar", "44100"}},
+		{"cbr", ConcatRequest{BitrateMode: bitrateCBR, BitrateKbps: 64}, []string{"-c:a", "libmp3lame", "-b:a", "64k", "-ar", "44100"}},
+		{"vbr", ConcatRequest{BitrateMode: bitrateVBR, VBRQuality: intPtr(0)}, []string{"-c:a", "libmp3lame", "-q:a", "0", "-ar", "44100"}},
+		{"sample format", ConcatRequest{SampleFormat: "s16p"}, []string{"-c:a", "libmp3lame", "-b:a", "128k", "-ar", "44100", "-sample_fmt", "s16p"}},
+		{"mono", ConcatRequest{ChannelLayout: "mono"}, []string{"-c:a", "libmp3lame", "-b:a", "128k", "-ar", "44100", "-ac", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encoderArgs(tt.req); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encoderArgs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChannelLayout(t *testing.T) {
+	tmpl := "https://cdn.example/ep1/{file}"
+	tests := []struct {
+		name    string
+		req     ConcatRequest
+		wantErr string
+	}{
+		{"default keeps input", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b"}, ""},
+		{"mp3 mono", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", ChannelLayout: "mono"}, ""},
+		{"mp3 stereo", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", ChannelLayout: "stereo"}, ""},
+		{"mp3 5.1", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", ChannelLayout: "5.1"},
+			`channel_layout "5.1" is not supported by MP3 output; use one of mono, stereo`},
+		{"hls 5.1", ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: tmpl, ChannelLayout: "5.1"}, ""},
+		{"unknown", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", ChannelLayout: "quad"},
+			`channel_layout must be "mono", "stereo", or "5.1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			err := validateRequest(&req)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBitrate(t *testing.T) {
+	req := &ConcatRequest{BitrateMode: bitrateVBR}
+	if err := validateBitrate(req); err != nil || req.VBRQuality == nil || *req.VBRQuality != defaultVBRQuality {
+		t.Errorf("vbr default: err = %v, quality = %v", err, req.VBRQuality)
+	}
+
+	invalid := map[string]*ConcatRequest{
+		"unknown mode":     {BitrateMode: "abr"},
+		"cbr with quality": {VBRQuality: intPtr(2)},
+		"vbr with bitrate": {BitrateMode: bitrateVBR, BitrateKbps: 192},
+		"quality too high": {BitrateMode: bitrateVBR, VBRQuality: intPtr(10)},
+		"bitrate too high": {BitrateKbps: 640},
+		"bitrate too low":  {BitrateKbps: 8},
+		"negative quality": {BitrateMode: bitrateVBR, VBRQuality: intPtr(-1)},
+	}
+	for name, req := range invalid {
+		if err := validateBitrate(req); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestID3Args(t *testing.T) {
+	if got, want := id3Args(3, false), []string{"-id3v2_version", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("id3Args(3) = %v, want %v", got, want)
+	}
+	if got, want := id3Args(0, false), []string{"-id3v2_version", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("id3Args(default) = %v, want %v", got, want)
+	}
+	if got, want := id3Args(3, true), []string{"-segment_format_options", "id3v2_version=3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("id3Args(3, split) = %v, want %v", got, want)
+	}
+
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", ID3Version: 2}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected error for id3_version 2")
+	}
+}
+
+func TestValidateSampleFormat(t *testing.T) {
+	for _, format := range []string{"", "s16p", "s32p", "fltp"} {
+		if err := validateSampleFormat(&ConcatRequest{SampleFormat: format}); err != nil {
+			t.Errorf("%q: %v", format, err)
+		}
+	}
+	// Packed formats aren't accepted by libmp3lame
+	for _, format := range []string{"s16", "flt", "u8", "bogus"} {
+		if err := validateSampleFormat(&ConcatRequest{SampleFormat: format}); err == nil {
+			t.Errorf("%q: expected error", format)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "sync"
+
+// ---------- Per-Episode Limit ----------
+//
+// Two clients racing to submit the same episode would each download,
+// encode, and upload it, and the later upload silently replaces the
+// earlier one. Idempotency keys only help when both requests carry the
+// same key. MAX_JOBS_PER_EPISODE caps how many /concat requests sharing an
+// episode_id may be queued or running at once; the next one gets 409
+// conflict right away instead of waiting. Requests without an episode_id
+// aren't limited.
+
+var (
+	episodeJobs   = map[string]int{}
+	episodeJobsMu sync.Mutex
+)
+
+// acquireEpisode claims a slot for id. It reports false when the episode is
+// already at MAX_JOBS_PER_EPISODE; otherwise the returned func releases the
+// slot and must be called once the job finishes.
+func acquireEpisode(id string) (func(), bool) {
+	limit := config.MaxJobsPerEpisode
+	if id == "" || limit <= 0 {
+		return func() {}, true
+	}
+
+	episodeJobsMu.Lock()
+	defer episodeJobsMu.Unlock()
+	if episodeJobs[id] >= limit {
+		return nil, false
+	}
+	episodeJobs[id]++
+	return func() {
+		episodeJobsMu.Lock()
+		defer episodeJobsMu.Unlock()
+		// Drop the entry at zero so finished episodes don't accumulate
+		if episodeJobs[id]--; episodeJobs[id] <= 0 {
+			delete(episodeJobs, id)
+		}
+	}, true
+}
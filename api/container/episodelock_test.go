@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcquireEpisode(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxJobsPerEpisode = 1
+
+	release, ok := acquireEpisode("ep-1")
+	if !ok {
+		t.Fatal("first job refused")
+	}
+	if _, ok := acquireEpisode("ep-1"); ok {
+		t.Error("second job for the same episode accepted")
+	}
+	if releaseOther, ok := acquireEpisode("ep-2"); !ok {
+		t.Error("other episode refused")
+	} else {
+		releaseOther()
+	}
+	if _, ok := acquireEpisode(""); !ok {
+		t.Error("job without an episode_id refused")
+	}
+
+	release()
+	if _, ok := episodeJobs["ep-1"]; ok {
+		t.Error("entry not cleaned up after release")
+	}
+	release, ok = acquireEpisode("ep-1")
+	if !ok {
+		t.Fatal("episode still locked after release")
+	}
+	release()
+
+	config.MaxJobsPerEpisode = 0
+	for i := 0; i < 3; i++ {
+		if _, ok := acquireEpisode("ep-1"); !ok {
+			t.Fatal("limit 0 should not cap jobs")
+		}
+	}
+}
+
+func TestHandleConcatDuplicateEpisode(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxJobsPerEpisode = 1
+
+	release, _ := acquireEpisode("ep-dup")
+	defer release()
+
+	body := `{"episode_id":"ep-dup","segments":["https://cdn.example.com/a.mp3"],"output_url":"https://storage.example.com/out.mp3"}`
+	rec := httptest.NewRecorder()
+	handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(body)))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), string(codeConflict)) {
+		t.Errorf("code = %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"syscall"
+)
+
+// ---------- Error Codes ----------
+//
+// Every failed response carries a stable error_code alongside the
+// human-readable error, so clients can branch without parsing messages.
+// Codes are part of the API: add new ones, but never rename or reuse them.
+
+// ErrorCode classifies a failed request
+type ErrorCode string
+
+const (
+	codeInvalidRequest        ErrorCode = "invalid_request"         // Malformed body, bad options, bad manifest or trim
+	codeUnauthorized          ErrorCode = "unauthorized"            // Missing or invalid HMAC signature
+	codeMethodNotAllowed      ErrorCode = "method_not_allowed"      // Wrong HTTP method
+	codeNotFound              ErrorCode = "not_found"               // No such job
+	codeConflict              ErrorCode = "conflict"                // Duplicate in-flight request or invalid state change
+	codeBusy                  ErrorCode = "busy"                    // MAX_CONCURRENT_JOBS reached
+	codeUnavailable           ErrorCode = "unavailable"             // Server is shutting down
+	codeSegmentDownloadFailed ErrorCode = "segment_download_failed" // A segment (or append_to_url) couldn't be fetched
+	codeFFmpegFailed          ErrorCode = "ffmpeg_failed"           // Encode failed or produced unusable output
+	codeFFmpegOOM             ErrorCode = "ffmpeg_oom"              // FFmpeg was SIGKILLed, almost always by the OOM killer
+	codeDiskFull              ErrorCode = "disk_full"               // The work dir volume ran out of space
+	codeCPUBudgetExceeded     ErrorCode = "cpu_budget_exceeded"     // Encode used more than MAX_CPU_SECONDS
+	codeEmptyOutput           ErrorCode = "empty_output"            // Output has no audio and allow_empty wasn't set
+	codeUploadFailed          ErrorCode = "upload_failed"           // Result couldn't be uploaded
+	codeTimeout               ErrorCode = "timeout"                 // Job exceeded its deadline
+	codeCancelled             ErrorCode = "cancelled"               // Job stopped by shutdown
+	codeInternal              ErrorCode = "internal_error"          // Local failure in the container
+)
+
+// contextFailure explains why a job's context ended. Shutdown wins when
+// both happened, since shutdownCtx is the parent: the job is safe to retry
+// elsewhere (503, cancelled). The job's own deadline firing means the work
+// itself ran too long (504, timeout), and an identical retry likely will too.
+func contextFailure(err error) (ErrorCode, string, int) {
+	if shutdownCtx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return codeTimeout, fmt.Sprintf("job exceeded its %v deadline", jobTimeout), http.StatusGatewayTimeout
+	}
+	return codeCancelled, "server is shutting down", http.StatusServiceUnavailable
+}
+
+// ffmpegFailure classifies a failed FFmpeg run from its process state
+// rather than the error text. Call it only when the job context is still
+// live: cancellation kills FFmpeg with SIGKILL too. A SIGKILL nobody in the
+// container sent is the kernel OOM killer in practice.
+func ffmpegFailure(err error) (ErrorCode, string) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			if status.Signal() == syscall.SIGKILL {
+				return codeFFmpegOOM, "FFmpeg was killed (SIGKILL), most likely out of memory; " +
+					"raise the container memory limit, lower MAX_CONCURRENT_JOBS, or split very long episodes"
+			}
+			return codeFFmpegFailed, fmt.Sprintf("FFmpeg was terminated by signal %v", status.Signal())
+		}
+	}
+	return codeFFmpegFailed, err.Error()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestContextFailure(t *testing.T) {
+	code, _, status := contextFailure(context.DeadlineExceeded)
+	if code != codeTimeout || status != http.StatusGatewayTimeout {
+		t.Errorf("deadline = %q/%d, want %q/%d", code, status, codeTimeout, http.StatusGatewayTimeout)
+	}
+	if code, _, _ := contextFailure(fmt.Errorf("wrapped: %w", context.DeadlineExceeded)); code != codeTimeout {
+		t.Errorf("wrapped deadline = %q, want %q", code, codeTimeout)
+	}
+
+	shutdownCancel()
+	defer func() { shutdownCtx, shutdownCancel = context.WithCancel(context.Background()) }()
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded} {
+		code, _, status := contextFailure(err)
+		if code != codeCancelled || status != http.StatusServiceUnavailable {
+			t.Errorf("shutdown with %v = %q/%d, want %q/%d", err, code, status, codeCancelled, http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func TestHandleConcatErrorCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   ErrorCode
+	}{
+		{"wrong method", http.MethodGet, "", codeMethodNotAllowed},
+		{"malformed body", http.MethodPost, "{", codeInvalidRequest},
+		{"no segments", http.MethodPost, `{"output_url": "b"}`, codeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleConcat(rec, httptest.NewRequest(tt.method, "/concat", strings.NewReader(tt.body)))
+
+			var resp ConcatResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ErrorCode != tt.want {
+				t.Errorf("error_code = %q, want %q (%s)", resp.ErrorCode, tt.want, resp.Error)
+			}
+		})
+	}
+}
+
+func TestFFmpegFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   ErrorCode
+		reason string
+	}{
+		{"oom kill", "kill -KILL $$", codeFFmpegOOM, "out of memory"},
+		{"other signal", "kill -TERM $$", codeFFmpegFailed, "signal"},
+		{"exit status", "exit 1", codeFFmpegFailed, "exit status 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exec.Command("sh", "-c", tt.script).Run()
+			if err == nil {
+				t.Fatal("expected the command to fail")
+			}
+			code, reason := ffmpegFailure(err)
+			if code != tt.want || !strings.Contains(reason, tt.reason) {
+				t.Errorf("ffmpegFailure = %q, %q; want %q containing %q", code, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
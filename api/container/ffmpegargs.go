@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// ---------- FFmpeg Arguments ----------
+//
+// The main encode's command line is assembled from the request and the
+// job's file layout alone, with no I/O, so /plan can show exactly what a
+// job would run. What the job only learns from the downloaded inputs (the
+// final input list, whether auto switched methods or copies) is passed in
+// through ffmpegPaths. Combinations FFmpeg can't run, which would
+// otherwise only fail as a cryptic encode error, are returned as errors.
+
+// ffmpegPaths describes the files the encode reads and writes, and the
+// decisions made about them once they were on disk
+type ffmpegPaths struct {
+	files      jobFiles
+	inputs     []concatInput // Absolute paths, in join order
+	method     string        // Resolved: demuxer, filter or single
+	streamCopy bool
+	safe       bool // CONCAT_SAFE_MODE: FFmpeg runs in the work dir and sees relative names
+}
+
+// listFile returns where the concat demuxer list is written
+func (p ffmpegPaths) listFile() string {
+	return p.files.path("list.txt")
+}
+
+// listInputs returns how FFmpeg names the list file and the inputs in it
+func (p ffmpegPaths) listInputs() (string, []concatInput) {
+	if p.safe {
+		return filepath.Base(p.listFile()), relativeInputs(p.inputs)
+	}
+	return p.listFile(), p.inputs
+}
+
+// outputPath returns the single-file output; split and HLS outputs are
+// named by their muxers
+func (p ffmpegPaths) outputPath() string {
+	return p.files.path("output.mp3")
+}
+
+// hlsDir returns the directory HLS segments and the playlist go in. HLS
+// names end up in URLs, so they stay plain inside a per-job directory
+// instead of carrying the prefix.
+func (p ffmpegPaths) hlsDir() string {
+	return p.files.path("hls")
+}
+
+// buildFFmpegArgs returns the arguments of the main encode
+func buildFFmpegArgs(req ConcatRequest, paths ffmpegPaths) ([]string, error) {
+	hls := req.OutputFormat == outputFormatHLS
+	split := req.SplitDurationSeconds > 0
+	if err := checkFFmpegPaths(paths, hls); err != nil {
+		return nil, err
+	}
+
+	audioFilter := audioFilterChain(req)
+	if paths.streamCopy {
+		audioFilter = ""
+	}
+	listArg, listInputs := paths.listInputs()
+	args := concatInputArgs(paths.method, listArg, listInputs, audioFilter, paths.safe)
+	switch {
+	case paths.streamCopy:
+		args = append(args, streamCopyArgs()...)
+	case !hls:
+		args = append(args, encoderArgs(req)...)
+	}
+
+	// Add metadata if provided, or strip every tag
+	tagArgs := id3Args(req.ID3Version, split)
+	if req.StripMetadata {
+		args = append(args, stripMetadataArgs()...)
+		tagArgs = stripID3Args(split)
+	} else {
+		args = append(args, metadataArgs(req.Metadata)...)
+	}
+	if req.Deterministic {
+		args = append(args, deterministicArgs()...)
+	}
+
+	switch {
+	case hls:
+		args = append(args, hlsOutputArgs(req, paths.hlsDir())...)
+	case split:
+		args = append(args, tagArgs...)
+		args = append(args, splitOutputArgs(req.SplitDurationSeconds, paths.files)...)
+	default:
+		// Encode to output.mp3.part and rename after a clean exit, so a
+		// killed or crashed FFmpeg can't leave a truncated output.mp3
+		args = append(args, tagArgs...)
+		if req.StreamUpload {
+			args = append(args, streamUploadArgs()...)
+		}
+		args = append(args, partialOutputArgs(paths.outputPath())...)
+	}
+
+	return append(debugLogArgs(req.Debug), args...), nil
+}
+
+// checkFFmpegPaths rejects input lists and decisions the encode can't run
+func checkFFmpegPaths(paths ffmpegPaths, hls bool) error {
+	if len(paths.inputs) == 0 {
+		return errors.New("no inputs to join")
+	}
+	switch paths.method {
+	case concatDemuxer, concatFilter:
+	case concatSingle:
+		if len(paths.inputs) != 1 {
+			return fmt.Errorf("concat method %q needs exactly one input, got %d", concatSingle, len(paths.inputs))
+		}
+	default:
+		return fmt.Errorf("unknown concat method %q", paths.method)
+	}
+	if paths.streamCopy {
+		// A copy can't decode through the filter graph or re-encode to AAC
+		switch {
+		case paths.method == concatFilter:
+			return errors.New("stream copy can't join through the concat filter")
+		case hls:
+			return errors.New("stream copy can't produce HLS output")
+		}
+	}
+	return checkInputPaths(paths.inputs)
+}
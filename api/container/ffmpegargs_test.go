@@ -0,0 +1,222 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Fixtures for the argument tables: a two-segment job in /work
+const (
+	argsIn0      = "/work/job_segment_0000.mp3"
+	argsIn1      = "/work/job_segment_0001.mp3"
+	argsLoudnorm = "loudnorm=I=-16:TP=-1.5:LRA=11"
+)
+
+// argsJoin concatenates argument groups, keeping the tables readable
+func argsJoin(groups ...[]string) []string {
+	var args []string
+	for _, g := range groups {
+		args = append(args, g...)
+	}
+	return args
+}
+
+func TestBuildFFmpegArgs(t *testing.T) {
+	files := jobFiles{dir: "/work", prefix: "job_"}
+	two := []concatInput{{Path: argsIn0}, {Path: argsIn1}}
+	demuxer := ffmpegPaths{files: files, inputs: two, method: concatDemuxer}
+
+	demuxerIn := []string{"-f", "concat", "-safe", "0", "-i", "/work/job_list.txt"}
+	mp3 := []string{"-c:a", "libmp3lame", "-b:a", "128k", "-ar", "44100"}
+	id3 := []string{"-id3v2_version", "4"}
+	out := []string{"-f", "mp3", "-y", "/work/job_output.mp3.part"}
+	vbrQuality := 2
+	explicit := true
+
+	cases := []struct {
+		name  string
+		req   ConcatRequest
+		paths ffmpegPaths
+		want  []string
+	}{
+		{
+			name:  "defaults",
+			paths: demuxer,
+			want:  argsJoin(demuxerIn, []string{"-af", argsLoudnorm}, mp3, id3, out),
+		},
+		{
+			name:  "bitrate",
+			req:   ConcatRequest{BitrateKbps: 192},
+			paths: demuxer,
+			want:  argsJoin(demuxerIn, []string{"-af", argsLoudnorm, "-c:a", "libmp3lame", "-b:a", "192k", "-ar", "44100"}, id3, out),
+		},
+		{
+			name:  "vbr",
+			req:   ConcatRequest{BitrateMode: bitrateVBR, VBRQuality: &vbrQuality},
+			paths: demuxer,
+			want:  argsJoin(demuxerIn, []string{"-af", argsLoudnorm, "-c:a", "libmp3lame", "-q:a", "2", "-ar", "44100"}, id3, out),
+		},
+		{
+			name:  "channel layout and sample format",
+			req:   ConcatRequest{ChannelLayout: "mono", SampleFormat: "s16p"},
+			paths: demuxer,
+			want:  argsJoin(demuxerIn, []string{"-af", argsLoudnorm}, mp3, []string{"-ac", "1", "-sample_fmt", "s16p"}, id3, out),
+		},
+		{
+			// Gate and EQ see the source, timing changes precede gain, and
+			// loudnorm measures everything but the custom stage
+			name: "filter order",
+			req: ConcatRequest{
+				NoiseGate:         &NoiseGate{ThresholdDB: -45, AttackMs: 10, ReleaseMs: 150},
+				EQBands:           []EQBand{{FrequencyHz: 100, WidthQ: 1, GainDB: -3}},
+				SpeedFactor:       1.5,
+				GainDB:            2,
+				CustomAudioFilter: "aecho=0.8:0.9:40:0.3",
+				CustomFilterMode:  customFilterAppend,
+			},
+			paths: demuxer,
+			want: argsJoin(demuxerIn, []string{"-af", "agate=threshold=-45dB:attack=10:release=150,equalizer=f=100:t=q:w=1:g=-3,atempo=1.5,volume=2dB," +
+				argsLoudnorm + ",aecho=0.8:0.9:40:0.3"}, mp3, id3, out),
+		},
+		{
+			name:  "custom filter replaces loudnorm",
+			req:   ConcatRequest{CustomAudioFilter: "dynaudnorm", CustomFilterMode: customFilterReplace},
+			paths: demuxer,
+			want:  argsJoin(demuxerIn, []string{"-af", "dynaudnorm"}, mp3, id3, out),
+		},
+		{
+			name: "concat filter with trims and gain",
+			paths: ffmpegPaths{files: files, method: concatFilter, inputs: []concatInput{
+				{Path: argsIn0, Start: 1.5, End: 10, GainDB: 2},
+				{Path: argsIn1},
+			}},
+			want: argsJoin([]string{
+				"-ss", "1.5", "-to", "10", "-i", argsIn0, "-i", argsIn1,
+				"-filter_complex", "[0:a]volume=2dB[g0];[g0][1:a]concat=n=2:v=0:a=1," + argsLoudnorm + "[out]",
+				"-map", "[out]",
+			}, mp3, id3, out),
+		},
+		{
+			name:  "single input",
+			paths: ffmpegPaths{files: files, method: concatSingle, inputs: []concatInput{{Path: argsIn0, GainDB: -6}}},
+			want:  argsJoin([]string{"-i", argsIn0, "-af", "volume=-6dB," + argsLoudnorm}, mp3, id3, out),
+		},
+		{
+			name:  "stream copy skips filters and the encoder",
+			req:   ConcatRequest{GainDB: 3},
+			paths: ffmpegPaths{files: files, inputs: two, method: concatDemuxer, streamCopy: true},
+			want:  argsJoin(demuxerIn, []string{"-c:a", "copy"}, id3, out),
+		},
+		{
+			name:  "safe mode",
+			paths: ffmpegPaths{files: files, inputs: two, method: concatDemuxer, safe: true},
+			want:  argsJoin([]string{"-f", "concat", "-safe", "1", "-i", "job_list.txt", "-af", argsLoudnorm}, mp3, id3, out),
+		},
+		{
+			name:  "podcast metadata",
+			req:   ConcatRequest{Metadata: ConcatMetadata{Title: "Ep 7", Date: "2024-03-05", Episode: 7, Explicit: &explicit}},
+			paths: demuxer,
+			want: argsJoin(demuxerIn, []string{"-af", argsLoudnorm}, mp3, []string{
+				"-metadata", "title=Ep 7", "-metadata", "date=2024-03-05",
+				"-metadata", "track=7", "-metadata", "ITUNESEPISODE=7", "-metadata", "ITUNESADVISORY=1",
+			}, id3, out),
+		},
+		{
+			name:  "strip metadata",
+			req:   ConcatRequest{StripMetadata: true},
+			paths: demuxer,
+			want:  argsJoin(demuxerIn, []string{"-af", argsLoudnorm}, mp3, []string{"-map_metadata", "-1", "-map_chapters", "-1", "-id3v2_version", "0"}, out),
+		},
+		{
+			// Bit-exact flags follow the tags, and the ID3 version stays last
+			name:  "deterministic",
+			req:   ConcatRequest{Deterministic: true, ID3Version: 3, Metadata: ConcatMetadata{Title: "Ep 7"}},
+			paths: demuxer,
+			want: argsJoin(demuxerIn, []string{"-af", argsLoudnorm}, mp3, []string{
+				"-metadata", "title=Ep 7",
+				"-map_metadata", "-1", "-fflags", "+bitexact", "-flags:a", "+bitexact",
+				"-id3v2_version", "3",
+			}, out),
+		},
+		{
+			name:  "split",
+			req:   ConcatRequest{SplitDurationSeconds: 600, ID3Version: 3},
+			paths: demuxer,
+			want: argsJoin(demuxerIn, []string{"-af", argsLoudnorm}, mp3, []string{
+				"-segment_format_options", "id3v2_version=3",
+				"-f", "segment", "-segment_format", "mp3", "-segment_time", "600", "-reset_timestamps", "1",
+				"-y", "/work/job_part_%03d.mp3",
+			}),
+		},
+		{
+			// The AAC encoder comes with the hls muxer, and no ID3 tag is written
+			name:  "hls",
+			req:   ConcatRequest{OutputFormat: outputFormatHLS, HLSSegmentSeconds: 6, BitrateKbps: 96},
+			paths: demuxer,
+			want: argsJoin(demuxerIn, []string{
+				"-af", argsLoudnorm,
+				"-c:a", "aac", "-b:a", "96k", "-ar", "44100",
+				"-f", "hls", "-hls_time", "6", "-hls_playlist_type", "vod",
+				"-hls_segment_filename", "/work/job_hls/" + hlsSegmentPattern,
+				"-y", "/work/job_hls/" + hlsPlaylistName,
+			}),
+		},
+		{
+			// Global options go first; -write_xing belongs to the mp3 output
+			name:  "debug and stream upload",
+			req:   ConcatRequest{Debug: true, StreamUpload: true},
+			paths: demuxer,
+			want:  argsJoin([]string{"-loglevel", "verbose"}, demuxerIn, []string{"-af", argsLoudnorm}, mp3, id3, []string{"-write_xing", "0"}, out),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := buildFFmpegArgs(c.req, c.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("args:\n got  %s\n want %s", strings.Join(got, " "), strings.Join(c.want, " "))
+			}
+		})
+	}
+}
+
+func TestBuildFFmpegArgsErrors(t *testing.T) {
+	files := jobFiles{dir: "/work", prefix: "job_"}
+	two := []concatInput{{Path: argsIn0}, {Path: argsIn1}}
+
+	cases := []struct {
+		name    string
+		req     ConcatRequest
+		paths   ffmpegPaths
+		wantErr string
+	}{
+		{"no inputs", ConcatRequest{}, ffmpegPaths{files: files, method: concatDemuxer}, "no inputs"},
+		{"unresolved method", ConcatRequest{}, ffmpegPaths{files: files, inputs: two, method: concatAuto}, "unknown concat method"},
+		{"single with two inputs", ConcatRequest{}, ffmpegPaths{files: files, inputs: two, method: concatSingle}, "exactly one input"},
+		{"copy through the filter", ConcatRequest{}, ffmpegPaths{files: files, inputs: two, method: concatFilter, streamCopy: true}, "concat filter"},
+		{"copy to hls", ConcatRequest{OutputFormat: outputFormatHLS}, ffmpegPaths{files: files, inputs: two, method: concatDemuxer, streamCopy: true}, "HLS"},
+		{"relative input", ConcatRequest{}, ffmpegPaths{files: files, inputs: []concatInput{{Path: "segment.mp3"}}, method: concatDemuxer}, "absolute"},
+		{"quote in input", ConcatRequest{}, ffmpegPaths{files: files, inputs: []concatInput{{Path: "/work/it's.mp3"}}, method: concatDemuxer}, "quote"},
+	}
+	for _, c := range cases {
+		if _, err := buildFFmpegArgs(c.req, c.paths); err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.wantErr)
+		}
+	}
+}
+
+// TestBuildFFmpegArgsSafeList checks the list file and entries match the
+// relative names the safe mode command uses
+func TestBuildFFmpegArgsSafeList(t *testing.T) {
+	paths := ffmpegPaths{files: jobFiles{dir: "/work", prefix: "job_"}, inputs: []concatInput{{Path: argsIn0, Start: 2}}, method: concatDemuxer, safe: true}
+	if got := paths.listFile(); got != "/work/job_list.txt" {
+		t.Errorf("list file = %s", got)
+	}
+	listArg, inputs := paths.listInputs()
+	if listArg != "job_list.txt" || concatList(inputs) != "file 'job_segment_0000.mp3'\ninpoint 2\n" {
+		t.Errorf("safe list = %s %q", listArg, concatList(inputs))
+	}
+}
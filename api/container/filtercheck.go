@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ---------- Filter Chain Dry Run ----------
+//
+// A typo in custom_audio_filter, or an option combination FFmpeg rejects,
+// used to surface only after every segment had been downloaded. With
+// validate_filter_chain (implied by custom_audio_filter) the assembled -af
+// chain and encoder options are first run over a tenth of a second of
+// generated silence into the null muxer, which takes milliseconds. A
+// rejection fails the request with 422 before anything is fetched.
+//
+// The dry run can't see what depends on the downloaded audio: auto_mono's
+// downmix is decided later, and input-specific problems still fail the
+// encode itself.
+
+// filterCheckTimeout bounds the dry run; a healthy one takes milliseconds
+var filterCheckTimeout = 10 * time.Second
+
+// wantsFilterCheck reports whether a request gets the dry run
+func wantsFilterCheck(req ConcatRequest) bool {
+	return req.ValidateFilterChain || req.CustomAudioFilter != ""
+}
+
+// filterCheckArgs returns the FFmpeg arguments for a dry run of the chain
+// and encoder options hls or MP3 output would use
+func filterCheckArgs(req ConcatRequest, hls bool) []string {
+	args := []string{
+		"-v", "error", "-nostdin",
+		"-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo",
+		"-t", "0.1",
+		"-af", audioFilterChain(req),
+	}
+	if hls {
+		args = append(args, hlsEncoderArgs(req)...)
+	} else {
+		args = append(args, encoderArgs(req)...)
+	}
+	return append(args, "-f", "null", "-")
+}
+
+// checkFilterChain runs the dry run and returns FFmpeg's complaint, if any
+func checkFilterChain(ctx context.Context, req ConcatRequest, hls bool) error {
+	ctx, cancel := context.WithTimeout(ctx, filterCheckTimeout)
+	defer cancel()
+	cmd := ffmpegCommand(ctx, filterCheckArgs(req, hls)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("dry run did not finish: %w", ctx.Err())
+		}
+		return fmt.Errorf("FFmpeg rejected the filter chain %q: %s", audioFilterChain(req), strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
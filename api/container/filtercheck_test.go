@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWantsFilterCheck(t *testing.T) {
+	if wantsFilterCheck(ConcatRequest{}) {
+		t.Error("plain request should skip the dry run")
+	}
+	if !wantsFilterCheck(ConcatRequest{ValidateFilterChain: true}) {
+		t.Error("validate_filter_chain should request the dry run")
+	}
+	if !wantsFilterCheck(ConcatRequest{CustomAudioFilter: "highpass=f=80"}) {
+		t.Error("custom_audio_filter should imply the dry run")
+	}
+}
+
+func TestFilterCheckArgs(t *testing.T) {
+	req := ConcatRequest{SpeedFactor: 1.0, GainDB: 3, ChannelLayout: "mono"}
+	args := filterCheckArgs(req, false)
+	want := append([]string{
+		"-v", "error", "-nostdin",
+		"-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo",
+		"-t", "0.1",
+		"-af", audioFilterChain(req),
+	}, encoderArgs(req)...)
+	want = append(want, "-f", "null", "-")
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("filterCheckArgs = %v, want %v", args, want)
+	}
+
+	hlsArgs := strings.Join(filterCheckArgs(ConcatRequest{BitrateKbps: 96}, true), " ")
+	if !strings.Contains(hlsArgs, "-c:a aac -b:a 96k") || !strings.HasSuffix(hlsArgs, "-f null -") {
+		t.Errorf("hls filterCheckArgs = %s", hlsArgs)
+	}
+}
+
+// TestCheckFilterChain runs real dry runs; it is skipped without FFmpeg
+func TestCheckFilterChain(t *testing.T) {
+	requireFFmpegTools(t)
+	if err := checkFilterChain(context.Background(), ConcatRequest{SpeedFactor: 1.0}, false); err != nil {
+		t.Errorf("default chain: %v", err)
+	}
+	bad := ConcatRequest{SpeedFactor: 1.0, CustomAudioFilter: "highpass=f=eighty"}
+	if err := checkFilterChain(context.Background(), bad, false); err == nil || !strings.Contains(err.Error(), "highpass") {
+		t.Errorf("bad chain: err = %v", err)
+	}
+}
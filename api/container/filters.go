@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ---------- Audio Filter Chain ----------
+
+// Accepted SpeedFactor range; values outside a single atempo's 0.5–2.0 are chained
+const (
+	minSpeedFactor = 0.25
+	maxSpeedFactor = 4.0
+)
+
+// Accepted GainDB range
+const (
+	minGainDB = -30
+	maxGainDB = 30
+)
+
+// audioFilterChain assembles the -af value for a request. Stages that change
+// timing run first so loudnorm always measures the final audio. A custom
+// filter runs last, after or in place of loudnorm.
+func audioFilterChain(req ConcatRequest) string {
+	var stages []string
+	if req.monoDownmix {
+		stages = append(stages, monoDownmixFilter)
+	}
+	if req.NoiseGate != nil {
+		stages = append(stages, req.NoiseGate.filter())
+	}
+	for _, band := range req.EQBands {
+		stages = append(stages, band.filter())
+	}
+	stages = append(stages, atempoFilters(req.SpeedFactor)...)
+	if req.GainDB != 0 {
+		stages = append(stages, "volume="+formatFloat(req.GainDB)+"dB")
+	}
+	if req.CustomAudioFilter == "" || req.CustomFilterMode != customFilterReplace {
+		stages = append(stages, resolveLoudness(req).filter())
+	}
+	if req.CustomAudioFilter != "" {
+		stages = append(stages, req.CustomAudioFilter)
+	}
+	return strings.Join(stages, ",")
+}
+
+// reappliedFilterOptions lists the options set on req whose filters change
+// the audio cumulatively. loudnorm is left out: normalizing an already
+// normalized file lands at the same target.
+func reappliedFilterOptions(req ConcatRequest) []string {
+	var options []string
+	if req.SpeedFactor != 0 && req.SpeedFactor != 1.0 {
+		options = append(options, "speed_factor")
+	}
+	if req.GainDB != 0 {
+		options = append(options, "gain_db")
+	}
+	if len(req.EQBands) > 0 {
+		options = append(options, "eq_bands")
+	}
+	if req.NoiseGate != nil {
+		options = append(options, "noise_gate")
+	}
+	if req.CustomAudioFilter != "" {
+		options = append(options, "custom_audio_filter")
+	}
+	return options
+}
+
+// atempoFilters returns the atempo stages for factor. A single atempo only
+// accepts 0.5–2.0 on older FFmpeg builds, so larger changes are split into a
+// chain whose product equals factor. A factor of 1.0 (or unset) yields none.
+func atempoFilters(factor float64) []string {
+	if factor == 0 || factor == 1.0 {
+		return nil
+	}
+
+	var stages []string
+	for factor > 2.0 {
+		stages = append(stages, "atempo=2")
+		factor /= 2.0
+	}
+	for factor < 0.5 {
+		stages = append(stages, "atempo=0.5")
+		factor /= 0.5
+	}
+	if factor != 1.0 {
+		stages = append(stages, "atempo="+formatFloat(factor))
+	}
+	return stages
+}
+
+// NoiseGate configures the agate stage. Unlike silence removal it keeps the
+// timeline intact and only attenuates audio that stays under the threshold.
+// Zero fields take voice-tuned defaults.
+type NoiseGate struct {
+	ThresholdDB float64 `json:"threshold_db,omitempty"` // Gate opens above this level (default -45)
+	AttackMs    float64 `json:"attack_ms,omitempty"`    // Time to open once speech starts (default 10)
+	ReleaseMs   float64 `json:"release_ms,omitempty"`   // Time to close after speech stops (default 150)
+}
+
+// Voice-tuned noise gate defaults
+const (
+	defaultGateThresholdDB = -45
+	defaultGateAttackMs    = 10
+	defaultGateReleaseMs   = 150
+)
+
+// validate fills defaults and checks ranges accepted by agate
+func (g *NoiseGate) validate() error {
+	if g.ThresholdDB == 0 {
+		g.ThresholdDB = defaultGateThresholdDB
+	}
+	if g.AttackMs == 0 {
+		g.AttackMs = defaultGateAttackMs
+	}
+	if g.ReleaseMs == 0 {
+		g.ReleaseMs = defaultGateReleaseMs
+	}
+
+	if g.ThresholdDB < -80 || g.ThresholdDB > 0 {
+		return errors.New("noise_gate.threshold_db must be between -80 and 0")
+	}
+	if g.AttackMs < 0.01 || g.AttackMs > 9000 {
+		return errors.New("noise_gate.attack_ms must be between 0.01 and 9000")
+	}
+	if g.ReleaseMs < 0.01 || g.ReleaseMs > 9000 {
+		return errors.New("noise_gate.release_ms must be between 0.01 and 9000")
+	}
+	return nil
+}
+
+// filter renders the agate stage; FFmpeg converts the dB threshold to linear
+func (g *NoiseGate) filter() string {
+	return fmt.Sprintf("agate=threshold=%sdB:attack=%s:release=%s",
+		formatFloat(g.ThresholdDB), formatFloat(g.AttackMs), formatFloat(g.ReleaseMs))
+}
+
+// EQBand is one peaking band of the parametric equalizer. Bands run in
+// order, each as its own equalizer stage, after the noise gate so the gate
+// sees the unshaped level.
+type EQBand struct {
+	FrequencyHz float64 `json:"frequency_hz"`      // Center frequency, 20–20000
+	GainDB      float64 `json:"gain_db"`           // Boost or cut, -20 to 20
+	WidthQ      float64 `json:"width_q,omitempty"` // Bandwidth as Q, 0.1–10 (default 1)
+}
+
+// maxEQBands caps the bands in one request; each is a full filter stage
+const maxEQBands = 10
+
+// defaultEQWidthQ is about 1.4 octaves, a broad musical band
+const defaultEQWidthQ = 1.0
+
+// validateEQ fills the default width of each band and checks ranges
+func validateEQ(req *ConcatRequest) error {
+	if len(req.EQBands) > maxEQBands {
+		return fmt.Errorf("eq_bands allows at most %d bands", maxEQBands)
+	}
+	for i := range req.EQBands {
+		band := &req.EQBands[i]
+		if band.WidthQ == 0 {
+			band.WidthQ = defaultEQWidthQ
+		}
+		if band.FrequencyHz < 20 || band.FrequencyHz > 20000 {
+			return fmt.Errorf("eq_bands[%d].frequency_hz must be between 20 and 20000", i)
+		}
+		if band.GainDB < -20 || band.GainDB > 20 {
+			return fmt.Errorf("eq_bands[%d].gain_db must be between -20 and 20", i)
+		}
+		if band.WidthQ < 0.1 || band.WidthQ > 10 {
+			return fmt.Errorf("eq_bands[%d].width_q must be between 0.1 and 10", i)
+		}
+	}
+	return nil
+}
+
+// filter renders the band as a peaking equalizer stage
+func (b EQBand) filter() string {
+	return fmt.Sprintf("equalizer=f=%s:t=q:w=%s:g=%s", formatFloat(b.FrequencyHz), formatFloat(b.WidthQ), formatFloat(b.GainDB))
+}
+
+// formatFloat renders f without trailing zeros for filter arguments
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
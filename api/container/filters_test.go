@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAtempoFilters(t *testing.T) {
+	tests := []struct {
+		factor float64
+		want   []string
+	}{
+		{0, nil},
+		{1.0, nil},
+		{1.05, []string{"atempo=1.05"}},
+		{0.5, []string{"atempo=0.5"}},
+		{2.0, []string{"atempo=2"}},
+		{3.0, []string{"atempo=2", "atempo=1.5"}},
+		{4.0, []string{"atempo=2", "atempo=2"}},
+		{0.25, []string{"atempo=0.5", "atempo=0.5"}},
+		{0.3, []string{"atempo=0.5", "atempo=0.6"}},
+	}
+
+	for _, tt := range tests {
+		got := atempoFilters(tt.factor)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("atempoFilters(%g) = %v, want %v", tt.factor, got, tt.want)
+		}
+	}
+}
+
+// podcastLoudnorm is the loudnorm stage for the default podcast profile
+const podcastLoudnorm = "loudnorm=I=-16:TP=-1.5:LRA=11"
+
+func TestAudioFilterChain(t *testing.T) {
+	if got := audioFilterChain(ConcatRequest{}); got != podcastLoudnorm {
+		t.Errorf("default chain = %q, want %q", got, podcastLoudnorm)
+	}
+
+	got := audioFilterChain(ConcatRequest{SpeedFactor: 1.1})
+	if want := "atempo=1.1," + podcastLoudnorm; got != want {
+		t.Errorf("chain = %q, want %q", got, want)
+	}
+}
+
+func TestGainDB(t *testing.T) {
+	got := audioFilterChain(ConcatRequest{SpeedFactor: 1.1, GainDB: 3})
+	if want := "atempo=1.1,volume=3dB," + podcastLoudnorm; got != want {
+		t.Errorf("chain = %q, want %q", got, want)
+	}
+
+	got = audioFilterChain(ConcatRequest{GainDB: -4.5, CustomAudioFilter: "acompressor", CustomFilterMode: customFilterReplace})
+	if want := "volume=-4.5dB,acompressor"; got != want {
+		t.Errorf("replace chain = %q, want %q", got, want)
+	}
+
+	for _, gain := range []float64{-31, 30.5} {
+		req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", GainDB: gain}
+		if err := validateRequest(req); err == nil {
+			t.Errorf("gain %g: expected validation error", gain)
+		}
+	}
+}
+
+func TestValidateRequestSpeedFactor(t *testing.T) {
+	base := func(speed float64) *ConcatRequest {
+		return &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", SpeedFactor: speed}
+	}
+
+	req := base(0)
+	if err := validateRequest(req); err != nil || req.SpeedFactor != 1.0 {
+		t.Errorf("unset speed: err = %v, SpeedFactor = %g", err, req.SpeedFactor)
+	}
+	for _, bad := range []float64{0.1, 5, -1} {
+		if err := validateRequest(base(bad)); err == nil {
+			t.Errorf("speed %g: expected validation error", bad)
+		}
+	}
+}
+
+func TestEQBands(t *testing.T) {
+	req := &ConcatRequest{
+		Segments:    segmentURLs("a"),
+		OutputURL:   "b",
+		NoiseGate:   &NoiseGate{},
+		EQBands:     []EQBand{{FrequencyHz: 100, GainDB: -3}, {FrequencyHz: 3500, GainDB: 4, WidthQ: 2}},
+		SpeedFactor: 1.1,
+	}
+	if err := validateRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	want := "agate=threshold=-45dB:attack=10:release=150," +
+		"equalizer=f=100:t=q:w=1:g=-3,equalizer=f=3500:t=q:w=2:g=4," +
+		"atempo=1.1," + podcastLoudnorm
+	if got := audioFilterChain(*req); got != want {
+		t.Errorf("chain = %q, want %q", got, want)
+	}
+
+	tooMany := make([]EQBand, maxEQBands+1)
+	for i := range tooMany {
+		tooMany[i] = EQBand{FrequencyHz: 1000}
+	}
+	for name, bands := range map[string][]EQBand{
+		"too many":  tooMany,
+		"frequency": {{FrequencyHz: 10}},
+		"gain":      {{FrequencyHz: 1000, GainDB: 25}},
+		"width":     {{FrequencyHz: 1000, WidthQ: 20}},
+	} {
+		req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", EQBands: bands}
+		if err := validateRequest(req); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestNoiseGate(t *testing.T) {
+	gate := &NoiseGate{}
+	if err := gate.validate(); err != nil {
+		t.Fatalf("defaults should validate: %v", err)
+	}
+	if got, want := gate.filter(), "agate=threshold=-45dB:attack=10:release=150"; got != want {
+		t.Errorf("filter = %q, want %q", got, want)
+	}
+
+	chain := audioFilterChain(ConcatRequest{NoiseGate: gate, SpeedFactor: 1.1})
+	if want := "agate=threshold=-45dB:attack=10:release=150,atempo=1.1," + podcastLoudnorm; chain != want {
+		t.Errorf("chain = %q, want %q", chain, want)
+	}
+
+	for _, bad := range []NoiseGate{
+		{ThresholdDB: 6},
+		{ThresholdDB: -100},
+		{AttackMs: -1},
+		{ReleaseMs: 10000},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%+v: expected validation error", bad)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Multipart POST Upload ----------
+//
+// Some storage endpoints only accept a browser-style form upload: S3
+// presigned POST, GCS signed policy documents, and upload proxies built on
+// them. The caller signs a policy and passes its fields (key, policy,
+// x-amz-signature, ...) in upload_form_fields; the container sends them as
+// multipart/form-data fields ahead of the file, which must be the last part.
+//
+// S3 rejects chunked POST bodies, so the body is assembled from a buffered
+// head (fields and the file part's header), the file itself, and a buffered
+// tail (the closing boundary). That gives an exact Content-Length without
+// reading the whole output into memory.
+
+const (
+	uploadMethodPut  = "put"
+	uploadMethodPost = "post"
+
+	// formFileField is the part that carries the output; S3 requires the name
+	formFileField = "file"
+
+	// maxFormFields bounds the policy fields a request can pass
+	maxFormFields = 50
+)
+
+// validateUploadMethod fills the default method and checks the form fields.
+// POST policies are signed for one object, so POST needs a single output.
+func validateUploadMethod(req *ConcatRequest, hls, hashNaming bool) error {
+	switch req.UploadMethod {
+	case "":
+		req.UploadMethod = uploadMethodPut
+	case uploadMethodPut, uploadMethodPost:
+	default:
+		return fmt.Errorf("upload_method must be %q or %q", uploadMethodPut, uploadMethodPost)
+	}
+
+	if req.UploadMethod == uploadMethodPut {
+		if len(req.UploadFormFields) > 0 {
+			return fmt.Errorf("upload_form_fields requires upload_method %q", uploadMethodPost)
+		}
+		return nil
+	}
+
+	switch {
+	case len(req.OutputURLs) > 0:
+		return fmt.Errorf("upload_method %q is not supported with output_urls", uploadMethodPost)
+	case req.SplitDurationSeconds > 0:
+		return fmt.Errorf("upload_method %q is not supported with split output", uploadMethodPost)
+	case hls:
+		return fmt.Errorf("upload_method %q is not supported with HLS output", uploadMethodPost)
+	case hashNaming:
+		return fmt.Errorf("upload_method %q is not supported with output_naming %q", uploadMethodPost, outputNamingHash)
+	}
+	if len(req.UploadFormFields) > maxFormFields {
+		return fmt.Errorf("upload_form_fields allows at most %d fields", maxFormFields)
+	}
+	for name := range req.UploadFormFields {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("upload_form_fields has an empty field name")
+		}
+		if strings.EqualFold(name, formFileField) {
+			return fmt.Errorf("upload_form_fields cannot set %q; it carries the output", formFileField)
+		}
+	}
+	return nil
+}
+
+// formFileName is the filename sent with the file part. S3 substitutes it
+// for ${filename} in the key field; a bucket endpoint has no useful path
+// segment, so it falls back to output.mp3.
+func formFileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "output.mp3"
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." || !strings.Contains(name, ".") {
+		return "output.mp3"
+	}
+	return name
+}
+
+// formBody returns the multipart body around file, its exact length, and
+// the Content-Type header carrying the boundary. Fields are written in
+// sorted order so the body is reproducible.
+func formBody(fields map[string]string, fileName, contentType string, file io.Reader, size int64) (io.Reader, int64, string, error) {
+	var head bytes.Buffer
+	mw := multipart.NewWriter(&head)
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := mw.WriteField(name, fields[name]); err != nil {
+			return nil, 0, "", err
+		}
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, formFileField, strings.ReplaceAll(fileName, `"`, "")))
+	h.Set("Content-Type", contentType)
+	if _, err := mw.CreatePart(h); err != nil {
+		return nil, 0, "", err
+	}
+
+	// Closing the writer appends the final boundary, which becomes the tail
+	headBytes := append([]byte(nil), head.Bytes()...)
+	head.Reset()
+	if err := mw.Close(); err != nil {
+		return nil, 0, "", err
+	}
+	tail := head.Bytes()
+
+	length := int64(len(headBytes)) + size + int64(len(tail))
+	body := io.MultiReader(bytes.NewReader(headBytes), file, bytes.NewReader(tail))
+	return body, length, mw.FormDataContentType(), nil
+}
+
+// uploadForm POSTs srcPath to url as a multipart form with fields
+func uploadForm(ctx context.Context, srcPath, url, contentType string, fields map[string]string) error {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("open file failed: %w", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file failed: %w", err)
+	}
+
+	body, length, formType, err := formBody(fields, formFileName(url), contentType, file, fileInfo.Size())
+	if err != nil {
+		return fmt.Errorf("build form failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return fmt.Errorf("create request failed: %w", err)
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", formType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return networkError("POST failed", err)
+	}
+	defer resp.Body.Close()
+
+	// S3 answers 204 by default, or 200/201 with success_action_status
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return statusError("POST", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// uploadFormWithRetry is uploadForm with retries for transient failures
+func uploadFormWithRetry(ctx context.Context, srcPath, url, contentType string, fields map[string]string) error {
+	_, err := retryTransfer(ctx, "upload "+redactURL(url), func() (struct{}, error) {
+		return struct{}{}, uploadForm(ctx, srcPath, url, contentType, fields)
+	})
+	if ctx.Err() == nil {
+		recordUpload(url, err, time.Now())
+	}
+	return err
+}
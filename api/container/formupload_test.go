@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateUploadMethod(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b"}
+	if err := validateRequest(req); err != nil || req.UploadMethod != uploadMethodPut {
+		t.Fatalf("default: method = %q, err = %v", req.UploadMethod, err)
+	}
+
+	req = &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", UploadMethod: "post",
+		UploadFormFields: map[string]string{"key": "episodes/ep.mp3", "policy": "eyJ9"}}
+	if err := validateRequest(req); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	for name, req := range map[string]*ConcatRequest{
+		"unknown method": {Segments: segmentURLs("a"), OutputURL: "b", UploadMethod: "patch"},
+		"fields on put":  {Segments: segmentURLs("a"), OutputURL: "b", UploadFormFields: map[string]string{"key": "k"}},
+		"file field":     {Segments: segmentURLs("a"), OutputURL: "b", UploadMethod: "post", UploadFormFields: map[string]string{"File": "x"}},
+		"empty name":     {Segments: segmentURLs("a"), OutputURL: "b", UploadMethod: "post", UploadFormFields: map[string]string{" ": "x"}},
+		"output_urls":    {Segments: segmentURLs("a"), OutputURLs: []string{"b", "c"}, UploadMethod: "post"},
+		"split":          {Segments: segmentURLs("a"), OutputURLTemplate: "b/{part}", SplitDurationSeconds: 60, UploadMethod: "post"},
+		"hash naming":    {Segments: segmentURLs("a"), OutputURLTemplate: "b/{sha256}", OutputNaming: "hash", UploadMethod: "post"},
+	} {
+		if err := validateRequest(req); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestFormFileName(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://bucket.s3.amazonaws.com/":              "output.mp3",
+		"https://bucket.s3.amazonaws.com":               "output.mp3",
+		"https://upload.example.com/episodes/ep-42.mp3": "ep-42.mp3",
+		"https://upload.example.com/form":               "output.mp3",
+	} {
+		if got := formFileName(raw); got != want {
+			t.Errorf("formFileName(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestUploadForm(t *testing.T) {
+	var (
+		order         []string
+		fields        = map[string]string{}
+		file          []byte
+		fileName      string
+		fileType      string
+		contentLength int64
+		chunked       bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		contentLength = r.ContentLength
+		chunked = len(r.TransferEncoding) > 0
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(part)
+			order = append(order, part.FormName())
+			if part.FormName() == formFileField {
+				file, fileName, fileType = data, part.FileName(), part.Header.Get("Content-Type")
+			} else {
+				fields[part.FormName()] = string(data)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	src := filepath.Join(t.TempDir(), "ab12_output.mp3")
+	os.WriteFile(src, []byte("audio bytes"), 0644)
+	policy := map[string]string{"key": "episodes/${filename}", "policy": "eyJ9", "x-amz-signature": "abc"}
+	if err := uploadFormWithRetry(context.Background(), src, server.URL+"/", "audio/mpeg", policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fields, policy) {
+		t.Errorf("fields = %v, want %v", fields, policy)
+	}
+	if want := []string{"key", "policy", "x-amz-signature", "file"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("part order = %v, want %v", order, want)
+	}
+	if string(file) != "audio bytes" || fileName != "output.mp3" || fileType != "audio/mpeg" {
+		t.Errorf("file part = %q %q %q", file, fileName, fileType)
+	}
+	if chunked || contentLength <= int64(len("audio bytes")) {
+		t.Errorf("body sent chunked=%v with Content-Length %d; S3 needs an exact length", chunked, contentLength)
+	}
+}
+
+func TestUploadFormRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<Error><Code>AccessDenied</Code><Message>Invalid according to Policy</Message></Error>", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+	err := uploadFormWithRetry(context.Background(), src, server.URL+"/", "audio/mpeg", nil)
+	if err == nil || isRetryable(err) {
+		t.Errorf("err = %v, want a terminal error", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// ---------- Liveness and Readiness ----------
+//
+// /healthz (and the original /health) only report that the process is up.
+// /readyz reports whether this instance should receive new /concat requests:
+// FFmpeg was found at startup, shutdown has not begun, the concurrency cap
+// has room, and a job could create its work dir right now. The last one is
+// probed on every call, since a full disk or a read-only remount otherwise
+// leaves a "ready" instance that fails every job it is sent.
+
+var (
+	// ffmpegAvailable and ffprobeAvailable are set by checkBinaries at startup
+	ffmpegAvailable  atomic.Bool
+	ffprobeAvailable atomic.Bool
+
+	// activeJobs counts /concat jobs currently holding a slot
+	activeJobs atomic.Int32
+)
+
+// checkBinaries records whether ffmpeg and ffprobe are on PATH. A missing
+// ffprobe is tolerated: durations then come from FFmpeg's progress output.
+func checkBinaries() {
+	ffmpegAvailable.Store(lookupBinary("ffmpeg"))
+	ffprobeAvailable.Store(lookupBinary("ffprobe"))
+}
+
+// lookupBinary logs where name resolves on PATH and reports if it was found
+func lookupBinary(name string) bool {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		fmt.Printf("Warning: %s not found on PATH: %v\n", name, err)
+		return false
+	}
+	fmt.Printf("Found %s at %s\n", name, path)
+	return true
+}
+
+// acquireJobSlot reserves a concurrency slot, returning false at the cap
+func acquireJobSlot() bool {
+	for {
+		n := activeJobs.Load()
+		if config.MaxConcurrentJobs > 0 && int(n) >= config.MaxConcurrentJobs {
+			return false
+		}
+		if activeJobs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// releaseJobSlot frees a slot taken by acquireJobSlot, or hands it
+// straight to the longest-waiting queued job
+func releaseJobSlot() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	if len(jobQueue) > 0 {
+		next := jobQueue[0]
+		jobQueue = jobQueue[1:]
+		close(next.ready)
+		return
+	}
+	activeJobs.Add(-1)
+}
+
+// readinessChecks evaluates each readiness condition by name
+func readinessChecks() map[string]bool {
+	atCapacity := config.MaxConcurrentJobs > 0 && int(activeJobs.Load()) >= config.MaxConcurrentJobs
+	writable := checkWorkDirWritable(os.TempDir())
+	if writable != nil {
+		fmt.Printf("Readiness: work dir not writable: %v\n", writable)
+	}
+	return map[string]bool{
+		"ffmpeg":            ffmpegAvailable.Load(),
+		"not_draining":      acceptingJobs(),
+		"has_capacity":      !atCapacity,
+		"work_dir_writable": writable == nil,
+	}
+}
+
+// checkWorkDirWritable creates a temp dir under root the way a job does,
+// writes a small file into it, and removes both. The name doesn't match
+// the concat-* sweep pattern, so a probe can never be mistaken for a job.
+func checkWorkDirWritable(root string) error {
+	dir, err := os.MkdirTemp(root, "readyz-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	return os.WriteFile(filepath.Join(dir, "probe"), []byte("ok"), 0644)
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := readinessChecks()
+	ready := true
+	for _, ok := range checks {
+		ready = ready && ok
+	}
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// handleInfo reports static capabilities of this instance
+func handleInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"schema_version":    schemaVersion,
+		"ffmpeg_available":  ffmpegAvailable.Load(),
+		"ffprobe_available": ffprobeAvailable.Load(),
+	})
+}
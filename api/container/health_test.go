@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readyz(t *testing.T) (int, map[string]bool) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body struct {
+		Checks map[string]bool `json:"checks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode readyz: %v", err)
+	}
+	return rec.Code, body.Checks
+}
+
+func TestReadyz(t *testing.T) {
+	ffmpegAvailable.Store(true)
+	defer ffmpegAvailable.Store(false)
+
+	if code, _ := readyz(t); code != http.StatusOK {
+		t.Fatalf("ready instance returned %d", code)
+	}
+
+	t.Run("ffmpeg missing", func(t *testing.T) {
+		ffmpegAvailable.Store(false)
+		defer ffmpegAvailable.Store(true)
+		if code, checks := readyz(t); code != http.StatusServiceUnavailable || checks["ffmpeg"] {
+			t.Errorf("code = %d, checks = %v", code, checks)
+		}
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		shutdownCancel()
+		defer func() { shutdownCtx, shutdownCancel = context.WithCancel(context.Background()) }()
+		if code, checks := readyz(t); code != http.StatusServiceUnavailable || checks["not_draining"] {
+			t.Errorf("code = %d, checks = %v", code, checks)
+		}
+	})
+
+	t.Run("at capacity", func(t *testing.T) {
+		config.MaxConcurrentJobs = 1
+		defer func() { config.MaxConcurrentJobs = 0 }()
+		if !acquireJobSlot() {
+			t.Fatal("first slot should be available")
+		}
+		defer releaseJobSlot()
+		if acquireJobSlot() {
+			t.Fatal("second slot should be refused")
+		}
+		if code, checks := readyz(t); code != http.StatusServiceUnavailable || checks["has_capacity"] {
+			t.Errorf("code = %d, checks = %v", code, checks)
+		}
+	})
+
+	t.Run("work dir not writable", func(t *testing.T) {
+		// os.TempDir follows TMPDIR; a missing directory fails like a bad mount
+		t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+		if code, checks := readyz(t); code != http.StatusServiceUnavailable || checks["work_dir_writable"] {
+			t.Errorf("code = %d, checks = %v", code, checks)
+		}
+	})
+}
+
+func TestCheckWorkDirWritable(t *testing.T) {
+	root := t.TempDir()
+	if err := checkWorkDirWritable(root); err != nil {
+		t.Fatalf("writable root: %v", err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("probe left %d entries behind", len(entries))
+	}
+	if err := checkWorkDirWritable(filepath.Join(root, "missing")); err == nil {
+		t.Error("expected error for a missing root")
+	}
+}
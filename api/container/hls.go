@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ---------- HLS Output ----------
+//
+// output_format "hls" encodes AAC into MPEG-TS media segments plus a VOD
+// .m3u8 playlist instead of a single MP3. Every file is uploaded to
+// OutputURLTemplate with {file} replaced by its name; the playlist refers to
+// segments by bare file name, so the template must map names onto one path
+// prefix for players to resolve them. The playlist is uploaded last, so it
+// never references a segment that isn't there yet.
+
+const (
+	outputFormatMP3 = "mp3"
+	outputFormatHLS = "hls"
+)
+
+// filePlaceholder is replaced by the file name in OutputURLTemplate for HLS
+const filePlaceholder = "{file}"
+
+const (
+	hlsPlaylistName   = "playlist.m3u8"
+	hlsSegmentPattern = "hls_%03d.ts"
+
+	defaultHLSSegmentSeconds = 6
+	maxHLSSegmentSeconds     = 60
+)
+
+// validateOutputFormat fills the default format and rejects options that
+// only make sense for a single MP3
+func validateOutputFormat(req *ConcatRequest) error {
+	switch req.OutputFormat {
+	case "":
+		req.OutputFormat = outputFormatMP3
+	case outputFormatMP3:
+	case outputFormatHLS:
+		if !strings.Contains(req.OutputURLTemplate, filePlaceholder) {
+			return fmt.Errorf("output_url_template must contain %s with output_format %q", filePlaceholder, outputFormatHLS)
+		}
+		switch {
+		case req.OutputURL != "" || len(req.OutputURLs) > 0:
+			return errors.New("output_format \"hls\" uses output_url_template instead of output_url")
+		case req.SplitDurationSeconds > 0:
+			return errors.New("split_duration_seconds is not supported with output_format \"hls\"; use hls_segment_seconds")
+		case req.OutputNaming == outputNamingHash:
+			return errors.New("output_naming \"hash\" is not supported with output_format \"hls\"")
+		case req.AppendToURL != "":
+			return errors.New("append_to_url is not supported with output_format \"hls\"")
+		case req.GenerateWaveform:
+			return errors.New("generate_waveform is not supported with output_format \"hls\"")
+		case req.GenerateDownloadURL:
+			return errors.New("generate_download_url is not supported with output_format \"hls\"")
+		case req.BitrateMode == bitrateVBR:
+			return errors.New("bitrate_mode \"vbr\" is not supported with output_format \"hls\"")
+		case req.SampleFormat != "":
+			return errors.New("sample_format is not supported with output_format \"hls\"")
+		}
+		if req.HLSSegmentSeconds == 0 {
+			req.HLSSegmentSeconds = defaultHLSSegmentSeconds
+		}
+		if req.HLSSegmentSeconds < 1 || req.HLSSegmentSeconds > maxHLSSegmentSeconds {
+			return fmt.Errorf("hls_segment_seconds must be between 1 and %d", maxHLSSegmentSeconds)
+		}
+		return nil
+	default:
+		return fmt.Errorf("output_format must be %q or %q", outputFormatMP3, outputFormatHLS)
+	}
+	if req.HLSSegmentSeconds != 0 {
+		return errors.New("hls_segment_seconds requires output_format \"hls\"")
+	}
+	return nil
+}
+
+// hlsOutputArgs returns the AAC encoder and hls muxer arguments writing into
+// dir. The muxer lists segments by base name, so the playlist never carries
+// container paths or the job's file prefix.
+func hlsOutputArgs(req ConcatRequest, dir string) []string {
+	return append(hlsEncoderArgs(req),
+		"-f", "hls",
+		"-hls_time", formatFloat(req.HLSSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, hlsSegmentPattern),
+		"-y", filepath.Join(dir, hlsPlaylistName),
+	)
+}
+
+// hlsEncoderArgs returns the AAC codec, bitrate, and layout arguments
+func hlsEncoderArgs(req ConcatRequest) []string {
+	kbps := req.BitrateKbps
+	if kbps == 0 {
+		kbps = defaultBitrateKbps
+	}
+	args := []string{
+		"-c:a", "aac",
+		"-b:a", strconv.Itoa(kbps) + "k",
+		"-ar", "44100",
+	}
+	return append(args, channelArgs(req.ChannelLayout)...)
+}
+
+// hlsEntry is one media segment listed in a playlist
+type hlsEntry struct {
+	Name     string
+	Duration float64
+}
+
+// parseHLSPlaylist reads segment names and #EXTINF durations in playlist order
+func parseHLSPlaylist(path string) ([]hlsEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []hlsEntry
+	var pending float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			pending, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad #EXTINF line %q", line)
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			if strings.ContainsAny(line, `/\`) {
+				return nil, fmt.Errorf("unexpected segment path %q", line)
+			}
+			entries = append(entries, hlsEntry{Name: line, Duration: pending})
+			pending = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("playlist lists no segments")
+	}
+	return entries, nil
+}
+
+// hlsFileURL resolves the upload URL for an HLS file name
+func hlsFileURL(template, name string) string {
+	return strings.ReplaceAll(template, filePlaceholder, name)
+}
+
+// outputContentType returns the upload Content-Type for an output file
+func outputContentType(path string) string {
+	switch filepath.Ext(path) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	default:
+		return "audio/mpeg"
+	}
+}
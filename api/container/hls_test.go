@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateOutputFormat(t *testing.T) {
+	tmpl := "https://cdn.example/ep1/{file}"
+	tests := []struct {
+		name    string
+		req     ConcatRequest
+		wantErr bool
+	}{
+		{"default mp3", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b"}, false},
+		{"hls", ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: tmpl}, false},
+		{"hls without placeholder", ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: "https://cdn.example/x"}, true},
+		{"hls with output_url", ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: tmpl, OutputURL: "b"}, true},
+		{"hls with split", ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: tmpl, SplitDurationSeconds: 60}, true},
+		{"hls with waveform", ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: tmpl, GenerateWaveform: true}, true},
+		{"hls segment too long", ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: tmpl, HLSSegmentSeconds: 90}, true},
+		{"segment seconds without hls", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", HLSSegmentSeconds: 6}, true},
+		{"unknown format", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", OutputFormat: "ogg"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			if err := validateRequest(&req); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	req := ConcatRequest{Segments: segmentURLs("a"), OutputFormat: "hls", OutputURLTemplate: tmpl}
+	validateRequest(&req)
+	if req.HLSSegmentSeconds != defaultHLSSegmentSeconds {
+		t.Errorf("HLSSegmentSeconds = %v, want default %d", req.HLSSegmentSeconds, defaultHLSSegmentSeconds)
+	}
+}
+
+func TestHLSOutputArgs(t *testing.T) {
+	got := hlsOutputArgs(ConcatRequest{BitrateKbps: 96, HLSSegmentSeconds: 4}, "/w/ab12_hls")
+	want := []string{
+		"-c:a", "aac", "-b:a", "96k", "-ar", "44100",
+		"-f", "hls", "-hls_time", "4", "-hls_playlist_type", "vod",
+		"-hls_segment_filename", "/w/ab12_hls/hls_%03d.ts",
+		"-y", "/w/ab12_hls/playlist.m3u8",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hlsOutputArgs = %v, want %v", got, want)
+	}
+
+	got = hlsOutputArgs(ConcatRequest{BitrateKbps: 256, HLSSegmentSeconds: 6, ChannelLayout: "5.1"}, "/w/ab12_hls")
+	if got[6] != "-ac" || got[7] != "6" {
+		t.Errorf("5.1 hlsOutputArgs = %v, want -ac 6 after the sample rate", got)
+	}
+}
+
+func TestParseHLSPlaylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "playlist.m3u8")
+	os.WriteFile(path, []byte("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXT-X-PLAYLIST-TYPE:VOD\n"+
+		"#EXTINF:6.016000,\nhls_000.ts\n#EXTINF:2.500000,\nhls_001.ts\n#EXT-X-ENDLIST\n"), 0644)
+
+	entries, err := parseHLSPlaylist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []hlsEntry{{"hls_000.ts", 6.016}, {"hls_001.ts", 2.5}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %v, want %v", entries, want)
+	}
+
+	os.WriteFile(path, []byte("#EXTM3U\n#EXTINF:6,\n../../etc/passwd\n"), 0644)
+	if _, err := parseHLSPlaylist(path); err == nil {
+		t.Error("expected error for a segment outside the work dir")
+	}
+}
+
+func TestOutputContentType(t *testing.T) {
+	tests := map[string]string{
+		"/w/output.mp3":    "audio/mpeg",
+		"/w/hls_000.ts":    "video/mp2t",
+		"/w/playlist.m3u8": "application/vnd.apple.mpegurl",
+		"/w/part_001.mp3":  "audio/mpeg",
+	}
+	for path, want := range tests {
+		if got := outputContentType(path); got != want {
+			t.Errorf("outputContentType(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if got := hlsFileURL("https://cdn.example/ep1/{file}", "hls_000.ts"); got != "https://cdn.example/ep1/hls_000.ts" {
+		t.Errorf("hlsFileURL = %q", got)
+	}
+}
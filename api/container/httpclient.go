@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ---------- HTTP Client ----------
+//
+// All downloads, uploads, manifest fetches, and trace exports share one
+// tuned client. The default transport keeps only two idle connections per
+// host, so a job pulling hundreds of segments from one storage host kept
+// re-dialing and re-doing TLS; a larger per-host pool lets consecutive
+// requests reuse connections. DNS_SERVER optionally sends lookups to a
+// specific resolver instead of the system one.
+//
+// Every request also carries HTTP_USER_AGENT. Some CDNs and storage
+// providers block or rate-limit Go's default "Go-http-client/1.1", and a
+// descriptive agent makes the container's traffic identifiable in origin
+// logs.
+
+// defaultUserAgent identifies the container when HTTP_USER_AGENT is unset
+const defaultUserAgent = "strollcast-ffmpeg-container"
+
+// httpClient is replaced by newHTTPClient at startup
+var httpClient = http.DefaultClient
+
+// newHTTPClient builds the shared client from the HTTP_* and DNS_SERVER settings
+func newHTTPClient(c Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   c.HTTPDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if c.DNSServer != "" {
+		server := c.DNSServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: c.HTTPDialTimeout}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.MaxIdleConns = c.HTTPMaxIdleConns
+	transport.MaxIdleConnsPerHost = c.HTTPMaxIdleConnsPerHost
+	transport.IdleConnTimeout = c.HTTPIdleConnTimeout
+	return &http.Client{Transport: userAgentTransport{base: transport, userAgent: c.UserAgent}}
+}
+
+// userAgentTransport sets User-Agent on requests that don't already have one
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent == "" || req.Header.Get("User-Agent") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	c := Config{
+		HTTPMaxIdleConns:        50,
+		HTTPMaxIdleConnsPerHost: 8,
+		HTTPIdleConnTimeout:     time.Minute,
+		HTTPDialTimeout:         time.Second,
+	}
+	transport := newHTTPClient(c).Transport.(userAgentTransport).base.(*http.Transport)
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 8 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("transport = %d/%d/%v", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+}
+
+func TestNewHTTPClientDNSServer(t *testing.T) {
+	// Nothing listens on port 1, so the lookup fails and names the configured server
+	client := newHTTPClient(Config{HTTPDialTimeout: time.Second, DNSServer: "127.0.0.1:1"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://segments.example.invalid/a.mp3", nil)
+	_, err := client.Do(req)
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Errorf("err = %v, want lookup via 127.0.0.1:1", err)
+	}
+}
+
+func TestSharedClientReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("segment"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	defer func(c *http.Client) { httpClient = c }(httpClient)
+	httpClient = newHTTPClient(Config{HTTPMaxIdleConns: 10, HTTPMaxIdleConnsPerHost: 10, HTTPIdleConnTimeout: time.Minute, HTTPDialTimeout: time.Second})
+
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		if _, err := downloadFile(context.Background(), server.URL, filepath.Join(dir, "segment.mp3")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("opened %d connections for 5 sequential downloads, want 1", n)
+	}
+}
+
+func TestHTTPClientUserAgent(t *testing.T) {
+	agents := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.UserAgent()
+	}))
+	defer server.Close()
+
+	client := newHTTPClient(Config{HTTPDialTimeout: time.Second, UserAgent: "strollcast-test/1"})
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := <-agents; got != "strollcast-test/1" {
+		t.Errorf("User-Agent = %q, want strollcast-test/1", got)
+	}
+	if req.Header.Get("User-Agent") != "" {
+		t.Error("caller's request was modified")
+	}
+
+	// An explicit header wins
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("User-Agent", "caller")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := <-agents; got != "caller" {
+		t.Errorf("User-Agent = %q, want caller", got)
+	}
+}
+
+func benchmarkDownloads(b *testing.B, client func() *http.Client) {
+	body := strings.Repeat("x", 64<<10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	defer func(c *http.Client) { httpClient = c }(httpClient)
+	dest := filepath.Join(b.TempDir(), "segment.mp3")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		httpClient = client()
+		if _, err := downloadFile(context.Background(), server.URL, dest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDownloadSharedClient(b *testing.B) {
+	shared := newHTTPClient(Config{HTTPMaxIdleConns: 100, HTTPMaxIdleConnsPerHost: 16, HTTPIdleConnTimeout: time.Minute, HTTPDialTimeout: time.Second})
+	benchmarkDownloads(b, func() *http.Client { return shared })
+}
+
+func BenchmarkDownloadFreshClient(b *testing.B) {
+	benchmarkDownloads(b, func() *http.Client {
+		return &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ---------- Idempotency Keys ----------
+//
+// Clients with at-least-once delivery send X-Idempotency-Key on /concat. The
+// first request with a key runs normally; a duplicate arriving while it runs
+// gets 409, and one arriving after it succeeded gets the original response
+// replayed without re-encoding or re-uploading. Failed responses are not kept,
+// so a retry after a failure runs the job again.
+//
+// The signature is checked before the key is looked up, so a replayed
+// response (which may hold presigned download URLs) only goes to signed
+// callers. Each key is bound to a hash of the body it was first sent with; a
+// different body under the same key gets 422 rather than the other job's
+// result.
+
+// maxIdempotencyKeys bounds memory used by remembered keys
+const maxIdempotencyKeys = 1000
+
+// idempotencyEntry is one remembered key
+type idempotencyEntry struct {
+	done        bool
+	bodyHash    [sha256.Size]byte
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyCache is a bounded TTL map of keys to results
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+var idempotencyKeys = &idempotencyCache{entries: make(map[string]*idempotencyEntry)}
+
+// begin claims key for a request body with the given hash. If the key is
+// already known it returns a copy of the existing entry and false.
+func (c *idempotencyCache) begin(key string, bodyHash [sha256.Size]byte, now time.Time) (idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if e.done && now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if e, ok := c.entries[key]; ok {
+		return *e, false
+	}
+
+	if len(c.entries) >= maxIdempotencyKeys {
+		c.evictOldestLocked()
+	}
+	c.entries[key] = &idempotencyEntry{bodyHash: bodyHash}
+	return idempotencyEntry{}, true
+}
+
+// complete stores the response for key so later duplicates replay it
+func (c *idempotencyCache) complete(key string, bodyHash [sha256.Size]byte, status int, contentType string, body []byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &idempotencyEntry{
+		done:        true,
+		bodyHash:    bodyHash,
+		status:      status,
+		contentType: contentType,
+		body:        body,
+		expires:     now.Add(config.IdempotencyTTL),
+	}
+}
+
+// abandon forgets key so the request can be retried
+func (c *idempotencyCache) abandon(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// evictOldestLocked drops the completed entry closest to expiry. In-flight
+// entries are never evicted, so a running job can't be started twice.
+func (c *idempotencyCache) evictOldestLocked() {
+	var oldestKey string
+	var oldest time.Time
+	for k, e := range c.entries {
+		if e.done && (oldestKey == "" || e.expires.Before(oldest)) {
+			oldestKey, oldest = k, e.expires
+		}
+	}
+	if oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.body = append(rw.body, b...)
+	return rw.ResponseWriter.Write(b)
+}
+
+// withIdempotency deduplicates requests carrying X-Idempotency-Key
+func withIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+
+		body, ok := readAuthorizedBody(w, r)
+		if !ok {
+			return
+		}
+		// The handler reads (and verifies) the body again
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		bodyHash := sha256.Sum256(body)
+
+		entry, isNew := idempotencyKeys.begin(key, bodyHash, time.Now())
+		if !isNew {
+			if entry.bodyHash != bodyHash {
+				sendError(w, codeInvalidRequest, "This idempotency key was already used with a different request body", http.StatusUnprocessableEntity)
+				return
+			}
+			if !entry.done {
+				sendError(w, codeConflict, "A request with this idempotency key is still in progress", http.StatusConflict)
+				return
+			}
+			w.Header().Set("Content-Type", entry.contentType)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			if !completed {
+				idempotencyKeys.abandon(key)
+			}
+		}()
+
+		next(rec, r)
+
+		if rec.status < 300 {
+			idempotencyKeys.complete(key, bodyHash, rec.status, rec.Header().Get("Content-Type"), rec.body, time.Now())
+			completed = true
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithIdempotencyReplaysSuccess(t *testing.T) {
+	config.IdempotencyTTL = time.Minute
+	defer func() { config.IdempotencyTTL = 0 }()
+
+	var calls atomic.Int32
+	handler := withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success":true}`))
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/concat", nil)
+		req.Header.Set("X-Idempotency-Key", "replay-key")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"success":true}` {
+			t.Fatalf("attempt %d: code = %d, body = %q", i, rec.Code, rec.Body.String())
+		}
+		if i == 1 && rec.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("second response was not marked as replayed")
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want 1", calls.Load())
+	}
+}
+
+func TestWithIdempotencyInProgress(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/concat", nil)
+		req.Header.Set("X-Idempotency-Key", "busy-key")
+		handler(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	req := httptest.NewRequest(http.MethodPost, "/concat", nil)
+	req.Header.Set("X-Idempotency-Key", "busy-key")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	close(release)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("duplicate in-flight request: code = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestWithIdempotencyRetriesFailure(t *testing.T) {
+	var calls atomic.Int32
+	handler := withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		sendError(w, codeInternal, "boom", http.StatusInternalServerError)
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/concat", nil)
+		req.Header.Set("X-Idempotency-Key", "fail-key")
+		handler(httptest.NewRecorder(), req)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", calls.Load())
+	}
+}
+
+func TestIdempotencyCacheExpiry(t *testing.T) {
+	config.IdempotencyTTL = time.Minute
+	defer func() { config.IdempotencyTTL = 0 }()
+
+	cache := &idempotencyCache{entries: make(map[string]*idempotencyEntry)}
+	now := time.Now()
+	var hash [sha256.Size]byte
+	cache.begin("k", hash, now)
+	cache.complete("k", hash, http.StatusOK, "application/json", nil, now)
+
+	if _, isNew := cache.begin("k", hash, now.Add(30*time.Second)); isNew {
+		t.Error("key should still be remembered within the TTL")
+	}
+	if _, isNew := cache.begin("k", hash, now.Add(2*time.Minute)); !isNew {
+		t.Error("key should be forgotten after the TTL")
+	}
+}
+
+func TestWithIdempotencyRejectsDifferentBody(t *testing.T) {
+	config.IdempotencyTTL = time.Minute
+	defer func() { config.IdempotencyTTL = 0 }()
+
+	var calls atomic.Int32
+	handler := withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"success":true}`))
+	})
+
+	for i, body := range []string{`{"episode_id":"a"}`, `{"episode_id":"b"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(body))
+		req.Header.Set("X-Idempotency-Key", "body-key")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if want := []int{http.StatusOK, http.StatusUnprocessableEntity}[i]; rec.Code != want {
+			t.Errorf("body %d: code = %d, want %d", i, rec.Code, want)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want 1", calls.Load())
+	}
+}
+
+func TestWithIdempotencyChecksSignatureFirst(t *testing.T) {
+	config.IdempotencyTTL = time.Minute
+	config.HMACSecret = "test-secret"
+	config.HMACMaxSkew = 5 * time.Minute
+	defer func() { config = Config{} }()
+
+	handler := withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := readAuthorizedBody(w, r); ok {
+			w.Write([]byte(`{"download_url":"https://example.com/secret"}`))
+		}
+	})
+	body := `{"episode_id":"a"}`
+	send := func(signed bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(body))
+		req.Header.Set("X-Idempotency-Key", "signed-key")
+		if signed {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set("X-Timestamp", ts)
+			req.Header.Set("X-Signature", signBody(config.HMACSecret, ts, []byte(body)))
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := send(false); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned first request: code = %d, want 401", rec.Code)
+	}
+	if rec := send(true); rec.Code != http.StatusOK {
+		t.Fatalf("signed request: code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(false); rec.Code != http.StatusUnauthorized || strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("unsigned replay: code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
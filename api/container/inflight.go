@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ---------- In-Flight Download Budget ----------
+//
+// MAX_CONCURRENT_JOBS bounds how many jobs run, but not how much they pull
+// at once: three jobs each fetching a 100 MB segment is very different from
+// three fetching 1 MB clips. MAX_INFLIGHT_DOWNLOAD_BYTES caps the total size
+// of downloads in progress across all jobs (and any future parallel
+// downloads within one).
+//
+// A download waits for its reservation before the request is sent, so a
+// job stuck behind a full budget holds no connection and leaves the wait as
+// soon as its context is done. The size isn't known yet at that point, so
+// the reservation is the estimate for a body without Content-Length; once
+// the headers arrive it is resized to the actual length without waiting
+// again. A body larger than the estimate can therefore overshoot the budget
+// briefly, by at most what MAX_SEGMENT_BYTES allows.
+
+// unknownSizeEstimate is reserved for responses without Content-Length
+// when MAX_SEGMENT_BYTES doesn't give a tighter bound
+const unknownSizeEstimate = 16 << 20
+
+// byteBudget is a counting semaphore over bytes
+type byteBudget struct {
+	mu      sync.Mutex
+	changed chan struct{} // Closed and replaced whenever bytes are returned
+	limit   int64
+	used    int64
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	return &byteBudget{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire reserves n bytes, waiting until they fit or ctx is done, and
+// returns the amount actually reserved for the matching release. A request
+// larger than the whole budget is clamped so it can still run, alone.
+func (b *byteBudget) acquire(ctx context.Context, n int64) (int64, error) {
+	if b == nil || b.limit <= 0 {
+		return 0, nil
+	}
+	n = b.clamp(n)
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return n, nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// resize changes a reservation of held bytes to n without waiting and
+// returns the new amount to release
+func (b *byteBudget) resize(held, n int64) int64 {
+	if b == nil || b.limit <= 0 {
+		return 0
+	}
+	n = b.clamp(n)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += n - held
+	if n < held {
+		b.notifyLocked()
+	}
+	return n
+}
+
+// release returns n bytes reserved by acquire or resize
+func (b *byteBudget) release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.notifyLocked()
+}
+
+// clamp keeps a reservation within 1 byte and the whole budget
+func (b *byteBudget) clamp(n int64) int64 {
+	return min(max(n, 1), b.limit)
+}
+
+// notifyLocked wakes every waiting acquire
+func (b *byteBudget) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// inUse reports the bytes currently reserved
+func (b *byteBudget) inUse() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// downloadBudget is shared by every download; nil when unlimited
+var downloadBudget *byteBudget
+
+// downloadReservation is the budget a download with the given Content-Length
+// (-1 when unknown) and size cap should hold
+func downloadReservation(contentLength, maxBytes int64) int64 {
+	if contentLength >= 0 {
+		return contentLength
+	}
+	if maxBytes > 0 {
+		return min(maxBytes, unknownSizeEstimate)
+	}
+	return unknownSizeEstimate
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestByteBudgetBlocksWhenFull(t *testing.T) {
+	budget := newByteBudget(300)
+	ctx := context.Background()
+	a, _ := budget.acquire(ctx, 100)
+	b, _ := budget.acquire(ctx, 100)
+	c, _ := budget.acquire(ctx, 100)
+
+	acquired := make(chan int64, 1)
+	go func() {
+		n, _ := budget.acquire(ctx, 100)
+		acquired <- n
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("fourth download started while the budget was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	budget.release(a)
+	select {
+	case n := <-acquired:
+		budget.release(n)
+	case <-time.After(time.Second):
+		t.Fatal("fourth download did not start after a release")
+	}
+	budget.release(b)
+	budget.release(c)
+	if used := budget.inUse(); used != 0 {
+		t.Errorf("inUse = %d after releasing everything", used)
+	}
+}
+
+func TestByteBudgetClampsOversizedDownloads(t *testing.T) {
+	budget := newByteBudget(100)
+	n, _ := budget.acquire(context.Background(), 500)
+	if n != 100 {
+		t.Errorf("reserved = %d, want the whole budget", n)
+	}
+	budget.release(n)
+
+	var unlimited *byteBudget
+	if n, _ := unlimited.acquire(context.Background(), 500); n != 0 {
+		t.Errorf("nil budget reserved %d", n)
+	}
+	unlimited.release(0)
+}
+
+func TestByteBudgetAcquireCancelled(t *testing.T) {
+	budget := newByteBudget(100)
+	held, _ := budget.acquire(context.Background(), 100)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if n, err := budget.acquire(ctx, 50); !errors.Is(err, context.DeadlineExceeded) || n != 0 {
+		t.Errorf("acquire on a full budget = %d, %v; want the deadline", n, err)
+	}
+	budget.release(held)
+	if used := budget.inUse(); used != 0 {
+		t.Errorf("inUse = %d, want the abandoned wait to hold nothing", used)
+	}
+}
+
+func TestByteBudgetResize(t *testing.T) {
+	budget := newByteBudget(100)
+	held, _ := budget.acquire(context.Background(), 80)
+
+	acquired := make(chan int64, 1)
+	go func() {
+		n, _ := budget.acquire(context.Background(), 50)
+		acquired <- n
+	}()
+	held = budget.resize(held, 30)
+	select {
+	case n := <-acquired:
+		budget.release(n)
+	case <-time.After(time.Second):
+		t.Fatal("shrinking a reservation did not wake a waiting download")
+	}
+
+	// Growing never waits, even past the budget
+	held = budget.resize(held, 100)
+	if used := budget.inUse(); used != 100 {
+		t.Errorf("inUse = %d after growing, want 100", used)
+	}
+	budget.release(held)
+}
+
+func TestDownloadReservation(t *testing.T) {
+	tests := []struct {
+		contentLength, maxBytes, want int64
+	}{
+		{1000, 0, 1000},
+		{-1, 0, unknownSizeEstimate},
+		{-1, 4096, 4096},
+		{-1, 1 << 30, unknownSizeEstimate},
+	}
+	for _, tt := range tests {
+		if got := downloadReservation(tt.contentLength, tt.maxBytes); got != tt.want {
+			t.Errorf("downloadReservation(%d, %d) = %d, want %d", tt.contentLength, tt.maxBytes, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadWaitsForBudgetBeforeConnecting(t *testing.T) {
+	defer func(b *byteBudget) { downloadBudget = b }(downloadBudget)
+	downloadBudget = newByteBudget(100)
+	held, _ := downloadBudget.acquire(context.Background(), 100)
+	defer downloadBudget.release(held)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := downloadFile(ctx, server.URL, filepath.Join(t.TempDir(), "s.mp3")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline while waiting for the budget", err)
+	}
+	if requests.Load() != 0 {
+		t.Error("the request was sent before the budget had room")
+	}
+}
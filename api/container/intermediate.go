@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// ---------- Intermediate Format ----------
+//
+// Trims and gain are applied inside the final encode, so segments are only
+// ever encoded once. The generated inputs are not: the preamble and the
+// min_duration_seconds padding are rendered to MP3 files first and then
+// decoded and encoded again with everything else. intermediate_format
+// renders them as WAV or FLAC instead, so the final encode is the only
+// lossy pass, at the cost of larger temporary files. A lossless file never
+// matches the segments' codec, so auto falls back to the concat filter
+// (see checkDemuxerInputs) and an explicit demuxer join is rejected.
+
+const (
+	intermediateMP3  = "mp3" // Default: 128k MP3, the long-standing behavior
+	intermediateWAV  = "wav"
+	intermediateFLAC = "flac"
+)
+
+// validateIntermediateFormat checks intermediate_format and fills in the default
+func validateIntermediateFormat(req *ConcatRequest) error {
+	switch req.IntermediateFormat {
+	case "":
+		req.IntermediateFormat = intermediateMP3
+	case intermediateMP3, intermediateWAV, intermediateFLAC:
+	default:
+		return fmt.Errorf("intermediate_format must be one of %s, %s, %s", intermediateMP3, intermediateWAV, intermediateFLAC)
+	}
+	generated := hasPreamble(*req) || req.MinDurationSeconds > 0
+	if req.IntermediateFormat != intermediateMP3 && generated && req.ConcatMethod == concatDemuxer {
+		return fmt.Errorf("intermediate_format %q can't be joined by concat_method \"demuxer\"", req.IntermediateFormat)
+	}
+	return nil
+}
+
+// intermediateCodecArgs returns the codec arguments for a generated input
+func intermediateCodecArgs(format string) []string {
+	switch format {
+	case intermediateWAV:
+		return []string{"-c:a", "pcm_s16le"}
+	case intermediateFLAC:
+		return []string{"-c:a", "flac"}
+	}
+	return []string{"-c:a", "libmp3lame", "-b:a", "128k"}
+}
+
+// intermediateName returns the work dir name for a generated input
+func intermediateName(base, format string) string {
+	if format == "" {
+		format = intermediateMP3
+	}
+	return base + "." + format
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateIntermediateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ConcatRequest
+		want    string
+		wantErr bool
+	}{
+		{"default", ConcatRequest{}, intermediateMP3, false},
+		{"flac", ConcatRequest{IntermediateFormat: "flac"}, intermediateFLAC, false},
+		{"wav with auto padding", ConcatRequest{IntermediateFormat: "wav", ConcatMethod: concatAuto, MinDurationSeconds: 60}, intermediateWAV, false},
+		{"wav with demuxer preamble", ConcatRequest{IntermediateFormat: "wav", ConcatMethod: concatDemuxer, PreambleSilenceSeconds: 1}, "", true},
+		{"wav with demuxer, nothing generated", ConcatRequest{IntermediateFormat: "wav", ConcatMethod: concatDemuxer}, intermediateWAV, false},
+		{"unknown", ConcatRequest{IntermediateFormat: "ogg"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			err := validateIntermediateFormat(&req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && req.IntermediateFormat != tt.want {
+				t.Errorf("IntermediateFormat = %q, want %q", req.IntermediateFormat, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntermediateArgs(t *testing.T) {
+	got := preambleArgs(ConcatRequest{PreambleSilenceSeconds: 1, IntermediateFormat: intermediateFLAC}, "/w/preamble.flac")
+	want := []string{"-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "1", "-c:a", "flac", "-y", "/w/preamble.flac"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flac preamble args = %v, want %v", got, want)
+	}
+	got = paddingArgs(2, "2", intermediateWAV, "/w/padding.wav")
+	want = []string{"-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo", "-t", "2", "-c:a", "pcm_s16le", "-y", "/w/padding.wav"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wav padding args = %v, want %v", got, want)
+	}
+	if name := intermediateName("padding", ""); name != "padding.mp3" {
+		t.Errorf("default name = %q", name)
+	}
+	if name := intermediateName("preamble", intermediateWAV); name != "preamble.wav" {
+		t.Errorf("wav name = %q", name)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+)
+
+// ---------- Job Files ----------
+//
+// Every job gets its own MkdirTemp work dir, but intermediate artifacts are
+// also named with a per-job prefix. Two jobs that end up writing into the
+// same directory (a shared scratch volume, or files linked in from the
+// segment cache) can therefore never overwrite each other's list, segments,
+// or output. All work dir paths go through jobFiles rather than being joined
+// by hand.
+
+// jobFiles names the artifacts of one job
+type jobFiles struct {
+	dir    string
+	prefix string // "<random hex>_", unique per job
+}
+
+// newJobFiles returns the file namer for a job working in dir
+func newJobFiles(dir string) jobFiles {
+	token := make([]byte, 6)
+	rand.Read(token)
+	return jobFiles{dir: dir, prefix: hex.EncodeToString(token) + "_"}
+}
+
+// path returns the job's artifact called name
+func (f jobFiles) path(name string) string {
+	return filepath.Join(f.dir, f.prefix+name)
+}
+
+// segment returns the download path of segment i
+func (f jobFiles) segment(i int) string {
+	return f.path(fmt.Sprintf("segment_%04d.mp3", i))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestJobFilesShareDirWithoutCollisions(t *testing.T) {
+	dir := t.TempDir()
+	const jobs = 16
+
+	var wg sync.WaitGroup
+	results := make([]jobFiles, jobs)
+	errs := make(chan error, jobs)
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+			files := newJobFiles(dir)
+			results[j] = files
+			content := fmt.Sprintf("job %d", j)
+			for _, path := range []string{files.path("list.txt"), files.segment(0), files.path("output.mp3")} {
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					errs <- err
+					return
+				}
+			}
+			for p := 0; p < 3; p++ {
+				os.WriteFile(files.path(fmt.Sprintf("part_%03d.mp3", p)), []byte(content), 0644)
+			}
+		}(j)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	for j, files := range results {
+		want := fmt.Sprintf("job %d", j)
+		for _, path := range []string{files.path("list.txt"), files.segment(0), files.path("output.mp3")} {
+			if data, _ := os.ReadFile(path); string(data) != want {
+				t.Errorf("%s = %q, want %q", path, data, want)
+			}
+		}
+		parts, err := splitOutputFiles(files)
+		if err != nil || len(parts) != 3 {
+			t.Fatalf("job %d: parts = %v, err = %v", j, parts, err)
+		}
+		for _, p := range parts {
+			if data, _ := os.ReadFile(p); string(data) != want {
+				t.Errorf("job %d picked up %s holding %q", j, p, data)
+			}
+		}
+	}
+}
+
+func TestJobFilesPrefix(t *testing.T) {
+	a, b := newJobFiles("/w"), newJobFiles("/w")
+	if a.prefix == b.prefix {
+		t.Fatalf("two jobs share prefix %q", a.prefix)
+	}
+	if got := a.path("list.txt"); !strings.HasPrefix(got, "/w/"+a.prefix) || !strings.HasSuffix(got, "_list.txt") {
+		t.Errorf("path = %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ---------- Job Retries ----------
+//
+// Per-transfer retries cover the network; JOB_MAX_RETRIES covers the encode.
+// FFmpeg occasionally fails for reasons unrelated to the inputs: a resource
+// limit hit for a moment, an interrupted read on a busy disk. Re-running the
+// encode against the segments already in the work dir usually succeeds, and
+// is far cheaper than the client resubmitting the whole job. Outputs are
+// uploaded only after the encode, with one exception: with stream_upload a
+// PUT is already sending the failed run's bytes. That PUT is aborted
+// mid-body, so the target never completes the object, and the re-run's
+// output goes out as a regular upload once the encode succeeds.
+//
+// Only failures that look transient are retried. Bad input (undecodable
+// data, unknown codecs, invalid filter options) fails the same way every
+// time and is reported at once. A SIGKILL is not retried either: it is
+// almost always the OOM killer, and an immediate re-run would only add to
+// the memory pressure.
+
+// jobRetryDelay is the pause before the first re-run; it doubles after that
+var jobRetryDelay = 2 * time.Second
+
+// transientFFmpegErrors are stderr fragments of failures that can clear up
+// on their own
+var transientFFmpegErrors = []string{
+	"Resource temporarily unavailable",
+	"Cannot allocate memory",
+	"Interrupted system call",
+	"Device or resource busy",
+	"Input/output error",
+	"Too many open files",
+}
+
+// ffmpegRetryable reports whether a failed encode is worth re-running
+func ffmpegRetryable(err error, stderr string) bool {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return status.Signal() != syscall.SIGKILL
+		}
+	}
+	for _, fragment := range transientFFmpegErrors {
+		if strings.Contains(stderr, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearEncodeOutputs removes what a failed attempt left behind, so a
+// re-run can't mix its output with stale split parts or HLS segments
+func clearEncodeOutputs(files jobFiles, outputPath string, split, hls bool) {
+	switch {
+	case hls:
+		entries, _ := os.ReadDir(files.path("hls"))
+		for _, e := range entries {
+			os.Remove(filepath.Join(files.path("hls"), e.Name()))
+		}
+	case split:
+		parts, _ := filepath.Glob(files.path("part_*.mp3"))
+		for _, p := range parts {
+			os.Remove(p)
+		}
+	default:
+		os.Remove(outputPath + partialSuffix)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFFmpegRetryable(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 1").Run()
+	if ffmpegRetryable(exitErr, "segment_0003.mp3: Invalid data found when processing input") {
+		t.Error("bad input should not be retried")
+	}
+	if !ffmpegRetryable(exitErr, "av_read_frame: Resource temporarily unavailable") {
+		t.Error("EAGAIN should be retried")
+	}
+	if !ffmpegRetryable(errors.New("wrapped"), "Error opening input: Too many open files") {
+		t.Error("EMFILE should be retried")
+	}
+
+	if killed := exec.Command("sh", "-c", "kill -KILL $$").Run(); ffmpegRetryable(killed, "") {
+		t.Error("SIGKILL (OOM) should not be retried")
+	}
+	if terminated := exec.Command("sh", "-c", "kill -TERM $$").Run(); !ffmpegRetryable(terminated, "") {
+		t.Error("SIGTERM should be retried")
+	}
+}
+
+func TestClearEncodeOutputs(t *testing.T) {
+	files := newJobFiles(t.TempDir())
+	parts := []string{files.path("part_000.mp3"), files.path("part_001.mp3")}
+	keep := files.segment(0)
+	for _, p := range append(parts, keep) {
+		os.WriteFile(p, []byte("x"), 0644)
+	}
+
+	clearEncodeOutputs(files, files.path("output.mp3"), true, false)
+	for _, p := range parts {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", filepath.Base(p))
+		}
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("downloaded segment removed: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ---------- Job Pause/Resume ----------
+//
+// An operator can pause a running job to temporarily yield bandwidth and disk
+// to another workload. Pausing only gates the download loop between
+// segments: an FFmpeg encode that has started runs to completion. The job's
+// context (and its 60-minute deadline) stays alive while paused, so a long
+// pause can still time the job out. Jobs are addressed by episode_id; a job
+// without one, or sharing one with a running job, can't be controlled.
+
+// jobControl is the pause gate for one running job
+type jobControl struct {
+	priority int // Effective queue priority, reported by GET /jobs/{id}
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // Closed on resume; replaced on every pause
+}
+
+var (
+	jobsMutex sync.Mutex
+	jobs      = map[string]*jobControl{}
+)
+
+// registerJob makes the job with id controllable. It returns nil when id is
+// empty or already taken; the unregister func is always safe to call.
+func registerJob(id string, priority int) (*jobControl, func()) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	if id == "" || jobs[id] != nil {
+		return nil, func() {}
+	}
+	c := &jobControl{priority: priority}
+	jobs[id] = c
+	return c, func() {
+		jobsMutex.Lock()
+		delete(jobs, id)
+		jobsMutex.Unlock()
+	}
+}
+
+// lookupJob returns the control for a running job, or nil
+func lookupJob(id string) *jobControl {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return jobs[id]
+}
+
+// pause sets the gate; it reports false if the job was already paused
+func (c *jobControl) pause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return false
+	}
+	c.paused = true
+	c.resumed = make(chan struct{})
+	return true
+}
+
+// resume releases the gate; it reports false if the job wasn't paused
+func (c *jobControl) resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return false
+	}
+	c.paused = false
+	close(c.resumed)
+	return true
+}
+
+// waitWhilePaused blocks until the job is resumed or ctx is done. A nil
+// control (unregistered job) never blocks.
+func (c *jobControl) waitWhilePaused(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	paused, resumed := c.paused, c.resumed
+	c.mu.Unlock()
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setJobState updates containerStatus.State if it still describes job id
+func setJobState(id, state string) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	if containerStatus.JobID == id && containerStatus.State != "error" {
+		containerStatus.State = state
+	}
+}
+
+// handlePauseJob serves POST /jobs/{id}/pause
+func handlePauseJob(w http.ResponseWriter, r *http.Request) {
+	handleJobControl(w, r, "paused", (*jobControl).pause)
+}
+
+// handleResumeJob serves POST /jobs/{id}/resume
+func handleResumeJob(w http.ResponseWriter, r *http.Request) {
+	handleJobControl(w, r, "processing", (*jobControl).resume)
+}
+
+// handleJobControl applies change to the job named in the path and reports
+// the resulting state
+func handleJobControl(w http.ResponseWriter, r *http.Request, state string, change func(*jobControl) bool) {
+	if _, ok := readAuthorizedBody(w, r); !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	c := lookupJob(id)
+	if c == nil {
+		sendError(w, codeNotFound, fmt.Sprintf("No running job %q", id), http.StatusNotFound)
+		return
+	}
+	if !change(c) {
+		sendError(w, codeConflict, fmt.Sprintf("Job %q is already %s", id, state), http.StatusConflict)
+		return
+	}
+
+	setJobState(id, state)
+	fmt.Printf("[%s] Job %s by operator\n", id, state)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"job_id": id,
+		"state":  state,
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func jobRequest(t *testing.T, handler http.HandlerFunc, id string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/jobs/"+id+"/pause", nil)
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec.Code
+}
+
+func TestPauseResumeJob(t *testing.T) {
+	control, unregister := registerJob("ep-pause", 0)
+	defer unregister()
+
+	if code := jobRequest(t, handlePauseJob, "ep-missing"); code != http.StatusNotFound {
+		t.Errorf("pause unknown job: code = %d, want 404", code)
+	}
+	if code := jobRequest(t, handlePauseJob, "ep-pause"); code != http.StatusOK {
+		t.Fatalf("pause: code = %d", code)
+	}
+	if code := jobRequest(t, handlePauseJob, "ep-pause"); code != http.StatusConflict {
+		t.Errorf("second pause: code = %d, want 409", code)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- control.waitWhilePaused(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("waitWhilePaused returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if code := jobRequest(t, handleResumeJob, "ep-pause"); code != http.StatusOK {
+		t.Fatalf("resume: code = %d", code)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("waitWhilePaused: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitWhilePaused did not return after resume")
+	}
+	if code := jobRequest(t, handleResumeJob, "ep-pause"); code != http.StatusConflict {
+		t.Errorf("resume running job: code = %d, want 409", code)
+	}
+}
+
+func TestWaitWhilePausedCancelled(t *testing.T) {
+	control, unregister := registerJob("ep-cancel", 0)
+	defer unregister()
+	control.pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := control.waitWhilePaused(ctx); err == nil {
+		t.Error("expected context error while paused")
+	}
+
+	var unregistered *jobControl
+	if err := unregistered.waitWhilePaused(ctx); err != nil {
+		t.Errorf("nil control should never block: %v", err)
+	}
+}
+
+func TestRegisterJobDuplicate(t *testing.T) {
+	first, unregister := registerJob("ep-dup", 0)
+	defer unregister()
+	if first == nil {
+		t.Fatal("first registration failed")
+	}
+	if second, _ := registerJob("ep-dup", 0); second != nil {
+		t.Error("duplicate episode id should not be controllable")
+	}
+	if anon, _ := registerJob("", 0); anon != nil {
+		t.Error("empty episode id should not be controllable")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ---------- Loudness Profiles ----------
+//
+// Named presets for the loudnorm stage so callers don't need to know each
+// platform's numbers:
+//
+//	podcast    I=-16 TP=-1.5 LRA=11   Apple Podcasts / Spotify spoken word
+//	music      I=-14 TP=-1   LRA=11   Spotify / Apple Music streaming
+//	audiobook  I=-18 TP=-3   LRA=7    ACX: RMS -23..-18 dB, peaks under -3 dB
+//	youtube    I=-14 TP=-1   LRA=11   YouTube playback reference
+
+const defaultLoudnessProfile = "podcast"
+
+// loudnessPreset holds concrete loudnorm targets
+type loudnessPreset struct {
+	I, TP, LRA float64
+}
+
+var loudnessProfiles = map[string]loudnessPreset{
+	"podcast":   {I: -16, TP: -1.5, LRA: 11},
+	"music":     {I: -14, TP: -1, LRA: 11},
+	"audiobook": {I: -18, TP: -3, LRA: 7},
+	"youtube":   {I: -14, TP: -1, LRA: 11},
+}
+
+// LoudnessTarget overrides individual values of the selected profile
+type LoudnessTarget struct {
+	IntegratedLUFS *float64 `json:"integrated_lufs,omitempty"` // loudnorm I, -70..-5
+	TruePeakDB     *float64 `json:"true_peak_db,omitempty"`    // loudnorm TP, -9..0
+	LRA            *float64 `json:"lra,omitempty"`             // loudnorm LRA, 1..50
+}
+
+// resolveLoudness returns the profile with any explicit overrides applied.
+// An unknown profile falls back to the default; validateLoudness rejects it
+// before a job runs.
+func resolveLoudness(req ConcatRequest) loudnessPreset {
+	preset, ok := loudnessProfiles[req.LoudnessProfile]
+	if !ok {
+		preset = loudnessProfiles[defaultLoudnessProfile]
+	}
+	if l := req.Loudness; l != nil {
+		if l.IntegratedLUFS != nil {
+			preset.I = *l.IntegratedLUFS
+		}
+		if l.TruePeakDB != nil {
+			preset.TP = *l.TruePeakDB
+		}
+		if l.LRA != nil {
+			preset.LRA = *l.LRA
+		}
+	}
+	return preset
+}
+
+// validateLoudness checks the profile name and the resolved values against
+// the ranges loudnorm accepts
+func validateLoudness(req *ConcatRequest) error {
+	if req.LoudnessProfile == "" {
+		req.LoudnessProfile = defaultLoudnessProfile
+	}
+	if _, ok := loudnessProfiles[req.LoudnessProfile]; !ok {
+		names := make([]string, 0, len(loudnessProfiles))
+		for name := range loudnessProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("loudness_profile must be one of %s", strings.Join(names, ", "))
+	}
+
+	p := resolveLoudness(*req)
+	if p.I < -70 || p.I > -5 {
+		return errors.New("loudness.integrated_lufs must be between -70 and -5")
+	}
+	if p.TP < -9 || p.TP > 0 {
+		return errors.New("loudness.true_peak_db must be between -9 and 0")
+	}
+	if p.LRA < 1 || p.LRA > 50 {
+		return errors.New("loudness.lra must be between 1 and 50")
+	}
+	return nil
+}
+
+// filter renders the loudnorm stage
+func (p loudnessPreset) filter() string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s", formatFloat(p.I), formatFloat(p.TP), formatFloat(p.LRA))
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestResolveLoudness(t *testing.T) {
+	tests := []struct {
+		name string
+		req  ConcatRequest
+		want string
+	}{
+		{"default", ConcatRequest{}, podcastLoudnorm},
+		{"audiobook", ConcatRequest{LoudnessProfile: "audiobook"}, "loudnorm=I=-18:TP=-3:LRA=7"},
+		{"override", ConcatRequest{LoudnessProfile: "music", Loudness: &LoudnessTarget{TruePeakDB: floatPtr(-2)}}, "loudnorm=I=-14:TP=-2:LRA=11"},
+		{"override default", ConcatRequest{Loudness: &LoudnessTarget{IntegratedLUFS: floatPtr(-19)}}, "loudnorm=I=-19:TP=-1.5:LRA=11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveLoudness(tt.req).filter(); got != tt.want {
+				t.Errorf("filter = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLoudness(t *testing.T) {
+	req := &ConcatRequest{}
+	if err := validateLoudness(req); err != nil || req.LoudnessProfile != defaultLoudnessProfile {
+		t.Errorf("default: err = %v, profile = %q", err, req.LoudnessProfile)
+	}
+
+	invalid := map[string]*ConcatRequest{
+		"unknown profile": {LoudnessProfile: "broadcast"},
+		"I too high":      {Loudness: &LoudnessTarget{IntegratedLUFS: floatPtr(0)}},
+		"TP positive":     {Loudness: &LoudnessTarget{TruePeakDB: floatPtr(1)}},
+		"LRA zero":        {Loudness: &LoudnessTarget{LRA: floatPtr(0)}},
+	}
+	for name, req := range invalid {
+		if err := validateLoudness(req); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -3,9 +3,11 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -25,14 +27,24 @@ import (
 
 // ContainerStatus represents the current state of the FFmpeg container
 type ContainerStatus struct {
-	State              string     `json:"state"`               // idle, processing, error
+	SchemaVersion      int        `json:"schema_version"`      // See schemaVersion
+	State              string     `json:"state"`               // idle, processing, paused, error
 	JobID              string     `json:"job_id"`              // Episode ID of current job
 	StartedAt          *time.Time `json:"started_at"`          // When processing started
 	SegmentsTotal      int        `json:"segments_total"`      // Total segments to process
 	SegmentsDownloaded int        `json:"segments_downloaded"` // Segments downloaded so far
 	LastError          string     `json:"last_error"`          // Most recent error message
+
+	Resources *ResourceUsage `json:"resources,omitempty"`       // Sampled when /status is served
+	Breakers  []BreakerState `json:"upload_breakers,omitempty"` // Storage hosts with recent upload failures
 }
 
+// schemaVersion identifies the shape of the /status and /concat payloads
+// (and /info). Bump it only for breaking changes: a field removed, renamed,
+// or changing meaning. Adding an optional field doesn't need a bump, so
+// clients must ignore fields they don't know.
+const schemaVersion = 1
+
 // Global container status with mutex for thread-safe access
 var (
 	containerStatus = ContainerStatus{State: "idle"}
@@ -41,14 +53,369 @@ var (
 	shutdownCancel  context.CancelFunc
 )
 
+// shutdownRetryAfterSeconds is the Retry-After hint sent while shutting down,
+// long enough for the load balancer to route the retry to another instance
+const shutdownRetryAfterSeconds = 5
+
+// ---------- Configuration ----------
+
+// Config holds server settings read from the environment at startup
+type Config struct {
+	MaxSegmentBytes         int64         // MAX_SEGMENT_BYTES: per-segment download cap, 0 = unlimited
+	HMACSecret              string        // HMAC_SECRET: when set, /concat bodies must be signed
+	HMACMaxSkew             time.Duration // HMAC_MAX_SKEW_SECONDS: accepted X-Timestamp age
+	MaxRequestBodyBytes     int64         // MAX_REQUEST_BODY_BYTES: largest request body read, checked before the signature
+	MaxConcurrentJobs       int           // MAX_CONCURRENT_JOBS: /concat jobs run at once, 0 = unlimited
+	MaxQueuedJobs           int           // MAX_QUEUED_JOBS: requests that wait for a slot instead of 429, 0 = no queue
+	MaxManifestSegments     int           // MAX_MANIFEST_SEGMENTS: cap on segments expanded from a manifest
+	IdempotencyTTL          time.Duration // IDEMPOTENCY_TTL_SECONDS: how long completed results are replayed
+	TransferRetries         int           // TRANSFER_RETRIES: extra attempts for retryable download/upload errors
+	MaxJobsPerEpisode       int           // MAX_JOBS_PER_EPISODE: queued or running jobs allowed per episode_id, 0 = unlimited
+	JobMaxRetries           int           // JOB_MAX_RETRIES: encode re-runs after a transient FFmpeg failure
+	DownloadPrefetchDepth   int           // DOWNLOAD_PREFETCH_DEPTH: segments downloaded ahead of the one being checked, 0 = one at a time
+	MaxCPUTime              time.Duration // MAX_CPU_SECONDS: CPU time (user + system, all threads) one encode may use, 0 = unlimited
+	UploadBreakerThreshold  int           // UPLOAD_BREAKER_THRESHOLD: consecutive upload failures that open a host's breaker, 0 = off
+	UploadBreakerCooldown   time.Duration // UPLOAD_BREAKER_COOLDOWN_SECONDS: how long an open breaker refuses jobs
+	UploadConcurrency       int           // UPLOAD_CONCURRENCY: output_urls uploads in flight across all jobs, 0 = unlimited
+	UploadTimeout           time.Duration // UPLOAD_TIMEOUT_SECONDS: deadline for the upload phase, counted from its start, 0 = share the job deadline
+	SweepMinAge             time.Duration // SWEEP_MIN_AGE_SECONDS: age at which leftover work dirs are removed at startup, 0 = never
+	ServeOutputTTL          time.Duration // SERVE_OUTPUT_SECONDS: how long finished outputs are served at /outputs/{token}, 0 = off
+	AllowCustomFilters      bool          // ALLOW_CUSTOM_FILTERS: accept custom_audio_filter (unsanitized beyond basic checks)
+	DurationTolerance       time.Duration // DURATION_TOLERANCE_MS: allowed output vs input duration drift, 0 = no check
+	StrictDuration          bool          // STRICT_DURATION_CHECK: fail the job instead of warning on drift
+	ReadHeaderTimeout       time.Duration // READ_HEADER_TIMEOUT_SECONDS: time to receive request headers
+	ReadTimeout             time.Duration // READ_TIMEOUT_SECONDS: time to receive a whole request, body included
+	WriteTimeout            time.Duration // WRITE_TIMEOUT_SECONDS: response deadline, except /concat which uses the job timeout
+	IdleTimeout             time.Duration // IDLE_TIMEOUT_SECONDS: how long idle keep-alive connections stay open
+	MaxInflightBytes        int64         // MAX_INFLIGHT_DOWNLOAD_BYTES: total size of downloads in progress, 0 = unlimited
+	SegmentCacheDir         string        // SEGMENT_CACHE_DIR: keep ETag-revalidated segments here between jobs, empty = off
+	SegmentCacheMaxBytes    int64         // SEGMENT_CACHE_MAX_BYTES: evict least recently used segments beyond this
+	ConcatSafeMode          bool          // CONCAT_SAFE_MODE: relative list paths with -safe 1 instead of absolute paths with -safe 0
+	OTLPEndpoint            string        // OTEL_EXPORTER_OTLP_ENDPOINT: OTLP/HTTP collector base URL, empty = no tracing
+	OTelServiceName         string        // OTEL_SERVICE_NAME: service.name on exported spans
+	StorageEndpoint         string        // STORAGE_ENDPOINT: S3/R2 endpoint URL whose objects may be presigned
+	StorageRegion           string        // STORAGE_REGION: signing region ("auto" for R2)
+	StorageAccessKeyID      string        // STORAGE_ACCESS_KEY_ID: credentials for presigned download URLs, empty = off
+	StorageSecretKey        string        // STORAGE_SECRET_ACCESS_KEY
+	DownloadURLTTL          time.Duration // DOWNLOAD_URL_TTL_SECONDS: lifetime of presigned download URLs
+	MultipartThreshold      int64         // MULTIPART_THRESHOLD_BYTES: multipart-upload outputs this large to the storage endpoint, 0 = off
+	MultipartPartSize       int64         // MULTIPART_PART_SIZE_BYTES: multipart part size, at least 5 MiB
+	MaxDownloadBPS          int64         // MAX_DOWNLOAD_BPS: download read rate in bytes/s, 0 = unlimited
+	HTTPMaxIdleConns        int           // HTTP_MAX_IDLE_CONNS: idle keep-alive connections kept across all hosts
+	HTTPMaxIdleConnsPerHost int           // HTTP_MAX_IDLE_CONNS_PER_HOST: idle connections kept per storage host
+	HTTPIdleConnTimeout     time.Duration // HTTP_IDLE_CONN_TIMEOUT_SECONDS: how long an idle connection is kept
+	HTTPDialTimeout         time.Duration // HTTP_DIAL_TIMEOUT_SECONDS: TCP connect (and custom DNS) timeout
+	DNSServer               string        // DNS_SERVER: resolver host[:port] for outbound requests, empty = system
+	UserAgent               string        // HTTP_USER_AGENT: User-Agent sent on all outbound requests
+	DownloadThrottleScope   string        // DOWNLOAD_THROTTLE_SCOPE: "connection" (each download) or "aggregate" (all downloads)
+	FFmpegNice              int           // FFMPEG_NICE: nice value for FFmpeg processes, 0 = normal priority
+	FFmpegIOClass           string        // FFMPEG_IONICE_CLASS: "best-effort" or "idle" I/O scheduling, empty = unchanged
+	FFmpegIOLevel           int           // FFMPEG_IONICE_LEVEL: best-effort level, 0 (highest) to 7 (lowest)
+	AutoBitrateSpeechKbps   int           // AUTO_BITRATE_SPEECH_KBPS: auto_bitrate rung for mono, narrowband content
+	AutoBitrateMixedKbps    int           // AUTO_BITRATE_MIXED_KBPS: rung for content that is stereo or wideband
+	AutoBitrateMusicKbps    int           // AUTO_BITRATE_MUSIC_KBPS: rung for stereo, wideband content
+	AutoBitrateStereoDB     int           // AUTO_BITRATE_STEREO_DB: side level relative to mid at which an input counts as stereo
+	AutoBitrateHighBandDB   int           // AUTO_BITRATE_HIGH_BAND_DB: level above 5 kHz relative to mid at which an input counts as wideband
+	AutoBitrateMinShare     int           // AUTO_BITRATE_MIN_SHARE_PERCENT: share of the audio a class needs to set the bitrate
+}
+
+var config Config
+
+// loadConfig reads Config from environment variables, falling back to defaults
+func loadConfig() Config {
+	return Config{
+		MaxSegmentBytes:         envInt64("MAX_SEGMENT_BYTES", 0),
+		HMACSecret:              os.Getenv("HMAC_SECRET"),
+		HMACMaxSkew:             time.Duration(envInt64("HMAC_MAX_SKEW_SECONDS", 300)) * time.Second,
+		MaxRequestBodyBytes:     envInt64("MAX_REQUEST_BODY_BYTES", 32<<20),
+		MaxConcurrentJobs:       int(envInt64("MAX_CONCURRENT_JOBS", 0)),
+		MaxQueuedJobs:           int(envInt64("MAX_QUEUED_JOBS", 0)),
+		MaxManifestSegments:     int(envInt64("MAX_MANIFEST_SEGMENTS", 5000)),
+		IdempotencyTTL:          time.Duration(envInt64("IDEMPOTENCY_TTL_SECONDS", 3600)) * time.Second,
+		TransferRetries:         int(envInt64("TRANSFER_RETRIES", 2)),
+		MaxJobsPerEpisode:       int(envInt64("MAX_JOBS_PER_EPISODE", 1)),
+		JobMaxRetries:           int(envInt64("JOB_MAX_RETRIES", 0)),
+		DownloadPrefetchDepth:   int(envInt64("DOWNLOAD_PREFETCH_DEPTH", 0)),
+		MaxCPUTime:              time.Duration(envInt64("MAX_CPU_SECONDS", 0)) * time.Second,
+		UploadBreakerThreshold:  int(envInt64("UPLOAD_BREAKER_THRESHOLD", 5)),
+		UploadBreakerCooldown:   time.Duration(envInt64("UPLOAD_BREAKER_COOLDOWN_SECONDS", 60)) * time.Second,
+		UploadConcurrency:       int(envInt64("UPLOAD_CONCURRENCY", 0)),
+		UploadTimeout:           time.Duration(envInt64("UPLOAD_TIMEOUT_SECONDS", 900)) * time.Second,
+		SweepMinAge:             time.Duration(envInt64("SWEEP_MIN_AGE_SECONDS", 3600)) * time.Second,
+		ServeOutputTTL:          time.Duration(envInt64("SERVE_OUTPUT_SECONDS", 0)) * time.Second,
+		AllowCustomFilters:      envBool("ALLOW_CUSTOM_FILTERS", false),
+		DurationTolerance:       time.Duration(envInt64("DURATION_TOLERANCE_MS", 1000)) * time.Millisecond,
+		StrictDuration:          envBool("STRICT_DURATION_CHECK", false),
+		ReadHeaderTimeout:       time.Duration(envInt64("READ_HEADER_TIMEOUT_SECONDS", 10)) * time.Second,
+		ReadTimeout:             time.Duration(envInt64("READ_TIMEOUT_SECONDS", 300)) * time.Second,
+		WriteTimeout:            time.Duration(envInt64("WRITE_TIMEOUT_SECONDS", 60)) * time.Second,
+		IdleTimeout:             time.Duration(envInt64("IDLE_TIMEOUT_SECONDS", 120)) * time.Second,
+		MaxInflightBytes:        envInt64("MAX_INFLIGHT_DOWNLOAD_BYTES", 0),
+		SegmentCacheDir:         os.Getenv("SEGMENT_CACHE_DIR"),
+		SegmentCacheMaxBytes:    envInt64("SEGMENT_CACHE_MAX_BYTES", 1<<30),
+		ConcatSafeMode:          envBool("CONCAT_SAFE_MODE", false),
+		OTLPEndpoint:            os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTelServiceName:         envString("OTEL_SERVICE_NAME", "ffmpeg-container"),
+		StorageEndpoint:         os.Getenv("STORAGE_ENDPOINT"),
+		StorageRegion:           envString("STORAGE_REGION", "auto"),
+		StorageAccessKeyID:      os.Getenv("STORAGE_ACCESS_KEY_ID"),
+		StorageSecretKey:        os.Getenv("STORAGE_SECRET_ACCESS_KEY"),
+		DownloadURLTTL:          time.Duration(envInt64("DOWNLOAD_URL_TTL_SECONDS", int64(defaultDownloadURLTTL.Seconds()))) * time.Second,
+		MultipartThreshold:      envInt64("MULTIPART_THRESHOLD_BYTES", 0),
+		MultipartPartSize:       envInt64("MULTIPART_PART_SIZE_BYTES", 16<<20),
+		MaxDownloadBPS:          envInt64("MAX_DOWNLOAD_BPS", 0),
+		HTTPMaxIdleConns:        int(envInt64("HTTP_MAX_IDLE_CONNS", 100)),
+		HTTPMaxIdleConnsPerHost: int(envInt64("HTTP_MAX_IDLE_CONNS_PER_HOST", 16)),
+		HTTPIdleConnTimeout:     time.Duration(envInt64("HTTP_IDLE_CONN_TIMEOUT_SECONDS", 90)) * time.Second,
+		HTTPDialTimeout:         time.Duration(envInt64("HTTP_DIAL_TIMEOUT_SECONDS", 30)) * time.Second,
+		DNSServer:               os.Getenv("DNS_SERVER"),
+		UserAgent:               envString("HTTP_USER_AGENT", defaultUserAgent),
+		DownloadThrottleScope:   envString("DOWNLOAD_THROTTLE_SCOPE", throttleConnection),
+		FFmpegNice:              int(envInt64("FFMPEG_NICE", 0)),
+		FFmpegIOClass:           os.Getenv("FFMPEG_IONICE_CLASS"),
+		FFmpegIOLevel:           int(envInt64("FFMPEG_IONICE_LEVEL", 4)),
+		AutoBitrateSpeechKbps:   int(envInt64("AUTO_BITRATE_SPEECH_KBPS", 64)),
+		AutoBitrateMixedKbps:    int(envInt64("AUTO_BITRATE_MIXED_KBPS", 96)),
+		AutoBitrateMusicKbps:    int(envInt64("AUTO_BITRATE_MUSIC_KBPS", 192)),
+		AutoBitrateStereoDB:     int(envInt64("AUTO_BITRATE_STEREO_DB", -20)),
+		AutoBitrateHighBandDB:   int(envInt64("AUTO_BITRATE_HIGH_BAND_DB", -25)),
+		AutoBitrateMinShare:     int(envInt64("AUTO_BITRATE_MIN_SHARE_PERCENT", 10)),
+	}
+}
+
+// envString returns an environment variable, or def when unset
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// envBool parses a boolean environment variable, returning def when unset or invalid
+func envBool(name string, def bool) bool {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		fmt.Printf("Warning: ignoring invalid %s=%q: %v\n", name, raw, err)
+		return def
+	}
+	return v
+}
+
+// envInt64 parses an integer environment variable, returning def when unset or invalid
+func envInt64(name string, def int64) int64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		fmt.Printf("Warning: ignoring invalid %s=%q: %v\n", name, raw, err)
+		return def
+	}
+	return v
+}
+
 // ---------- Existing Types ----------
 
 // ConcatRequest is the request body for /concat endpoint
 type ConcatRequest struct {
-	EpisodeID string           `json:"episode_id"` // Episode ID for logging
-	Segments  []string         `json:"segments"`   // Signed URLs for input MP3 files
-	OutputURL string           `json:"output_url"` // Signed URL for uploading result
-	Metadata  ConcatMetadata   `json:"metadata"`
+	EpisodeID string         `json:"episode_id"` // Episode ID for logging
+	Segments  []Segment      `json:"segments"`   // Signed URLs for input MP3 files, optionally trimmed
+	OutputURL string         `json:"output_url"` // Signed URL for uploading result
+	Metadata  ConcatMetadata `json:"metadata"`
+
+	// Optional: URL of a JSON or M3U playlist listing the segments, used
+	// instead of inline Segments for large episodes (see manifest.go)
+	ManifestURL string `json:"manifest_url,omitempty"`
+
+	// Optional: publish to several destinations from one encode. The first
+	// URL is the primary; replaces OutputURL. Mirror failures are reported but
+	// only fail the job when RequireAllUploads is set.
+	OutputURLs        []string `json:"output_urls,omitempty"`
+	RequireAllUploads bool     `json:"require_all_uploads,omitempty"`
+
+	// Optional: "put" (default) or "post" for a multipart form upload of
+	// the output, e.g. to an S3 presigned POST; UploadFormFields are the
+	// signed policy fields sent before the file (see formupload.go)
+	UploadMethod     string            `json:"upload_method,omitempty"`
+	UploadFormFields map[string]string `json:"upload_form_fields,omitempty"`
+
+	// Optional: split the output into parts of at most this many seconds.
+	// Each part is uploaded to OutputURLTemplate with {part} replaced by its
+	// zero-padded index (000, 001, ...); OutputURL is ignored.
+	SplitDurationSeconds float64 `json:"split_duration_seconds,omitempty"`
+	OutputURLTemplate    string  `json:"output_url_template,omitempty"`
+
+	// Optional: "mp3" (default) or "hls" for an AAC/MPEG-TS playlist whose
+	// files are uploaded to OutputURLTemplate with {file} replaced by each
+	// name. HLSSegmentSeconds is the target segment length (default 6).
+	OutputFormat      string  `json:"output_format,omitempty"`
+	HLSSegmentSeconds float64 `json:"hls_segment_seconds,omitempty"`
+
+	// Optional: "url" (default) uploads to OutputURL; "hash" uploads to
+	// OutputURLTemplate with {sha256} replaced by the output's digest
+	OutputNaming string `json:"output_naming,omitempty"`
+
+	// Optional: named loudness preset (default "podcast"); fields set in
+	// Loudness override the preset's values
+	LoudnessProfile string          `json:"loudness_profile,omitempty"`
+	Loudness        *LoudnessTarget `json:"loudness,omitempty"`
+
+	// Optional: playback speed multiplier without pitch change (default 1.0)
+	SpeedFactor float64 `json:"speed_factor,omitempty"`
+
+	// Optional: fixed gain in dB applied before loudnorm, or before the
+	// custom filter that replaces it
+	GainDB float64 `json:"gain_db,omitempty"`
+
+	// Optional: "demuxer", "filter", or "auto" (default); see resolveConcatMethod
+	ConcatMethod string `json:"concat_method,omitempty"`
+
+	// Optional: "reencode" (default) or "auto", which copies already
+	// compatible inputs without re-encoding or normalizing; see streamcopy.go
+	EncodeMode string `json:"encode_mode,omitempty"`
+
+	// Optional: attenuate low-level noise between words; omitted = no gate
+	NoiseGate *NoiseGate `json:"noise_gate,omitempty"`
+
+	// Optional: parametric EQ bands applied after the noise gate; omitted =
+	// no EQ
+	EQBands []EQBand `json:"eq_bands,omitempty"`
+
+	// Optional: raw FFmpeg filter chain, "append"ed after (default) or
+	// "replace"-ing loudnorm. Requires ALLOW_CUSTOM_FILTERS; see customfilter.go
+	CustomAudioFilter string `json:"custom_audio_filter,omitempty"`
+	CustomFilterMode  string `json:"custom_filter_mode,omitempty"`
+
+	// Optional: dry-run the filter chain and encoder options on generated
+	// silence before downloading; implied by custom_audio_filter
+	ValidateFilterChain bool `json:"validate_filter_chain,omitempty"`
+
+	// Optional: "cbr" (default) with BitrateKbps, or "vbr" with VBRQuality
+	// (libmp3lame -q:a, 0 = best, 9 = smallest). The two are exclusive.
+	BitrateMode string `json:"bitrate_mode,omitempty"`
+	BitrateKbps int    `json:"bitrate_kbps,omitempty"` // Default 128
+	VBRQuality  *int   `json:"vbr_quality,omitempty"`  // Default 4
+
+	// Optional: pick the CBR bitrate from the AUTO_BITRATE_* ladder by
+	// measuring whether the inputs are speech or music; an explicit
+	// BitrateKbps wins. See autobitrate.go.
+	AutoBitrate bool `json:"auto_bitrate,omitempty"`
+
+	// Optional: encoder sample format (-sample_fmt), e.g. "s16p" or "fltp";
+	// empty leaves FFmpeg's choice
+	SampleFormat string `json:"sample_format,omitempty"`
+
+	// Optional: output channel layout, "mono", "stereo", or "5.1" (HLS
+	// only); empty keeps the input layout
+	ChannelLayout string `json:"channel_layout,omitempty"`
+
+	// Optional: skip segments that fail to download or don't probe as audio
+	// instead of failing the job; skipped segments are listed in the response
+	SkipCorruptSegments bool `json:"skip_corrupt_segments,omitempty"`
+
+	// Optional: ID3v2 tag version, 3 for older players or 4 (default)
+	ID3Version int `json:"id3_version,omitempty"`
+
+	// Optional: write no tags at all, neither request metadata nor tags
+	// carried over from the inputs; excludes metadata and id3_version
+	StripMetadata bool `json:"strip_metadata,omitempty"`
+
+	// Optional: upload an output with no audio (probed duration under a
+	// tenth of a second) instead of failing with empty_output
+	AllowEmpty bool `json:"allow_empty,omitempty"`
+
+	// Optional: PUT output_url while FFmpeg is still writing it, for
+	// targets that accept chunked uploads; falls back to a regular upload
+	// after the encode
+	StreamUpload bool `json:"stream_upload,omitempty"`
+
+	// Optional: upload output_url as an S3 multipart upload signed with the
+	// container's credentials even when it is presigned. See multipart.go.
+	MultipartUpload bool `json:"multipart_upload,omitempty"`
+
+	// Optional: resume the multipart upload a failed job returned under
+	// "multipart"; parts already stored with a matching checksum are not
+	// sent again. See multipart.go.
+	MultipartUploadID string `json:"multipart_upload_id,omitempty"`
+
+	// Optional: URL of a previously produced output to extend. It is
+	// downloaded as the first input and the new segments are joined after
+	// it; the whole result is re-normalized and re-encoded.
+	AppendToURL string `json:"append_to_url,omitempty"`
+
+	// Optional: prepend this many seconds of generated lead-in before the
+	// first segment; silence unless PreambleToneHz selects a sine tone
+	PreambleSilenceSeconds float64 `json:"preamble_silence_seconds,omitempty"`
+	PreambleToneHz         float64 `json:"preamble_tone_hz,omitempty"`
+
+	// Optional: append silence so the output lasts at least this long;
+	// longer content is left as is. See padding.go.
+	MinDurationSeconds float64 `json:"min_duration_seconds,omitempty"`
+
+	// Optional: format of the generated preamble and padding before the
+	// final encode, "mp3" (default), or lossless "wav" or "flac" so the
+	// final encode is the only lossy pass. See intermediate.go.
+	IntermediateFormat string `json:"intermediate_format,omitempty"`
+
+	// Optional: run the encode at -loglevel verbose and keep its log, uploaded
+	// to DebugLogURL when set or returned as ffmpeg_log otherwise
+	Debug       bool   `json:"debug,omitempty"`
+	DebugLogURL string `json:"debug_log_url,omitempty"`
+
+	// Optional: return a presigned GET URL for each uploaded object. Needs
+	// storage credentials in the container (STORAGE_* env).
+	GenerateDownloadURL bool `json:"generate_download_url,omitempty"`
+
+	// Optional: compute min/max peaks for waveform rendering. Returned inline
+	// unless WaveformURL is set, in which case the JSON is uploaded there.
+	GenerateWaveform bool   `json:"generate_waveform,omitempty"`
+	WaveformBuckets  int    `json:"waveform_buckets,omitempty"` // Default 1000
+	WaveformURL      string `json:"waveform_url,omitempty"`
+
+	// Optional: render a PNG spectrogram of the output for QA. Uploaded to
+	// SpectrogramURL when set, otherwise returned inline if small enough.
+	GenerateSpectrogram bool   `json:"generate_spectrogram,omitempty"`
+	SpectrogramWidth    int    `json:"spectrogram_width,omitempty"`  // Default 1024
+	SpectrogramHeight   int    `json:"spectrogram_height,omitempty"` // Default 512
+	SpectrogramURL      string `json:"spectrogram_url,omitempty"`
+
+	// Optional: scan each segment for clipping before the encode and list
+	// the clipped ones; costs a decode per segment
+	DetectClipping bool `json:"detect_clipping,omitempty"`
+
+	// Optional: flag segments whose probed bitrate is below this, warning
+	// (default) or failing the job in "strict" mode; see bitratecheck.go
+	MinInputBitrateKbps int    `json:"min_input_bitrate_kbps,omitempty"`
+	MinInputBitrateMode string `json:"min_input_bitrate_mode,omitempty"`
+
+	// Optional: queue priority, -10 to 10 (clamped); higher runs first and
+	// equal priorities run in arrival order. Default 0 (normal)
+	Priority int `json:"priority,omitempty"`
+
+	// Optional: downmix to mono when every stereo input has a near-silent
+	// channel; see automono.go. Threshold defaults to -60 dB.
+	AutoMono            bool     `json:"auto_mono,omitempty"`
+	AutoMonoThresholdDB *float64 `json:"auto_mono_threshold_db,omitempty"`
+
+	// monoDownmix is set by the auto_mono analysis, never by the client
+	monoDownmix bool
+
+	// encoderOption names the encoder setting the client gave explicitly,
+	// recorded by validateRequest before defaults are filled in
+	encoderOption string
+
+	// Optional: PUT a JSON summary of the output (duration, size, tags,
+	// loudness target, waveform) here after the audio upload; see sidecar.go
+	SidecarURL string `json:"sidecar_url,omitempty"`
+
+	// Optional: strip inherited tags, version strings, and timestamps so
+	// identical inputs give byte-identical outputs; see deterministic.go
+	Deterministic bool `json:"deterministic,omitempty"`
 }
 
 // ConcatMetadata contains ID3 tag metadata
@@ -57,17 +424,140 @@ type ConcatMetadata struct {
 	Artist string `json:"artist"`
 	Album  string `json:"album"`
 	Genre  string `json:"genre"`
+
+	// Optional release date: RFC 3339, YYYY-MM-DD, YYYY-MM or YYYY,
+	// normalized for id3_version; see metadatadate.go
+	Date string `json:"date,omitempty"`
+
+	// Optional podcast fields; see metadata.go for the frames written
+	Season   int   `json:"season,omitempty"`
+	Episode  int   `json:"episode,omitempty"`
+	Explicit *bool `json:"explicit,omitempty"`
 }
 
 // ConcatResponse is the response body for /concat endpoint
 type ConcatResponse struct {
-	Success         bool    `json:"success"`
+	SchemaVersion   int              `json:"schema_version"` // See schemaVersion
+	Success         bool             `json:"success"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	FileSize        int64            `json:"file_size"`
+	OutputURL       string           `json:"output_url,omitempty"`   // Where the output was uploaded (resolved for hash naming)
+	DownloadURL     string           `json:"download_url,omitempty"` // Presigned GET URL, with generate_download_url
+	ServedPath      string           `json:"served_path,omitempty"`  // /outputs/{token} on this container, with SERVE_OUTPUT_SECONDS
+	Error           string           `json:"error,omitempty"`
+	ErrorCode       ErrorCode        `json:"error_code,omitempty"`      // Stable failure class; see errcodes.go
+	Retryable       bool             `json:"retryable,omitempty"`       // Failure was transient (network, 5xx, 429)
+	StreamCopied    bool             `json:"stream_copied,omitempty"`   // encode_mode "auto" copied the inputs without re-encoding
+	JobRetries      int              `json:"job_retries,omitempty"`     // Encode re-runs after transient FFmpeg failures
+	StreamedUpload  bool             `json:"streamed_upload,omitempty"` // stream_upload published the output during the encode
+	Multipart       *MultipartResult `json:"multipart,omitempty"`       // The output's multipart upload, on failure too so it can be resumed
+
+	Clipping           []ClippingReport     `json:"clipping,omitempty"`             // Clipped segments, with detect_clipping
+	AutoMono           *AutoMonoDecision    `json:"auto_mono,omitempty"`            // Downmix decision, with auto_mono
+	AutoBitrate        *AutoBitrateDecision `json:"auto_bitrate,omitempty"`         // Chosen bitrate, with auto_bitrate
+	PaddedSeconds      float64              `json:"padded_seconds,omitempty"`       // Silence appended to reach min_duration_seconds
+	LowBitrateSegments []LowBitrateSegment  `json:"low_bitrate_segments,omitempty"` // Segments below min_input_bitrate_kbps
+
+	// Tags read back from the output with ffprobe, keyed in lower case;
+	// absent for HLS or without ffprobe. See tagverify.go.
+	WrittenMetadata map[string]string `json:"written_metadata,omitempty"`
+
+	Parts            []OutputPart `json:"parts,omitempty"`              // Set when the output was split
+	PlaylistURL      string       `json:"playlist_url,omitempty"`       // output_format "hls"
+	MediaSegmentURLs []string     `json:"media_segment_urls,omitempty"` // output_format "hls", in playlist order
+	Waveform         *Waveform    `json:"waveform,omitempty"`           // Set when generated and not uploaded
+	Spectrogram      *Spectrogram `json:"spectrogram,omitempty"`        // With generate_spectrogram, unless it was skipped
+	Warnings         []string     `json:"warnings,omitempty"`           // Non-fatal problems with optional features
+
+	SkippedSegments []SkippedSegment `json:"skipped_segments,omitempty"` // Lenient mode only
+	FFmpegLog       string           `json:"ffmpeg_log,omitempty"`       // Debug mode without debug_log_url
+	Uploads         []UploadResult   `json:"uploads,omitempty"`          // Set when output_urls was used
+	FailedMirrors   []string         `json:"failed_mirrors,omitempty"`   // Mirror URLs that failed; retry them with /reupload
+}
+
+// SkippedSegment records a segment left out by skip_corrupt_segments
+type SkippedSegment struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// OutputPart describes one uploaded file of a split output
+type OutputPart struct {
+	Index           int     `json:"index"`
+	URL             string  `json:"url"`
 	DurationSeconds float64 `json:"duration_seconds"`
 	FileSize        int64   `json:"file_size"`
-	Error           string  `json:"error,omitempty"`
+	DownloadURL     string  `json:"download_url,omitempty"` // Presigned GET URL, with generate_download_url
+}
+
+// JobSummary is the single terminal log record emitted for every /concat job.
+// Field names are stable so log-based analytics can rely on them.
+type JobSummary struct {
+	Event           string    `json:"event"` // Always "job_summary"
+	EpisodeID       string    `json:"episode_id"`
+	Success         bool      `json:"success"`
+	Error           string    `json:"error,omitempty"`
+	SegmentCount    int       `json:"segment_count"`
+	SegmentsSkipped int       `json:"segments_skipped"`
+	BytesDownloaded int64     `json:"bytes_downloaded"`
+	OutputBytes     int64     `json:"output_bytes"`
+	DurationSeconds float64   `json:"duration_seconds"` // Duration of the produced audio
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	TotalMs         int64     `json:"total_ms"`
+	EncodeCPUMs     int64     `json:"encode_cpu_ms"` // FFmpeg user + system time for the main encode, all runs
+	Phases          JobPhases `json:"phases"`
+}
+
+// JobPhases records wall-clock milliseconds spent in each job phase
+type JobPhases struct {
+	DownloadMs int64 `json:"download_ms"`
+	EncodeMs   int64 `json:"encode_ms"`
+	ProbeMs    int64 `json:"probe_ms"`
+	AnalysisMs int64 `json:"analysis_ms"`
+	UploadMs   int64 `json:"upload_ms"`
+}
+
+// logJobSummary writes the summary to stdout as one JSON line
+func logJobSummary(summary JobSummary) {
+	summary.Event = "job_summary"
+	summary.FinishedAt = time.Now()
+	summary.TotalMs = summary.FinishedAt.Sub(summary.StartedAt).Milliseconds()
+
+	line, err := json.Marshal(summary)
+	if err != nil {
+		fmt.Printf("[%s] Warning: failed to encode job summary: %v\n", summary.EpisodeID, err)
+		return
+	}
+	fmt.Println(string(line))
+}
+
+// serverTiming renders phases as a Server-Timing header value so the
+// breakdown shows up in browser devtools and curl -v. Phases that didn't
+// run are left out; total covers the job so far.
+func serverTiming(phases JobPhases, total time.Duration) string {
+	var metrics []string
+	for _, p := range []struct {
+		name string
+		ms   int64
+	}{
+		{"download", phases.DownloadMs},
+		{"encode", phases.EncodeMs},
+		{"probe", phases.ProbeMs},
+		{"analysis", phases.AnalysisMs},
+		{"upload", phases.UploadMs},
+	} {
+		if p.ms > 0 {
+			metrics = append(metrics, fmt.Sprintf("%s;dur=%d", p.name, p.ms))
+		}
+	}
+	metrics = append(metrics, fmt.Sprintf("total;dur=%d", total.Milliseconds()))
+	return strings.Join(metrics, ", ")
 }
 
 func main() {
+	config = loadConfig()
+
 	// Initialize shutdown context for graceful shutdown (US3)
 	shutdownCtx, shutdownCancel = context.WithCancel(context.Background())
 
@@ -80,9 +570,48 @@ func main() {
 		shutdownCancel()
 	}()
 
-	http.HandleFunc("/concat", handleConcat)
+	if config.MaxInflightBytes > 0 {
+		downloadBudget = newByteBudget(config.MaxInflightBytes)
+	}
+	if config.UploadConcurrency > 0 {
+		uploadSlots = make(chan struct{}, config.UploadConcurrency)
+	}
+	downloadSigner = newDownloadSigner()
+	multipartStorage = newMultipartStore()
+	httpClient = newHTTPClient(config)
+	fmt.Printf("Outbound User-Agent: %s\n", config.UserAgent)
+	setupDownloadThrottle()
+
+	// Startup validation: readiness stays false if FFmpeg is missing
+	checkBinaries()
+	setupFFmpegPriority()
+
+	// Reclaim work dirs leaked by a previous process that was killed mid-job
+	// Retained outputs from a previous process can no longer be looked up
+	os.RemoveAll(servedOutputsDir)
+
+	if config.SweepMinAge > 0 {
+		if n := sweepWorkDirs(os.TempDir(), config.SweepMinAge, time.Now()); n > 0 {
+			fmt.Printf("Startup sweep removed %d orphaned work dirs\n", n)
+		}
+	}
+
+	// Allow a minute past the job timeout to write the final response
+	http.HandleFunc("/concat", withWriteDeadline(maxQueueWait+jobTimeout+config.UploadTimeout+time.Minute, withIdempotency(handleConcat)))
 	http.HandleFunc("/health", handleHealth)
-	http.HandleFunc("/status", handleStatus) // US2: Status endpoint
+	http.HandleFunc("/healthz", handleHealth) // Liveness
+	http.HandleFunc("/readyz", handleReadyz)  // Readiness
+	http.HandleFunc("/status", handleStatus)  // US2: Status endpoint
+	http.HandleFunc("/info", handleInfo)
+	http.HandleFunc("/preflight", handlePreflight)
+	http.HandleFunc("/plan", handlePlan)
+	http.HandleFunc("/reupload", withWriteDeadline(jobTimeout+config.UploadTimeout+time.Minute, handleReupload))
+	http.HandleFunc("/reset", handleReset)
+	http.HandleFunc("/drain", handleDrain)
+	http.HandleFunc("GET /jobs/{id}", handleGetJob)
+	http.HandleFunc("GET /outputs/{token}", handleGetOutput)
+	http.HandleFunc("POST /jobs/{id}/pause", handlePauseJob)
+	http.HandleFunc("POST /jobs/{id}/resume", handleResumeJob)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -90,7 +619,7 @@ func main() {
 	}
 
 	fmt.Printf("Starting server on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := newServer(":"+port, nil).ListenAndServe(); err != nil {
 		fmt.Printf("Server error: %v\n", err)
 		os.Exit(1)
 	}
@@ -100,44 +629,326 @@ func main() {
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		sendError(w, codeMethodNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	statusMutex.RLock()
 	status := containerStatus
 	statusMutex.RUnlock()
+	status.SchemaVersion = schemaVersion
+
+	usage := sampleResourceUsage()
+	status.Resources = &usage
+	status.Breakers = breakerStates(time.Now())
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
 
+// handleReset clears a stale error state so dashboards show the container as
+// idle again. It refuses while any job is running.
+func handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, codeMethodNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := readAuthorizedBody(w, r); !ok {
+		return
+	}
+
+	if activeJobs.Load() > 0 {
+		sendError(w, codeConflict, "Cannot reset while a job is processing", http.StatusConflict)
+		return
+	}
+
+	statusMutex.Lock()
+	previous := containerStatus.State
+	containerStatus = ContainerStatus{State: "idle"}
+	statusMutex.Unlock()
+
+	fmt.Printf("Status reset from %q to idle\n", previous)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":         "idle",
+		"previous_state": previous,
+	})
+}
+
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// validateRequest rejects invalid option combinations and fills in defaults
+func validateRequest(req *ConcatRequest) error {
+	req.encoderOption = explicitEncoderOption(*req)
+	if req.ManifestURL != "" {
+		if len(req.Segments) > 0 {
+			return errors.New("segments and manifest_url are mutually exclusive")
+		}
+	} else if len(req.Segments) == 0 {
+		return errors.New("No segments provided")
+	}
+	for i, seg := range req.Segments {
+		if err := seg.validate(); err != nil {
+			return fmt.Errorf("segments[%d]: %v", i, err)
+		}
+	}
+
+	if len(req.OutputURLs) > 0 {
+		if req.OutputURL != "" {
+			return errors.New("output_url and output_urls are mutually exclusive")
+		}
+		if req.SplitDurationSeconds > 0 {
+			return errors.New("output_urls is not supported with split output")
+		}
+		for i, u := range req.OutputURLs {
+			if u == "" {
+				return fmt.Errorf("output_urls[%d] is empty", i)
+			}
+		}
+		req.OutputURL = req.OutputURLs[0]
+	}
+
+	if err := validateOutputNaming(req); err != nil {
+		return err
+	}
+	hashNaming := req.OutputNaming == outputNamingHash
+	if err := validateOutputFormat(req); err != nil {
+		return err
+	}
+	hls := req.OutputFormat == outputFormatHLS
+	if err := validateUploadMethod(req, hls, hashNaming); err != nil {
+		return err
+	}
+	if err := validateStreamUpload(req, hls, hashNaming); err != nil {
+		return err
+	}
+	if err := validateMultipartUpload(req, hls); err != nil {
+		return err
+	}
+	if err := validateSpectrogram(req, hls); err != nil {
+		return err
+	}
+	if err := validateChannelLayout(req, hls); err != nil {
+		return err
+	}
+
+	if req.SplitDurationSeconds < 0 {
+		return errors.New("split_duration_seconds must not be negative")
+	}
+	if req.SplitDurationSeconds > 0 && req.SplitDurationSeconds < minSplitDurationSeconds {
+		return fmt.Errorf("split_duration_seconds must be at least %d", minSplitDurationSeconds)
+	}
+	if req.SplitDurationSeconds > 0 {
+		// Hashes already give each part a distinct name
+		if !hashNaming && !strings.Contains(req.OutputURLTemplate, partPlaceholder) {
+			return fmt.Errorf("output_url_template must contain %s when splitting", partPlaceholder)
+		}
+	} else if req.OutputURL == "" && !hashNaming && !hls {
+		return errors.New("No output URL provided")
+	}
+
+	switch req.ConcatMethod {
+	case "":
+		req.ConcatMethod = concatAuto
+	case concatAuto, concatDemuxer, concatFilter:
+	default:
+		return fmt.Errorf("concat_method must be one of %s, %s, %s", concatAuto, concatDemuxer, concatFilter)
+	}
+	if req.ConcatMethod == concatDemuxer && hasSegmentGain(req.Segments) {
+		return errors.New("segment gain_db needs concat_method \"filter\" or \"auto\"")
+	}
+
+	if req.NoiseGate != nil {
+		if err := req.NoiseGate.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateEQ(req); err != nil {
+		return err
+	}
+
+	if err := validateBitrate(req); err != nil {
+		return err
+	}
+	if err := validateAutoBitrate(req); err != nil {
+		return err
+	}
+	if err := validateSampleFormat(req); err != nil {
+		return err
+	}
+	if err := validateEncodeMode(req); err != nil {
+		return err
+	}
+	if err := validateAutoMono(req); err != nil {
+		return err
+	}
+
+	if err := validateStripMetadata(req); err != nil {
+		return err
+	}
+	if req.ID3Version == 0 {
+		req.ID3Version = defaultID3Version
+	}
+	if req.ID3Version != 3 && req.ID3Version != 4 {
+		return errors.New("id3_version must be 3 or 4")
+	}
+	if err := validateMetadataText(req.Metadata); err != nil {
+		return err
+	}
+	if err := validateMetadataDate(req); err != nil {
+		return err
+	}
+
+	if req.Metadata.Season < 0 || req.Metadata.Episode < 0 {
+		return errors.New("metadata.season and metadata.episode must not be negative")
+	}
+
+	if req.DebugLogURL != "" && !req.Debug {
+		return errors.New("debug_log_url requires debug")
+	}
+
+	if req.GenerateDownloadURL && downloadSigner == nil {
+		return errors.New("generate_download_url requires storage credentials (STORAGE_* env)")
+	}
+
+	if req.GenerateWaveform {
+		if req.SplitDurationSeconds > 0 {
+			return errors.New("generate_waveform is not supported with split output")
+		}
+		if req.WaveformBuckets == 0 {
+			req.WaveformBuckets = defaultWaveformBuckets
+		}
+		if req.WaveformBuckets < 1 || req.WaveformBuckets > maxWaveformBuckets {
+			return fmt.Errorf("waveform_buckets must be between 1 and %d", maxWaveformBuckets)
+		}
+	}
+
+	if err := validateLoudness(req); err != nil {
+		return err
+	}
+
+	if err := validatePreamble(req); err != nil {
+		return err
+	}
+	if err := validateMinDuration(req); err != nil {
+		return err
+	}
+	if err := validateMinInputBitrate(req); err != nil {
+		return err
+	}
+	if err := validateIntermediateFormat(req); err != nil {
+		return err
+	}
+
+	if req.AppendToURL != "" {
+		if req.SplitDurationSeconds > 0 {
+			return errors.New("append_to_url is not supported with split output")
+		}
+		if hasPreamble(*req) {
+			return errors.New("append_to_url and preamble are mutually exclusive; the existing file already has its lead-in")
+		}
+		// The whole-output chain runs over the existing file again, so these
+		// would apply twice to it (sped up again, gain stacked)
+		if reapplied := reappliedFilterOptions(*req); len(reapplied) > 0 {
+			return fmt.Errorf("append_to_url is not supported with %s; they would be applied to the existing output a second time", strings.Join(reapplied, ", "))
+		}
+	}
+
+	if err := validateCustomFilter(req); err != nil {
+		return err
+	}
+
+	if req.SpeedFactor == 0 {
+		req.SpeedFactor = 1.0
+	}
+	if req.SpeedFactor < minSpeedFactor || req.SpeedFactor > maxSpeedFactor {
+		return fmt.Errorf("speed_factor must be between %g and %g", minSpeedFactor, maxSpeedFactor)
+	}
+
+	if req.GainDB < minGainDB || req.GainDB > maxGainDB {
+		return fmt.Errorf("gain_db must be between %d and %d", minGainDB, maxGainDB)
+	}
+
+	req.Priority = clampPriority(req.Priority)
+
+	return nil
+}
+
 func handleConcat(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		sendError(w, codeMethodNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Reject new work immediately once shutdown or a drain has begun so the
+	// client retries elsewhere instead of starting a job that will be cancelled
+	if !acceptingJobs() {
+		w.Header().Set("Retry-After", strconv.Itoa(shutdownRetryAfterSeconds))
+		sendError(w, codeUnavailable, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, ok := readAuthorizedBody(w, r)
+	if !ok {
 		return
 	}
 
 	var req ConcatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, codeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	if len(req.Segments) == 0 {
-		sendError(w, "No segments provided", http.StatusBadRequest)
+	if err := validateRequest(&req); err != nil {
+		sendError(w, codeInvalidRequest, err.Error(), http.StatusBadRequest)
 		return
 	}
+	split := req.SplitDurationSeconds > 0
+	hls := req.OutputFormat == outputFormatHLS
 
-	if req.OutputURL == "" {
-		sendError(w, "No output URL provided", http.StatusBadRequest)
+	if req.ManifestURL != "" {
+		segments, err := fetchManifest(r.Context(), req.ManifestURL)
+		if err != nil {
+			sendError(w, codeInvalidRequest, fmt.Sprintf("Invalid manifest: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Segments = segmentURLs(segments...)
+		fmt.Printf("[%s] Expanded manifest into %d segments\n", req.EpisodeID, len(segments))
+	}
+
+	// Don't spend an encode on output storage that has been failing
+	host, wait, breakerDone := openBreaker(uploadTargets(req), time.Now())
+	if host != "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		sendError(w, codeUnavailable, fmt.Sprintf("Uploads to %s are failing; not starting the job for another %s", host, wait.Round(time.Second)), http.StatusServiceUnavailable)
 		return
 	}
+	defer breakerDone()
+
+	// A duplicate submission of a running episode is refused rather than
+	// queued behind it
+	releaseEpisode, ok := acquireEpisode(req.EpisodeID)
+	if !ok {
+		sendError(w, codeConflict, fmt.Sprintf("Episode %q already has a job in progress (limit %d)", req.EpisodeID, config.MaxJobsPerEpisode), http.StatusConflict)
+		return
+	}
+	defer releaseEpisode()
+
+	// Wait in the queue until a slot frees up, the client goes away, or
+	// shutdown begins
+	queueCtx, cancelQueue := context.WithTimeout(r.Context(), maxQueueWait)
+	stopOnShutdown := context.AfterFunc(shutdownCtx, cancelQueue)
+	acquired := waitForJobSlot(queueCtx, req.EpisodeID, req.Priority)
+	stopOnShutdown()
+	cancelQueue()
+	if !acquired {
+		sendError(w, codeBusy, fmt.Sprintf("Too many concurrent jobs (limit %d, queue %d)", config.MaxConcurrentJobs, config.MaxQueuedJobs), http.StatusTooManyRequests)
+		return
+	}
+	defer releaseJobSlot()
 
 	// T012: Update container status to "processing"
 	now := time.Now()
@@ -152,24 +963,56 @@ func handleConcat(w http.ResponseWriter, r *http.Request) {
 	}
 	statusMutex.Unlock()
 
-	// Helper to handle errors with status update
-	handleError := func(message string, status int) {
+	summary := JobSummary{
+		EpisodeID:    req.EpisodeID,
+		SegmentCount: len(req.Segments),
+		StartedAt:    now,
+	}
+	defer func() {
+		logJobSummary(summary)
+		recordThroughput(summary)
+	}()
+
+	trace := startTrace(r, "concat")
+	trace.setAttr("episode_id", req.EpisodeID)
+	trace.setAttr("segment_count", len(req.Segments))
+	defer func() { trace.finish(summary.Error) }()
+
+	// Helpers to handle errors with status update
+	failJob := func(resp ConcatResponse, status int) {
 		// T016: Set state to "error" on failure
 		statusMutex.Lock()
 		containerStatus.State = "error"
-		containerStatus.LastError = message
+		containerStatus.LastError = resp.Error
 		statusMutex.Unlock()
-		sendError(w, message, status)
+		summary.Error = resp.Error
+		w.Header().Set("Server-Timing", serverTiming(summary.Phases, time.Since(summary.StartedAt)))
+		writeErrorResponse(w, resp, status)
+	}
+	handleError := func(code ErrorCode, message string, status int) {
+		failJob(ConcatResponse{Error: message, ErrorCode: code}, status)
 	}
+	// Transfer failures also tell the client whether retrying may help
+	handleTransferError := func(code ErrorCode, message string, err error) {
+		failJob(ConcatResponse{
+			Error:     fmt.Sprintf("%s: %v", message, err),
+			ErrorCode: code,
+			Retryable: isRetryable(err),
+		}, http.StatusInternalServerError)
+	}
+
+	// Let operators pause the download loop via /jobs/{id}/pause
+	control, unregisterJob := registerJob(req.EpisodeID, req.Priority)
+	defer unregisterJob()
 
 	// T017: Create context with 60-minute deadline to prevent zombie containers
-	ctx, cancel := context.WithTimeout(shutdownCtx, 60*time.Minute)
+	ctx, cancel := context.WithTimeout(shutdownCtx, jobTimeout)
 	defer cancel()
 
 	// Create temp directory for this request
 	workDir, err := os.MkdirTemp("", "concat-*")
 	if err != nil {
-		handleError(fmt.Sprintf("Failed to create temp dir: %v", err), http.StatusInternalServerError)
+		handleError(codeInternal, fmt.Sprintf("Failed to create temp dir: %v", err), http.StatusInternalServerError)
 		return
 	}
 	// T027: Cleanup temp directory (always, including on shutdown)
@@ -177,119 +1020,717 @@ func handleConcat(w http.ResponseWriter, r *http.Request) {
 		os.RemoveAll(workDir)
 		fmt.Printf("[%s] Cleaned up temp directory: %s\n", req.EpisodeID, workDir)
 	}()
+	files := newJobFiles(workDir)
+	// A full disk gets its own code, and the job's files go at once so
+	// other jobs on the volume can finish
+	handleDiskFull := func(step string) {
+		freed := emptyWorkDir(workDir)
+		fmt.Printf("[%s] Disk full during %s; freed %d bytes\n", req.EpisodeID, step, freed)
+		handleError(codeDiskFull, diskFullMessage(step, freed), http.StatusInsufficientStorage)
+	}
 
 	// Check for shutdown/timeout before starting
 	select {
 	case <-ctx.Done():
-		handleError(fmt.Sprintf("Job cancelled: %v", ctx.Err()), http.StatusServiceUnavailable)
+		code, reason, status := contextFailure(ctx.Err())
+		handleError(code, "Job stopped: "+reason, status)
 		return
 	default:
 	}
 
+	// Catch a chain FFmpeg won't accept before fetching anything
+	var warnings []string
+	if wantsFilterCheck(req) && ffmpegAvailable.Load() {
+		if err := checkFilterChain(ctx, req, hls); err != nil {
+			switch {
+			case ctx.Err() != nil:
+				code, reason, status := contextFailure(ctx.Err())
+				handleError(code, "Job stopped: "+reason, status)
+				return
+			case errors.Is(err, context.DeadlineExceeded):
+				warnings = append(warnings, fmt.Sprintf("filter chain not validated: %v", err))
+			default:
+				handleError(codeInvalidRequest, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+	}
+
 	// Download all segments
 	fmt.Printf("[%s] Downloading %d segments...\n", req.EpisodeID, len(req.Segments))
-	listFile := filepath.Join(workDir, "list.txt")
-	listContent := ""
+	inputs := make([]concatInput, 0, len(req.Segments))
+	inputIndexes := make([]int, 0, len(req.Segments)) // Segment index of each input
+	var skipped []SkippedSegment
+	downloadStart := time.Now()
+	downloadSpan := trace.startSpan("download")
+
+	// Later segments download while the loop checks the current one
+	prefetch := startPrefetch(ctx, len(req.Segments), config.DownloadPrefetchDepth, func(ctx context.Context, i int) (int64, error) {
+		if err := control.waitWhilePaused(ctx); err != nil {
+			return 0, err
+		}
+		return retryTransfer(ctx, fmt.Sprintf("[%s] download segment %d", req.EpisodeID, i), func() (int64, error) {
+			return downloadSegment(ctx, req.Segments[i].URL, files.segment(i))
+		})
+	})
+	defer prefetch.stop()
 
-	for i, url := range req.Segments {
+	for i, seg := range req.Segments {
 		// Check for shutdown/timeout during download
 		select {
 		case <-ctx.Done():
-			handleError(fmt.Sprintf("Job cancelled during download: %v", ctx.Err()), http.StatusServiceUnavailable)
+			code, reason, status := contextFailure(ctx.Err())
+			handleError(code, "Job stopped during download: "+reason, status)
 			return
 		default:
 		}
+		if err := control.waitWhilePaused(ctx); err != nil {
+			code, reason, status := contextFailure(err)
+			handleError(code, "Job stopped while paused: "+reason, status)
+			return
+		}
 
-		segmentPath := filepath.Join(workDir, fmt.Sprintf("segment_%04d.mp3", i))
-		if err := downloadFile(url, segmentPath); err != nil {
-			handleError(fmt.Sprintf("Failed to download segment %d: %v", i, err), http.StatusInternalServerError)
+		segmentPath := files.segment(i)
+		written, err := prefetch.next(ctx, i)
+		summary.BytesDownloaded += written
+		if err == nil && req.SkipCorruptSegments && ffprobeAvailable.Load() {
+			err = validateAudio(ctx, segmentPath)
+		}
+		if isDiskFull(err, "") {
+			summary.Phases.DownloadMs = time.Since(downloadStart).Milliseconds()
+			handleDiskFull(fmt.Sprintf("download of segment %d", i))
 			return
 		}
-		// FFmpeg concat format requires 'file' directive
-		listContent += fmt.Sprintf("file '%s'\n", segmentPath)
+		if err != nil {
+			if req.SkipCorruptSegments && ctx.Err() == nil {
+				fmt.Printf("[%s] Warning: skipping segment %d: %v\n", req.EpisodeID, i, err)
+				skipped = append(skipped, SkippedSegment{Index: i, Reason: err.Error()})
+				summary.SegmentsSkipped++
+				os.Remove(segmentPath)
+				continue
+			}
+			summary.Phases.DownloadMs = time.Since(downloadStart).Milliseconds()
+			handleTransferError(codeSegmentDownloadFailed, fmt.Sprintf("Failed to download segment %d", i), err)
+			return
+		}
+		// Trim points beyond the clip would silently yield nothing
+		if seg.trimmed() && ffprobeAvailable.Load() {
+			segDuration, err := getDuration(segmentPath)
+			if err == nil {
+				err = seg.checkDuration(segDuration)
+			}
+			if err != nil {
+				summary.Phases.DownloadMs = time.Since(downloadStart).Milliseconds()
+				handleError(codeInvalidRequest, fmt.Sprintf("Invalid trim for segment %d: %v", i, err), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+		inputs = append(inputs, concatInput{Path: segmentPath, Start: seg.Start, End: seg.End, GainDB: seg.GainDB})
+		inputIndexes = append(inputIndexes, i)
 
 		// T014: Update segments_downloaded count
 		statusMutex.Lock()
 		containerStatus.SegmentsDownloaded = i + 1
 		statusMutex.Unlock()
 	}
+	summary.Phases.DownloadMs = time.Since(downloadStart).Milliseconds()
+	downloadSpan.setAttr("bytes", summary.BytesDownloaded)
+	downloadSpan.setAttr("segments_skipped", summary.SegmentsSkipped)
+	downloadSpan.finish()
 	fmt.Printf("[%s] Done: download.\n", req.EpisodeID)
 
-	if err := os.WriteFile(listFile, []byte(listContent), 0644); err != nil {
-		handleError(fmt.Sprintf("Failed to write list file: %v", err), http.StatusInternalServerError)
+	if len(inputs) == 0 {
+		handleError(codeSegmentDownloadFailed, fmt.Sprintf("All %d segments were skipped as corrupt", len(skipped)), http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Run FFmpeg to concatenate and normalize
-	outputPath := filepath.Join(workDir, "output.mp3")
-	fmt.Printf("[%s] Running FFmpeg concatenation with volume normalization...\n", req.EpisodeID)
+	// Clipping is a property of the sources, so it is measured before the
+	// preamble or an earlier output joins the inputs
+	var clipping []ClippingReport
+	if req.DetectClipping {
+		fmt.Printf("[%s] Scanning %d segments for clipping...\n", req.EpisodeID, len(inputs))
+		clippingStart := time.Now()
+		clippingSpan := trace.startSpan("clipping")
+		var clippingWarnings []string
+		clipping, clippingWarnings = detectClipping(ctx, inputs, inputIndexes)
+		warnings = append(warnings, clippingWarnings...)
+		summary.Phases.AnalysisMs += time.Since(clippingStart).Milliseconds()
+		clippingSpan.setAttr("clipped_segments", len(clipping))
+		clippingSpan.finish()
+		if ctx.Err() != nil {
+			code, reason, status := contextFailure(ctx.Err())
+			handleError(code, "Job stopped: "+reason, status)
+			return
+		}
+	}
 
-	args := []string{
-		"-f", "concat",
-		"-safe", "0",
-		"-i", listFile,
-		"-af", "loudnorm=I=-16:TP=-1.5:LRA=11", // Normalize to -16 LUFS (podcast standard)
-		"-c:a", "libmp3lame",
-		"-b:a", "128k",
-		"-ar", "44100",
+	var lowBitrate []LowBitrateSegment
+	if req.MinInputBitrateKbps > 0 {
+		if !ffprobeAvailable.Load() {
+			warnings = append(warnings, "min_input_bitrate_kbps ignored: ffprobe is unavailable")
+		} else {
+			bitrateStart := time.Now()
+			var bitrateWarnings []string
+			lowBitrate, bitrateWarnings = checkInputBitrates(ctx, inputs, inputIndexes, req.MinInputBitrateKbps)
+			summary.Phases.AnalysisMs += time.Since(bitrateStart).Milliseconds()
+			warnings = append(warnings, bitrateWarnings...)
+			if ctx.Err() != nil {
+				code, reason, status := contextFailure(ctx.Err())
+				handleError(code, "Job stopped: "+reason, status)
+				return
+			}
+		}
+		if len(lowBitrate) > 0 {
+			message := fmt.Sprintf("segments below min_input_bitrate_kbps %d: %s", req.MinInputBitrateKbps, describeLowBitrate(lowBitrate))
+			if req.MinInputBitrateMode == bitrateCheckStrict {
+				handleError(codeInvalidRequest, "Rejected "+message, http.StatusUnprocessableEntity)
+				return
+			}
+			warnings = append(warnings, message)
+		}
+	}
+
+	var autoMono *AutoMonoDecision
+	if req.AutoMono {
+		fmt.Printf("[%s] Measuring channel levels for auto_mono...\n", req.EpisodeID)
+		monoStart := time.Now()
+		decision := decideAutoMono(ctx, inputs, inputIndexes, *req.AutoMonoThresholdDB)
+		summary.Phases.AnalysisMs += time.Since(monoStart).Milliseconds()
+		if ctx.Err() != nil {
+			code, reason, status := contextFailure(ctx.Err())
+			handleError(code, "Job stopped: "+reason, status)
+			return
+		}
+		fmt.Printf("[%s] auto_mono: downmix=%v (%s)\n", req.EpisodeID, decision.Downmixed, decision.Reason)
+		req.monoDownmix = decision.Downmixed
+		autoMono = &decision
+	}
+
+	// Measured after auto_mono, whose downmix rules out stereo
+	var autoBitrate *AutoBitrateDecision
+	if req.AutoBitrate {
+		fmt.Printf("[%s] Measuring content for auto_bitrate...\n", req.EpisodeID)
+		bitrateStart := time.Now()
+		decision := decideAutoBitrate(ctx, req, inputs, inputIndexes)
+		summary.Phases.AnalysisMs += time.Since(bitrateStart).Milliseconds()
+		if ctx.Err() != nil {
+			code, reason, status := contextFailure(ctx.Err())
+			handleError(code, "Job stopped: "+reason, status)
+			return
+		}
+		fmt.Printf("[%s] auto_bitrate: %d kbps (%s)\n", req.EpisodeID, decision.BitrateKbps, decision.Reason)
+		req.BitrateKbps = decision.BitrateKbps
+		autoBitrate = &decision
+	}
+
+	// The existing output goes first; it was our own encode, so it isn't
+	// held to the per-segment size cap
+	if req.AppendToURL != "" {
+		existingPath := files.path("existing.mp3")
+		fmt.Printf("[%s] Downloading existing output to append to...\n", req.EpisodeID)
+		written, err := retryTransfer(ctx, fmt.Sprintf("[%s] download append_to_url", req.EpisodeID), func() (int64, error) {
+			return downloadFileLimit(ctx, req.AppendToURL, existingPath, 0)
+		})
+		summary.BytesDownloaded += written
+		if err != nil {
+			handleTransferError(codeSegmentDownloadFailed, "Failed to download append_to_url", err)
+			return
+		}
+		inputs = append([]concatInput{{Path: existingPath}}, inputs...)
+	}
+
+	if hasPreamble(req) {
+		preamblePath := files.path(intermediateName("preamble", req.IntermediateFormat))
+		if err := generatePreamble(ctx, req, preamblePath); isDiskFull(err, fmt.Sprint(err)) {
+			handleDiskFull("preamble generation")
+			return
+		} else if err != nil {
+			handleError(codeFFmpegFailed, fmt.Sprintf("Failed to generate preamble: %v", err), http.StatusInternalServerError)
+			return
+		}
+		inputs = append([]concatInput{{Path: preamblePath}}, inputs...)
+	}
+
+	// Padding is measured last, so the preamble and an earlier output count
+	// toward the minimum
+	var paddedSeconds float64
+	if req.MinDurationSeconds > 0 {
+		if !ffprobeAvailable.Load() {
+			warnings = append(warnings, "min_duration_seconds ignored: ffprobe is unavailable to measure the inputs")
+		} else {
+			paddingPath := files.path(intermediateName("padding", req.IntermediateFormat))
+			paddedSeconds, err = padToMinDuration(ctx, inputs, req.SpeedFactor, req.MinDurationSeconds, req.IntermediateFormat, paddingPath)
+			if isDiskFull(err, fmt.Sprint(err)) {
+				handleDiskFull("padding")
+				return
+			} else if err != nil {
+				handleError(codeFFmpegFailed, fmt.Sprintf("Failed to pad to min_duration_seconds: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if paddedSeconds > 0 {
+				fmt.Printf("[%s] Padding with %.2fs of silence to reach %gs\n", req.EpisodeID, paddedSeconds, req.MinDurationSeconds)
+				inputs = append(inputs, concatInput{Path: paddingPath})
+			}
+		}
 	}
 
-	// Add metadata if provided
-	if req.Metadata.Title != "" {
-		args = append(args, "-metadata", fmt.Sprintf("title=%s", req.Metadata.Title))
+	// AAC, Opus, or mismatched MP3 inputs can't be byte-joined by the
+	// demuxer; decode them through the concat filter instead
+	method := singleInputMethod(req, resolveConcatMethod(req), inputs)
+	var streams []audioStreamInfo
+	if method == concatDemuxer && ffprobeAvailable.Load() {
+		mismatch, probed, err := checkDemuxerInputs(ctx, inputs)
+		streams = probed
+		switch {
+		case err != nil:
+			fmt.Printf("[%s] Warning: input format check skipped: %v\n", req.EpisodeID, err)
+		case mismatch != "" && req.ConcatMethod == concatDemuxer:
+			handleError(codeInvalidRequest, fmt.Sprintf("concat_method \"demuxer\" can't join these inputs: %s", mismatch), http.StatusUnprocessableEntity)
+			return
+		case mismatch != "":
+			fmt.Printf("[%s] %s; using the concat filter\n", req.EpisodeID, mismatch)
+			method = concatFilter
+		}
 	}
-	if req.Metadata.Artist != "" {
-		args = append(args, "-metadata", fmt.Sprintf("artist=%s", req.Metadata.Artist))
+
+	// Refuse a split that would upload more than maxSplitParts parts
+	if split && ffprobeAvailable.Load() {
+		if inputDurations, err := probeDurations(inputs); err != nil {
+			fmt.Printf("[%s] Warning: split part check skipped: %v\n", req.EpisodeID, err)
+		} else if err := checkSplitParts(inputDurations, req.SpeedFactor, req.SplitDurationSeconds); err != nil {
+			handleError(codeInvalidRequest, fmt.Sprintf("split_duration_seconds too short: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
 	}
-	if req.Metadata.Album != "" {
-		args = append(args, "-metadata", fmt.Sprintf("album=%s", req.Metadata.Album))
+
+	// Already compatible inputs can skip the encode entirely
+	streamCopy := false
+	if req.EncodeMode == encodeAuto {
+		var reason string
+		if streamCopy, reason = chooseStreamCopy(ctx, req, method, inputs, streams); streamCopy {
+			fmt.Printf("[%s] Inputs are compatible MP3; copying without re-encoding or normalization\n", req.EpisodeID)
+		} else {
+			fmt.Printf("[%s] Re-encoding: %s\n", req.EpisodeID, reason)
+		}
 	}
-	if req.Metadata.Genre != "" {
-		args = append(args, "-metadata", fmt.Sprintf("genre=%s", req.Metadata.Genre))
+
+	if err := checkConcatInputs(inputs); err != nil {
+		handleError(codeSegmentDownloadFailed, fmt.Sprintf("Concat input check failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// In safe mode FFmpeg runs inside workDir and sees only plain relative
+	// names, so the concat demuxer can keep its -safe 1 path checks
+	paths := ffmpegPaths{files: files, inputs: inputs, method: method, streamCopy: streamCopy, safe: config.ConcatSafeMode}
+	if method == concatDemuxer {
+		_, listInputs := paths.listInputs()
+		if err := os.WriteFile(paths.listFile(), []byte(concatList(listInputs)), 0644); err != nil {
+			handleError(codeInternal, fmt.Sprintf("Failed to write list file: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if hls {
+		if err := os.Mkdir(paths.hlsDir(), 0755); err != nil {
+			handleError(codeInternal, fmt.Sprintf("Failed to create HLS dir: %v", err), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	args = append(args, "-y", outputPath)
+	// Run FFmpeg to concatenate and normalize
+	outputPath := paths.outputPath()
+	fmt.Printf("[%s] Running FFmpeg concatenation (%s) with volume normalization...\n", req.EpisodeID, method)
+	args, err := buildFFmpegArgs(req, paths)
+	if err != nil {
+		handleError(codeInternal, fmt.Sprintf("Failed to build FFmpeg arguments: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-	// T026: Use CommandContext to allow cancellation on shutdown/timeout
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	encodeStart := time.Now()
+	encodeSpan := trace.startSpan("ffmpeg")
+	encodeSpan.setAttr("concat_method", method)
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	jobRetries := 0
+	// Start publishing the output while it is being written
+	var stream *streamUpload
+	if req.StreamUpload {
+		stream = startStreamUpload(ctx, outputPath, req.OutputURL, "audio/mpeg")
+		defer stream.abort()
+	}
+	for delay := jobRetryDelay; ; delay *= 2 {
+		// T026: Use CommandContext to allow cancellation on shutdown/timeout
+		cmd := ffmpegCommand(ctx, args...)
+		cmd.Dir = workDir
+		stderr.Reset()
+		cmd.Stderr = &stderr
+		var cpu time.Duration
+		cpu, err = runWithCPUBudget(cmd, config.MaxCPUTime)
+		summary.EncodeCPUMs += cpu.Milliseconds()
+		if err == nil || ctx.Err() != nil || errors.Is(err, errCPUBudgetExceeded) || jobRetries >= config.JobMaxRetries || !ffmpegRetryable(err, stderr.String()) {
+			break
+		}
 
-	if err := cmd.Run(); err != nil {
+		jobRetries++
+		if stream != nil {
+			// What was sent belongs to the failed run
+			stream.abort()
+		}
+		fmt.Printf("[%s] FFmpeg failed transiently (%v); re-running encode (%d/%d) in %s\n", req.EpisodeID, err, jobRetries, config.JobMaxRetries, delay)
+		clearEncodeOutputs(files, outputPath, split, hls)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	summary.Phases.EncodeMs = time.Since(encodeStart).Milliseconds()
+	encodeSpan.setAttr("retries", jobRetries)
+	if err != nil {
 		// Check if it was a context cancellation
 		if ctx.Err() != nil {
-			handleError(fmt.Sprintf("FFmpeg cancelled: %v", ctx.Err()), http.StatusServiceUnavailable)
+			code, reason, status := contextFailure(ctx.Err())
+			handleError(code, "FFmpeg stopped: "+reason, status)
+		} else if errors.Is(err, errCPUBudgetExceeded) {
+			handleError(codeCPUBudgetExceeded, fmt.Sprintf("FFmpeg killed: %v (MAX_CPU_SECONDS); the input likely makes the encoder spin", err), http.StatusUnprocessableEntity)
+		} else if isDiskFull(err, stderr.String()) {
+			handleDiskFull("encode")
 		} else {
-			handleError(fmt.Sprintf("FFmpeg failed: %v\nStderr: %s", err, stderr.String()), http.StatusInternalServerError)
+			code, reason := ffmpegFailure(err)
+			if jobRetries > 0 {
+				reason += fmt.Sprintf(" (after %d re-runs)", jobRetries)
+			}
+			handleError(code, fmt.Sprintf("FFmpeg failed: %s\nStderr: %s", reason, stderr.String()), http.StatusInternalServerError)
 		}
 		return
 	}
+	if !split && !hls {
+		if err := commitPartialOutput(outputPath); isDiskFull(err, "") {
+			handleDiskFull("finalizing the output")
+			return
+		} else if err != nil {
+			handleError(codeFFmpegFailed, fmt.Sprintf("Failed to finalize output: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	encodeSpan.finish()
 	fmt.Printf("[%s] Done: FFmpeg concatenation and metadata to %s.\n", req.EpisodeID, outputPath)
 
-	// Get duration using ffprobe
-	fmt.Printf("[%s] Getting duration with ffprobe...\n", req.EpisodeID)
-	duration, err := getDuration(outputPath)
-	if err != nil {
-		fmt.Printf("[%s] Warning: Failed to get duration: %v\n", req.EpisodeID, err)
-		duration = 0
+	// The work dir is at its largest right after the encode
+	sampleWorkDirUsage()
+
+	// Files to probe and upload: the single output, every split part, or
+	// the HLS segments followed by their playlist
+	outputs := []OutputPart{{URL: req.OutputURL}}
+	outputFiles := []string{outputPath}
+	if hls {
+		playlistPath := filepath.Join(files.path("hls"), hlsPlaylistName)
+		entries, err := parseHLSPlaylist(playlistPath)
+		if err != nil {
+			handleError(codeFFmpegFailed, fmt.Sprintf("Failed to read HLS playlist: %v", err), http.StatusInternalServerError)
+			return
+		}
+		outputFiles = make([]string, 0, len(entries)+1)
+		outputs = make([]OutputPart, 0, len(entries)+1)
+		for i, e := range entries {
+			outputFiles = append(outputFiles, filepath.Join(files.path("hls"), e.Name))
+			outputs = append(outputs, OutputPart{Index: i, URL: hlsFileURL(req.OutputURLTemplate, e.Name), DurationSeconds: e.Duration})
+		}
+		outputFiles = append(outputFiles, playlistPath)
+		outputs = append(outputs, OutputPart{Index: len(entries), URL: hlsFileURL(req.OutputURLTemplate, hlsPlaylistName)})
+		fmt.Printf("[%s] Encoded HLS playlist with %d segments\n", req.EpisodeID, len(entries))
+	} else if split {
+		outputFiles, err = splitOutputFiles(files)
+		if err != nil {
+			handleError(codeFFmpegFailed, fmt.Sprintf("Failed to list split output: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(outputFiles) > maxSplitParts {
+			handleError(codeInvalidRequest, fmt.Sprintf("split_duration_seconds too short: output has %d parts, more than %d", len(outputFiles), maxSplitParts), http.StatusUnprocessableEntity)
+			return
+		}
+		outputs = make([]OutputPart, len(outputFiles))
+		for i := range outputFiles {
+			outputs[i] = OutputPart{Index: i, URL: partURL(req.OutputURLTemplate, i)}
+		}
+		fmt.Printf("[%s] Split output into %d parts\n", req.EpisodeID, len(outputFiles))
+	}
+
+	if len(clipping) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d segments clip; normalization can't restore their peaks", len(clipping)))
+	}
+
+	// Tags are checked before hash naming, since a remux changes the bytes
+	var writtenMetadata map[string]string
+	if !hls && ffprobeAvailable.Load() {
+		var tagWarnings []string
+		writtenMetadata, tagWarnings = ensureMetadata(ctx, req, outputFiles)
+		warnings = append(warnings, tagWarnings...)
+	}
+
+	if req.OutputNaming == outputNamingHash {
+		for i, path := range outputFiles {
+			digest, err := fileSHA256(path)
+			if err != nil {
+				handleError(codeInternal, fmt.Sprintf("Failed to hash output: %v", err), http.StatusInternalServerError)
+				return
+			}
+			outputs[i].URL = hashedURL(partURL(req.OutputURLTemplate, i), digest)
+		}
+	}
+
+	if !hls {
+		warnings = append(warnings, metadataEncodingWarnings(req.Metadata, req.ID3Version)...)
+	}
+
+	// Get duration using ffprobe, or from FFmpeg's own progress output on
+	// images that ship without ffprobe
+	probeStart := time.Now()
+	probeSpan := trace.startSpan("probe")
+	var duration float64
+	durationKnown := true
+	if hls {
+		// The playlist already states every segment's duration
+		for _, o := range outputs {
+			duration += o.DurationSeconds
+		}
+	} else if ffprobeAvailable.Load() {
+		fmt.Printf("[%s] Getting duration with ffprobe...\n", req.EpisodeID)
+		for i, path := range outputFiles {
+			partDuration, err := getDuration(path)
+			if err != nil {
+				fmt.Printf("[%s] Warning: Failed to get duration of %s: %v\n", req.EpisodeID, filepath.Base(path), err)
+				partDuration = 0
+				durationKnown = false
+			}
+			outputs[i].DurationSeconds = partDuration
+			duration += partDuration
+		}
+	} else {
+		fmt.Printf("[%s] ffprobe unavailable, reading duration from FFmpeg output...\n", req.EpisodeID)
+		duration, err = durationFromFFmpegLog(stderr.String())
+		if err != nil {
+			fmt.Printf("[%s] Warning: Failed to get duration: %v\n", req.EpisodeID, err)
+			warnings = append(warnings, fmt.Sprintf("duration unavailable without ffprobe: %v", err))
+			duration = 0
+			durationKnown = false
+		}
+		if !split {
+			outputs[0].DurationSeconds = duration
+		}
+	}
+
+	// Reconcile against the inputs to catch audio silently lost in the concat
+	if config.DurationTolerance > 0 && ffprobeAvailable.Load() {
+		inputDurations, err := probeDurations(inputs)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("duration check skipped: %v", err))
+		} else if err := reconcileDuration(inputDurations, req.SpeedFactor, duration, config.DurationTolerance); err != nil {
+			fmt.Printf("[%s] Warning: %v\n", req.EpisodeID, err)
+			if config.StrictDuration {
+				summary.Phases.ProbeMs = time.Since(probeStart).Milliseconds()
+				handleError(codeFFmpegFailed, fmt.Sprintf("Duration check failed: %v", err), http.StatusInternalServerError)
+				return
+			}
+			warnings = append(warnings, err.Error())
+		}
+	}
+	summary.Phases.ProbeMs = time.Since(probeStart).Milliseconds()
+	summary.DurationSeconds = duration
+	probeSpan.setAttr("duration_seconds", duration)
+	probeSpan.finish()
+
+	// Refuse to publish an output with no audio in it
+	if err := checkEmptyOutput(duration, durationKnown); err != nil {
+		if !req.AllowEmpty {
+			handleError(codeEmptyOutput, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		warnings = append(warnings, err.Error())
 	}
 
 	// Get file size
-	fileInfo, err := os.Stat(outputPath)
-	if err != nil {
-		handleError(fmt.Sprintf("Failed to stat output file: %v", err), http.StatusInternalServerError)
-		return
+	var fileSize int64
+	for i, path := range outputFiles {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			handleError(codeFFmpegFailed, fmt.Sprintf("Failed to stat output file: %v", err), http.StatusInternalServerError)
+			return
+		}
+		outputs[i].FileSize = fileInfo.Size()
+		fileSize += fileInfo.Size()
+	}
+	summary.OutputBytes = fileSize
+
+	// Optional analysis of the finished output
+	var waveform *Waveform
+	if req.GenerateWaveform {
+		fmt.Printf("[%s] Generating waveform peaks (%d buckets)...\n", req.EpisodeID, req.WaveformBuckets)
+		analysisStart := time.Now()
+		analysisSpan := trace.startSpan("waveform")
+		waveform, err = generateWaveform(ctx, outputPath, req.WaveformBuckets)
+		summary.Phases.AnalysisMs += time.Since(analysisStart).Milliseconds()
+		analysisSpan.finish()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("waveform generation failed: %v", err))
+			waveform = nil
+		}
+	}
+	var spectrogram *Spectrogram
+	spectrogramPath := files.path("spectrogram.png")
+	if req.GenerateSpectrogram {
+		fmt.Printf("[%s] Rendering %dx%d spectrogram...\n", req.EpisodeID, req.SpectrogramWidth, req.SpectrogramHeight)
+		analysisStart := time.Now()
+		analysisSpan := trace.startSpan("spectrogram")
+		spectrogram, err = renderSpectrogram(ctx, outputPath, spectrogramPath, req.SpectrogramWidth, req.SpectrogramHeight)
+		if err == nil && req.SpectrogramURL == "" {
+			err = inlineSpectrogram(spectrogram, spectrogramPath)
+		}
+		summary.Phases.AnalysisMs += time.Since(analysisStart).Milliseconds()
+		analysisSpan.finish()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("spectrogram skipped: %v", err))
+			spectrogram = nil
+		}
 	}
-	fileSize := fileInfo.Size()
 
-	// Upload to output URL
-	fmt.Printf("[%s] Uploading result to %s..\n", req.EpisodeID, req.OutputURL)
-	if err := uploadFile(outputPath, req.OutputURL); err != nil {
-		handleError(fmt.Sprintf("Failed to upload result: %v", err), http.StatusInternalServerError)
-		return
+	// Upload to output URL(s). Uploads run on their own deadline so an
+	// encode that finished near jobTimeout still gets published.
+	uploadCtx, cancelUpload := uploadContext(ctx)
+	defer cancelUpload()
+	uploadStart := time.Now()
+	uploadSpan := trace.startSpan("upload")
+	uploadSpan.setAttr("files", len(outputFiles))
+	var uploads []UploadResult
+	var failedMirrors []string
+	// A streamed output only needs its body ended; it falls back to the
+	// regular upload below
+	streamedUpload := false
+	var multipart *MultipartResult
+	if stream != nil {
+		if err := stream.finish(outputPath); err != nil {
+			fmt.Printf("[%s] Streaming upload failed (%v); uploading after the encode\n", req.EpisodeID, err)
+			warnings = append(warnings, fmt.Sprintf("streaming upload fell back to a regular upload: %v", err))
+		} else {
+			streamedUpload = true
+			recordUpload(req.OutputURL, nil, time.Now())
+		}
+	}
+	if len(req.OutputURLs) > 0 {
+		fmt.Printf("[%s] Uploading result to %d destinations..\n", req.EpisodeID, len(req.OutputURLs))
+		uploads = uploadToDestinations(uploadCtx, outputPath, req.OutputURLs, "audio/mpeg")
+		if err := checkUploads(uploads, req.RequireAllUploads); err != nil {
+			summary.Phases.UploadMs = time.Since(uploadStart).Milliseconds()
+			// Per-destination results still let the client re-push what failed
+			failJob(ConcatResponse{
+				Error:         fmt.Sprintf("Failed to upload result: %v", err),
+				ErrorCode:     codeUploadFailed,
+				Uploads:       uploads,
+				FailedMirrors: failedUploadURLs(uploads[1:]),
+			}, http.StatusInternalServerError)
+			return
+		}
+		failedMirrors = failedUploadURLs(uploads[1:])
+		for _, u := range uploads[1:] {
+			if !u.Success {
+				warnings = append(warnings, fmt.Sprintf("mirror upload to %s failed after %d attempts: %s", redactURL(u.URL), u.Attempts, u.Error))
+			}
+		}
+	} else if !streamedUpload {
+		for i, path := range outputFiles {
+			fmt.Printf("[%s] Uploading result to %s..\n", req.EpisodeID, outputs[i].URL)
+			var err error
+			switch {
+			case req.UploadMethod == uploadMethodPost:
+				err = uploadFormWithRetry(uploadCtx, path, outputs[i].URL, outputContentType(path), req.UploadFormFields)
+			case !split && !hls && useMultipartUpload(req, outputs[i].URL, fileSize):
+				var result MultipartResult
+				result, err = uploadMultipartOutput(uploadCtx, path, outputs[i].URL, outputContentType(path), req.MultipartUploadID)
+				multipart = &result
+				if result.Restarted {
+					warnings = append(warnings, fmt.Sprintf("multipart upload %s was not found; started %s instead", req.MultipartUploadID, result.UploadID))
+				}
+			default:
+				err = uploadWithRetry(uploadCtx, path, outputs[i].URL, outputContentType(path))
+			}
+			if err != nil {
+				summary.Phases.UploadMs = time.Since(uploadStart).Milliseconds()
+				// The upload ID lets the client resume a multipart upload
+				failJob(ConcatResponse{
+					Error:     fmt.Sprintf("Failed to upload result: %v", err),
+					ErrorCode: codeUploadFailed,
+					Retryable: isRetryable(err),
+					Multipart: multipart,
+				}, http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	// The sidecar carries the waveform even when it went to its own URL
+	sidecarWaveform := waveform
+	if waveform != nil && req.WaveformURL != "" {
+		if err := uploadWaveform(uploadCtx, waveform, files.path("waveform.json"), req.WaveformURL); err != nil {
+			warnings = append(warnings, fmt.Sprintf("waveform upload failed: %v", err))
+		}
+		waveform = nil
+	}
+	if spectrogram != nil && req.SpectrogramURL != "" {
+		if err := uploadWithRetry(uploadCtx, spectrogramPath, req.SpectrogramURL, "image/png"); err != nil {
+			warnings = append(warnings, fmt.Sprintf("spectrogram upload failed: %v", err))
+			spectrogram = nil
+		} else {
+			spectrogram.URL = req.SpectrogramURL
+		}
+	}
+	var ffmpegLog string
+	if req.Debug {
+		if req.DebugLogURL != "" {
+			if err := uploadDebugLog(uploadCtx, stderr.String(), files.path("ffmpeg.log"), req.DebugLogURL); err != nil {
+				warnings = append(warnings, fmt.Sprintf("debug log upload failed: %v", err))
+			}
+		} else {
+			ffmpegLog = inlineDebugLog(stderr.String())
+		}
 	}
+	if req.SidecarURL != "" {
+		sidecar := Sidecar{
+			SchemaVersion:   schemaVersion,
+			EpisodeID:       req.EpisodeID,
+			CreatedAt:       jobTimestamp(req, time.Now()),
+			DurationSeconds: duration,
+			FileSize:        fileSize,
+			Metadata:        req.Metadata,
+			StreamCopied:    streamCopy,
+			Waveform:        sidecarWaveform,
+			SkippedSegments: skipped,
+		}
+		switch {
+		case hls:
+			sidecar.PlaylistURL = outputs[len(outputs)-1].URL
+		case split:
+			sidecar.Parts = outputs
+		default:
+			sidecar.OutputURL = outputs[0].URL
+		}
+		if !streamCopy {
+			sidecar.Loudness = sidecarLoudness(req)
+		}
+		if err := uploadSidecar(uploadCtx, sidecar, files.path("sidecar.json"), req.SidecarURL); err != nil {
+			warnings = append(warnings, fmt.Sprintf("sidecar upload failed: %v", err))
+		}
+	}
+	summary.Phases.UploadMs = time.Since(uploadStart).Milliseconds()
+	uploadSpan.setAttr("bytes", fileSize)
+	uploadSpan.finish()
 	fmt.Printf("[%s] Done: uploading result.\n", req.EpisodeID)
 
+	if req.GenerateDownloadURL {
+		warnings = append(warnings, presignOutputs(outputs, time.Now())...)
+	}
+
+	var servedPath string
+	if config.ServeOutputTTL > 0 && !split && !hls {
+		if servedPath, err = retainOutput(outputPath, config.ServeOutputTTL); err != nil {
+			warnings = append(warnings, fmt.Sprintf("output not retained for serving: %v", err))
+		}
+	}
+
 	// T015: Reset state to "idle" on success
 	statusMutex.Lock()
 	containerStatus = ContainerStatus{
@@ -301,45 +1742,167 @@ func handleConcat(w http.ResponseWriter, r *http.Request) {
 		LastError:          "",
 	}
 	statusMutex.Unlock()
+	summary.Success = true
 
 	// Send success response
+	resp := ConcatResponse{
+		SchemaVersion:      schemaVersion,
+		Success:            true,
+		DurationSeconds:    duration,
+		FileSize:           fileSize,
+		Waveform:           waveform,
+		Spectrogram:        spectrogram,
+		Warnings:           warnings,
+		StreamCopied:       streamCopy,
+		JobRetries:         jobRetries,
+		Clipping:           clipping,
+		LowBitrateSegments: lowBitrate,
+		AutoMono:           autoMono,
+		AutoBitrate:        autoBitrate,
+		WrittenMetadata:    writtenMetadata,
+		PaddedSeconds:      paddedSeconds,
+		SkippedSegments:    skipped,
+		StreamedUpload:     streamedUpload,
+		Multipart:          multipart,
+		Uploads:            uploads,
+		FailedMirrors:      failedMirrors,
+		FFmpegLog:          ffmpegLog,
+	}
+	switch {
+	case hls:
+		for _, o := range outputs[:len(outputs)-1] {
+			resp.MediaSegmentURLs = append(resp.MediaSegmentURLs, o.URL)
+		}
+		resp.PlaylistURL = outputs[len(outputs)-1].URL
+	case split:
+		resp.Parts = outputs
+	default:
+		resp.OutputURL = outputs[0].URL
+		resp.DownloadURL = outputs[0].DownloadURL
+		resp.ServedPath = servedPath
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ConcatResponse{
-		Success:         true,
-		DurationSeconds: duration,
-		FileSize:        fileSize,
-	})
+	w.Header().Set("Server-Timing", serverTiming(summary.Phases, time.Since(summary.StartedAt)))
+	json.NewEncoder(w).Encode(resp)
 
 	fmt.Printf("[%s] Successfully concatenated and normalized %d segments: %.2fs, %d bytes\n", req.EpisodeID, len(req.Segments), duration, fileSize)
 }
 
-func downloadFile(url, destPath string) error {
-	resp, err := http.Get(url)
+// errSegmentTooLarge is returned when a download exceeds MAX_SEGMENT_BYTES
+var errSegmentTooLarge = errors.New("segment exceeds maximum size")
+
+// downloadFile fetches url into destPath and returns the number of bytes written.
+// Origins using chunked transfer encoding send no Content-Length (ContentLength
+// is -1), so the byte count always comes from the copy itself; the header is
+// only used to detect truncated bodies when it is present.
+// A partially written destPath is removed on any error.
+// data: URLs are decoded locally instead of fetched (see decodeDataURL).
+func downloadFile(ctx context.Context, url, destPath string) (written int64, err error) {
+	return downloadFileLimit(ctx, url, destPath, config.MaxSegmentBytes)
+}
+
+// downloadFileLimit is downloadFile with an explicit size cap, 0 = unlimited
+func downloadFileLimit(ctx context.Context, url, destPath string, maxBytes int64) (written int64, err error) {
+	if isDataURL(url) {
+		return decodeDataURL(url, destPath)
+	}
+	written, _, err = downloadConditional(ctx, url, destPath, maxBytes, "")
+	return written, err
+}
+
+// errNotModified is returned by downloadConditional on a 304 response
+var errNotModified = errors.New("not modified")
+
+// downloadConditional is downloadFileLimit for http(s) URLs that revalidates
+// a cached copy: a non-empty etag is sent as If-None-Match and a 304 returns
+// errNotModified without touching destPath. The response ETag is returned
+// so the caller can cache the new body.
+func downloadConditional(ctx context.Context, url, destPath string, maxBytes int64, etag string) (written int64, respETag string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("GET failed: %w", err)
+		return 0, "", networkError("GET failed", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	// Audio doesn't compress; any encoding a CDN applies anyway is undone
+	// by decodeContentEncoding rather than the transport
+	req.Header.Set("Accept-Encoding", "identity")
+
+	// Wait for the in-flight budget before connecting; see inflight.go
+	reserved, err := downloadBudget.acquire(ctx, downloadReservation(-1, maxBytes))
+	if err != nil {
+		return 0, "", fmt.Errorf("wait for download budget: %w", err)
+	}
+	defer func() { downloadBudget.release(reserved) }()
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, "", networkError("GET failed", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return 0, etag, errNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("GET returned %d: %s", resp.StatusCode, string(body))
+		return 0, "", statusError("GET", resp.StatusCode, body)
+	}
+
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return 0, "", fmt.Errorf("%w: Content-Length %d > %d bytes", errSegmentTooLarge, resp.ContentLength, maxBytes)
 	}
 
-	out, err := os.Create(destPath)
+	// Undo a gzip encoding the transport didn't; see contentencoding.go
+	decoded, contentLength, err := decodeContentEncoding(resp)
 	if err != nil {
-		return fmt.Errorf("create file failed: %w", err)
+		return 0, "", err
+	}
+
+	// Catch auth walls and error pages served with 200; see nonaudio.go
+	respBody := bufio.NewReaderSize(decoded, sniffLen)
+	if err := checkAudioResponse(url, resp, respBody); err != nil {
+		return 0, "", err
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	reserved = downloadBudget.resize(reserved, downloadReservation(contentLength, maxBytes))
+
+	// Write through a temp file so destPath only ever holds a complete body
+	written, err = atomicWrite(destPath, func(out *os.File) (int64, error) {
+		// Count bytes as they are copied rather than trusting Content-Length,
+		// which may be absent or wrong. Reading one byte past the limit is
+		// enough to know it was exceeded.
+		body := throttleDownload(ctx, respBody)
+		if maxBytes > 0 {
+			body = io.LimitReader(body, maxBytes+1)
+		}
+
+		n, err := io.Copy(out, body)
+		if err != nil {
+			return n, networkError("copy failed", err)
+		}
+
+		if maxBytes > 0 && n > maxBytes {
+			return n, fmt.Errorf("%w: more than %d bytes received", errSegmentTooLarge, maxBytes)
+		}
+
+		if contentLength >= 0 && n != contentLength {
+			return n, &TransferError{
+				Kind: kindNetwork,
+				Err:  fmt.Errorf("short body: got %d bytes, Content-Length was %d", n, contentLength),
+			}
+		}
+		return n, nil
+	})
 	if err != nil {
-		return fmt.Errorf("copy failed: %w", err)
+		return written, "", err
 	}
 
-	return nil
+	return written, resp.Header.Get("ETag"), nil
 }
 
-func uploadFile(srcPath, url string) error {
+func uploadFile(ctx context.Context, srcPath, url, contentType string) error {
 	file, err := os.Open(srcPath)
 	if err != nil {
 		return fmt.Errorf("open file failed: %w", err)
@@ -351,28 +1914,69 @@ func uploadFile(srcPath, url string) error {
 		return fmt.Errorf("stat file failed: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPut, url, file)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, file)
 	if err != nil {
 		return fmt.Errorf("create request failed: %w", err)
 	}
 
 	req.ContentLength = fileInfo.Size()
-	req.Header.Set("Content-Type", "audio/mpeg")
+	req.Header.Set("Content-Type", contentType)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("PUT failed: %w", err)
+		return networkError("PUT failed", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("PUT returned %d: %s", resp.StatusCode, string(body))
+		return statusError("PUT", resp.StatusCode, body)
 	}
 
 	return nil
 }
 
+// ffmpegTimePattern matches the time= field of FFmpeg's progress lines
+var ffmpegTimePattern = regexp.MustCompile(`time=(\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// durationFromFFmpegLog returns the last progress time FFmpeg reported on
+// stderr, which is the output duration once the encode has finished
+func durationFromFFmpegLog(log string) (float64, error) {
+	matches := ffmpegTimePattern.FindAllStringSubmatch(log, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("no time= progress in FFmpeg output")
+	}
+	last := matches[len(matches)-1]
+	hours, _ := strconv.Atoi(last[1])
+	minutes, _ := strconv.Atoi(last[2])
+	seconds, err := strconv.ParseFloat(last[3], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse duration failed: %w", err)
+	}
+	return float64(hours*3600+minutes*60) + seconds, nil
+}
+
+// validateAudio checks that ffprobe finds a decodable audio stream in path
+func validateAudio(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("ffprobe failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if strings.TrimSpace(string(output)) == "" {
+		return errors.New("no audio stream found")
+	}
+	return nil
+}
+
 func getDuration(filePath string) (float64, error) {
 	cmd := exec.Command("ffprobe",
 		"-v", "error",
@@ -401,15 +2005,16 @@ func getDuration(filePath string) (float64, error) {
 	return duration, nil
 }
 
-func sendError(w http.ResponseWriter, message string, status int) {
+func sendError(w http.ResponseWriter, code ErrorCode, message string, status int) {
+	writeErrorResponse(w, ConcatResponse{Error: message, ErrorCode: code}, status)
+}
+
+// writeErrorResponse sends a failed ConcatResponse carrying extra detail
+func writeErrorResponse(w http.ResponseWriter, resp ConcatResponse, status int) {
+	resp.SchemaVersion = schemaVersion
+	resp.Success = false
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ConcatResponse{
-		Success: false,
-		Error:   message,
-	})
-	fmt.Printf("Error: %s\n", message)
+	json.NewEncoder(w).Encode(resp)
+	fmt.Printf("Error: %s\n", resp.Error)
 }
-
-// Unused but kept for future use
-var _ = regexp.Compile
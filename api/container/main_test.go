@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	shutdownCtx, shutdownCancel = context.WithCancel(context.Background())
+	os.Exit(m.Run())
+}
+
+func TestHandleConcatDuringShutdown(t *testing.T) {
+	shutdownCancel()
+	defer func() { shutdownCtx, shutdownCancel = context.WithCancel(context.Background()) }()
+
+	req := httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader(`{"segments":["x"],"output_url":"y"}`))
+	rec := httptest.NewRecorder()
+	handleConcat(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+}
+
+func TestDownloadFileChunked(t *testing.T) {
+	chunks := [][]byte{
+		bytes.Repeat([]byte{0xff}, 1024),
+		bytes.Repeat([]byte{0xfb}, 2048),
+		bytes.Repeat([]byte{0x90}, 512),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before the handler returns forces chunked encoding with no Content-Length
+		for _, chunk := range chunks {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "segment.mp3")
+	written, err := downloadFile(context.Background(), server.URL, dest)
+	if err != nil {
+		t.Fatalf("downloadFile: %v", err)
+	}
+
+	want := bytes.Join(chunks, nil)
+	if written != int64(len(want)) {
+		t.Errorf("written = %d, want %d", written, len(want))
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read dest: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("downloaded content mismatch: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestDownloadFileContentLength(t *testing.T) {
+	body := bytes.Repeat([]byte{0xff}, 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "segment.mp3")
+	written, err := downloadFile(context.Background(), server.URL, dest)
+	if err != nil {
+		t.Fatalf("downloadFile: %v", err)
+	}
+	if written != int64(len(body)) {
+		t.Errorf("written = %d, want %d", written, len(body))
+	}
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, err := downloadFile(context.Background(), server.URL, filepath.Join(t.TempDir(), "segment.mp3")); err == nil {
+		t.Fatal("expected error for 404 response")
+	}
+}
+
+func TestDownloadFileMaxSegmentBytes(t *testing.T) {
+	config.MaxSegmentBytes = 1000
+	defer func() { config.MaxSegmentBytes = 0 }()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"content-length", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(bytes.Repeat([]byte{0xff}, 2000))
+		}},
+		{"chunked", func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 4; i++ {
+				w.Write(bytes.Repeat([]byte{0xff}, 500))
+				w.(http.Flusher).Flush()
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			dest := filepath.Join(t.TempDir(), "segment.mp3")
+			_, err := downloadFile(context.Background(), server.URL, dest)
+			if !errors.Is(err, errSegmentTooLarge) {
+				t.Fatalf("err = %v, want errSegmentTooLarge", err)
+			}
+			if _, statErr := os.Stat(dest); !os.IsNotExist(statErr) {
+				t.Errorf("partial file was not removed: %v", statErr)
+			}
+		})
+	}
+}
+
+func TestLogJobSummary(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	logJobSummary(JobSummary{
+		EpisodeID:    "ep-1",
+		Success:      true,
+		SegmentCount: 3,
+		StartedAt:    time.Now().Add(-2 * time.Second),
+		Phases:       JobPhases{DownloadMs: 1200},
+	})
+	os.Stdout = stdout
+	w.Close()
+
+	out, _ := io.ReadAll(r)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one log line, got %d: %q", len(lines), out)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("summary is not JSON: %v", err)
+	}
+	if got["event"] != "job_summary" || got["episode_id"] != "ep-1" || got["success"] != true {
+		t.Errorf("unexpected summary: %v", got)
+	}
+	if total, _ := got["total_ms"].(float64); total < 2000 {
+		t.Errorf("total_ms = %v, want >= 2000", got["total_ms"])
+	}
+	if phases, _ := got["phases"].(map[string]any); phases["download_ms"] != float64(1200) {
+		t.Errorf("phases = %v", got["phases"])
+	}
+}
+
+func TestDurationFromFFmpegLog(t *testing.T) {
+	log := "size=     512kB time=00:00:30.12 bitrate= 128.0kbits/s speed=60x\r" +
+		"size=    2048kB time=00:02:11.05 bitrate= 128.0kbits/s speed=61x\r" +
+		"[out#0/mp3] video:0kB audio:2050kB\n" +
+		"size=    2050kB time=01:02:11.50 bitrate= 128.0kbits/s speed=61x\n"
+
+	got, err := durationFromFFmpegLog(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 3731.5; got != want {
+		t.Errorf("duration = %v, want %v", got, want)
+	}
+
+	if _, err := durationFromFFmpegLog("Stream mapping: ..."); err == nil {
+		t.Error("expected error when no progress lines are present")
+	}
+}
+
+func TestHandleReset(t *testing.T) {
+	statusMutex.Lock()
+	containerStatus = ContainerStatus{State: "error", JobID: "ep-1", LastError: "FFmpeg failed"}
+	statusMutex.Unlock()
+
+	// Refused while a job holds a slot
+	acquireJobSlot()
+	rec := httptest.NewRecorder()
+	handleReset(rec, httptest.NewRequest(http.MethodPost, "/reset", nil))
+	releaseJobSlot()
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("reset during job: code = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = httptest.NewRecorder()
+	handleReset(rec, httptest.NewRequest(http.MethodPost, "/reset", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset: code = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	statusMutex.RLock()
+	defer statusMutex.RUnlock()
+	if containerStatus.State != "idle" || containerStatus.LastError != "" {
+		t.Errorf("status after reset = %+v", containerStatus)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	var payload struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+
+	rec := httptest.NewRecorder()
+	handleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil || payload.SchemaVersion != schemaVersion {
+		t.Errorf("/status schema_version = %d (err %v), want %d", payload.SchemaVersion, err, schemaVersion)
+	}
+
+	payload.SchemaVersion = 0
+	rec = httptest.NewRecorder()
+	handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", strings.NewReader("{")))
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil || payload.SchemaVersion != schemaVersion {
+		t.Errorf("/concat error schema_version = %d (err %v), want %d", payload.SchemaVersion, err, schemaVersion)
+	}
+}
+
+func TestHandleConcatSkipsAllCorruptSegments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	body, _ := json.Marshal(ConcatRequest{
+		EpisodeID:           "ep-skip",
+		Segments:            segmentURLs(server.URL+"/a.mp3", server.URL+"/b.mp3"),
+		OutputURL:           server.URL + "/out.mp3",
+		SkipCorruptSegments: true,
+	})
+	rec := httptest.NewRecorder()
+	handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("code = %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+	var resp ConcatResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.ErrorCode != codeSegmentDownloadFailed {
+		t.Errorf("error_code = %q, want %q", resp.ErrorCode, codeSegmentDownloadFailed)
+	}
+	if timing := rec.Header().Get("Server-Timing"); !strings.Contains(timing, "total;dur=") {
+		t.Errorf("Server-Timing = %q", timing)
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	got := serverTiming(JobPhases{DownloadMs: 1200, EncodeMs: 3400, UploadMs: 500}, 5200*time.Millisecond)
+	if want := "download;dur=1200, encode;dur=3400, upload;dur=500, total;dur=5200"; got != want {
+		t.Errorf("serverTiming = %q, want %q", got, want)
+	}
+	if got := serverTiming(JobPhases{}, 0); got != "total;dur=0" {
+		t.Errorf("empty serverTiming = %q", got)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ---------- Segment Manifests ----------
+//
+// A manifest replaces the inline segment list for large episodes. Two formats
+// are accepted:
+//
+//	JSON: {"segments": ["https://...", ...]}
+//	M3U:  one URL per line; blank lines and #-comments are ignored
+//
+// Relative URLs in either format resolve against the manifest URL.
+//
+// Either format may be gzip-compressed, which matters for thousand-segment
+// playlists. The transport already undoes Content-Encoding: gzip when it
+// negotiated it; a .gz object served as-is, or a Content-Encoding the
+// transport left alone, is recognized by the gzip magic bytes, the header,
+// or the .gz suffix and decompressed here.
+
+// maxManifestBytes bounds the manifest body read into memory
+const maxManifestBytes = 10 << 20
+
+// jsonManifest is the JSON manifest schema
+type jsonManifest struct {
+	Segments []string `json:"segments"`
+}
+
+// fetchManifest downloads and expands the manifest at manifestURL
+func fetchManifest(ctx context.Context, manifestURL string) ([]string, error) {
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse manifest URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GET returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	if len(data) > maxManifestBytes {
+		return nil, fmt.Errorf("manifest exceeds %d bytes", maxManifestBytes)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if isGzipManifest(data, resp, base) {
+		if data, err = gunzipManifest(data); err != nil {
+			return nil, err
+		}
+		// A .gz object's Content-Type describes the archive, not the list
+		if mediaType, _, _ := mime.ParseMediaType(contentType); strings.Contains(mediaType, "gzip") {
+			contentType = ""
+		}
+	}
+
+	return parseManifest(data, contentType, base)
+}
+
+// isGzipManifest reports whether the fetched body still needs gunzipping
+func isGzipManifest(data []byte, resp *http.Response, base *url.URL) bool {
+	if resp.Uncompressed {
+		return false
+	}
+	return bytes.HasPrefix(data, []byte{0x1f, 0x8b}) ||
+		strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") ||
+		strings.HasSuffix(base.Path, ".gz")
+}
+
+// gunzipManifest decompresses data, holding the result to maxManifestBytes
+func gunzipManifest(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("manifest is not valid gzip: %w", err)
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(zr, maxManifestBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("manifest gzip is corrupt: %w", err)
+	}
+	if len(out) > maxManifestBytes {
+		return nil, fmt.Errorf("decompressed manifest exceeds %d bytes", maxManifestBytes)
+	}
+	return out, nil
+}
+
+// parseManifest decodes a JSON or M3U manifest into absolute segment URLs
+func parseManifest(data []byte, contentType string, base *url.URL) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	trimmed := bytes.TrimSpace(data)
+
+	var entries []string
+	if strings.HasSuffix(mediaType, "json") || bytes.HasPrefix(trimmed, []byte("{")) {
+		var m jsonManifest
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("invalid JSON manifest: %w", err)
+		}
+		entries = m.Segments
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("invalid M3U manifest: %w", err)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("manifest lists no segments")
+	}
+	if limit := config.MaxManifestSegments; limit > 0 && len(entries) > limit {
+		return nil, fmt.Errorf("manifest lists %d segments, limit is %d", len(entries), limit)
+	}
+
+	segments := make([]string, len(entries))
+	for i, entry := range entries {
+		if entry == "" {
+			return nil, fmt.Errorf("manifest entry %d is empty", i)
+		}
+		if isDataURL(entry) {
+			segments[i] = entry
+			continue
+		}
+		ref, err := url.Parse(entry)
+		if err != nil {
+			return nil, fmt.Errorf("manifest entry %d: %w", i, err)
+		}
+		segments[i] = base.ResolveReference(ref).String()
+	}
+	return segments, nil
+}
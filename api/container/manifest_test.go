@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	base, _ := url.Parse("https://r2.example/manifests/ep-1.json")
+
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		want        []string
+	}{
+		{
+			"json",
+			`{"segments": ["https://cdn.example/a.mp3", "b.mp3"]}`,
+			"application/json",
+			[]string{"https://cdn.example/a.mp3", "https://r2.example/manifests/b.mp3"},
+		},
+		{
+			"json sniffed",
+			`{"segments": ["/segments/a.mp3"]}`,
+			"",
+			[]string{"https://r2.example/segments/a.mp3"},
+		},
+		{
+			"m3u",
+			"#EXTM3U\n#EXTINF:3,intro\nhttps://cdn.example/a.mp3\n\nb.mp3\n",
+			"audio/x-mpegurl",
+			[]string{"https://cdn.example/a.mp3", "https://r2.example/manifests/b.mp3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseManifest([]byte(tt.data), tt.contentType, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifestInvalid(t *testing.T) {
+	base, _ := url.Parse("https://r2.example/m.json")
+	config.MaxManifestSegments = 2
+	defer func() { config.MaxManifestSegments = 0 }()
+
+	tests := map[string]string{
+		"empty json":     `{"segments": []}`,
+		"unknown field":  `{"segment": ["a.mp3"]}`,
+		"wrong type":     `{"segments": [1, 2]}`,
+		"empty m3u":      "#EXTM3U\n",
+		"over the limit": "a.mp3\nb.mp3\nc.mp3\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseManifest([]byte(data), "", base); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestFetchManifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"segments": ["seg/0.mp3", "seg/1.mp3"]}`))
+	}))
+	defer server.Close()
+
+	got, err := fetchManifest(context.Background(), server.URL+"/ep/manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/ep/seg/0.mp3", server.URL + "/ep/seg/1.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFetchManifestGzip(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("#EXTM3U\nseg/0.mp3\nseg/1.mp3\n"))
+	zw.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ep/manifest.m3u.gz":
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(gz.Bytes())
+		case "/ep/encoded.m3u":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gz.Bytes())
+		default:
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(gz.Bytes()[:gz.Len()/2])
+		}
+	}))
+	defer server.Close()
+
+	want := []string{server.URL + "/ep/seg/0.mp3", server.URL + "/ep/seg/1.mp3"}
+	for _, name := range []string{"manifest.m3u.gz", "encoded.m3u"} {
+		got, err := fetchManifest(context.Background(), server.URL+"/ep/"+name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+
+	_, err := fetchManifest(context.Background(), server.URL+"/ep/truncated.m3u.gz")
+	if err == nil || !strings.Contains(err.Error(), "gzip") {
+		t.Errorf("truncated gzip: err = %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---------- Metadata Tags ----------
+//
+// FFmpeg's mp3 muxer maps well-known -metadata keys to ID3v2 frames and
+// writes any other key as a TXXX frame with that key as its description.
+// Podcast fields use both:
+//
+//	season   -> TPOS (disc number) and TXXX:ITUNESSEASON
+//	episode  -> TRCK (track number) and TXXX:ITUNESEPISODE
+//	explicit -> TXXX:ITUNESADVISORY, "1" explicit or "2" clean
+//
+// ID3 has no native season/episode/advisory frames. The TXXX descriptions
+// follow the names iTunes uses for its own advisory and episode tags, and
+// the standard TPOS/TRCK numbers are what generic players show.
+//
+// Text encoding follows id3_version. For 2.4 the muxer writes UTF-8. For 2.3
+// it writes UTF-16 with a BOM whenever a value isn't plain ASCII, so CJK and
+// accented titles survive either way. Two cases can still lose characters:
+// 2.3 is specified as UCS-2, so characters outside the Basic Multilingual
+// Plane (most emoji) become surrogate pairs that strict 2.3 readers show as
+// garbage, and a NUL ends an ID3 text frame early in both versions. Those
+// are reported as warnings rather than rejected.
+
+// Apple-style advisory values
+const (
+	advisoryExplicit = "1"
+	advisoryClean    = "2"
+)
+
+// metadataArgs returns the -metadata arguments for the set fields
+func metadataArgs(m ConcatMetadata) []string {
+	var args []string
+	add := func(key, value string) {
+		args = append(args, "-metadata", fmt.Sprintf("%s=%s", key, value))
+	}
+
+	if m.Title != "" {
+		add("title", m.Title)
+	}
+	if m.Artist != "" {
+		add("artist", m.Artist)
+	}
+	if m.Album != "" {
+		add("album", m.Album)
+	}
+	if m.Genre != "" {
+		add("genre", m.Genre)
+	}
+	if m.Date != "" {
+		add("date", m.Date)
+	}
+	if m.Season > 0 {
+		add("disc", strconv.Itoa(m.Season))
+		add("ITUNESSEASON", strconv.Itoa(m.Season))
+	}
+	if m.Episode > 0 {
+		add("track", strconv.Itoa(m.Episode))
+		add("ITUNESEPISODE", strconv.Itoa(m.Episode))
+	}
+	if m.Explicit != nil {
+		advisory := advisoryClean
+		if *m.Explicit {
+			advisory = advisoryExplicit
+		}
+		add("ITUNESADVISORY", advisory)
+	}
+	return args
+}
+
+// stripMetadataArgs returns the output options for strip_metadata: no tags
+// inherited from the inputs and no chapters. The ID3v2 header itself is
+// dropped by stripID3Args; the mp3 muxer writes no ID3v1 tag by default.
+func stripMetadataArgs() []string {
+	return []string{"-map_metadata", "-1", "-map_chapters", "-1"}
+}
+
+// stripID3Args replaces id3Args for strip_metadata, so the mp3 muxer writes
+// no ID3v2 header at all, not even its own encoder tag
+func stripID3Args(split bool) []string {
+	if split {
+		return []string{"-segment_format_options", "id3v2_version=0"}
+	}
+	return []string{"-id3v2_version", "0"}
+}
+
+// validateStripMetadata rejects strip_metadata combined with anything that
+// would write tags. Runs before id3_version gets its default.
+func validateStripMetadata(req *ConcatRequest) error {
+	if !req.StripMetadata {
+		return nil
+	}
+	if len(metadataArgs(req.Metadata)) > 0 {
+		return errors.New("strip_metadata and metadata are mutually exclusive")
+	}
+	if req.ID3Version != 0 {
+		return errors.New("id3_version has no effect with strip_metadata; no ID3 tag is written")
+	}
+	return nil
+}
+
+// validateMetadataText rejects NUL in the text fields. Tags are passed to
+// FFmpeg as arguments, which exec refuses to carry a NUL in.
+func validateMetadataText(m ConcatMetadata) error {
+	for _, field := range []struct{ name, value string }{
+		{"title", m.Title},
+		{"artist", m.Artist},
+		{"album", m.Album},
+		{"genre", m.Genre},
+		{"date", m.Date},
+	} {
+		if strings.ContainsRune(field.value, 0) {
+			return fmt.Errorf("metadata.%s must not contain a NUL character", field.name)
+		}
+	}
+	return nil
+}
+
+// metadataEncodingWarnings lists the text fields that id3Version can't carry
+// faithfully
+func metadataEncodingWarnings(m ConcatMetadata, id3Version int) []string {
+	var warnings []string
+	for _, field := range []struct{ name, value string }{
+		{"title", m.Title},
+		{"artist", m.Artist},
+		{"album", m.Album},
+		{"genre", m.Genre},
+	} {
+		if id3Version == 3 && hasSupplementaryRune(field.value) {
+			warnings = append(warnings, fmt.Sprintf("metadata.%s has characters outside the Basic Multilingual Plane (e.g. emoji) that ID3v2.3 readers may not decode; use id3_version 4", field.name))
+		}
+	}
+	return warnings
+}
+
+// hasSupplementaryRune reports whether s has a rune that needs a UTF-16
+// surrogate pair
+func hasSupplementaryRune(s string) bool {
+	for _, r := range s {
+		if utf8.RuneLen(r) == 4 {
+			return true
+		}
+	}
+	return false
+}
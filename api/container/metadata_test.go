@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetadataArgs(t *testing.T) {
+	explicit := true
+	got := metadataArgs(ConcatMetadata{Title: "Ep 12", Season: 2, Episode: 12, Explicit: &explicit})
+	want := []string{
+		"-metadata", "title=Ep 12",
+		"-metadata", "disc=2", "-metadata", "ITUNESSEASON=2",
+		"-metadata", "track=12", "-metadata", "ITUNESEPISODE=12",
+		"-metadata", "ITUNESADVISORY=1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metadataArgs = %v, want %v", got, want)
+	}
+
+	clean := false
+	if got := metadataArgs(ConcatMetadata{Explicit: &clean}); !reflect.DeepEqual(got, []string{"-metadata", "ITUNESADVISORY=2"}) {
+		t.Errorf("clean = %v", got)
+	}
+	if got := metadataArgs(ConcatMetadata{}); len(got) != 0 {
+		t.Errorf("empty metadata = %v", got)
+	}
+
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", Metadata: ConcatMetadata{Episode: -1}}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected error for a negative episode")
+	}
+}
+
+// TestMetadataRoundTrip writes the tags with FFmpeg and reads them back with
+// ffprobe; it is skipped without them
+func TestMetadataRoundTrip(t *testing.T) {
+	for _, bin := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not installed", bin)
+		}
+	}
+	explicit := true
+	out := filepath.Join(t.TempDir(), "tagged.mp3")
+	args := []string{"-v", "error", "-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "1", "-c:a", "libmp3lame"}
+	args = append(args, metadataArgs(ConcatMetadata{Season: 3, Episode: 7, Explicit: &explicit})...)
+	args = append(args, "-id3v2_version", "4", "-y", out)
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, output)
+	}
+
+	output, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format_tags", "-of", "json", out).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var probe struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	json.Unmarshal(output, &probe)
+	tags := map[string]string{}
+	for k, v := range probe.Format.Tags {
+		tags[strings.ToLower(k)] = v
+	}
+	for key, want := range map[string]string{
+		"disc": "3", "track": "7",
+		"itunesseason": "3", "itunesepisode": "7", "itunesadvisory": "1",
+	} {
+		if tags[key] != want {
+			t.Errorf("tag %s = %q, want %q (all tags: %v)", key, tags[key], want, tags)
+		}
+	}
+}
+
+func TestMetadataEncodingWarnings(t *testing.T) {
+	cjk := ConcatMetadata{Title: "東京の夜", Artist: "Zoë"}
+	if got := metadataEncodingWarnings(cjk, 3); len(got) != 0 {
+		t.Errorf("CJK on 2.3 = %v, want no warnings", got)
+	}
+
+	emoji := ConcatMetadata{Title: "Launch day 🚀", Album: "Show"}
+	if got := metadataEncodingWarnings(emoji, 4); len(got) != 0 {
+		t.Errorf("emoji on 2.4 = %v, want no warnings", got)
+	}
+	if got := metadataEncodingWarnings(emoji, 3); len(got) != 1 || !strings.Contains(got[0], "metadata.title") {
+		t.Errorf("emoji on 2.3 = %v, want one title warning", got)
+	}
+
+}
+
+func TestValidateMetadataNUL(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", Metadata: ConcatMetadata{Genre: "News\x00Talk"}}
+	if err := validateRequest(req); err == nil || !strings.Contains(err.Error(), "metadata.genre") {
+		t.Errorf("err = %v, want metadata.genre rejected", err)
+	}
+}
+
+// TestMetadataUnicodeRoundTrip checks that emoji and CJK titles read back
+// unchanged from both ID3 versions; it is skipped without FFmpeg
+func TestMetadataUnicodeRoundTrip(t *testing.T) {
+	for _, bin := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not installed", bin)
+		}
+	}
+	m := ConcatMetadata{Title: "Launch day 🚀", Artist: "東京の夜", Album: "Ça va"}
+	for _, version := range []string{"3", "4"} {
+		out := filepath.Join(t.TempDir(), "tagged.mp3")
+		args := []string{"-v", "error", "-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "1", "-c:a", "libmp3lame"}
+		args = append(args, metadataArgs(m)...)
+		args = append(args, "-id3v2_version", version, "-y", out)
+		if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg: %v: %s", err, output)
+		}
+
+		output, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format_tags", "-of", "json", out).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var probe struct {
+			Format struct {
+				Tags map[string]string `json:"tags"`
+			} `json:"format"`
+		}
+		json.Unmarshal(output, &probe)
+		for key, want := range map[string]string{"title": m.Title, "artist": m.Artist, "album": m.Album} {
+			if got := probe.Format.Tags[key]; got != want {
+				t.Errorf("id3v2.%s %s = %q, want %q", version, key, got, want)
+			}
+		}
+	}
+}
+
+func TestValidateStripMetadata(t *testing.T) {
+	clean := false
+	tests := []struct {
+		name    string
+		req     ConcatRequest
+		wantErr bool
+	}{
+		{"off", ConcatRequest{Metadata: ConcatMetadata{Title: "Ep 1"}}, false},
+		{"strip alone", ConcatRequest{StripMetadata: true}, false},
+		{"with title", ConcatRequest{StripMetadata: true, Metadata: ConcatMetadata{Title: "Ep 1"}}, true},
+		{"with explicit", ConcatRequest{StripMetadata: true, Metadata: ConcatMetadata{Explicit: &clean}}, true},
+		{"with id3_version", ConcatRequest{StripMetadata: true, ID3Version: 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			if err := validateStripMetadata(&req); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestStripMetadataRoundTrip encodes a tagged input with the strip options
+// and checks no tag survives; it is skipped without FFmpeg
+func TestStripMetadataRoundTrip(t *testing.T) {
+	requireFFmpegTools(t)
+	dir := t.TempDir()
+	tagged := filepath.Join(dir, "tagged.mp3")
+	if output, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "1",
+		"-c:a", "libmp3lame", "-metadata", "title=Private", "-y", tagged).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, output)
+	}
+
+	out := filepath.Join(dir, "stripped.mp3")
+	args := []string{"-v", "error", "-i", tagged, "-c:a", "libmp3lame"}
+	args = append(args, stripMetadataArgs()...)
+	args = append(args, stripID3Args(false)...)
+	if output, err := exec.Command("ffmpeg", append(args, "-y", out)...).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, output)
+	}
+	output, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format_tags", "-of", "json", out).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(output), "Private") || strings.Contains(string(output), "encoder") {
+		t.Errorf("stripped output still has tags: %s", output)
+	}
+}
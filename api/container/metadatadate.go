@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ---------- Metadata Date ----------
+//
+// metadata.date is written as FFmpeg's "date" key. For ID3v2.4 the muxer
+// stores it verbatim in TDRC, which holds an ISO 8601 subset: yyyy,
+// yyyy-MM, yyyy-MM-dd or yyyy-MM-ddTHH:mm:ss, with no zone. For ID3v2.3 it
+// splits a "yyyy-MM-dd" value into TYER and TDAT and keeps only the year of
+// anything else. A value in any other shape (a zone suffix, slashes, a
+// month name) ends up as a frame players ignore or misread, so the date is
+// parsed and rewritten into the exact form the version stores:
+//
+//	input                      id3_version 4         id3_version 3
+//	2024-03-05T14:30:00+01:00  2024-03-05T13:30:00   2024-03-05
+//	2024-03-05                 2024-03-05            2024-03-05
+//	2024-03                    2024-03               2024
+//	2024                       2024                  2024
+//
+// RFC 3339 timestamps are converted to UTC, since TDRC has no zone; zoneless
+// timestamps are taken as UTC already. A date that parses as none of these
+// is rejected with 400.
+
+// metadataDateForms are the accepted date shapes, with the layout each is
+// written in per ID3 version
+var metadataDateForms = []struct {
+	layout, v24, v23 string
+}{
+	{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"},
+	{"2006-01-02T15:04:05", "2006-01-02T15:04:05", "2006-01-02"},
+	{"2006-01-02", "2006-01-02", "2006-01-02"},
+	{"2006-01", "2006-01", "2006"},
+	{"2006", "2006", "2006"},
+}
+
+// normalizeMetadataDate rewrites value into the form id3Version stores
+func normalizeMetadataDate(value string, id3Version int) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, f := range metadataDateForms {
+		t, err := time.Parse(f.layout, value)
+		if err != nil {
+			continue
+		}
+		if id3Version == 3 {
+			return t.UTC().Format(f.v23), nil
+		}
+		return t.UTC().Format(f.v24), nil
+	}
+	return "", fmt.Errorf("metadata.date %q must be an RFC 3339 timestamp, YYYY-MM-DD, YYYY-MM or YYYY", value)
+}
+
+// validateMetadataDate normalizes metadata.date in place. Runs after
+// id3_version gets its default.
+func validateMetadataDate(req *ConcatRequest) error {
+	if req.Metadata.Date == "" {
+		return nil
+	}
+	date, err := normalizeMetadataDate(req.Metadata.Date, req.ID3Version)
+	if err != nil {
+		return err
+	}
+	req.Metadata.Date = date
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeMetadataDate(t *testing.T) {
+	cases := []struct {
+		in       string
+		v24, v23 string
+	}{
+		{"2024-03-05T14:30:00+01:00", "2024-03-05T13:30:00", "2024-03-05"},
+		{"2024-03-05T14:30:00Z", "2024-03-05T14:30:00", "2024-03-05"},
+		{"2024-03-05T14:30:00.250Z", "2024-03-05T14:30:00", "2024-03-05"},
+		{"2024-03-05T23:30:00-02:00", "2024-03-06T01:30:00", "2024-03-06"}, // The UTC day
+		{"2024-03-05T14:30:00", "2024-03-05T14:30:00", "2024-03-05"},
+		{"2024-03-05", "2024-03-05", "2024-03-05"},
+		{" 2024-03-05 ", "2024-03-05", "2024-03-05"},
+		{"2024-03", "2024-03", "2024"},
+		{"2024", "2024", "2024"},
+	}
+	for _, c := range cases {
+		if got, err := normalizeMetadataDate(c.in, 4); err != nil || got != c.v24 {
+			t.Errorf("normalizeMetadataDate(%q, 4) = %q, %v, want %q", c.in, got, err, c.v24)
+		}
+		if got, err := normalizeMetadataDate(c.in, 3); err != nil || got != c.v23 {
+			t.Errorf("normalizeMetadataDate(%q, 3) = %q, %v, want %q", c.in, got, err, c.v23)
+		}
+	}
+
+	for _, bad := range []string{"", "03/05/2024", "5 March 2024", "2024-13-01", "2024-02-30", "24", "2024-03-05 14:30", "yesterday"} {
+		if got, err := normalizeMetadataDate(bad, 4); err == nil {
+			t.Errorf("normalizeMetadataDate(%q) = %q, want an error", bad, got)
+		}
+	}
+}
+
+func TestValidateMetadataDate(t *testing.T) {
+	req := ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", ID3Version: 3, Metadata: ConcatMetadata{Date: "2024-03-05T14:30:00Z"}}
+	if err := validateRequest(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Metadata.Date != "2024-03-05" {
+		t.Errorf("date = %q, want 2024-03-05", req.Metadata.Date)
+	}
+	// Validating again leaves the normalized date alone
+	if err := validateRequest(&req); err != nil || req.Metadata.Date != "2024-03-05" {
+		t.Errorf("second validation: date = %q, %v", req.Metadata.Date, err)
+	}
+
+	req = ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", Metadata: ConcatMetadata{Date: "March 2024"}}
+	if err := validateRequest(&req); err == nil {
+		t.Error("expected an error for an unparseable date")
+	}
+	req = ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", StripMetadata: true, Metadata: ConcatMetadata{Date: "2024"}}
+	if err := validateRequest(&req); err == nil {
+		t.Error("expected strip_metadata to reject a date")
+	}
+}
+
+// TestMetadataDateRoundTrip writes normalized dates with both ID3 versions
+// and reads them back; it is skipped without FFmpeg
+func TestMetadataDateRoundTrip(t *testing.T) {
+	requireFFmpegTools(t)
+	for _, version := range []int{3, 4} {
+		date, err := normalizeMetadataDate("2024-03-05T14:30:00Z", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(t.TempDir(), "dated.mp3")
+		args := []string{"-v", "error", "-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "1", "-c:a", "libmp3lame"}
+		args = append(args, metadataArgs(ConcatMetadata{Date: date})...)
+		args = append(args, id3Args(version, false)...)
+		args = append(args, "-y", out)
+		if output, err := ffmpegCommand(context.Background(), args...).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg: %v: %s", err, output)
+		}
+		tags, err := probeTags(context.Background(), out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if missing := missingTags(expectedTags(ConcatMetadata{Date: date}), tags); len(missing) > 0 {
+			t.Errorf("id3_version %d: tags %v don't read back (got %v)", version, missing, tags)
+		}
+	}
+}
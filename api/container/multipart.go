@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Multipart Upload ----------
+//
+// A single PUT of a long episode has to start over from the first byte
+// whenever the connection drops near the end. With storage credentials
+// configured, outputs of at least MULTIPART_THRESHOLD_BYTES on
+// STORAGE_ENDPOINT's host are uploaded as an S3 multipart upload instead:
+// each part is sent with its SHA-256 in x-amz-checksum-sha256, so storage
+// rejects a part that arrives corrupted, and a failed part is retried on
+// its own. CompleteMultipartUpload then assembles the object from the
+// parts' ETags and checksums.
+//
+// A job whose upload fails leaves the multipart upload open and returns its
+// ID under "multipart". Passing it back as multipart_upload_id resumes at
+// part granularity: ListParts reports what storage already holds, parts
+// whose number, size and checksum match the new output are reused, and
+// only the rest are sent. A re-encode that isn't byte-identical simply
+// re-sends every part. Uploads that are never resumed are left to the
+// bucket's AbortIncompleteMultipartUpload lifecycle rule.
+//
+// Multipart requests are signed with the container's own credentials, which
+// replaces the caller's signature. So a presigned output_url keeps its single
+// PUT, with the key, expiry and content type the caller signed for, unless
+// the request opts in with multipart_upload or multipart_upload_id; the
+// threshold alone only applies to unsigned URLs.
+//
+// The storage calls sit behind multipartStore; sigV4Signer implements it
+// with header-signed requests against S3 or R2.
+
+const (
+	minMultipartPartSize = 5 << 20 // S3's minimum for every part but the last
+	maxMultipartParts    = 10000
+)
+
+// multipartStore runs S3 multipart uploads on the storage endpoint
+type multipartStore interface {
+	owns(objectURL string) bool
+	createMultipartUpload(ctx context.Context, objectURL, contentType string) (string, error)
+	uploadPart(ctx context.Context, objectURL, uploadID string, number int, body io.Reader, size int64, checksum string) (string, error)
+	listParts(ctx context.Context, objectURL, uploadID string) ([]multipartPart, error)
+	completeMultipartUpload(ctx context.Context, objectURL, uploadID string, parts []multipartPart) error
+}
+
+// multipartStorage is nil unless storage credentials are configured
+var multipartStorage multipartStore
+
+// newMultipartStore returns the storage client for multipart uploads. It
+// shares the download signer's credentials and endpoint check.
+func newMultipartStore() multipartStore {
+	if s, ok := downloadSigner.(*sigV4Signer); ok {
+		return s
+	}
+	return nil
+}
+
+// multipartPart is one stored part
+type multipartPart struct {
+	Number   int
+	ETag     string
+	Checksum string // Base64 SHA-256, as x-amz-checksum-sha256 carries it
+	Size     int64
+}
+
+// MultipartResult reports a multipart upload, on failure too, so the client
+// can resume it with multipart_upload_id
+type MultipartResult struct {
+	UploadID    string `json:"upload_id"`
+	PartSize    int64  `json:"part_size"`
+	Parts       int    `json:"parts"`
+	PartsReused int    `json:"parts_reused,omitempty"` // Already stored with a matching checksum
+	Restarted   bool   `json:"restarted,omitempty"`    // multipart_upload_id was gone, so a new upload was started
+}
+
+// validateMultipartUpload checks that a requested multipart upload (or
+// resume) can run
+func validateMultipartUpload(req *ConcatRequest, hls bool) error {
+	option := "multipart_upload"
+	switch {
+	case req.MultipartUploadID != "":
+		option = "multipart_upload_id"
+	case !req.MultipartUpload:
+		return nil
+	}
+	switch {
+	case multipartStorage == nil:
+		return fmt.Errorf("%s requires storage credentials (STORAGE_* env)", option)
+	case req.SplitDurationSeconds > 0:
+		return fmt.Errorf("%s is not supported with split output", option)
+	case hls:
+		return fmt.Errorf("%s is not supported with HLS output", option)
+	case len(req.OutputURLs) > 0:
+		return fmt.Errorf("%s is not supported with output_urls", option)
+	case req.UploadMethod == uploadMethodPost:
+		return fmt.Errorf("%s is not supported with upload_method %q", option, uploadMethodPost)
+	case req.StreamUpload:
+		return fmt.Errorf("%s and stream_upload are mutually exclusive", option)
+	case !multipartStorage.owns(req.OutputURL):
+		return fmt.Errorf("%s requires an output_url on the storage endpoint", option)
+	}
+	return nil
+}
+
+// isPresignedURL reports whether rawURL carries a query-string signature
+// (SigV4, or SigV2's Signature)
+func isPresignedURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	q := u.Query()
+	return q.Has("X-Amz-Signature") || q.Has("X-Amz-Credential") || q.Has("Signature")
+}
+
+// useMultipartUpload reports whether a single-file output of size bytes
+// goes to objectURL as a multipart upload
+func useMultipartUpload(req ConcatRequest, objectURL string, size int64) bool {
+	if multipartStorage == nil || req.UploadMethod == uploadMethodPost || !multipartStorage.owns(objectURL) {
+		return false
+	}
+	if req.MultipartUploadID != "" || req.MultipartUpload {
+		return true
+	}
+	return config.MultipartThreshold > 0 && size >= config.MultipartThreshold && !isPresignedURL(objectURL)
+}
+
+// multipartPartSize returns MULTIPART_PART_SIZE_BYTES, raised to S3's
+// minimum and to what keeps size within maxMultipartParts
+func multipartPartSize(size int64) int64 {
+	partSize := max(config.MultipartPartSize, minMultipartPartSize)
+	if size > partSize*maxMultipartParts {
+		partSize = (size + maxMultipartParts - 1) / maxMultipartParts
+	}
+	return partSize
+}
+
+// uploadMultipartOutput uploads srcPath with the configured storage client
+func uploadMultipartOutput(ctx context.Context, srcPath, objectURL, contentType, resumeID string) (MultipartResult, error) {
+	result, err := uploadMultipart(ctx, multipartStorage, srcPath, objectURL, contentType, resumeID)
+	if ctx.Err() == nil {
+		recordUpload(objectURL, err, time.Now())
+	}
+	return result, err
+}
+
+// uploadMultipart uploads srcPath to objectURL in parts, resuming resumeID
+// when it is set. The upload is left open on failure.
+func uploadMultipart(ctx context.Context, store multipartStore, srcPath, objectURL, contentType, resumeID string) (MultipartResult, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return MultipartResult{}, &TransferError{Kind: kindLocal, Err: fmt.Errorf("open file failed: %w", err)}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return MultipartResult{}, &TransferError{Kind: kindLocal, Err: fmt.Errorf("stat file failed: %w", err)}
+	}
+
+	size := info.Size()
+	result := MultipartResult{PartSize: multipartPartSize(size)}
+	result.Parts = max(1, int((size+result.PartSize-1)/result.PartSize))
+	label := "multipart upload " + redactURL(objectURL)
+
+	stored := map[int]multipartPart{}
+	if resumeID != "" {
+		parts, err := retryTransfer(ctx, label, func() ([]multipartPart, error) {
+			return store.listParts(ctx, objectURL, resumeID)
+		})
+		var te *TransferError
+		switch {
+		case err == nil:
+			result.UploadID = resumeID
+			for _, p := range parts {
+				stored[p.Number] = p
+			}
+		case errors.As(err, &te) && te.StatusCode == http.StatusNotFound:
+			// Completed, aborted or expired: the parts are gone
+			fmt.Printf("%s: upload %s not found; starting a new one\n", label, resumeID)
+			result.Restarted = true
+		default:
+			result.UploadID = resumeID
+			return result, fmt.Errorf("list parts failed: %w", err)
+		}
+	}
+	if result.UploadID == "" {
+		result.UploadID, err = retryTransfer(ctx, label, func() (string, error) {
+			return store.createMultipartUpload(ctx, objectURL, contentType)
+		})
+		if err != nil {
+			return result, fmt.Errorf("create multipart upload failed: %w", err)
+		}
+	}
+
+	parts := make([]multipartPart, result.Parts)
+	for i := range parts {
+		offset := int64(i) * result.PartSize
+		n := min(result.PartSize, size-offset)
+		checksum, err := partChecksum(io.NewSectionReader(file, offset, n))
+		if err != nil {
+			return result, &TransferError{Kind: kindLocal, Err: fmt.Errorf("read part %d failed: %w", i+1, err)}
+		}
+		if p, ok := stored[i+1]; ok && p.Size == n && p.Checksum == checksum {
+			parts[i] = p
+			result.PartsReused++
+			continue
+		}
+		etag, err := retryTransfer(ctx, fmt.Sprintf("%s part %d", label, i+1), func() (string, error) {
+			return store.uploadPart(ctx, objectURL, result.UploadID, i+1, io.NewSectionReader(file, offset, n), n, checksum)
+		})
+		if err != nil {
+			return result, fmt.Errorf("part %d failed: %w", i+1, err)
+		}
+		parts[i] = multipartPart{Number: i + 1, ETag: etag, Checksum: checksum, Size: n}
+	}
+
+	_, err = retryTransfer(ctx, label, func() (struct{}, error) {
+		return struct{}{}, store.completeMultipartUpload(ctx, objectURL, result.UploadID, parts)
+	})
+	if err != nil {
+		return result, fmt.Errorf("complete multipart upload failed: %w", err)
+	}
+	return result, nil
+}
+
+// partChecksum returns the base64 SHA-256 of r
+func partChecksum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// owns reports whether objectURL is on the storage endpoint
+func (s *sigV4Signer) owns(objectURL string) bool {
+	_, err := s.objectURL(objectURL)
+	return err == nil
+}
+
+// createMultipartUpload starts an upload whose parts carry SHA-256 checksums
+func (s *sigV4Signer) createMultipartUpload(ctx context.Context, objectURL, contentType string) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("X-Amz-Checksum-Algorithm", "SHA256")
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.storageCall(ctx, http.MethodPost, objectURL, map[string]string{"uploads": ""}, header, nil, 0, &result); err != nil {
+		return "", err
+	}
+	if result.UploadID == "" {
+		return "", &TransferError{Kind: kindServer, Err: errors.New("CreateMultipartUpload returned no UploadId")}
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart sends one part and returns its ETag
+func (s *sigV4Signer) uploadPart(ctx context.Context, objectURL, uploadID string, number int, body io.Reader, size int64, checksum string) (string, error) {
+	header := http.Header{}
+	header.Set("X-Amz-Checksum-Sha256", checksum)
+	query := map[string]string{"partNumber": strconv.Itoa(number), "uploadId": uploadID}
+	resp, err := s.storageRequest(ctx, http.MethodPut, objectURL, query, header, body, size)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	// Storage echoes the checksum it computed; S3 already refuses a
+	// mismatch with BadDigest, this catches stores that only echo it
+	if echoed := resp.Header.Get("X-Amz-Checksum-Sha256"); echoed != "" && echoed != checksum {
+		return "", &TransferError{Kind: kindNetwork, Err: fmt.Errorf("part %d stored with checksum %s, sent %s", number, echoed, checksum)}
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", &TransferError{Kind: kindServer, Err: fmt.Errorf("part %d returned no ETag", number)}
+	}
+	return etag, nil
+}
+
+// listParts returns the parts storage holds for uploadID
+func (s *sigV4Signer) listParts(ctx context.Context, objectURL, uploadID string) ([]multipartPart, error) {
+	var parts []multipartPart
+	marker := 0
+	for {
+		query := map[string]string{"uploadId": uploadID}
+		if marker > 0 {
+			query["part-number-marker"] = strconv.Itoa(marker)
+		}
+		var page struct {
+			IsTruncated          bool
+			NextPartNumberMarker int
+			Part                 []struct {
+				PartNumber     int
+				ETag           string
+				ChecksumSHA256 string
+				Size           int64
+			}
+		}
+		if err := s.storageCall(ctx, http.MethodGet, objectURL, query, nil, nil, 0, &page); err != nil {
+			return nil, err
+		}
+		for _, p := range page.Part {
+			parts = append(parts, multipartPart{Number: p.PartNumber, ETag: p.ETag, Checksum: p.ChecksumSHA256, Size: p.Size})
+		}
+		if !page.IsTruncated || page.NextPartNumberMarker <= marker {
+			return parts, nil
+		}
+		marker = page.NextPartNumberMarker
+	}
+}
+
+// completeMultipartUpload assembles the object from parts
+func (s *sigV4Signer) completeMultipartUpload(ctx context.Context, objectURL, uploadID string, parts []multipartPart) error {
+	type completedPart struct {
+		PartNumber     int
+		ETag           string
+		ChecksumSHA256 string
+	}
+	body := struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{}
+	for _, p := range parts {
+		body.Parts = append(body.Parts, completedPart{PartNumber: p.Number, ETag: p.ETag, ChecksumSHA256: p.Checksum})
+	}
+	sort.Slice(body.Parts, func(i, j int) bool { return body.Parts[i].PartNumber < body.Parts[j].PartNumber })
+	payload, err := xml.Marshal(body)
+	if err != nil {
+		return &TransferError{Kind: kindLocal, Err: err}
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	return s.storageCall(ctx, http.MethodPost, objectURL, map[string]string{"uploadId": uploadID}, header, bytes.NewReader(payload), int64(len(payload)), nil)
+}
+
+// storageCall sends a signed request and decodes its XML response into out.
+// S3 can report a failed CompleteMultipartUpload as an <Error> document in
+// a 200 response, so one is returned as a retryable error.
+func (s *sigV4Signer) storageCall(ctx context.Context, method, objectURL string, query map[string]string, header http.Header, body io.Reader, size int64, out any) error {
+	resp, err := s.storageRequest(ctx, method, objectURL, query, header, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return networkError(method+" response failed", err)
+	}
+
+	var storageErr struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(data, &storageErr) == nil {
+		return &TransferError{Kind: kindServer, StatusCode: resp.StatusCode, Err: fmt.Errorf("%s returned %s: %s", method, storageErr.Code, storageErr.Message)}
+	}
+	if out != nil {
+		if err := xml.Unmarshal(data, out); err != nil {
+			return &TransferError{Kind: kindServer, StatusCode: resp.StatusCode, Err: fmt.Errorf("%s returned an unreadable response: %w", method, err)}
+		}
+	}
+	return nil
+}
+
+// storageRequest sends a signed request for objectURL and returns the
+// response of a successful one
+func (s *sigV4Signer) storageRequest(ctx context.Context, method, objectURL string, query map[string]string, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	u, err := s.objectURL(objectURL)
+	if err != nil {
+		return nil, &TransferError{Kind: kindLocal, Err: err}
+	}
+	u.RawQuery = canonicalQueryString(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, &TransferError{Kind: kindLocal, Err: fmt.Errorf("create request failed: %w", err)}
+	}
+	req.ContentLength = size
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.signRequest(req, "UNSIGNED-PAYLOAD", time.Now())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, networkError(method+" failed", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		te := statusError(method, resp.StatusCode, data)
+		// A part corrupted in transit fails its checksum; sending it again helps
+		if bytes.Contains(data, []byte("<Code>BadDigest</Code>")) {
+			te.Kind = kindNetwork
+		}
+		return nil, te
+	}
+	return resp, nil
+}
+
+// signRequest adds a SigV4 Authorization header covering host and every
+// header already set on req, for a body whose SHA-256 is payloadHash
+// (or UNSIGNED-PAYLOAD)
+func (s *sigV4Signer) signRequest(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQueryString(firstValues(req.URL.Query())),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.credentialScope(date), signedHeaders, s.signature(date, amzDate, canonicalRequest)))
+}
+
+// firstValues flattens a query for canonicalQueryString
+func firstValues(values url.Values) map[string]string {
+	params := make(map[string]string, len(values))
+	for k, v := range values {
+		params[k] = v[0]
+	}
+	return params
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ---------- Output Naming ----------
+//
+// With output_naming "hash" the upload URL is derived from the encoded bytes:
+// {sha256} in OutputURLTemplate becomes the hex digest of each output file,
+// so identical episodes land on the same immutable object in
+// content-addressed storage and nothing is ever overwritten with different
+// content.
+
+const (
+	outputNamingURL  = "url" // Default: upload to the URL given in the request
+	outputNamingHash = "hash"
+)
+
+// hashPlaceholder is replaced by the output's SHA-256 in OutputURLTemplate
+const hashPlaceholder = "{sha256}"
+
+// validateOutputNaming fills the default naming mode and checks that hash
+// naming has a template to resolve
+func validateOutputNaming(req *ConcatRequest) error {
+	switch req.OutputNaming {
+	case "":
+		req.OutputNaming = outputNamingURL
+	case outputNamingURL:
+	case outputNamingHash:
+		if !strings.Contains(req.OutputURLTemplate, hashPlaceholder) {
+			return fmt.Errorf("output_url_template must contain %s with output_naming %q", hashPlaceholder, outputNamingHash)
+		}
+		if req.OutputURL != "" || len(req.OutputURLs) > 0 {
+			return fmt.Errorf("output_naming %q uses output_url_template instead of output_url", outputNamingHash)
+		}
+	default:
+		return errors.New(`output_naming must be "url" or "hash"`)
+	}
+	return nil
+}
+
+// hashedURL resolves template for a file with the given hex digest
+func hashedURL(template, digest string) string {
+	return strings.ReplaceAll(template, hashPlaceholder, digest)
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateOutputNaming(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ConcatRequest
+		wantErr bool
+	}{
+		{"default", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b"}, false},
+		{"hash", ConcatRequest{Segments: segmentURLs("a"), OutputNaming: "hash", OutputURLTemplate: "https://r2/{sha256}.mp3"}, false},
+		{"hash split", ConcatRequest{Segments: segmentURLs("a"), OutputNaming: "hash", SplitDurationSeconds: 600, OutputURLTemplate: "https://r2/{sha256}.mp3"}, false},
+		{"hash without placeholder", ConcatRequest{Segments: segmentURLs("a"), OutputNaming: "hash", OutputURLTemplate: "https://r2/out.mp3"}, true},
+		{"hash with output_url", ConcatRequest{Segments: segmentURLs("a"), OutputNaming: "hash", OutputURL: "b", OutputURLTemplate: "https://r2/{sha256}.mp3"}, true},
+		{"unknown", ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", OutputNaming: "uuid"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			if err := validateRequest(&req); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashedURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(path, []byte("abc"), 0644)
+
+	digest, err := fileSHA256(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if digest != want {
+		t.Errorf("digest = %s, want %s", digest, want)
+	}
+	if got := hashedURL("https://r2/episodes/{sha256}.mp3?sig=x", digest); got != "https://r2/episodes/"+want+".mp3?sig=x" {
+		t.Errorf("hashedURL = %s", got)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ---------- Non-Audio Responses ----------
+//
+// An expired CDN link often 302s to a login or error page that answers 200,
+// so the download "succeeds" with HTML and the encode either fails with an
+// opaque demuxer error or, with the concat filter, turns the page into noise.
+// Segment downloads therefore check both the final response's Content-Type
+// and the first bytes of the body, since such pages are sometimes served as
+// application/octet-stream. Only markup is rejected: some origins serve real
+// audio as text/plain or without a type at all.
+
+var (
+	// errNonAudioContent is a 200 whose body is a web page, not audio
+	errNonAudioContent = errors.New("non-audio content")
+
+	// errRedirectedNonAudio is errNonAudioContent reached through a redirect,
+	// almost always an auth wall in front of an expired link
+	errRedirectedNonAudio = fmt.Errorf("redirected to %w", errNonAudioContent)
+)
+
+// sniffLen is how much of the body http.DetectContentType looks at
+const sniffLen = 512
+
+// markupType reports whether a media type is a web page rather than audio
+func markupType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/xml":
+		return true
+	}
+	return false
+}
+
+// checkAudioResponse rejects a response whose header or sniffed body is
+// markup. body must wrap resp.Body; peeking leaves the bytes for the copy.
+func checkAudioResponse(requestURL string, resp *http.Response, body *bufio.Reader) error {
+	contentType := resp.Header.Get("Content-Type")
+	if !markupType(contentType) {
+		// Peek errors (short body, reset) surface again during the copy
+		head, _ := body.Peek(sniffLen)
+		if sniffed := http.DetectContentType(head); markupType(sniffed) {
+			contentType = sniffed
+		} else {
+			return nil
+		}
+	}
+
+	if final := resp.Request.URL.String(); final != requestURL {
+		return fmt.Errorf("%w: %s from %s", errRedirectedNonAudio, strings.TrimSpace(contentType), redactURL(final))
+	}
+	return fmt.Errorf("%w: %s", errNonAudioContent, strings.TrimSpace(contentType))
+}
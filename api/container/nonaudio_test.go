@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loginPage is what an expired CDN link typically lands on
+const loginPage = "<!DOCTYPE html><html><head><title>Sign in</title></head><body><form></form></body></html>"
+
+func TestMarkupType(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/html; charset=utf-8":  true,
+		"application/xhtml+xml":     true,
+		"text/xml; charset=utf-8":   true,
+		"audio/mpeg":                false,
+		"application/octet-stream":  false,
+		"text/plain; charset=utf-8": false,
+		"":                          false,
+	} {
+		if got := markupType(contentType); got != want {
+			t.Errorf("markupType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestDownloadRejectsRedirectToLoginPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/segment.mp3" {
+			http.Redirect(w, r, "/login?next=segment", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(loginPage))
+	}))
+	defer server.Close()
+
+	_, err := downloadFile(context.Background(), server.URL+"/segment.mp3", filepath.Join(t.TempDir(), "s.mp3"))
+	if !errors.Is(err, errRedirectedNonAudio) {
+		t.Fatalf("err = %v, want %v", err, errRedirectedNonAudio)
+	}
+	if !strings.Contains(err.Error(), server.URL+"/login") || strings.Contains(err.Error(), "next=") {
+		t.Errorf("error should name the redacted landing URL: %v", err)
+	}
+	if isRetryable(err) {
+		t.Error("an auth wall won't go away on retry")
+	}
+}
+
+func TestDownloadSniffsMislabeledHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(loginPage))
+	}))
+	defer server.Close()
+
+	_, err := downloadFile(context.Background(), server.URL, filepath.Join(t.TempDir(), "s.mp3"))
+	if !errors.Is(err, errNonAudioContent) || errors.Is(err, errRedirectedNonAudio) {
+		t.Errorf("err = %v, want %v without a redirect", err, errNonAudioContent)
+	}
+}
+
+func TestDownloadAcceptsAudio(t *testing.T) {
+	audio := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 200)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			// Some origins label everything text/plain
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		w.Write(audio)
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/typed", "/plain"} {
+		dest := filepath.Join(t.TempDir(), "s.mp3")
+		if n, err := downloadFile(context.Background(), server.URL+path, dest); err != nil || n != int64(len(audio)) {
+			t.Errorf("%s: n = %d, err = %v", path, n, err)
+		}
+	}
+}
+
+func TestHandleConcatReportsAuthWall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/b.mp3" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/login" {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(loginPage))
+			return
+		}
+		w.Write([]byte("ID3 audio"))
+	}))
+	defer server.Close()
+
+	body, _ := json.Marshal(ConcatRequest{
+		EpisodeID: "ep-auth-wall",
+		Segments:  segmentURLs(server.URL+"/a.mp3", server.URL+"/b.mp3"),
+		OutputURL: server.URL + "/out.mp3",
+	})
+	rec := httptest.NewRecorder()
+	handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", bytes.NewReader(body)))
+
+	var resp ConcatResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.ErrorCode != codeSegmentDownloadFailed || resp.Retryable {
+		t.Errorf("error_code = %q, retryable = %v", resp.ErrorCode, resp.Retryable)
+	}
+	if !strings.Contains(resp.Error, "segment 1: redirected to non-audio content") {
+		t.Errorf("error = %q", resp.Error)
+	}
+}
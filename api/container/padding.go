@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// ---------- Minimum Duration Padding ----------
+//
+// Ad-insertion slots often require a minimum length. With
+// min_duration_seconds the downloaded inputs are probed, and when the
+// content would come out shorter, a block of anullsrc silence is rendered
+// and joined after the last segment like any other input. Longer content is
+// never truncated. The padding goes through the same filter chain as the
+// content; it is silence, so loudnorm and the gate leave it silent.
+
+// maxMinDurationSeconds bounds how much silence a request can ask for
+const maxMinDurationSeconds = 4 * 3600
+
+// validateMinDuration checks min_duration_seconds; 0 = no padding
+func validateMinDuration(req *ConcatRequest) error {
+	if req.MinDurationSeconds < 0 || req.MinDurationSeconds > maxMinDurationSeconds {
+		return fmt.Errorf("min_duration_seconds must be between 0 and %d", maxMinDurationSeconds)
+	}
+	return nil
+}
+
+// paddingSeconds returns how much silence, in input time, brings trimmed
+// inputs of the given durations up to minSeconds of output. atempo shortens
+// the padding too, so it is scaled by speed.
+func paddingSeconds(durations []float64, speed, minSeconds float64) float64 {
+	if speed <= 0 {
+		speed = 1
+	}
+	var content float64
+	for _, d := range durations {
+		content += d
+	}
+	if content/speed >= minSeconds {
+		return 0
+	}
+	return minSeconds*speed - content
+}
+
+// paddingArgs returns the FFmpeg arguments that render seconds of silence
+// to destPath in the intermediate format. Matching the last input's channel
+// count keeps a demuxer join possible for MP3.
+func paddingArgs(seconds float64, channels, format, destPath string) []string {
+	layout := "stereo"
+	if channels == "1" {
+		layout = "mono"
+	}
+	args := []string{
+		"-f", "lavfi",
+		"-i", "anullsrc=r=44100:cl=" + layout,
+		"-t", formatFloat(seconds),
+	}
+	args = append(args, intermediateCodecArgs(format)...)
+	return append(args, "-y", destPath)
+}
+
+// padToMinDuration renders the silence inputs need to reach minSeconds into
+// destPath and returns its length in output seconds, or 0 when the inputs
+// are already long enough
+func padToMinDuration(ctx context.Context, inputs []concatInput, speed, minSeconds float64, format, destPath string) (float64, error) {
+	durations, err := probeDurations(inputs)
+	if err != nil {
+		return 0, err
+	}
+	pad := paddingSeconds(durations, speed, minSeconds)
+	if pad <= 0 {
+		return 0, nil
+	}
+
+	last, err := probeAudioStream(ctx, inputs[len(inputs)-1].Path)
+	if err != nil {
+		return 0, err
+	}
+	cmd := ffmpegCommand(ctx, paddingArgs(pad, last.Channels, format, destPath)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("%w: %s", err, out)
+	}
+	if speed > 0 {
+		pad /= speed
+	}
+	return pad, nil
+}
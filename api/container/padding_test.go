@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMinDuration(t *testing.T) {
+	for value, ok := range map[float64]bool{0: true, 30: true, maxMinDurationSeconds: true, -1: false, maxMinDurationSeconds + 1: false} {
+		req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", MinDurationSeconds: value}
+		if err := validateRequest(req); (err == nil) != ok {
+			t.Errorf("min_duration_seconds %g: err = %v", value, err)
+		}
+	}
+}
+
+func TestPaddingSeconds(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		durations []float64
+		speed     float64
+		min       float64
+		want      float64
+	}{
+		{"short", []float64{10, 5}, 0, 30, 15},
+		{"exact", []float64{20, 10}, 1, 30, 0},
+		{"longer is not truncated", []float64{40}, 1, 30, 0},
+		// 24s at 1.5x plays for 16s; 21s of input padding plays for 14s
+		{"sped up", []float64{24}, 1.5, 30, 21},
+	} {
+		if got := paddingSeconds(tt.durations, tt.speed, tt.min); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: paddingSeconds = %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPaddingArgs(t *testing.T) {
+	got := paddingArgs(12.5, "1", intermediateMP3, "/w/padding.mp3")
+	want := []string{"-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "12.5", "-c:a", "libmp3lame", "-b:a", "128k", "-y", "/w/padding.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paddingArgs = %v, want %v", got, want)
+	}
+	if got := paddingArgs(1, "2", intermediateMP3, "p.mp3")[3]; got != "anullsrc=r=44100:cl=stereo" {
+		t.Errorf("stereo source = %q", got)
+	}
+}
+
+// TestPadToMinDuration renders padding for a short input; it is skipped
+// without FFmpeg
+func TestPadToMinDuration(t *testing.T) {
+	requireFFmpegTools(t)
+	dir := t.TempDir()
+	segment := filepath.Join(dir, "segment.mp3")
+	if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=duration=2",
+		"-c:a", "libmp3lame", "-ar", "44100", "-y", segment).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+	inputs := []concatInput{{Path: segment}}
+
+	padPath := filepath.Join(dir, "padding.mp3")
+	padded, err := padToMinDuration(context.Background(), inputs, 1, 5, intermediateMP3, padPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(padded-3) > 0.1 {
+		t.Errorf("padded = %g, want about 3", padded)
+	}
+	if d, err := getDuration(padPath); err != nil || math.Abs(d-3) > 0.1 {
+		t.Errorf("padding file lasts %g (%v), want about 3", d, err)
+	}
+
+	if padded, err := padToMinDuration(context.Background(), inputs, 1, 1, intermediateMP3, filepath.Join(dir, "none.mp3")); err != nil || padded != 0 {
+		t.Errorf("longer input: padded = %g, err = %v", padded, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ---------- Plan ----------
+//
+// POST /plan takes a /concat body and returns the FFmpeg command line and
+// concat list the job would run, built by the same buildFFmpegArgs, without
+// downloading a segment or starting FFmpeg. Only a manifest_url is fetched,
+// since the segment list comes from it.
+//
+// The plan is what the job runs when its inputs hold no surprises. Choices
+// made from the downloaded files (auto switching to the concat filter,
+// encode_mode auto copying, auto_mono's downmix, min_duration_seconds
+// padding, skipped segments) are listed as notes instead of being guessed.
+// Paths are shown under planWorkDir without the job's random file prefix.
+
+// planWorkDir stands in for the job's MkdirTemp work dir
+const planWorkDir = "/tmp/concat-plan"
+
+// PlanResponse is the response body for /plan
+type PlanResponse struct {
+	SchemaVersion int      `json:"schema_version"`
+	ConcatMethod  string   `json:"concat_method"`         // demuxer, filter or single
+	Command       []string `json:"command"`               // argv, including any FFMPEG_NICE/FFMPEG_IONICE_CLASS wrapper
+	ConcatList    string   `json:"concat_list,omitempty"` // list.txt, for the demuxer
+	WorkDir       string   `json:"work_dir"`              // Placeholder for the job's work dir
+	Notes         []string `json:"notes,omitempty"`       // Decisions made only once the inputs are on disk
+}
+
+// planInputs returns the inputs a job would join, in the order the handler
+// assembles them: preamble, earlier output, then the segments
+func planInputs(req ConcatRequest, files jobFiles) []concatInput {
+	inputs := make([]concatInput, 0, len(req.Segments)+2)
+	if hasPreamble(req) {
+		inputs = append(inputs, concatInput{Path: files.path(intermediateName("preamble", req.IntermediateFormat))})
+	}
+	if req.AppendToURL != "" {
+		inputs = append(inputs, concatInput{Path: files.path("existing.mp3")})
+	}
+	for i, seg := range req.Segments {
+		inputs = append(inputs, concatInput{Path: files.segment(i), Start: seg.Start, End: seg.End, GainDB: seg.GainDB})
+	}
+	return inputs
+}
+
+// planNotes lists what the job decides only after download
+func planNotes(req ConcatRequest, paths ffmpegPaths) []string {
+	var notes []string
+	if paths.method == concatDemuxer {
+		if req.ConcatMethod == concatAuto {
+			notes = append(notes, "concat_method auto switches to the concat filter if ffprobe finds inputs with different codecs, sample rates or channel counts")
+		} else {
+			notes = append(notes, "concat_method demuxer fails with 422 if ffprobe finds inputs with different codecs, sample rates or channel counts")
+		}
+	}
+	if req.EncodeMode == encodeAuto {
+		notes = append(notes, "encode_mode auto copies with -c:a copy and no filters instead if every input probes as compatible MP3")
+	}
+	if req.AutoMono {
+		notes = append(notes, "auto_mono adds a mono downmix to the filter chain if one channel measures as silent")
+	}
+	if req.AutoBitrate && req.BitrateKbps == 0 {
+		notes = append(notes, "auto_bitrate replaces the default -b:a with a bitrate from the AUTO_BITRATE_* ladder once the inputs are measured")
+	}
+	if req.MinDurationSeconds > 0 {
+		notes = append(notes, "a silence input is appended if the inputs are shorter than min_duration_seconds")
+	}
+	if req.SkipCorruptSegments {
+		notes = append(notes, "segments that fail to download or probe as audio are dropped from the inputs")
+	}
+	if paths.safe {
+		notes = append(notes, "FFmpeg runs with the work dir as its current directory (CONCAT_SAFE_MODE)")
+	}
+	return notes
+}
+
+// planRequest builds the plan for a validated request
+func planRequest(req ConcatRequest) (PlanResponse, error) {
+	files := jobFiles{dir: planWorkDir}
+	inputs := planInputs(req, files)
+	paths := ffmpegPaths{
+		files:  files,
+		inputs: inputs,
+		method: singleInputMethod(req, resolveConcatMethod(req), inputs),
+		safe:   config.ConcatSafeMode,
+	}
+	args, err := buildFFmpegArgs(req, paths)
+	if err != nil {
+		return PlanResponse{}, err
+	}
+	resp := PlanResponse{
+		SchemaVersion: schemaVersion,
+		ConcatMethod:  paths.method,
+		Command:       ffmpegCommand(context.Background(), args...).Args,
+		WorkDir:       planWorkDir,
+		Notes:         planNotes(req, paths),
+	}
+	if paths.method == concatDemuxer {
+		_, listInputs := paths.listInputs()
+		resp.ConcatList = concatList(listInputs)
+	}
+	return resp, nil
+}
+
+// handlePlan serves POST /plan
+func handlePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, codeMethodNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readAuthorizedBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req ConcatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, codeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validateRequest(&req); err != nil {
+		sendError(w, codeInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ManifestURL != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), preflightTimeout)
+		defer cancel()
+		segments, err := fetchManifest(ctx, req.ManifestURL)
+		if err != nil {
+			sendError(w, codeInvalidRequest, fmt.Sprintf("Invalid manifest: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Segments = segmentURLs(segments...)
+	}
+
+	resp, err := planRequest(req)
+	if err != nil {
+		sendError(w, codeInternal, fmt.Sprintf("Failed to build FFmpeg arguments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandlePlan(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	plan := func(body string) PlanResponse {
+		rec := httptest.NewRecorder()
+		handlePlan(rec, httptest.NewRequest(http.MethodPost, "/plan", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+		}
+		var resp PlanResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	resp := plan(fmt.Sprintf(`{"segments": ["%[1]s/a.mp3", {"url": "%[1]s/b.mp3", "start": 1.5}], "output_url": "https://out", "metadata": {"title": "Ep 1"}}`, server.URL))
+	if resp.ConcatMethod != concatDemuxer || resp.Command[0] != "ffmpeg" {
+		t.Errorf("plan = %+v", resp)
+	}
+	wantList := "file '" + planWorkDir + "/segment_0000.mp3'\nfile '" + planWorkDir + "/segment_0001.mp3'\ninpoint 1.5\n"
+	if resp.ConcatList != wantList {
+		t.Errorf("concat_list = %q, want %q", resp.ConcatList, wantList)
+	}
+	if !slices.Contains(resp.Command, "title=Ep 1") || resp.Command[len(resp.Command)-1] != planWorkDir+"/output.mp3.part" {
+		t.Errorf("command = %v", resp.Command)
+	}
+	if len(resp.Notes) != 1 || !strings.Contains(resp.Notes[0], "auto switches") {
+		t.Errorf("notes = %v", resp.Notes)
+	}
+
+	// A preamble is decoded through the concat filter, with no list
+	resp = plan(fmt.Sprintf(`{"segments": ["%[1]s/a.mp3"], "output_url": "https://out", "preamble_silence_seconds": 2, "encode_mode": "auto"}`, server.URL))
+	if resp.ConcatMethod != concatFilter || resp.ConcatList != "" || !slices.Contains(resp.Command, "-filter_complex") {
+		t.Errorf("preamble plan = %+v", resp)
+	}
+	if !slices.Contains(resp.Command, planWorkDir+"/preamble.mp3") {
+		t.Errorf("command = %v, want the preamble as an input", resp.Command)
+	}
+	if len(resp.Notes) != 1 || !strings.Contains(resp.Notes[0], "encode_mode auto") {
+		t.Errorf("notes = %v", resp.Notes)
+	}
+
+	if n := requests.Load(); n != 0 {
+		t.Errorf("plan made %d requests, want none", n)
+	}
+}
+
+func TestHandlePlanValidates(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handlePlan(rec, httptest.NewRequest(http.MethodPost, "/plan", strings.NewReader(`{"output_url": "b"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("code = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = httptest.NewRecorder()
+	handlePlan(rec, httptest.NewRequest(http.MethodGet, "/plan", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET code = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ---------- Preamble ----------
+//
+// A preamble is a short generated lead-in (silence, or a marker tone) placed
+// before the first segment so every episode starts the same way without the
+// caller hosting an intro clip. It is rendered with lavfi into its own file
+// and joined like any other segment.
+
+// Accepted preamble ranges
+const (
+	maxPreambleSeconds = 30.0
+	minPreambleToneHz  = 20.0
+	maxPreambleToneHz  = 20000.0
+)
+
+// validatePreamble checks the preamble options; both default to off
+func validatePreamble(req *ConcatRequest) error {
+	if req.PreambleSilenceSeconds < 0 || req.PreambleSilenceSeconds > maxPreambleSeconds {
+		return fmt.Errorf("preamble_silence_seconds must be between 0 and %g", maxPreambleSeconds)
+	}
+	if req.PreambleToneHz != 0 {
+		if req.PreambleSilenceSeconds == 0 {
+			return errors.New("preamble_tone_hz requires preamble_silence_seconds")
+		}
+		if req.PreambleToneHz < minPreambleToneHz || req.PreambleToneHz > maxPreambleToneHz {
+			return fmt.Errorf("preamble_tone_hz must be between %g and %g", minPreambleToneHz, maxPreambleToneHz)
+		}
+	}
+	return nil
+}
+
+// hasPreamble reports whether req asks for a generated lead-in
+func hasPreamble(req ConcatRequest) bool {
+	return req.PreambleSilenceSeconds > 0
+}
+
+// preambleArgs returns the FFmpeg arguments that render the preamble to
+// destPath in the intermediate format: a sine tone when PreambleToneHz is
+// set, otherwise silence
+func preambleArgs(req ConcatRequest, destPath string) []string {
+	duration := formatFloat(req.PreambleSilenceSeconds)
+	source := "anullsrc=r=44100:cl=mono"
+	if req.PreambleToneHz > 0 {
+		source = fmt.Sprintf("sine=frequency=%s:sample_rate=44100", formatFloat(req.PreambleToneHz))
+	}
+	args := []string{
+		"-f", "lavfi",
+		"-i", source,
+		"-t", duration,
+	}
+	args = append(args, intermediateCodecArgs(req.IntermediateFormat)...)
+	return append(args, "-y", destPath)
+}
+
+// generatePreamble renders the preamble for req into destPath
+func generatePreamble(ctx context.Context, req ConcatRequest, destPath string) error {
+	cmd := ffmpegCommand(ctx, preambleArgs(req, destPath)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidatePreamble(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds float64
+		toneHz  float64
+		wantErr bool
+	}{
+		{"off", 0, 0, false},
+		{"silence", 2.5, 0, false},
+		{"tone", 1, 440, false},
+		{"negative", -1, 0, true},
+		{"too long", 31, 0, true},
+		{"tone without duration", 0, 440, true},
+		{"tone too low", 1, 5, true},
+		{"tone too high", 1, 30000, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &ConcatRequest{PreambleSilenceSeconds: tt.seconds, PreambleToneHz: tt.toneHz}
+			if err := validatePreamble(req); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPreambleArgs(t *testing.T) {
+	got := preambleArgs(ConcatRequest{PreambleSilenceSeconds: 1.5}, "/w/preamble.mp3")
+	want := []string{"-f", "lavfi", "-i", "anullsrc=r=44100:cl=mono", "-t", "1.5", "-c:a", "libmp3lame", "-b:a", "128k", "-y", "/w/preamble.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("silence args = %v, want %v", got, want)
+	}
+
+	got = preambleArgs(ConcatRequest{PreambleSilenceSeconds: 2, PreambleToneHz: 440}, "/w/preamble.mp3")
+	if got[3] != "sine=frequency=440:sample_rate=44100" || got[5] != "2" {
+		t.Errorf("tone args = %v", got)
+	}
+}
+
+func TestPreambleSelectsConcatFilter(t *testing.T) {
+	req := ConcatRequest{ConcatMethod: concatAuto, PreambleSilenceSeconds: 1}
+	if got := resolveConcatMethod(req); got != concatFilter {
+		t.Errorf("auto with preamble = %q, want %q", got, concatFilter)
+	}
+
+	req.ConcatMethod = concatDemuxer
+	if got := resolveConcatMethod(req); got != concatDemuxer {
+		t.Errorf("explicit demuxer = %q, want %q", got, concatDemuxer)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ---------- Segment Prefetch ----------
+//
+// The download loop handles segments strictly in order: it checks each one
+// (trim bounds, skip_corrupt_segments probing), records it, and moves on.
+// With DOWNLOAD_PREFETCH_DEPTH set, up to that many later segments are
+// already downloading while the loop works on the current one, so a slow
+// origin round trip or a probe no longer stalls the next transfer. Results
+// are still consumed in order, and errors surface when the loop reaches
+// the failed segment, exactly as without prefetch. Depth 0 is the old
+// one-at-a-time behavior.
+//
+// The encode still starts only after every segment is on disk: FFmpeg reads
+// finished files (the demuxer list, -ss trims, the probes before it), so
+// there is no streaming input for downloads to overlap with.
+
+// prefetchResult is the outcome of one segment download
+type prefetchResult struct {
+	written int64
+	err     error
+}
+
+// segmentPrefetch downloads segments ahead of the loop consuming them
+type segmentPrefetch struct {
+	cancel  context.CancelFunc
+	slots   chan struct{} // One per segment in flight or waiting to be consumed
+	results []chan prefetchResult
+	wg      sync.WaitGroup
+}
+
+// startPrefetch runs fetch for segments 0..n-1 in order, keeping at most
+// depth+1 of them in flight or unconsumed
+func startPrefetch(ctx context.Context, n, depth int, fetch func(ctx context.Context, i int) (int64, error)) *segmentPrefetch {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &segmentPrefetch{
+		cancel:  cancel,
+		slots:   make(chan struct{}, max(depth, 0)+1),
+		results: make([]chan prefetchResult, n),
+	}
+	for i := range p.results {
+		p.results[i] = make(chan prefetchResult, 1)
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for i := 0; i < n; i++ {
+			select {
+			case p.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			p.wg.Add(1)
+			go func(i int) {
+				defer p.wg.Done()
+				written, err := fetch(ctx, i)
+				p.results[i] <- prefetchResult{written, err}
+			}(i)
+		}
+	}()
+	return p
+}
+
+// next waits for segment i, which must be consumed in order, and frees its
+// slot for the next prefetch
+func (p *segmentPrefetch) next(ctx context.Context, i int) (int64, error) {
+	select {
+	case r := <-p.results[i]:
+		<-p.slots
+		return r.written, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// stop cancels downloads that haven't started and waits for running ones,
+// so nothing writes into the work dir after the job removes it
+func (p *segmentPrefetch) stop() {
+	p.cancel()
+	p.wg.Wait()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrefetchDepth(t *testing.T) {
+	for _, depth := range []int{0, 2} {
+		var inFlight, peak atomic.Int32
+		release := make(chan struct{})
+		p := startPrefetch(context.Background(), 6, depth, func(ctx context.Context, i int) (int64, error) {
+			n := inFlight.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			<-release
+			inFlight.Add(-1)
+			return int64(i * 10), nil
+		})
+
+		// Nothing is consumed yet, so only depth+1 downloads may start
+		waitFor(t, "prefetch to fill", func() bool { return inFlight.Load() == int32(depth+1) })
+		time.Sleep(20 * time.Millisecond)
+		if got := peak.Load(); got != int32(depth+1) {
+			t.Errorf("depth %d: %d downloads started before any was consumed", depth, got)
+		}
+
+		close(release)
+		for i := 0; i < 6; i++ {
+			written, err := p.next(context.Background(), i)
+			if err != nil || written != int64(i*10) {
+				t.Errorf("depth %d: next(%d) = %d, %v", depth, i, written, err)
+			}
+		}
+		p.stop()
+	}
+}
+
+func TestPrefetchErrorsInOrder(t *testing.T) {
+	errBroken := errors.New("broken segment")
+	p := startPrefetch(context.Background(), 3, 2, func(ctx context.Context, i int) (int64, error) {
+		if i == 2 {
+			return 0, errBroken
+		}
+		// Earlier segments finish last; results still come back in order
+		time.Sleep(time.Duration(2-i) * 10 * time.Millisecond)
+		return 1, nil
+	})
+	defer p.stop()
+	for i := 0; i < 2; i++ {
+		if _, err := p.next(context.Background(), i); err != nil {
+			t.Fatalf("next(%d): %v", i, err)
+		}
+	}
+	if _, err := p.next(context.Background(), 2); !errors.Is(err, errBroken) {
+		t.Errorf("next(2) = %v, want errBroken", err)
+	}
+}
+
+func TestPrefetchStop(t *testing.T) {
+	var started atomic.Int32
+	p := startPrefetch(context.Background(), 10, 1, func(ctx context.Context, i int) (int64, error) {
+		started.Add(1)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	waitFor(t, "downloads to start", func() bool { return started.Load() == 2 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.next(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("next with a cancelled context = %v", err)
+	}
+	// stop cancels the running downloads and returns once they have
+	p.stop()
+	if n := started.Load(); n != 2 {
+		t.Errorf("%d downloads started, want 2", n)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Preflight Estimates ----------
+//
+// POST /preflight takes a /concat body and, without downloading anything,
+// estimates how long the job would take here: segment sizes come from HEAD
+// requests, and the rate from recent successful jobs on this container
+// (bytes downloaded per second of total job time). It is a scheduling hint,
+// not a promise; origin speed, codecs, and options like HLS or waveforms
+// all shift the real number.
+
+const (
+	throughputWindow     = 20      // Recent jobs averaged
+	defaultThroughputBps = 1 << 20 // Assumed before any job has finished
+	preflightHeadWorkers = 8
+	preflightTimeout     = 30 * time.Second
+)
+
+const preflightDisclaimer = "Best-effort estimate from segment sizes and this container's recent throughput; actual time varies with origin speed, codecs, and options."
+
+// PreflightResponse is the response body for /preflight
+type PreflightResponse struct {
+	SchemaVersion    int     `json:"schema_version"`
+	Segments         int     `json:"segments"`
+	InputBytes       int64   `json:"input_bytes"`   // Sum of the sizes that were known
+	UnknownSizes     int     `json:"unknown_sizes"` // Segments whose HEAD gave no Content-Length
+	EstimatedSeconds float64 `json:"estimated_seconds"`
+	Basis            string  `json:"basis"` // "recent_jobs" or "default"
+	JobsSampled      int     `json:"jobs_sampled"`
+	Disclaimer       string  `json:"disclaimer"`
+}
+
+// throughputSample is one finished job's input size and wall time
+type throughputSample struct {
+	bytes   int64
+	elapsed time.Duration
+}
+
+var (
+	throughputMu      sync.Mutex
+	throughputSamples []throughputSample
+)
+
+// recordThroughput adds a finished job to the rolling window
+func recordThroughput(summary JobSummary) {
+	elapsed := time.Since(summary.StartedAt)
+	if !summary.Success || summary.BytesDownloaded <= 0 || elapsed <= 0 {
+		return
+	}
+	throughputMu.Lock()
+	defer throughputMu.Unlock()
+	throughputSamples = append(throughputSamples, throughputSample{summary.BytesDownloaded, elapsed})
+	if len(throughputSamples) > throughputWindow {
+		throughputSamples = throughputSamples[len(throughputSamples)-throughputWindow:]
+	}
+}
+
+// recentThroughput returns the window's bytes per second and sample count
+func recentThroughput() (float64, int) {
+	throughputMu.Lock()
+	defer throughputMu.Unlock()
+	var bytes int64
+	var elapsed time.Duration
+	for _, s := range throughputSamples {
+		bytes += s.bytes
+		elapsed += s.elapsed
+	}
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	return float64(bytes) / elapsed.Seconds(), len(throughputSamples)
+}
+
+// estimateProcessing fills the estimate fields of resp from its sizes.
+// Segments of unknown size are assumed to average like the known ones.
+func estimateProcessing(resp *PreflightResponse) {
+	bytes := float64(resp.InputBytes)
+	if known := resp.Segments - resp.UnknownSizes; known > 0 && resp.UnknownSizes > 0 {
+		bytes *= float64(resp.Segments) / float64(known)
+	}
+
+	rate, n := recentThroughput()
+	resp.Basis, resp.JobsSampled = "recent_jobs", n
+	if n == 0 {
+		rate, resp.Basis = defaultThroughputBps, "default"
+	}
+	resp.EstimatedSeconds = bytes / rate
+	resp.Disclaimer = preflightDisclaimer
+}
+
+// segmentSize returns a segment's size without downloading it, or -1
+func segmentSize(ctx context.Context, url string) int64 {
+	if isDataURL(url) {
+		_, payload, ok := strings.Cut(url, ",")
+		if !ok {
+			return -1
+		}
+		return int64(base64.StdEncoding.DecodedLen(len(payload)))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return -1
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// segmentSizes sizes every segment with a few concurrent HEAD requests
+func segmentSizes(ctx context.Context, segments []Segment) []int64 {
+	sizes := make([]int64, len(segments))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(preflightHeadWorkers, len(segments)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				sizes[i] = segmentSize(ctx, segments[i].URL)
+			}
+		}()
+	}
+	for i := range segments {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return sizes
+}
+
+func handlePreflight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, codeMethodNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readAuthorizedBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req ConcatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, codeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validateRequest(&req); err != nil {
+		sendError(w, codeInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), preflightTimeout)
+	defer cancel()
+	if req.ManifestURL != "" {
+		segments, err := fetchManifest(ctx, req.ManifestURL)
+		if err != nil {
+			sendError(w, codeInvalidRequest, fmt.Sprintf("Invalid manifest: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Segments = segmentURLs(segments...)
+	}
+
+	resp := PreflightResponse{SchemaVersion: schemaVersion, Segments: len(req.Segments)}
+	for _, size := range segmentSizes(ctx, req.Segments) {
+		if size < 0 {
+			resp.UnknownSizes++
+			continue
+		}
+		resp.InputBytes += size
+	}
+	estimateProcessing(&resp)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
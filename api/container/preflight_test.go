@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlePreflight(t *testing.T) {
+	defer func() { throughputSamples = nil }()
+	throughputSamples = nil
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path == "/missing.mp3" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", "1048576")
+	}))
+	defer server.Close()
+
+	body := fmt.Sprintf(`{"segments": ["%[1]s/a.mp3", "%[1]s/b.mp3", "%[1]s/missing.mp3"], "output_url": "https://out"}`, server.URL)
+	preflight := func() PreflightResponse {
+		rec := httptest.NewRecorder()
+		handlePreflight(rec, httptest.NewRequest(http.MethodPost, "/preflight", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+		}
+		var resp PreflightResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	resp := preflight()
+	if resp.Segments != 3 || resp.InputBytes != 2<<20 || resp.UnknownSizes != 1 {
+		t.Errorf("sizes = %+v", resp)
+	}
+	// 2 MiB known over 2 of 3 segments extrapolates to 3 MiB at 1 MiB/s
+	if resp.Basis != "default" || resp.EstimatedSeconds != 3 || resp.Disclaimer == "" {
+		t.Errorf("default estimate = %+v", resp)
+	}
+
+	recordThroughput(JobSummary{Success: true, BytesDownloaded: 6 << 20, StartedAt: time.Now().Add(-2 * time.Second)})
+	recordThroughput(JobSummary{Success: false, BytesDownloaded: 1, StartedAt: time.Now().Add(-time.Hour)})
+	resp = preflight()
+	if resp.Basis != "recent_jobs" || resp.JobsSampled != 1 || resp.EstimatedSeconds < 0.9 || resp.EstimatedSeconds > 1.1 {
+		t.Errorf("recent estimate = %+v, want ~1s from 3 MiB/s", resp)
+	}
+}
+
+func TestHandlePreflightValidates(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handlePreflight(rec, httptest.NewRequest(http.MethodPost, "/preflight", strings.NewReader(`{"output_url": "b"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("code = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestThroughputWindow(t *testing.T) {
+	defer func() { throughputSamples = nil }()
+	throughputSamples = nil
+	for i := 0; i < throughputWindow+5; i++ {
+		recordThroughput(JobSummary{Success: true, BytesDownloaded: 100, StartedAt: time.Now().Add(-time.Second)})
+	}
+	if _, n := recentThroughput(); n != throughputWindow {
+		t.Errorf("samples = %d, want %d", n, throughputWindow)
+	}
+}
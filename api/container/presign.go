@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Presigned Download URLs ----------
+//
+// When the container holds storage credentials, generate_download_url adds a
+// short-lived GET URL for each uploaded object to the response, so callers
+// don't need their own signing step. Signing sits behind urlSigner; the
+// implementation here is AWS Signature Version 4 query signing, which both
+// S3 and R2 accept. Only objects on STORAGE_ENDPOINT's host are signed, so a
+// request can't mint read URLs for arbitrary locations.
+
+// urlSigner issues presigned GET URLs for stored objects
+type urlSigner interface {
+	presignGet(objectURL string, ttl time.Duration, now time.Time) (string, error)
+}
+
+// SigV4 presigned URLs must expire within a week; S3 and R2 reject an
+// X-Amz-Expires outside 1..604800
+const (
+	defaultDownloadURLTTL = time.Hour
+	maxDownloadURLTTL     = 7 * 24 * time.Hour
+)
+
+// downloadSigner is nil unless storage credentials are configured
+var downloadSigner urlSigner
+
+// newDownloadSigner builds the signer from config, or returns nil
+func newDownloadSigner() urlSigner {
+	if config.StorageEndpoint == "" || config.StorageAccessKeyID == "" || config.StorageSecretKey == "" {
+		return nil
+	}
+	endpoint, err := url.Parse(config.StorageEndpoint)
+	if err != nil || endpoint.Host == "" {
+		fmt.Printf("Warning: ignoring invalid STORAGE_ENDPOINT=%q\n", config.StorageEndpoint)
+		return nil
+	}
+	if config.DownloadURLTTL < time.Second || config.DownloadURLTTL > maxDownloadURLTTL {
+		fmt.Printf("Warning: DOWNLOAD_URL_TTL_SECONDS=%d is outside 1..%d, using %d\n",
+			int64(config.DownloadURLTTL.Seconds()), int64(maxDownloadURLTTL.Seconds()), int64(defaultDownloadURLTTL.Seconds()))
+		config.DownloadURLTTL = defaultDownloadURLTTL
+	}
+	return &sigV4Signer{
+		host:      endpoint.Host,
+		region:    config.StorageRegion,
+		accessKey: config.StorageAccessKeyID,
+		secretKey: config.StorageSecretKey,
+	}
+}
+
+// sigV4Signer presigns S3-compatible URLs with AWS Signature Version 4
+type sigV4Signer struct {
+	host      string // Only objects on this host are signed
+	region    string
+	accessKey string
+	secretKey string
+}
+
+// presignGet returns objectURL (its query, such as an upload signature,
+// stripped) with a GET signature valid for ttl
+func (s *sigV4Signer) presignGet(objectURL string, ttl time.Duration, now time.Time) (string, error) {
+	u, err := s.objectURL(objectURL)
+	if err != nil {
+		return "", err
+	}
+
+	now = now.UTC()
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.credentialScope(date)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    s.accessKey + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       strconv.Itoa(int(ttl.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		canonicalURI(u),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	signature := s.signature(date, amzDate, canonicalRequest)
+
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// objectURL parses objectURL without its query and fragment, and checks
+// it is on the storage endpoint
+func (s *sigV4Signer) objectURL(objectURL string) (*url.URL, error) {
+	u, err := url.Parse(objectURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != s.host {
+		return nil, fmt.Errorf("object host %q is not the storage endpoint", u.Host)
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u, nil
+}
+
+// credentialScope returns the scope signatures made on date are valid for
+func (s *sigV4Signer) credentialScope(date string) string {
+	return date + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature signs canonicalRequest with the key derived for date
+func (s *sigV4Signer) signature(date, amzDate, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		s.credentialScope(date),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalURI returns u's path as SigV4 encodes it
+func canonicalURI(u *url.URL) string {
+	if uri := sigV4Escape(u.EscapedPath(), false); uri != "" {
+		return uri
+	}
+	return "/"
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQueryString sorts and encodes params as SigV4 requires
+func canonicalQueryString(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = sigV4Escape(k, true) + "=" + sigV4Escape(params[k], true)
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything but RFC 3986 unreserved characters.
+// An already escaped path keeps its %XX sequences; '/' is kept unless
+// encodeSlash is set.
+func sigV4Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		case c == '%' && !encodeSlash && i+2 < len(s):
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+			i += 2
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// presignOutputs sets DownloadURL on each uploaded output. Signing failures
+// are returned as warnings; the upload itself already succeeded.
+func presignOutputs(outputs []OutputPart, now time.Time) []string {
+	var warnings []string
+	for i := range outputs {
+		signed, err := downloadSigner.presignGet(outputs[i].URL, config.DownloadURLTTL, now)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("download URL not generated: %v", err))
+			continue
+		}
+		outputs[i].DownloadURL = signed
+	}
+	return warnings
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+)
+
+// ---------- FFmpeg Priority ----------
+//
+// On a host shared with latency-sensitive work, encodes should yield CPU and
+// disk. FFMPEG_NICE and FFMPEG_IONICE_CLASS run every FFmpeg process through
+// nice and ionice. Both exec the next program in place, so FFmpeg keeps the
+// PID that CommandContext kills on cancellation and its exit status (and
+// signal, for OOM detection) reaches the job unchanged. ffprobe calls are
+// short and stay at normal priority.
+
+// I/O scheduling classes accepted by FFMPEG_IONICE_CLASS. Realtime is left
+// out on purpose: it would let an encode starve everything else.
+const (
+	ioClassBestEffort = "best-effort"
+	ioClassIdle       = "idle"
+)
+
+// ffmpegPrefix is prepended to every FFmpeg command line; nil runs FFmpeg
+// directly at normal priority
+var ffmpegPrefix []string
+
+// priorityPrefix builds the nice/ionice wrapper for the settings, or returns
+// an error for values the tools would reject
+func priorityPrefix(nice int, ioClass string, ioLevel int) ([]string, error) {
+	var prefix []string
+	if nice < -20 || nice > 19 {
+		return nil, fmt.Errorf("FFMPEG_NICE=%d is outside -20..19", nice)
+	}
+	if nice != 0 {
+		prefix = append(prefix, "nice", "-n", strconv.Itoa(nice))
+	}
+
+	switch ioClass {
+	case "":
+	case ioClassBestEffort:
+		if ioLevel < 0 || ioLevel > 7 {
+			return nil, fmt.Errorf("FFMPEG_IONICE_LEVEL=%d is outside 0..7", ioLevel)
+		}
+		prefix = append(prefix, "ionice", "-c", "2", "-n", strconv.Itoa(ioLevel))
+	case ioClassIdle:
+		prefix = append(prefix, "ionice", "-c", "3")
+	default:
+		return nil, fmt.Errorf("FFMPEG_IONICE_CLASS must be %q or %q, got %q", ioClassBestEffort, ioClassIdle, ioClass)
+	}
+	return prefix, nil
+}
+
+// setupFFmpegPriority resolves the wrapper at startup. A bad setting or a
+// missing tool is logged and FFmpeg runs at normal priority rather than
+// failing every job.
+func setupFFmpegPriority() {
+	prefix, err := priorityPrefix(config.FFmpegNice, config.FFmpegIOClass, config.FFmpegIOLevel)
+	if err != nil {
+		fmt.Printf("Warning: %v; running FFmpeg at normal priority\n", err)
+		return
+	}
+	for _, tool := range []string{"nice", "ionice"} {
+		if slices.Contains(prefix, tool) && !lookupBinary(tool) {
+			fmt.Printf("Warning: %s is required for the configured FFmpeg priority; running FFmpeg at normal priority\n", tool)
+			return
+		}
+	}
+	ffmpegPrefix = prefix
+	if len(prefix) > 0 {
+		fmt.Printf("FFmpeg runs as: %v ffmpeg ...\n", prefix)
+	}
+}
+
+// ffmpegCommand is exec.CommandContext for FFmpeg at the configured priority
+func ffmpegCommand(ctx context.Context, args ...string) *exec.Cmd {
+	if len(ffmpegPrefix) == 0 {
+		return exec.CommandContext(ctx, "ffmpeg", args...)
+	}
+	argv := make([]string, 0, len(ffmpegPrefix)+len(args))
+	argv = append(argv, ffmpegPrefix[1:]...)
+	argv = append(argv, "ffmpeg")
+	argv = append(argv, args...)
+	return exec.CommandContext(ctx, ffmpegPrefix[0], argv...)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPriorityPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		nice    int
+		class   string
+		level   int
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", want: nil},
+		{name: "nice", nice: 10, want: []string{"nice", "-n", "10"}},
+		{name: "best-effort", class: "best-effort", level: 7, want: []string{"ionice", "-c", "2", "-n", "7"}},
+		{name: "both", nice: 19, class: "idle", want: []string{"nice", "-n", "19", "ionice", "-c", "3"}},
+		{name: "nice too high", nice: 20, wantErr: true},
+		{name: "level out of range", class: "best-effort", level: 8, wantErr: true},
+		{name: "realtime refused", class: "realtime", wantErr: true},
+	} {
+		got, err := priorityPrefix(tt.nice, tt.class, tt.level)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: prefix = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFFmpegCommand(t *testing.T) {
+	defer func(p []string) { ffmpegPrefix = p }(ffmpegPrefix)
+
+	ffmpegPrefix = nil
+	if got := ffmpegCommand(context.Background(), "-i", "in.mp3").Args; !reflect.DeepEqual(got, []string{"ffmpeg", "-i", "in.mp3"}) {
+		t.Errorf("normal priority args = %v", got)
+	}
+
+	ffmpegPrefix = []string{"nice", "-n", "10", "ionice", "-c", "3"}
+	cmd := ffmpegCommand(context.Background(), "-i", "in.mp3")
+	want := []string{"nice", "-n", "10", "ionice", "-c", "3", "ffmpeg", "-i", "in.mp3"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("wrapped args = %v, want %v", cmd.Args, want)
+	}
+	// The prefix is shared across jobs and must not be written through
+	if !reflect.DeepEqual(ffmpegPrefix, want[:6]) {
+		t.Errorf("ffmpegPrefix modified: %v", ffmpegPrefix)
+	}
+}
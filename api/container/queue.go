@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ---------- Job Queue ----------
+//
+// With MAX_QUEUED_JOBS set, a /concat request that finds every slot taken
+// waits in a queue instead of getting 429 straight away. The queue is
+// ordered by priority, highest first, and FIFO within a priority, so an
+// urgent episode overtakes bulk backfill but never an equally urgent job
+// that arrived earlier. A freed slot is handed directly to the head of the
+// queue, so newcomers can't overtake waiting jobs of their own priority.
+// GET /jobs/{id} reports a queued job's position and priority; the request
+// itself just takes longer to answer. Only a full queue, or a wait longer
+// than maxQueueWait, still returns 429. Low-priority jobs can wait out
+// maxQueueWait under a steady stream of urgent ones; that 429 is the
+// backpressure signal for backfill.
+
+// maxQueueWait bounds how long a request waits for a slot
+const maxQueueWait = 10 * time.Minute
+
+// Accepted priority range; requests outside it are clamped. 0 is normal.
+const (
+	minJobPriority = -10
+	maxJobPriority = 10
+)
+
+// clampPriority limits a requested priority to the accepted range
+func clampPriority(p int) int {
+	return min(max(p, minJobPriority), maxJobPriority)
+}
+
+// queuedJob is a request waiting for a slot
+type queuedJob struct {
+	id       string        // episode_id, may be empty
+	priority int           // Higher runs first
+	ready    chan struct{} // Closed when a slot has been handed over
+}
+
+var (
+	queueMu  sync.Mutex
+	jobQueue []*queuedJob
+)
+
+// waitForJobSlot takes a concurrency slot, queueing for one when the cap is
+// reached and the queue has room. It returns false when the queue is full
+// or ctx ends first; only a true result must be paired with releaseJobSlot.
+func waitForJobSlot(ctx context.Context, id string, priority int) bool {
+	queueMu.Lock()
+	if len(jobQueue) == 0 && acquireJobSlot() {
+		queueMu.Unlock()
+		return true
+	}
+	if len(jobQueue) >= config.MaxQueuedJobs {
+		queueMu.Unlock()
+		return false
+	}
+	job := &queuedJob{id: id, priority: priority, ready: make(chan struct{})}
+	// Behind every job of the same or higher priority
+	pos := len(jobQueue)
+	for i, j := range jobQueue {
+		if j.priority < priority {
+			pos = i
+			break
+		}
+	}
+	jobQueue = slices.Insert(jobQueue, pos, job)
+	queueMu.Unlock()
+	if id != "" {
+		fmt.Printf("[%s] Queued for a job slot at position %d (priority %d)\n", id, pos+1, priority)
+	}
+
+	select {
+	case <-job.ready:
+		return true
+	case <-ctx.Done():
+	}
+
+	queueMu.Lock()
+	for i, j := range jobQueue {
+		if j == job {
+			jobQueue = append(jobQueue[:i], jobQueue[i+1:]...)
+			queueMu.Unlock()
+			return false
+		}
+	}
+	queueMu.Unlock()
+	// The slot arrived as ctx ended; pass it on
+	releaseJobSlot()
+	return false
+}
+
+// queuePosition returns id's 1-based place in the queue, or 0
+func queuePosition(id string) int {
+	pos, _ := queuedJobInfo(id)
+	return pos
+}
+
+// queuedJobInfo returns id's 1-based place in the queue and its priority;
+// the position is 0 when id isn't queued
+func queuedJobInfo(id string) (int, int) {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	for i, j := range jobQueue {
+		if j.id == id {
+			return i + 1, j.priority
+		}
+	}
+	return 0, 0
+}
+
+// jobStatus is the response body for GET /jobs/{id}
+type jobStatus struct {
+	JobID         string `json:"job_id"`
+	State         string `json:"state"`                    // queued, processing, paused
+	Priority      int    `json:"priority"`                 // Effective priority after clamping
+	QueuePosition int    `json:"queue_position,omitempty"` // 1 = next to run
+}
+
+// handleGetJob serves GET /jobs/{id}
+func handleGetJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	status := jobStatus{JobID: id}
+	if pos, priority := queuedJobInfo(id); pos > 0 {
+		status.State, status.QueuePosition, status.Priority = "queued", pos, priority
+	} else if c := lookupJob(id); c != nil {
+		status.Priority = c.priority
+		c.mu.Lock()
+		status.State = "processing"
+		if c.paused {
+			status.State = "paused"
+		}
+		c.mu.Unlock()
+	} else {
+		sendError(w, codeNotFound, fmt.Sprintf("No queued or running job %q", id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
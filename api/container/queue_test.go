@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func getJob(id string) (int, jobStatus) {
+	req := httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil)
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	handleGetJob(rec, req)
+	var status jobStatus
+	json.NewDecoder(rec.Body).Decode(&status)
+	return rec.Code, status
+}
+
+func TestJobQueue(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxConcurrentJobs = 1
+	config.MaxQueuedJobs = 2
+
+	if !waitForJobSlot(context.Background(), "running", 0) {
+		t.Fatal("first job should get a slot")
+	}
+
+	gotA := make(chan bool, 1)
+	go func() { gotA <- waitForJobSlot(context.Background(), "a", 0) }()
+	waitFor(t, "a to queue", func() bool { return queuePosition("a") == 1 })
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	gotB := make(chan bool, 1)
+	go func() { gotB <- waitForJobSlot(ctxB, "b", 0) }()
+	waitFor(t, "b to queue", func() bool { return queuePosition("b") == 2 })
+
+	if code, status := getJob("b"); code != http.StatusOK || status.State != "queued" || status.QueuePosition != 2 {
+		t.Errorf("GET /jobs/b = %d %+v", code, status)
+	}
+
+	// Queue full: rejected immediately
+	if waitForJobSlot(context.Background(), "c", 0) {
+		t.Error("c should be rejected with a full queue")
+	}
+
+	// A freed slot goes to the head of the queue
+	releaseJobSlot()
+	if !<-gotA {
+		t.Fatal("a should get the freed slot")
+	}
+	if pos := queuePosition("b"); pos != 1 {
+		t.Errorf("b position = %d, want 1", pos)
+	}
+
+	// Giving up leaves the queue
+	cancelB()
+	if <-gotB {
+		t.Error("b should not get a slot after cancelling")
+	}
+	if code, _ := getJob("b"); code != http.StatusNotFound {
+		t.Errorf("GET /jobs/b after cancel = %d, want 404", code)
+	}
+
+	releaseJobSlot()
+	if n := activeJobs.Load(); n != 0 {
+		t.Errorf("activeJobs = %d, want 0", n)
+	}
+}
+
+func TestJobQueueDisabled(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxConcurrentJobs = 1
+	config.MaxQueuedJobs = 0
+
+	if !waitForJobSlot(context.Background(), "", 0) {
+		t.Fatal("first job should get a slot")
+	}
+	defer releaseJobSlot()
+	if waitForJobSlot(context.Background(), "", 0) {
+		t.Error("without a queue the second job should be rejected")
+	}
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxConcurrentJobs = 1
+	config.MaxQueuedJobs = 4
+
+	if !waitForJobSlot(context.Background(), "running", 0) {
+		t.Fatal("first job should get a slot")
+	}
+
+	got := make(chan string, 4)
+	enqueue := func(id string, priority, wantPos int) {
+		go func() {
+			if waitForJobSlot(context.Background(), id, priority) {
+				got <- id
+			}
+		}()
+		waitFor(t, id+" to queue", func() bool { return queuePosition(id) == wantPos })
+	}
+	enqueue("low", -5, 1)
+	enqueue("normal-1", 0, 1)
+	enqueue("normal-2", 0, 2)
+	enqueue("urgent", 10, 1)
+
+	if _, status := getJob("normal-2"); status.QueuePosition != 3 || status.Priority != 0 {
+		t.Errorf("GET /jobs/normal-2 = %+v, want position 3", status)
+	}
+	if _, status := getJob("low"); status.QueuePosition != 4 || status.Priority != -5 {
+		t.Errorf("GET /jobs/low = %+v, want position 4 priority -5", status)
+	}
+
+	// Highest priority first, FIFO within a priority
+	for _, want := range []string{"urgent", "normal-1", "normal-2", "low"} {
+		releaseJobSlot()
+		if id := <-got; id != want {
+			t.Fatalf("slot went to %s, want %s", id, want)
+		}
+	}
+	releaseJobSlot()
+}
+
+func TestClampPriority(t *testing.T) {
+	for in, want := range map[int]int{0: 0, 3: 3, -10: -10, 99: maxJobPriority, -99: minJobPriority} {
+		req := ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", Priority: in}
+		if err := validateRequest(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Priority != want {
+			t.Errorf("priority %d clamped to %d, want %d", in, req.Priority, want)
+		}
+	}
+}
+
+func TestGetRunningJob(t *testing.T) {
+	c, unregister := registerJob("ep-running", 0)
+	defer unregister()
+	if _, status := getJob("ep-running"); status.State != "processing" {
+		t.Errorf("state = %q, want processing", status.State)
+	}
+	_, unregisterUrgent := registerJob("ep-urgent", 7)
+	defer unregisterUrgent()
+	if _, status := getJob("ep-urgent"); status.Priority != 7 {
+		t.Errorf("priority = %d, want 7", status.Priority)
+	}
+	c.pause()
+	if _, status := getJob("ep-running"); status.State != "paused" {
+		t.Errorf("state = %q, want paused", status.State)
+	}
+}
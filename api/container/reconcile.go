@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ---------- Duration Reconciliation ----------
+//
+// A concat that drops a segment or mangles timestamps still produces a valid
+// file, just a shorter (or longer) one. After encoding, the probed output
+// duration is compared with the sum of the probed inputs, scaled by
+// SpeedFactor. MP3 encoder delay and padding add a few frames per segment,
+// so each input earns a small allowance on top of the configured tolerance.
+
+// perSegmentAllowance is the drift each joined input may add in seconds
+const perSegmentAllowance = 0.05
+
+// probeDurations returns the ffprobe duration of every input after trimming
+func probeDurations(inputs []concatInput) ([]float64, error) {
+	durations := make([]float64, len(inputs))
+	for i, in := range inputs {
+		d, err := getDuration(in.Path)
+		if err != nil {
+			return nil, fmt.Errorf("probe input %d: %w", i, err)
+		}
+		durations[i] = in.trimmedDuration(d)
+	}
+	return durations, nil
+}
+
+// reconcileDuration returns an error describing the mismatch when actual
+// differs from the expected output duration by more than the tolerance
+func reconcileDuration(inputs []float64, speed, actual float64, tolerance time.Duration) error {
+	var sum float64
+	for _, d := range inputs {
+		sum += d
+	}
+	if speed > 0 {
+		sum /= speed
+	}
+
+	allowed := tolerance.Seconds() + perSegmentAllowance*float64(len(inputs))
+	if diff := actual - sum; math.Abs(diff) > allowed {
+		return fmt.Errorf("output duration %.2fs differs from inputs (%.2fs) by %+.2fs, more than %.2fs allowed", actual, sum, diff, allowed)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconcileDuration(t *testing.T) {
+	inputs := []float64{60, 60, 60}
+
+	tests := []struct {
+		name    string
+		speed   float64
+		actual  float64
+		wantErr bool
+	}{
+		{"exact", 1, 180, false},
+		{"encoder padding", 1, 180.1, false},
+		{"within tolerance", 1, 181, false},
+		{"dropped segment", 1, 120, true},
+		{"too long", 1, 185, true},
+		{"speed adjusted", 1.5, 120, false},
+		{"speed ignored", 1.5, 180, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := reconcileDuration(inputs, tt.speed, tt.actual, time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ---------- Resource Usage ----------
+//
+// Telemetry for right-sizing the container. Everything is sampled on demand
+// (when /status is served, plus once after each encode for the disk peak), so
+// the job hot path never pays for it. Figures cover this Go process and the
+// concat-* work dirs; FFmpeg child processes report their own RSS separately.
+
+// ResourceUsage is the memory and disk snapshot reported in /status
+type ResourceUsage struct {
+	RSSBytes         int64  `json:"rss_bytes"`           // VmRSS from /proc/self/status
+	PeakRSSBytes     int64  `json:"peak_rss_bytes"`      // VmHWM: high-water mark since start
+	HeapBytes        uint64 `json:"heap_bytes"`          // Go heap in use
+	WorkDirBytes     int64  `json:"work_dir_bytes"`      // Current size of all concat-* dirs
+	PeakWorkDirBytes int64  `json:"peak_work_dir_bytes"` // Largest size observed since start
+}
+
+// peakWorkDirBytes is the largest work dir total seen by any sample
+var peakWorkDirBytes atomic.Int64
+
+// sampleResourceUsage collects the current snapshot
+func sampleResourceUsage() ResourceUsage {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	rss, peakRSS := readProcMemory("/proc/self/status")
+	workDir := sampleWorkDirUsage()
+
+	return ResourceUsage{
+		RSSBytes:         rss,
+		PeakRSSBytes:     peakRSS,
+		HeapBytes:        mem.HeapInuse,
+		WorkDirBytes:     workDir,
+		PeakWorkDirBytes: peakWorkDirBytes.Load(),
+	}
+}
+
+// sampleWorkDirUsage measures all job work dirs and updates the peak
+func sampleWorkDirUsage() int64 {
+	total := workDirUsage(os.TempDir())
+	for {
+		peak := peakWorkDirBytes.Load()
+		if total <= peak || peakWorkDirBytes.CompareAndSwap(peak, total) {
+			return total
+		}
+	}
+}
+
+// workDirUsage sums file sizes under every concat-* dir in root
+func workDirUsage(root string) int64 {
+	dirs, _ := filepath.Glob(filepath.Join(root, "concat-*"))
+	var total int64
+	for _, dir := range dirs {
+		// Files can disappear mid-walk when a job finishes; skip them
+		filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return total
+}
+
+// readProcMemory returns VmRSS and VmHWM in bytes, or zeros when the file
+// is unavailable (non-Linux development machines)
+func readProcMemory(path string) (rss, hwm int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "VmRSS":
+			rss = kb * 1024
+		case "VmHWM":
+			hwm = kb * 1024
+		}
+	}
+	return rss, hwm
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadProcMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status")
+	os.WriteFile(path, []byte("Name:\tserver\nVmHWM:\t   20480 kB\nVmRSS:\t   10240 kB\nThreads:\t8\n"), 0644)
+
+	rss, hwm := readProcMemory(path)
+	if rss != 10240*1024 || hwm != 20480*1024 {
+		t.Errorf("rss = %d, hwm = %d", rss, hwm)
+	}
+
+	if rss, hwm := readProcMemory(filepath.Join(t.TempDir(), "missing")); rss != 0 || hwm != 0 {
+		t.Errorf("missing file: rss = %d, hwm = %d", rss, hwm)
+	}
+}
+
+func TestWorkDirUsage(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"concat-1", "concat-2", "other"} {
+		os.Mkdir(filepath.Join(root, dir), 0755)
+		os.WriteFile(filepath.Join(root, dir, "segment_0000.mp3"), make([]byte, 100), 0644)
+	}
+
+	if got := workDirUsage(root); got != 200 {
+		t.Errorf("workDirUsage = %d, want 200", got)
+	}
+}
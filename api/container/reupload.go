@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ---------- Re-upload ----------
+//
+// With output_urls, a job succeeds once the primary upload does; failed
+// mirrors are listed in failed_mirrors with their error and attempt count
+// in uploads. POST /reupload lets the client push the published file to
+// just those mirrors later, without re-encoding: it downloads source_url
+// (usually the primary's download_url) once and PUTs it to every target
+// with the same per-destination retries as a job. It takes no job slot;
+// UPLOAD_CONCURRENCY still caps the PUTs in flight.
+
+// ReuploadRequest is the request body for /reupload
+type ReuploadRequest struct {
+	SourceURL   string   `json:"source_url"`             // GET URL of the produced file
+	TargetURLs  []string `json:"target_urls"`            // Signed PUT URLs to publish to
+	ContentType string   `json:"content_type,omitempty"` // Default audio/mpeg
+}
+
+// ReuploadResponse is the response body for /reupload
+type ReuploadResponse struct {
+	SchemaVersion int            `json:"schema_version"`
+	Success       bool           `json:"success"` // Every target succeeded
+	Error         string         `json:"error,omitempty"`
+	ErrorCode     ErrorCode      `json:"error_code,omitempty"`
+	Uploads       []UploadResult `json:"uploads"`
+	FailedURLs    []string       `json:"failed_urls,omitempty"` // Targets to retry again
+}
+
+// validate checks a /reupload body and fills in defaults
+func (req *ReuploadRequest) validate() error {
+	if req.SourceURL == "" {
+		return errors.New("source_url is required")
+	}
+	if len(req.TargetURLs) == 0 {
+		return errors.New("target_urls must not be empty")
+	}
+	for i, u := range req.TargetURLs {
+		if u == "" {
+			return fmt.Errorf("target_urls[%d] is empty", i)
+		}
+	}
+	if req.ContentType == "" {
+		req.ContentType = "audio/mpeg"
+	}
+	return nil
+}
+
+// handleReupload serves POST /reupload
+func handleReupload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, codeMethodNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !acceptingJobs() {
+		w.Header().Set("Retry-After", strconv.Itoa(shutdownRetryAfterSeconds))
+		sendError(w, codeUnavailable, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	body, ok := readAuthorizedBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReuploadRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, codeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		sendError(w, codeInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workDir, err := os.MkdirTemp("", "concat-*")
+	if err != nil {
+		sendError(w, codeInternal, fmt.Sprintf("Failed to create temp dir: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(workDir)
+
+	ctx, cancel := context.WithTimeout(shutdownCtx, jobTimeout)
+	defer cancel()
+	srcPath := filepath.Join(workDir, "reupload")
+	start := time.Now()
+	if _, err := retryTransfer(ctx, "download "+redactURL(req.SourceURL), func() (int64, error) {
+		return downloadFileLimit(ctx, req.SourceURL, srcPath, 0)
+	}); err != nil {
+		writeErrorResponse(w, ConcatResponse{
+			Error:     fmt.Sprintf("Failed to download source_url: %v", err),
+			ErrorCode: codeSegmentDownloadFailed,
+			Retryable: isRetryable(err),
+		}, http.StatusBadGateway)
+		return
+	}
+
+	uploadCtx, cancelUpload := uploadContext(ctx)
+	defer cancelUpload()
+	uploads := uploadToDestinations(uploadCtx, srcPath, req.TargetURLs, req.ContentType)
+	// Every target is a mirror; none is more primary than the others
+	for i := range uploads {
+		uploads[i].Primary = false
+	}
+
+	resp := ReuploadResponse{SchemaVersion: schemaVersion, Uploads: uploads, FailedURLs: failedUploadURLs(uploads)}
+	resp.Success = len(resp.FailedURLs) == 0
+	status := http.StatusOK
+	if !resp.Success {
+		resp.Error = fmt.Sprintf("%d of %d targets failed", len(resp.FailedURLs), len(uploads))
+		resp.ErrorCode = codeUploadFailed
+		status = http.StatusBadGateway
+	}
+	fmt.Printf("Reupload of %s to %d targets: %d failed (%s)\n", redactURL(req.SourceURL), len(uploads), len(resp.FailedURLs), time.Since(start).Round(time.Millisecond))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
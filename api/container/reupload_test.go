@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHandleReupload(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/output.mp3":
+			w.Write([]byte("published audio"))
+		case r.URL.Path == "/broken":
+			http.Error(w, "denied", http.StatusForbidden)
+		case r.Method == http.MethodPut:
+			var body bytes.Buffer
+			body.ReadFrom(r.Body)
+			mu.Lock()
+			received[r.URL.Path] = body.String()
+			mu.Unlock()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	post := func(req ReuploadRequest) (int, ReuploadResponse) {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handleReupload(rec, httptest.NewRequest(http.MethodPost, "/reupload", bytes.NewReader(body)))
+		var resp ReuploadResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := post(ReuploadRequest{
+		SourceURL:  server.URL + "/output.mp3",
+		TargetURLs: []string{server.URL + "/mirror-a", server.URL + "/mirror-b"},
+	})
+	if code != http.StatusOK || !resp.Success || len(resp.FailedURLs) != 0 {
+		t.Fatalf("reupload = %d %+v", code, resp)
+	}
+	if received["/mirror-a"] != "published audio" || received["/mirror-b"] != "published audio" {
+		t.Errorf("targets received %v", received)
+	}
+	for _, u := range resp.Uploads {
+		if u.Primary || u.Attempts != 1 {
+			t.Errorf("upload result = %+v", u)
+		}
+	}
+
+	// A failed target is reported for another retry
+	code, resp = post(ReuploadRequest{
+		SourceURL:  server.URL + "/output.mp3",
+		TargetURLs: []string{server.URL + "/mirror-a", server.URL + "/broken"},
+	})
+	if code != http.StatusBadGateway || resp.Success || resp.ErrorCode != codeUploadFailed {
+		t.Errorf("partial reupload = %d %+v", code, resp)
+	}
+	if len(resp.FailedURLs) != 1 || resp.FailedURLs[0] != server.URL+"/broken" {
+		t.Errorf("failed_urls = %v", resp.FailedURLs)
+	}
+
+	// An unreachable source uploads nothing
+	code, resp = post(ReuploadRequest{SourceURL: server.URL + "/missing.mp3", TargetURLs: []string{server.URL + "/mirror-c"}})
+	if code != http.StatusBadGateway || resp.ErrorCode != codeSegmentDownloadFailed {
+		t.Errorf("missing source = %d %+v", code, resp)
+	}
+	if _, ok := received["/mirror-c"]; ok {
+		t.Error("target was written without a source")
+	}
+}
+
+func TestReuploadRequestValidate(t *testing.T) {
+	for _, req := range []ReuploadRequest{
+		{TargetURLs: []string{"https://a"}},
+		{SourceURL: "https://s"},
+		{SourceURL: "https://s", TargetURLs: []string{"https://a", ""}},
+	} {
+		if err := req.validate(); err == nil {
+			t.Errorf("%+v: expected an error", req)
+		}
+	}
+	req := ReuploadRequest{SourceURL: "https://s", TargetURLs: []string{"https://a"}}
+	if err := req.validate(); err != nil || req.ContentType != "audio/mpeg" {
+		t.Errorf("valid request: err %v, content type %q", err, req.ContentType)
+	}
+
+	rec := httptest.NewRecorder()
+	handleReupload(rec, httptest.NewRequest(http.MethodPost, "/reupload", strings.NewReader(`{"source_url":"x"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("code = %d, want 400", rec.Code)
+	}
+}
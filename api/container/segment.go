@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ---------- Segments ----------
+//
+// A segment is either a plain URL string or an object with optional trim
+// points, so callers can keep part of a source clip (skipping a countdown,
+// say) without pre-cutting it:
+//
+//	"segments": ["https://.../a.mp3", {"url": "https://.../b.mp3", "start": 3}]
+//
+// Trims become inpoint/outpoint directives in the concat list, or -ss/-to
+// input options with the concat filter. An object may also carry gain_db to
+// balance clips whose relative levels the caller has already measured; it
+// becomes a volume filter on that input, so it needs the concat filter.
+
+// Segment is one input of a /concat request
+type Segment struct {
+	URL    string  `json:"url"`
+	Start  float64 `json:"start,omitempty"`   // Seconds to skip at the beginning
+	End    float64 `json:"end,omitempty"`     // Seconds at which to stop, 0 = to the end
+	GainDB float64 `json:"gain_db,omitempty"` // Gain applied to this segment before the join
+}
+
+// UnmarshalJSON accepts a URL string or a {url, start, end} object
+func (s *Segment) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*s = Segment{URL: url}
+		return nil
+	}
+
+	// The alias drops this method so the object form decodes normally
+	type segmentObject Segment
+	var obj segmentObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return errors.New("segment must be a URL string or an object with url, start, end, gain_db")
+	}
+	*s = Segment(obj)
+	return nil
+}
+
+// MarshalJSON writes untrimmed segments without gain in the plain string form
+func (s Segment) MarshalJSON() ([]byte, error) {
+	if !s.trimmed() && s.GainDB == 0 {
+		return json.Marshal(s.URL)
+	}
+	type segmentObject Segment
+	return json.Marshal(segmentObject(s))
+}
+
+// trimmed reports whether the segment has an in or out point
+func (s Segment) trimmed() bool {
+	return s.Start > 0 || s.End > 0
+}
+
+// validate checks the trim points on their own; they are checked against
+// the probed duration once the segment is downloaded (see checkDuration)
+func (s Segment) validate() error {
+	if s.URL == "" {
+		return errors.New("url is required")
+	}
+	if s.Start < 0 || s.End < 0 {
+		return errors.New("start and end must not be negative")
+	}
+	if s.End > 0 && s.End <= s.Start {
+		return errors.New("end must be after start")
+	}
+	if s.GainDB < minGainDB || s.GainDB > maxGainDB {
+		return fmt.Errorf("gain_db must be between %d and %d", minGainDB, maxGainDB)
+	}
+	return nil
+}
+
+// checkDuration verifies the trim points fall within the segment's duration
+func (s Segment) checkDuration(duration float64) error {
+	if s.Start >= duration {
+		return fmt.Errorf("start %gs is not before the segment's %.3fs duration", s.Start, duration)
+	}
+	if s.End > duration {
+		return fmt.Errorf("end %gs is past the segment's %.3fs duration", s.End, duration)
+	}
+	return nil
+}
+
+// segmentURLs wraps plain URLs as untrimmed segments
+func segmentURLs(urls ...string) []Segment {
+	segments := make([]Segment, len(urls))
+	for i, url := range urls {
+		segments[i] = Segment{URL: url}
+	}
+	return segments
+}
+
+// hasSegmentGain reports whether any segment sets gain_db
+func hasSegmentGain(segments []Segment) bool {
+	for _, s := range segments {
+		if s.GainDB != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSegmentJSON(t *testing.T) {
+	var req ConcatRequest
+	body := `{"segments": ["https://a/1.mp3", {"url": "https://a/2.mp3", "start": 3}, {"url": "https://a/3.mp3", "start": 1, "end": 9.5}]}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	want := []Segment{
+		{URL: "https://a/1.mp3"},
+		{URL: "https://a/2.mp3", Start: 3},
+		{URL: "https://a/3.mp3", Start: 1, End: 9.5},
+	}
+	if !reflect.DeepEqual(req.Segments, want) {
+		t.Errorf("segments = %+v, want %+v", req.Segments, want)
+	}
+
+	out, _ := json.Marshal(want[:2])
+	if string(out) != `["https://a/1.mp3",{"url":"https://a/2.mp3","start":3}]` {
+		t.Errorf("marshal = %s", out)
+	}
+
+	out, _ = json.Marshal(Segment{URL: "https://a/4.mp3", GainDB: 2})
+	if string(out) != `{"url":"https://a/4.mp3","gain_db":2}` {
+		t.Errorf("marshal with gain = %s", out)
+	}
+
+	if err := json.Unmarshal([]byte(`{"segments": [42]}`), &req); err == nil {
+		t.Error("expected error for a numeric segment")
+	}
+}
+
+func TestSegmentValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		seg     Segment
+		wantErr bool
+	}{
+		{"plain", Segment{URL: "a"}, false},
+		{"start only", Segment{URL: "a", Start: 3}, false},
+		{"range", Segment{URL: "a", Start: 3, End: 10}, false},
+		{"missing url", Segment{Start: 3}, true},
+		{"negative start", Segment{URL: "a", Start: -1}, true},
+		{"end before start", Segment{URL: "a", Start: 5, End: 4}, true},
+		{"gain", Segment{URL: "a", GainDB: -6}, false},
+		{"gain out of range", Segment{URL: "a", GainDB: 40}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.seg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSegmentCheckDuration(t *testing.T) {
+	if err := (Segment{URL: "a", Start: 3, End: 10}).checkDuration(30); err != nil {
+		t.Errorf("in range: %v", err)
+	}
+	if err := (Segment{URL: "a", Start: 30}).checkDuration(30); err == nil {
+		t.Error("expected error for start at the end")
+	}
+	if err := (Segment{URL: "a", End: 31}).checkDuration(30); err == nil {
+		t.Error("expected error for end past the duration")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Segment Cache ----------
+//
+// With SEGMENT_CACHE_DIR set, segments served with an ETag are kept on disk
+// between jobs. The next fetch of the same object sends If-None-Match and a
+// 304 reuses the cached copy instead of downloading it again, which pays off
+// for intro/outro clips shared by many episodes. Entries are keyed by URL
+// without its query string so presigned URLs for the same object share an
+// entry; the origin's ETag check is what guarantees the content still
+// matches. Bodies without an ETag are always downloaded in full.
+
+// segmentCacheKey names the cache entry for rawURL
+func segmentCacheKey(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		u.RawQuery, u.Fragment = "", ""
+		rawURL = u.String()
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:])
+}
+
+// downloadSegment fetches a segment, revalidating against the segment cache
+// when one is configured
+func downloadSegment(ctx context.Context, rawURL, destPath string) (int64, error) {
+	if config.SegmentCacheDir == "" || isDataURL(rawURL) {
+		return downloadFile(ctx, rawURL, destPath)
+	}
+	return fetchCached(ctx, config.SegmentCacheDir, rawURL, destPath)
+}
+
+// fetchCached downloads rawURL into destPath through the cache in dir. The
+// returned byte count is what crossed the network: 0 for a cache hit.
+func fetchCached(ctx context.Context, dir, rawURL, destPath string) (int64, error) {
+	entry := filepath.Join(dir, segmentCacheKey(rawURL))
+	etag := ""
+	if data, err := os.ReadFile(entry + ".etag"); err == nil {
+		if _, err := os.Stat(entry + ".mp3"); err == nil {
+			etag = string(data)
+		}
+	}
+
+	written, respETag, err := downloadConditional(ctx, rawURL, destPath, config.MaxSegmentBytes, etag)
+	if errors.Is(err, errNotModified) {
+		if err := linkOrCopy(entry+".mp3", destPath); err != nil {
+			return 0, fmt.Errorf("read cached segment: %w", err)
+		}
+		// Touch the entry so eviction keeps recently used segments
+		now := time.Now()
+		os.Chtimes(entry+".mp3", now, now)
+		return 0, nil
+	}
+	if err != nil {
+		return written, err
+	}
+
+	if respETag == "" {
+		// Can't be revalidated; drop any stale entry for this URL
+		os.Remove(entry + ".mp3")
+		os.Remove(entry + ".etag")
+		return written, nil
+	}
+	if err := storeCached(dir, entry, destPath, respETag); err != nil {
+		fmt.Printf("Warning: failed to cache segment: %v\n", err)
+	}
+	return written, nil
+}
+
+// storeCached copies srcPath into the cache entry. Files are renamed into
+// place so concurrent jobs never see a partial entry.
+func storeCached(dir, entry, srcPath, etag string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp := uniqueTempPath(entry)
+	if err := linkOrCopy(srcPath, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, entry+".mp3"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.WriteFile(tmp, []byte(etag), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, entry+".etag"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	evictSegmentCache(dir, config.SegmentCacheMaxBytes)
+	return nil
+}
+
+// evictSegmentCache removes the least recently used entries until the
+// cache fits in maxBytes; 0 = unbounded
+func evictSegmentCache(dir string, maxBytes int64) {
+	if maxBytes <= 0 {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.mp3"))
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []cached
+	var total int64
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			entries = append(entries, cached{f, info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if total <= maxBytes {
+			return
+		}
+		os.Remove(e.path)
+		os.Remove(strings.TrimSuffix(e.path, ".mp3") + ".etag")
+		total -= e.size
+	}
+}
+
+// linkOrCopy hard-links src to dst, copying when a link isn't possible
+// (for example across filesystems)
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
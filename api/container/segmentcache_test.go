@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchCachedRevalidatesWithETag(t *testing.T) {
+	body := bytes.Repeat([]byte{0xff}, 2048)
+	var fullResponses, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	workDir := t.TempDir()
+
+	// First fetch downloads and fills the cache; the second uses a
+	// different signature but the same object, and gets a 304
+	first := filepath.Join(workDir, "segment_0000.mp3")
+	written, err := fetchCached(context.Background(), cacheDir, server.URL+"/intro.mp3?sig=a", first)
+	if err != nil || written != int64(len(body)) {
+		t.Fatalf("first fetch: written = %d, err = %v", written, err)
+	}
+
+	second := filepath.Join(workDir, "segment_0001.mp3")
+	written, err = fetchCached(context.Background(), cacheDir, server.URL+"/intro.mp3?sig=b", second)
+	if err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if written != 0 {
+		t.Errorf("cache hit written = %d, want 0", written)
+	}
+	if fullResponses.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("full = %d, 304 = %d; want 1 and 1", fullResponses.Load(), notModified.Load())
+	}
+	if got, _ := os.ReadFile(second); !bytes.Equal(got, body) {
+		t.Errorf("cached copy has %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func TestFetchCachedWithoutETag(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") != "" {
+			t.Error("sent If-None-Match without a cached ETag")
+		}
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		dest := filepath.Join(t.TempDir(), "segment.mp3")
+		if written, err := fetchCached(context.Background(), cacheDir, server.URL+"/a.mp3", dest); err != nil || written != 5 {
+			t.Fatalf("fetch %d: written = %d, err = %v", i, written, err)
+		}
+	}
+	if requests.Load() != 2 {
+		t.Errorf("requests = %d, want 2 full downloads", requests.Load())
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("cache should stay empty without an ETag, has %d entries", len(entries))
+	}
+}
+
+func TestEvictSegmentCache(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"old", "new"} {
+		os.WriteFile(filepath.Join(dir, name+".mp3"), make([]byte, 600), 0644)
+		os.WriteFile(filepath.Join(dir, name+".etag"), []byte(`"x"`), 0644)
+	}
+	past := filepath.Join(dir, "old.mp3")
+	info, _ := os.Stat(past)
+	os.Chtimes(past, info.ModTime().Add(-time.Minute), info.ModTime().Add(-time.Minute))
+
+	evictSegmentCache(dir, 1000)
+	if _, err := os.Stat(past); !os.IsNotExist(err) {
+		t.Error("least recently used entry was not evicted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.mp3")); err != nil {
+		t.Errorf("recent entry was evicted: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ---------- Serving Outputs ----------
+//
+// For local testing the container can act as the media origin itself. With
+// SERVE_OUTPUT_SECONDS set, a finished single-file output is moved out of
+// the work dir after its upload and served at GET /outputs/{token} until
+// the TTL lapses. The token is random, so the path is unguessable; it is
+// returned as served_path.
+//
+// http.ServeContent does the serving, so players get Range requests (206
+// Partial Content, for seeking), If-Modified-Since, and HEAD without any
+// code here. Retained files live in one directory that is wiped at startup:
+// the token table is in memory and doesn't survive a restart.
+
+// servedOutputsDir holds retained outputs
+var servedOutputsDir = filepath.Join(os.TempDir(), "strollcast-served")
+
+var (
+	servedOutputs   = map[string]string{} // token -> path
+	servedOutputsMu sync.Mutex
+)
+
+// retainOutput moves src into the served dir and registers it for ttl. It
+// returns the path the output is served at.
+func retainOutput(src string, ttl time.Duration) (string, error) {
+	if err := os.MkdirAll(servedOutputsDir, 0755); err != nil {
+		return "", err
+	}
+	token := randomHex(16)
+	dst := filepath.Join(servedOutputsDir, token+".mp3")
+	if err := os.Rename(src, dst); err != nil {
+		return "", err
+	}
+
+	servedOutputsMu.Lock()
+	servedOutputs[token] = dst
+	servedOutputsMu.Unlock()
+	time.AfterFunc(ttl, func() { expireOutput(token) })
+	return "/outputs/" + token, nil
+}
+
+// expireOutput stops serving token and deletes its file
+func expireOutput(token string) {
+	servedOutputsMu.Lock()
+	path, ok := servedOutputs[token]
+	delete(servedOutputs, token)
+	servedOutputsMu.Unlock()
+	if ok {
+		os.Remove(path)
+	}
+}
+
+// handleGetOutput serves a retained output, honoring Range requests
+func handleGetOutput(w http.ResponseWriter, r *http.Request) {
+	servedOutputsMu.Lock()
+	path, ok := servedOutputs[r.PathValue("token")]
+	servedOutputsMu.Unlock()
+	if !ok {
+		sendError(w, codeNotFound, "No such output (it may have expired)", http.StatusNotFound)
+		return
+	}
+
+	// An open file stays readable even if it expires mid-response
+	file, err := os.Open(path)
+	if err != nil {
+		sendError(w, codeNotFound, fmt.Sprintf("Output unavailable: %v", err), http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		sendError(w, codeInternal, fmt.Sprintf("Stat output failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), file)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeOutputRange(t *testing.T) {
+	defer func(dir string) { servedOutputsDir = dir }(servedOutputsDir)
+	servedOutputsDir = t.TempDir()
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, content, 0644)
+
+	servedPath, err := retainOutput(src, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source was not moved: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /outputs/{token}", handleGetOutput)
+
+	req := httptest.NewRequest(http.MethodGet, servedPath, nil)
+	req.Header.Set("Range", "bytes=100-109")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("code = %d, want 206", rec.Code)
+	}
+	if got := rec.Body.String(); got != "0123456789" {
+		t.Errorf("body = %q", got)
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 100-109/1000" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "audio/mpeg" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, servedPath, nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != len(content) || rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("full GET: code = %d, %d bytes, Accept-Ranges %q", rec.Code, rec.Body.Len(), rec.Header().Get("Accept-Ranges"))
+	}
+
+	expireOutput(strings.TrimPrefix(servedPath, "/outputs/"))
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, servedPath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expired: code = %d, want 404", rec.Code)
+	}
+	if entries, _ := os.ReadDir(servedOutputsDir); len(entries) != 0 {
+		t.Errorf("expired file left behind: %v", entries)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ---------- HTTP Server ----------
+//
+// http.ListenAndServe has no timeouts at all, so a client that trickles
+// headers or holds idle connections can tie up the server indefinitely.
+// The server-wide WriteTimeout suits the quick endpoints; /concat responds
+// only after the whole job, so it extends its own write deadline.
+
+// jobTimeout bounds a single /concat job up to the upload
+const jobTimeout = 60 * time.Minute
+
+// uploadContext returns the context for a job's upload phase. With
+// UPLOAD_TIMEOUT_SECONDS set the upload gets that long from the moment it
+// starts, rather than whatever is left of jobTimeout, so an encode that
+// finishes a minute before the deadline isn't thrown away at the finish
+// line. It derives from shutdownCtx, not the job context, so shutdown
+// still stops it but the job deadline doesn't.
+func uploadContext(jobCtx context.Context) (context.Context, context.CancelFunc) {
+	if config.UploadTimeout <= 0 {
+		return context.WithCancel(jobCtx)
+	}
+	return context.WithTimeout(shutdownCtx, config.UploadTimeout)
+}
+
+// newServer builds the HTTP server with timeouts from config
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
+// withWriteDeadline lets next write its response for up to d after the
+// request arrives, overriding the server's WriteTimeout
+func withWriteDeadline(d time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d)); err != nil {
+			fmt.Printf("Warning: failed to extend write deadline for %s: %v\n", r.URL.Path, err)
+		}
+		next(w, r)
+	}
+}
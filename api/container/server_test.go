@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithWriteDeadlineOutlivesWriteTimeout(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", slow)
+	mux.HandleFunc("/extended", withWriteDeadline(time.Minute, slow))
+
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// The server-wide timeout cuts off the plain handler's response
+	if resp, err := http.Get(server.URL + "/slow"); err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) == "done" {
+			t.Error("expected WriteTimeout to cut off /slow")
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/extended")
+	if err != nil {
+		t.Fatalf("extended request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "done" {
+		t.Errorf("body = %q, want %q", body, "done")
+	}
+}
+
+func TestUploadContextOutlivesJobDeadline(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.UploadTimeout = time.Minute
+
+	jobCtx, cancelJob := context.WithTimeout(shutdownCtx, time.Millisecond)
+	defer cancelJob()
+	uploadCtx, cancelUpload := uploadContext(jobCtx)
+	defer cancelUpload()
+
+	<-jobCtx.Done()
+	if err := uploadCtx.Err(); err != nil {
+		t.Fatalf("upload stopped with the job deadline: %v", err)
+	}
+	deadline, ok := uploadCtx.Deadline()
+	if !ok || time.Until(deadline) < 50*time.Second {
+		t.Errorf("upload deadline = %v, want about a minute from now", deadline)
+	}
+}
+
+func TestUploadContextStopsOnShutdown(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	defer func() { shutdownCtx, shutdownCancel = context.WithCancel(context.Background()) }()
+	config.UploadTimeout = time.Minute
+
+	uploadCtx, cancelUpload := uploadContext(context.Background())
+	defer cancelUpload()
+	shutdownCancel()
+	if uploadCtx.Err() == nil {
+		t.Error("shutdown should cancel the upload")
+	}
+}
+
+func TestUploadContextSharesJobDeadlineWhenUnset(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.UploadTimeout = 0
+
+	jobCtx, cancelJob := context.WithCancel(context.Background())
+	uploadCtx, cancelUpload := uploadContext(jobCtx)
+	defer cancelUpload()
+	cancelJob()
+	if uploadCtx.Err() == nil {
+		t.Error("with UPLOAD_TIMEOUT_SECONDS=0 the upload should end with the job")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// ---------- Sidecar Metadata ----------
+//
+// Pipelines that catalogue episodes want everything the job learned about
+// its output in one file next to the audio, rather than reassembled from
+// the /concat response. With sidecar_url set, that JSON is PUT after the
+// audio upload succeeds. The audio is already in place by then, so a failed
+// sidecar upload is a warning and never fails the job.
+//
+// The loudness block is the target loudnorm was run with, not a measurement
+// of the output; a stream-copied job wasn't normalized and omits it.
+
+// Sidecar is the JSON document uploaded to sidecar_url
+type Sidecar struct {
+	SchemaVersion   int              `json:"schema_version"` // See schemaVersion
+	EpisodeID       string           `json:"episode_id,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	FileSize        int64            `json:"file_size"`
+	OutputURL       string           `json:"output_url,omitempty"`
+	Parts           []OutputPart     `json:"parts,omitempty"`
+	PlaylistURL     string           `json:"playlist_url,omitempty"`
+	Metadata        ConcatMetadata   `json:"metadata"`
+	Loudness        *SidecarLoudness `json:"loudness,omitempty"`
+	StreamCopied    bool             `json:"stream_copied,omitempty"`
+	Waveform        *Waveform        `json:"waveform,omitempty"`
+	SkippedSegments []SkippedSegment `json:"skipped_segments,omitempty"`
+}
+
+// SidecarLoudness is the loudnorm target the output was normalized to
+type SidecarLoudness struct {
+	Profile        string  `json:"profile"`
+	IntegratedLUFS float64 `json:"integrated_lufs"`
+	TruePeakDB     float64 `json:"true_peak_db"`
+	LRA            float64 `json:"lra"`
+}
+
+// sidecarLoudness describes the loudnorm target for req
+func sidecarLoudness(req ConcatRequest) *SidecarLoudness {
+	p := resolveLoudness(req)
+	return &SidecarLoudness{Profile: req.LoudnessProfile, IntegratedLUFS: p.I, TruePeakDB: p.TP, LRA: p.LRA}
+}
+
+// uploadSidecar writes sidecar to path and PUTs it to url
+func uploadSidecar(ctx context.Context, sidecar Sidecar, path, url string) error {
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	return uploadWithRetry(ctx, path, url, "application/json")
+}
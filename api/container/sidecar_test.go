@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUploadSidecar(t *testing.T) {
+	var got map[string]any
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer server.Close()
+
+	req := ConcatRequest{LoudnessProfile: "audiobook"}
+	sidecar := Sidecar{
+		SchemaVersion:   schemaVersion,
+		EpisodeID:       "ep-1",
+		CreatedAt:       time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		DurationSeconds: 1800.5,
+		FileSize:        28800000,
+		OutputURL:       "https://storage.example.com/ep-1.mp3",
+		Metadata:        ConcatMetadata{Title: "Ep 1"},
+		Loudness:        sidecarLoudness(req),
+		Waveform:        &Waveform{Buckets: 1, Peaks: []int8{-3, 4}},
+	}
+	if err := uploadSidecar(context.Background(), sidecar, filepath.Join(t.TempDir(), "sidecar.json"), server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if got["episode_id"] != "ep-1" || got["duration_seconds"] != 1800.5 || got["created_at"] != "2026-10-16T12:00:00Z" {
+		t.Errorf("sidecar = %v", got)
+	}
+	loudness, _ := got["loudness"].(map[string]any)
+	if loudness["profile"] != "audiobook" || loudness["integrated_lufs"] != float64(-18) || loudness["true_peak_db"] != float64(-3) {
+		t.Errorf("loudness = %v", got["loudness"])
+	}
+	if got["waveform"] == nil {
+		t.Error("waveform missing")
+	}
+	if _, ok := got["parts"]; ok {
+		t.Error("empty parts should be omitted")
+	}
+}
+
+func TestUploadSidecarFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if err := uploadSidecar(context.Background(), Sidecar{}, filepath.Join(t.TempDir(), "sidecar.json"), server.URL); err == nil {
+		t.Fatal("expected error for 403")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ---------- Spectrogram ----------
+//
+// For audio QA, generate_spectrogram renders the output with FFmpeg's
+// showspectrumpic into a PNG: encoder artifacts show up as a hard cutoff or
+// holes in the high band, clipping as vertical smears, and a dead channel as
+// an empty half, since each channel is drawn separately. The image is
+// uploaded to spectrogram_url, or returned inline as a data: URL when it is
+// small enough.
+//
+// spectrogram_width and spectrogram_height size the spectrum itself; the
+// legend (time, frequency and level axes) adds a margin around it. FFmpeg
+// builds without showspectrumpic skip the image with a warning rather than
+// failing the job, as does any rendering error.
+
+const (
+	defaultSpectrogramWidth  = 1024
+	defaultSpectrogramHeight = 512
+	minSpectrogramSize       = 64
+	maxSpectrogramSize       = 4096
+
+	// maxInlineSpectrogramBytes caps the PNG returned in the response
+	// without spectrogram_url
+	maxInlineSpectrogramBytes = 256 << 10
+)
+
+// Spectrogram is the rendered image, uploaded or inline
+type Spectrogram struct {
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Bytes   int    `json:"bytes"`
+	URL     string `json:"url,omitempty"`      // spectrogram_url, once uploaded
+	DataURL string `json:"data_url,omitempty"` // data:image/png;base64,..., without spectrogram_url
+}
+
+// validateSpectrogram fills the default dimensions and checks their range
+func validateSpectrogram(req *ConcatRequest, hls bool) error {
+	if !req.GenerateSpectrogram {
+		if req.SpectrogramURL != "" || req.SpectrogramWidth != 0 || req.SpectrogramHeight != 0 {
+			return errors.New("spectrogram_url, spectrogram_width and spectrogram_height require generate_spectrogram")
+		}
+		return nil
+	}
+	switch {
+	case req.SplitDurationSeconds > 0:
+		return errors.New("generate_spectrogram is not supported with split output")
+	case hls:
+		return errors.New("generate_spectrogram is not supported with HLS output")
+	}
+	if req.SpectrogramWidth == 0 {
+		req.SpectrogramWidth = defaultSpectrogramWidth
+	}
+	if req.SpectrogramHeight == 0 {
+		req.SpectrogramHeight = defaultSpectrogramHeight
+	}
+	for _, size := range []int{req.SpectrogramWidth, req.SpectrogramHeight} {
+		if size < minSpectrogramSize || size > maxSpectrogramSize {
+			return fmt.Errorf("spectrogram_width and spectrogram_height must be between %d and %d", minSpectrogramSize, maxSpectrogramSize)
+		}
+	}
+	return nil
+}
+
+var (
+	spectrumFilterOnce      sync.Once
+	spectrumFilterAvailable bool
+)
+
+// hasSpectrumFilter reports whether this FFmpeg build has showspectrumpic.
+// The filter list is read once per process.
+func hasSpectrumFilter() bool {
+	spectrumFilterOnce.Do(func() {
+		// Not the job's context: a cancelled job mustn't cache a false answer
+		ctx, cancel := context.WithTimeout(context.Background(), filterCheckTimeout)
+		defer cancel()
+		out, err := ffmpegCommand(ctx, "-hide_banner", "-filters").Output()
+		if err != nil {
+			fmt.Printf("Warning: could not list FFmpeg filters: %v\n", err)
+			return
+		}
+		spectrumFilterAvailable = listsFilter(string(out), "showspectrumpic")
+	})
+	return spectrumFilterAvailable
+}
+
+// listsFilter reports whether `ffmpeg -filters` output names filter. Each
+// line is flags, name, pads and a description.
+func listsFilter(filters, name string) bool {
+	for _, line := range strings.Split(filters, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// spectrogramArgs returns the FFmpeg arguments rendering input to pngPath
+func spectrogramArgs(input, pngPath string, width, height int) []string {
+	return []string{
+		"-v", "error", "-nostdin",
+		"-i", input,
+		"-lavfi", fmt.Sprintf("showspectrumpic=s=%dx%d:mode=separate:legend=1", width, height),
+		"-frames:v", "1",
+		"-y", pngPath,
+	}
+}
+
+// renderSpectrogram writes the spectrogram of input to pngPath
+func renderSpectrogram(ctx context.Context, input, pngPath string, width, height int) (*Spectrogram, error) {
+	if !hasSpectrumFilter() {
+		return nil, errors.New("FFmpeg has no showspectrumpic filter")
+	}
+	cmd := ffmpegCommand(ctx, spectrogramArgs(input, pngPath, width, height)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("showspectrumpic failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	info, err := os.Stat(pngPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Spectrogram{Width: width, Height: height, Bytes: int(info.Size())}, nil
+}
+
+// inlineSpectrogram sets DataURL from the PNG at pngPath, refusing images
+// too large for the response
+func inlineSpectrogram(s *Spectrogram, pngPath string) error {
+	if s.Bytes > maxInlineSpectrogramBytes {
+		return fmt.Errorf("%d bytes is too large to return inline (limit %d); set spectrogram_url or reduce its size", s.Bytes, maxInlineSpectrogramBytes)
+	}
+	data, err := os.ReadFile(pngPath)
+	if err != nil {
+		return err
+	}
+	s.DataURL = "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+	return nil
+}
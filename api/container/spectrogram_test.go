@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateSpectrogram(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", GenerateSpectrogram: true}
+	if err := validateRequest(req); err != nil || req.SpectrogramWidth != defaultSpectrogramWidth || req.SpectrogramHeight != defaultSpectrogramHeight {
+		t.Errorf("defaults: err = %v, size = %dx%d", err, req.SpectrogramWidth, req.SpectrogramHeight)
+	}
+
+	for name, req := range map[string]*ConcatRequest{
+		"url without flag":  {Segments: segmentURLs("a"), OutputURL: "b", SpectrogramURL: "c"},
+		"too wide":          {Segments: segmentURLs("a"), OutputURL: "b", GenerateSpectrogram: true, SpectrogramWidth: 10000},
+		"too short":         {Segments: segmentURLs("a"), OutputURL: "b", GenerateSpectrogram: true, SpectrogramHeight: 10},
+		"with split output": {Segments: segmentURLs("a"), OutputURL: "b", GenerateSpectrogram: true, SplitDurationSeconds: 600},
+		"with hls output":   {Segments: segmentURLs("a"), OutputURL: "b", GenerateSpectrogram: true, OutputFormat: outputFormatHLS},
+	} {
+		if err := validateRequest(req); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestListsFilter(t *testing.T) {
+	filters := `Filters:
+  T.. = Timeline support
+  ---
+ ... showspectrum      A->V       Convert input audio to a spectrum video output.
+ ... showspectrumpic   A->V       Convert input audio to a spectrum video output single picture.
+`
+	if !listsFilter(filters, "showspectrumpic") {
+		t.Error("showspectrumpic not found")
+	}
+	if listsFilter(strings.ReplaceAll(filters, "showspectrumpic", "showwavespic"), "showspectrumpic") {
+		t.Error("showspectrumpic found by prefix")
+	}
+}
+
+func TestSpectrogramArgs(t *testing.T) {
+	args := strings.Join(spectrogramArgs("/work/out.mp3", "/work/spec.png", 800, 400), " ")
+	if !strings.Contains(args, "-i /work/out.mp3 -lavfi showspectrumpic=s=800x400:mode=separate:legend=1 -frames:v 1 -y /work/spec.png") {
+		t.Errorf("args = %s", args)
+	}
+}
+
+func TestInlineSpectrogram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spectrogram.png")
+	if err := os.WriteFile(path, []byte("\x89PNG"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Spectrogram{Width: 64, Height: 64, Bytes: 4}
+	if err := inlineSpectrogram(s, path); err != nil || s.DataURL != "data:image/png;base64,iVBORw==" {
+		t.Errorf("data URL = %q, %v", s.DataURL, err)
+	}
+
+	large := &Spectrogram{Bytes: maxInlineSpectrogramBytes + 1}
+	if err := inlineSpectrogram(large, path); err == nil || large.DataURL != "" {
+		t.Error("expected a large image to be refused inline")
+	}
+}
+
+// TestRenderSpectrogram renders a generated tone; it is skipped without
+// FFmpeg
+func TestRenderSpectrogram(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "tone.mp3")
+	if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=frequency=1000:duration=2",
+		"-c:a", "libmp3lame", "-y", input).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+	if !hasSpectrumFilter() {
+		t.Skip("FFmpeg has no showspectrumpic")
+	}
+
+	pngPath := filepath.Join(dir, "spectrogram.png")
+	s, err := renderSpectrogram(context.Background(), input, pngPath, 256, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(pngPath)
+	if err != nil || !strings.HasPrefix(string(data), "\x89PNG") || s.Bytes != len(data) {
+		t.Errorf("spectrogram = %+v, %d bytes read, %v", s, len(data), err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---------- Split Output ----------
+
+// partPlaceholder is replaced by the part index in OutputURLTemplate
+const partPlaceholder = "{part}"
+
+// minSplitDurationSeconds keeps split_duration_seconds from cutting the
+// output into a part per frame
+const minSplitDurationSeconds = 10
+
+// maxSplitParts caps how many parts one job may upload; the probed input
+// duration divided by split_duration_seconds must stay within it
+const maxSplitParts = 1000
+
+// splitPattern is the FFmpeg segment muxer output pattern inside the work dir
+const splitPattern = "part_%03d.mp3"
+
+// splitOutputArgs returns the FFmpeg output arguments that cut the encoded
+// stream into parts of at most seconds each using the segment muxer.
+// Timestamps are reset so every part starts at zero and reports its own duration.
+func splitOutputArgs(seconds float64, files jobFiles) []string {
+	return []string{
+		"-f", "segment",
+		"-segment_format", "mp3",
+		"-segment_time", formatFloat(seconds),
+		"-reset_timestamps", "1",
+		"-y", files.path(splitPattern),
+	}
+}
+
+// splitOutputFiles lists the parts written by the segment muxer in order
+func splitOutputFiles(files jobFiles) ([]string, error) {
+	parts, err := filepath.Glob(files.path("part_*.mp3"))
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("FFmpeg produced no parts")
+	}
+	// The segment muxer widens the index past 999, so compare numbers
+	// rather than names
+	index := make(map[string]int, len(parts))
+	for _, p := range parts {
+		name := filepath.Base(p)
+		n, err := strconv.Atoi(strings.TrimSuffix(name[strings.LastIndex(name, "part_")+len("part_"):], ".mp3"))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected part name %s", filepath.Base(p))
+		}
+		index[p] = n
+	}
+	sort.Slice(parts, func(i, j int) bool { return index[parts[i]] < index[parts[j]] })
+	return parts, nil
+}
+
+// checkSplitParts rejects a split that would cut inputs (in seconds, before
+// speed is applied) into more than maxSplitParts parts
+func checkSplitParts(inputs []float64, speed, seconds float64) error {
+	var total float64
+	for _, d := range inputs {
+		total += d
+	}
+	if speed > 0 {
+		total /= speed
+	}
+	if parts := math.Ceil(total / seconds); parts > maxSplitParts {
+		return fmt.Errorf("%.0fs of audio split every %gs makes %.0f parts, more than %d", total, seconds, parts, maxSplitParts)
+	}
+	return nil
+}
+
+// partURL resolves the upload URL for part index from template
+func partURL(template string, index int) string {
+	return strings.ReplaceAll(template, partPlaceholder, fmt.Sprintf("%03d", index))
+}
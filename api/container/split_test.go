@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartURL(t *testing.T) {
+	got := partURL("https://r2.example/ep/ep_{part}.mp3?sig=abc", 7)
+	want := "https://r2.example/ep/ep_007.mp3?sig=abc"
+	if got != want {
+		t.Errorf("partURL = %q, want %q", got, want)
+	}
+}
+
+func TestSplitOutputFilesOrdered(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"part_010.mp3", "part_002.mp3", "part_000.mp3", "list.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := splitOutputFiles(jobFiles{dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"part_000.mp3", "part_002.mp3", "part_010.mp3"}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(files), len(want))
+	}
+	for i, f := range files {
+		if filepath.Base(f) != want[i] {
+			t.Errorf("files[%d] = %s, want %s", i, filepath.Base(f), want[i])
+		}
+	}
+}
+
+func TestSplitOutputFilesEmpty(t *testing.T) {
+	if _, err := splitOutputFiles(jobFiles{dir: t.TempDir()}); err == nil {
+		t.Error("expected error when no parts were produced")
+	}
+}
+
+func TestSplitOutputFilesPastThreeDigits(t *testing.T) {
+	dir := t.TempDir()
+	// The segment muxer writes part_1000.mp3 after part_999.mp3
+	for _, name := range []string{"part_1000.mp3", "part_999.mp3", "part_998.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := splitOutputFiles(jobFiles{dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"part_998.mp3", "part_999.mp3", "part_1000.mp3"}
+	for i, f := range files {
+		if filepath.Base(f) != want[i] {
+			t.Errorf("files[%d] = %s, want %s", i, filepath.Base(f), want[i])
+		}
+	}
+}
+
+func TestCheckSplitParts(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []float64
+		speed   float64
+		seconds float64
+		ok      bool
+	}{
+		{"at the cap", []float64{5000, 5000}, 1, 10, true},
+		{"one part over", []float64{5000, 5001}, 1, 10, false},
+		{"speed shortens the output", []float64{15000}, 1.5, 10, true},
+		{"long parts", []float64{36000}, 0, 600, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSplitParts(tt.inputs, tt.speed, tt.seconds)
+			if (err == nil) != tt.ok {
+				t.Errorf("err = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateSplitDuration(t *testing.T) {
+	for seconds, ok := range map[float64]bool{minSplitDurationSeconds: true, 600: true, 1: false, minSplitDurationSeconds - 0.5: false} {
+		req := ConcatRequest{Segments: segmentURLs("a"), OutputURLTemplate: "https://r2/ep_{part}.mp3", SplitDurationSeconds: seconds}
+		err := validateRequest(&req)
+		if (err == nil) != ok {
+			t.Errorf("split_duration_seconds %g: err = %v, want ok = %v", seconds, err, ok)
+		}
+		if err != nil && !strings.Contains(err.Error(), "split_duration_seconds") {
+			t.Errorf("split_duration_seconds %g: err = %v", seconds, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// ---------- Stream Copy ----------
+//
+// Re-encoding is the expensive part of a job, and for some sources it buys
+// nothing: the segments are already MP3 at the output sample rate, mastered
+// to a consistent level upstream. With encode_mode "auto" such a job is
+// joined with -c:a copy instead, which runs at disk speed and adds no
+// generation loss.
+//
+// Copying means no filter can run, loudnorm included, so auto only copies
+// when nothing in the request asks for a filter and every input qualifies.
+// Anything else falls back to the normal re-encode; auto never fails a job
+// that reencode would have run. Mixing copied and re-encoded inputs in one
+// output isn't attempted: MP3 frames from two encoders can be byte-joined,
+// but the loudness of the copied parts would then differ from the
+// normalized ones, which defeats the point of normalizing any of them.
+
+const (
+	encodeReencode = "reencode"
+	encodeAuto     = "auto"
+)
+
+// validateEncodeMode fills the default mode and rejects unknown ones
+func validateEncodeMode(req *ConcatRequest) error {
+	switch req.EncodeMode {
+	case "":
+		req.EncodeMode = encodeReencode
+	case encodeReencode, encodeAuto:
+	default:
+		return fmt.Errorf("encode_mode must be %q or %q", encodeReencode, encodeAuto)
+	}
+	return nil
+}
+
+// explicitEncoderOption returns the first encoder setting req asks for, or
+// "". It must see the request before validation fills the defaults, which
+// are indistinguishable from the same values sent explicitly.
+func explicitEncoderOption(req ConcatRequest) string {
+	switch {
+	case req.AutoBitrate:
+		return "auto_bitrate"
+	case req.BitrateMode == bitrateVBR:
+		return "bitrate_mode"
+	case req.BitrateKbps != 0:
+		return "bitrate_kbps"
+	case req.LoudnessProfile != "":
+		return "loudness_profile"
+	}
+	return ""
+}
+
+// streamCopyBlocker returns the request option that needs a decode, or ""
+func streamCopyBlocker(req ConcatRequest) string {
+	switch {
+	case req.OutputFormat == outputFormatHLS:
+		return "HLS output is AAC"
+	case req.SpeedFactor != 0 && req.SpeedFactor != 1:
+		return "speed_factor is set"
+	case req.GainDB != 0 || hasSegmentGain(req.Segments):
+		return "gain_db is set"
+	case req.NoiseGate != nil:
+		return "noise_gate is set"
+	case len(req.EQBands) > 0:
+		return "eq_bands is set"
+	case req.CustomAudioFilter != "":
+		return "custom_audio_filter is set"
+	case req.Loudness != nil:
+		return "an explicit loudness target is set"
+	case req.encoderOption != "":
+		// A copy keeps the sources' bitrate and level, so these would be
+		// silently ignored
+		return req.encoderOption + " is set"
+	case req.SampleFormat != "":
+		return "sample_format is set"
+	case req.ChannelLayout != "":
+		return "channel_layout is set"
+	case req.AutoMono:
+		return "auto_mono is set"
+	case hasPreamble(req) || req.AppendToURL != "":
+		return "the inputs are joined in the concat filter"
+	}
+	for i, s := range req.Segments {
+		if s.trimmed() {
+			// Copy can only cut on frame boundaries
+			return fmt.Sprintf("segment %d is trimmed", i)
+		}
+	}
+	return ""
+}
+
+// inputsCopyBlocker returns why inputs with these streams can't be copied
+// into the output, or ""
+func inputsCopyBlocker(names []string, streams []audioStreamInfo) string {
+	if mismatch := demuxerMismatch(names, streams); mismatch != "" {
+		return mismatch
+	}
+	// The rate encoderArgs would resample to
+	if rate := streams[0].SampleRate; rate != "44100" {
+		return fmt.Sprintf("inputs are %s Hz, output is 44100 Hz", rate)
+	}
+	return ""
+}
+
+// chooseStreamCopy decides whether an encode_mode "auto" job can copy.
+// streams are the input formats when the demuxer check already probed
+// them; otherwise the inputs are probed here. It returns the reason when
+// the job has to be re-encoded.
+func chooseStreamCopy(ctx context.Context, req ConcatRequest, method string, inputs []concatInput, streams []audioStreamInfo) (bool, string) {
+	if reason := streamCopyBlocker(req); reason != "" {
+		return false, reason
+	}
+	if method == concatFilter {
+		return false, "the inputs are joined in the concat filter"
+	}
+	if !ffprobeAvailable.Load() {
+		return false, "inputs can't be checked without ffprobe"
+	}
+
+	names := make([]string, len(inputs))
+	for i, in := range inputs {
+		names[i] = filepath.Base(in.Path)
+	}
+	if streams == nil {
+		var err error
+		if _, streams, err = checkDemuxerInputs(ctx, inputs); err != nil {
+			return false, fmt.Sprintf("input probe failed: %v", err)
+		}
+	}
+	if reason := inputsCopyBlocker(names, streams); reason != "" {
+		return false, reason
+	}
+	return true, ""
+}
+
+// streamCopyArgs replaces encoderArgs when copying
+func streamCopyArgs() []string {
+	return []string{"-c:a", "copy"}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateEncodeMode(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b"}
+	if err := validateRequest(req); err != nil || req.EncodeMode != encodeReencode {
+		t.Errorf("default: err = %v, EncodeMode = %q", err, req.EncodeMode)
+	}
+	req = &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", EncodeMode: "copy"}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected error for unknown encode_mode")
+	}
+}
+
+func TestStreamCopyBlocker(t *testing.T) {
+	if got := streamCopyBlocker(ConcatRequest{Segments: segmentURLs("a", "b"), SpeedFactor: 1}); got != "" {
+		t.Errorf("plain request blocked: %q", got)
+	}
+	for name, req := range map[string]ConcatRequest{
+		"speed":   {SpeedFactor: 1.2},
+		"gain":    {Segments: []Segment{{URL: "a", GainDB: 2}}},
+		"gate":    {NoiseGate: &NoiseGate{}},
+		"filter":  {CustomAudioFilter: "acompressor"},
+		"hls":     {OutputFormat: outputFormatHLS},
+		"trimmed": {Segments: []Segment{{URL: "a", Start: 3}}},
+		"append":  {AppendToURL: "c"},
+	} {
+		if streamCopyBlocker(req) == "" {
+			t.Errorf("%s: expected a blocker", name)
+		}
+	}
+}
+
+func TestStreamCopyBlockerEncoderOptions(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config = loadConfig()
+
+	plain := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", EncodeMode: encodeAuto}
+	if err := validateRequest(plain); err != nil || streamCopyBlocker(*plain) != "" {
+		t.Errorf("defaults alone blocked the copy: err = %v, blocker = %q", err, streamCopyBlocker(*plain))
+	}
+
+	quality := 2
+	for option, req := range map[string]*ConcatRequest{
+		"bitrate_kbps":     {BitrateKbps: 128},
+		"bitrate_mode":     {BitrateMode: bitrateVBR, VBRQuality: &quality},
+		"auto_bitrate":     {AutoBitrate: true},
+		"loudness_profile": {LoudnessProfile: defaultLoudnessProfile},
+	} {
+		req.Segments, req.OutputURL, req.EncodeMode = segmentURLs("a"), "b", encodeAuto
+		if err := validateRequest(req); err != nil {
+			t.Fatalf("%s: %v", option, err)
+		}
+		// auto_bitrate's decision lands in bitrate_kbps before the copy check
+		if req.AutoBitrate {
+			req.BitrateKbps = 96
+		}
+		if got := streamCopyBlocker(*req); got != option+" is set" {
+			t.Errorf("%s: blocker = %q", option, got)
+		}
+	}
+}
+
+func TestInputsCopyBlocker(t *testing.T) {
+	names := []string{"a.mp3", "b.mp3"}
+	mp3 := audioStreamInfo{Codec: "mp3", SampleRate: "44100", Channels: "2"}
+	if got := inputsCopyBlocker(names, []audioStreamInfo{mp3, mp3}); got != "" {
+		t.Errorf("matching inputs blocked: %q", got)
+	}
+
+	lowRate := audioStreamInfo{Codec: "mp3", SampleRate: "22050", Channels: "2"}
+	if got := inputsCopyBlocker(names, []audioStreamInfo{lowRate, lowRate}); got == "" {
+		t.Error("22050 Hz inputs should need a resample")
+	}
+	if got := inputsCopyBlocker(names, []audioStreamInfo{mp3, lowRate}); got == "" {
+		t.Error("mixed inputs should be blocked")
+	}
+}
+
+func TestStreamCopyArgs(t *testing.T) {
+	got := concatInputArgs(concatDemuxer, "list.txt", nil, "", false)
+	want := []string{"-f", "concat", "-safe", "0", "-i", "list.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("demuxer args without a filter = %v, want %v", got, want)
+	}
+}
+
+// TestChooseStreamCopy probes real MP3 inputs; it is skipped without FFmpeg
+func TestChooseStreamCopy(t *testing.T) {
+	for _, bin := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not installed", bin)
+		}
+	}
+	defer func(available bool) { ffprobeAvailable.Store(available) }(ffprobeAvailable.Load())
+	ffprobeAvailable.Store(true)
+
+	dir := t.TempDir()
+	var inputs []concatInput
+	for i, rate := range []string{"44100", "44100", "22050"} {
+		path := filepath.Join(dir, "segment_"+rate+"_"+string(rune('a'+i))+".mp3")
+		if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=frequency=440:duration=1",
+			"-c:a", "libmp3lame", "-ar", rate, "-y", path).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg: %v: %s", err, out)
+		}
+		inputs = append(inputs, concatInput{Path: path})
+	}
+
+	req := ConcatRequest{Segments: segmentURLs("a", "b"), EncodeMode: encodeAuto, SpeedFactor: 1}
+	if ok, reason := chooseStreamCopy(context.Background(), req, concatDemuxer, inputs[:2], nil); !ok {
+		t.Errorf("matching MP3s not copied: %s", reason)
+	}
+	if ok, _ := chooseStreamCopy(context.Background(), req, concatDemuxer, inputs, nil); ok {
+		t.Error("mixed sample rates copied")
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---------- Streaming Upload ----------
+//
+// For long episodes the upload is a large share of the job, and it used to
+// start only after the encode had finished. With stream_upload the output is
+// PUT as FFmpeg writes it: the request body tails output.mp3.part with
+// chunked transfer encoding, since the final size isn't known, so encode
+// and upload overlap.
+//
+// The body is held open until the job has finished with the output. Only
+// when the encode succeeded and every post-encode check passed does the
+// body end, and only if the bytes sent match the final file: the MP3 muxer
+// writes its Xing header at the end (stream_upload turns it off), and a
+// tag remux rewrites the file in place. On any mismatch, failure, or
+// rejection the body is aborted mid-stream, so the target never completes
+// the object, and the output is uploaded the regular way after the encode.
+// That is also the fallback for targets that don't accept chunked PUTs
+// (presigned S3 URLs answer 501), so the flag only helps when the storage
+// target supports streaming uploads. Some targets drop a request whose body
+// stalls, which can happen during long post-encode checks such as waveform
+// generation; that falls back the same way.
+//
+// Streaming covers a single output_url written with PUT; split, HLS, hash
+// naming, output_urls and upload_method "post" are rejected.
+
+// streamPollInterval is how often the body looks for new output bytes
+var streamPollInterval = 100 * time.Millisecond
+
+// errStreamAborted ends a streamed body without completing the upload
+var errStreamAborted = errors.New("streaming upload aborted")
+
+// validateStreamUpload checks that stream_upload has a single PUT target
+func validateStreamUpload(req *ConcatRequest, hls, hashNaming bool) error {
+	if !req.StreamUpload {
+		return nil
+	}
+	switch {
+	case req.SplitDurationSeconds > 0:
+		return errors.New("stream_upload is not supported with split output")
+	case hls:
+		return errors.New("stream_upload is not supported with HLS output")
+	case hashNaming:
+		return fmt.Errorf("stream_upload is not supported with output_naming %q", outputNamingHash)
+	case len(req.OutputURLs) > 0:
+		return errors.New("stream_upload is not supported with output_urls")
+	case req.UploadMethod == uploadMethodPost:
+		return fmt.Errorf("stream_upload is not supported with upload_method %q", uploadMethodPost)
+	}
+	return nil
+}
+
+// streamUploadArgs keeps the MP3 muxer from seeking back to fill in its
+// Xing header, which would change bytes already sent
+func streamUploadArgs() []string {
+	return []string{"-write_xing", "0"}
+}
+
+// streamUpload is one output PUT while FFmpeg is still writing it
+type streamUpload struct {
+	body   *tailReader
+	cancel context.CancelFunc
+	done   chan struct{} // Closed once the PUT has returned
+	err    error
+	once   sync.Once
+}
+
+// startStreamUpload begins PUTting path+".part" to url. The body waits for
+// finish or abort before it ends.
+func startStreamUpload(ctx context.Context, path, url, contentType string) *streamUpload {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &streamUpload{
+		body: &tailReader{
+			ctx:    ctx,
+			path:   path + partialSuffix,
+			hash:   sha256.New(),
+			sealed: make(chan struct{}),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		release, err := acquireUploadSlot(ctx)
+		if err != nil {
+			s.err = err
+			return
+		}
+		defer release()
+		s.err = putStream(ctx, s.body, url, contentType)
+	}()
+	return s
+}
+
+// finish ends the body once it has sent all of the final file at path, and
+// returns the PUT's result. The upload fails instead of completing if the
+// bytes sent don't match the file.
+func (s *streamUpload) finish(path string) error {
+	digest, err := fileSHA256(path)
+	if err != nil {
+		s.abort()
+		return err
+	}
+	s.seal(path, digest)
+	<-s.done
+	return s.err
+}
+
+// abort stops the upload without completing it; it is a no-op after finish
+func (s *streamUpload) abort() {
+	s.seal("", "")
+	s.cancel()
+	<-s.done
+}
+
+// seal tells the body how to end: with the digest of the final file, or
+// with an abort when digest is empty
+func (s *streamUpload) seal(path, digest string) {
+	s.once.Do(func() {
+		s.body.finalPath, s.body.digest = path, digest
+		close(s.body.sealed)
+	})
+}
+
+// putStream sends body as a chunked PUT
+func putStream(ctx context.Context, body io.ReadCloser, url, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, body)
+	if err != nil {
+		body.Close()
+		return fmt.Errorf("create request failed: %w", err)
+	}
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return networkError("streaming PUT failed", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return statusError("PUT", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// tailReader reads a file that is still being written, ending only once it
+// is sealed and everything sent matches the final file
+type tailReader struct {
+	ctx    context.Context
+	path   string // The .part file FFmpeg writes
+	hash   hash.Hash
+	sealed chan struct{}
+	// Set before sealed is closed; an empty digest aborts the body
+	finalPath string
+	digest    string
+
+	mu   sync.Mutex // Guards file, which the transport may Close from another goroutine
+	file *os.File
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		f, err := t.open()
+		if err != nil {
+			return 0, err
+		}
+		if f != nil {
+			n, err := f.Read(p)
+			if n > 0 {
+				t.hash.Write(p[:n])
+				return n, nil
+			}
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+		}
+
+		// Caught up with FFmpeg: end the body if the job is done with the
+		// output, else wait for more
+		select {
+		case <-t.sealed:
+			if f == nil {
+				continue // Sealed before the .part file was ever opened
+			}
+			if t.digest == "" {
+				return 0, errStreamAborted
+			}
+			if got := hex.EncodeToString(t.hash.Sum(nil)); got != t.digest {
+				return 0, fmt.Errorf("%w: output changed after it was sent", errStreamAborted)
+			}
+			return 0, io.EOF
+		default:
+		}
+		select {
+		case <-t.sealed:
+		case <-t.ctx.Done():
+			return 0, t.ctx.Err()
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+// open returns the file being sent, opening it on first use: the .part file
+// while FFmpeg writes it, or the final file when sealed first, since the
+// .part file is renamed away after the encode. It returns nil while the
+// .part file doesn't exist yet.
+func (t *tailReader) open() (*os.File, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil {
+		return t.file, nil
+	}
+	select {
+	case <-t.sealed:
+		if t.digest == "" {
+			return nil, errStreamAborted
+		}
+		f, err := os.Open(t.finalPath)
+		t.file = f
+		return f, err
+	default:
+	}
+	f, err := os.Open(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	t.file = f
+	return f, err
+}
+
+// Close releases the file; the HTTP transport calls it when the PUT is done
+func (t *tailReader) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// streamTarget is a PUT target that stores only completed bodies
+type streamTarget struct {
+	mu        sync.Mutex
+	stored    map[string]string
+	firstByte chan struct{} // Closed when the first body byte arrives
+	once      sync.Once
+}
+
+func newStreamTarget() *streamTarget {
+	return &streamTarget{stored: map[string]string{}, firstByte: make(chan struct{})}
+}
+
+func (s *streamTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/no-chunked" {
+		http.Error(w, "chunked uploads not implemented", http.StatusNotImplemented)
+		return
+	}
+	var body []byte
+	buf := make([]byte, 4)
+	for {
+		n, err := r.Body.Read(buf)
+		if n > 0 {
+			s.once.Do(func() { close(s.firstByte) })
+			body = append(body, buf[:n]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return // Incomplete body: nothing is stored
+		}
+	}
+	s.mu.Lock()
+	s.stored[r.URL.Path] = string(body)
+	s.mu.Unlock()
+}
+
+func (s *streamTarget) object(path string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.stored[path]
+	return body, ok
+}
+
+func TestStreamUploadOverlapsEncode(t *testing.T) {
+	defer func(d time.Duration) { streamPollInterval = d }(streamPollInterval)
+	streamPollInterval = 5 * time.Millisecond
+	target := newStreamTarget()
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "output.mp3")
+	stream := startStreamUpload(context.Background(), outputPath, server.URL+"/episode.mp3", "audio/mpeg")
+	defer stream.abort()
+
+	// The target sees the first bytes before the encode has finished
+	part, err := os.Create(outputPath + partialSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.WriteString("ID3 first frames ")
+	select {
+	case <-target.firstByte:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no bytes sent while the output was being written")
+	}
+	if _, ok := target.object("/episode.mp3"); ok {
+		t.Fatal("object completed before the encode finished")
+	}
+	part.WriteString("last frames")
+	part.Close()
+	if err := commitPartialOutput(outputPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.finish(outputPath); err != nil {
+		t.Fatalf("finish = %v", err)
+	}
+	if got, _ := target.object("/episode.mp3"); got != "ID3 first frames last frames" {
+		t.Errorf("stored %q", got)
+	}
+}
+
+func TestStreamUploadNeverCompletes(t *testing.T) {
+	defer func(d time.Duration) { streamPollInterval = d }(streamPollInterval)
+	streamPollInterval = 5 * time.Millisecond
+	target := newStreamTarget()
+	server := httptest.NewServer(target)
+	defer server.Close()
+	dir := t.TempDir()
+
+	// A failed job aborts the body mid-stream
+	outputPath := filepath.Join(dir, "failed.mp3")
+	os.WriteFile(outputPath+partialSuffix, []byte("half an encode"), 0644)
+	stream := startStreamUpload(context.Background(), outputPath, server.URL+"/failed.mp3", "audio/mpeg")
+	<-target.firstByte
+	stream.abort()
+	if _, ok := target.object("/failed.mp3"); ok {
+		t.Error("aborted upload was stored")
+	}
+
+	// Bytes rewritten after they were sent fail finish instead of completing
+	outputPath = filepath.Join(dir, "remuxed.mp3")
+	os.WriteFile(outputPath+partialSuffix, []byte("stale xing header"), 0644)
+	stream = startStreamUpload(context.Background(), outputPath, server.URL+"/remuxed.mp3", "audio/mpeg")
+	time.Sleep(50 * time.Millisecond)
+	os.Remove(outputPath + partialSuffix)
+	os.WriteFile(outputPath, []byte("fresh xing header"), 0644)
+	if err := stream.finish(outputPath); err == nil {
+		t.Error("finish succeeded after the output changed")
+	}
+	if _, ok := target.object("/remuxed.mp3"); ok {
+		t.Error("changed output was stored")
+	}
+
+	// A target that rejects chunked uploads is reported for the fallback
+	outputPath = filepath.Join(dir, "rejected.mp3")
+	os.WriteFile(outputPath, []byte("whole output"), 0644)
+	stream = startStreamUpload(context.Background(), outputPath, server.URL+"/no-chunked", "audio/mpeg")
+	var transferErr *TransferError
+	if err := stream.finish(outputPath); !errors.As(err, &transferErr) || transferErr.StatusCode != http.StatusNotImplemented {
+		t.Errorf("finish = %v, want a 501", err)
+	}
+}
+
+func TestValidateStreamUpload(t *testing.T) {
+	valid := ConcatRequest{Segments: segmentURLs("a"), OutputURL: "https://bucket/out.mp3", StreamUpload: true}
+	if err := validateRequest(&valid); err != nil {
+		t.Errorf("single PUT output: %v", err)
+	}
+
+	for name, req := range map[string]ConcatRequest{
+		"split":       {Segments: segmentURLs("a"), OutputURLTemplate: "https://bucket/part-{part}.mp3", SplitDurationSeconds: 600, StreamUpload: true},
+		"output_urls": {Segments: segmentURLs("a"), OutputURLs: []string{"https://a/out.mp3", "https://b/out.mp3"}, StreamUpload: true},
+		"post":        {Segments: segmentURLs("a"), OutputURL: "https://bucket/", UploadMethod: uploadMethodPost, StreamUpload: true},
+		"hash naming": {Segments: segmentURLs("a"), OutputURLTemplate: "https://bucket/{sha256}.mp3", OutputNaming: outputNamingHash, StreamUpload: true},
+		"hls":         {Segments: segmentURLs("a"), OutputURLTemplate: "https://bucket/{file}", OutputFormat: outputFormatHLS, StreamUpload: true},
+	} {
+		plain := req
+		plain.StreamUpload = false
+		if err := validateRequest(&plain); err != nil {
+			t.Fatalf("%s without stream_upload: %v", name, err)
+		}
+		if err := validateRequest(&req); err == nil {
+			t.Errorf("%s: expected stream_upload to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ---------- Orphaned Work Dir Sweep ----------
+//
+// Jobs remove their concat-* dir on return, but an OOM kill or SIGKILL skips
+// the deferred cleanup. On a persistent volume those dirs survive restarts
+// and accumulate, so startup removes any that are older than the threshold.
+// The age check keeps a sweep from touching dirs of another instance that
+// shares the volume and is still running.
+
+// sweepWorkDirs removes concat-* dirs in root last modified more than maxAge
+// ago and returns how many it removed
+func sweepWorkDirs(root string, maxAge time.Duration, now time.Time) int {
+	dirs, _ := filepath.Glob(filepath.Join(root, "concat-*"))
+	removed := 0
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		age := now.Sub(info.ModTime())
+		if age < maxAge {
+			continue
+		}
+		size := workDirUsage(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("Warning: failed to remove orphaned work dir %s: %v\n", dir, err)
+			continue
+		}
+		fmt.Printf("Removed orphaned work dir %s (age %s, %d bytes)\n", dir, age.Round(time.Second), size)
+		removed++
+	}
+	return removed
+}
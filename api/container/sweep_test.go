@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweepWorkDirs(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+
+	mkdir := func(name string, age time.Duration) string {
+		dir := filepath.Join(root, name)
+		os.Mkdir(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "segment_0000.mp3"), []byte("audio"), 0644)
+		os.Chtimes(dir, now.Add(-age), now.Add(-age))
+		return dir
+	}
+	stale := mkdir("concat-stale", 2*time.Hour)
+	fresh := mkdir("concat-fresh", time.Minute)
+	other := mkdir("unrelated", 2*time.Hour)
+
+	if n := sweepWorkDirs(root, time.Hour, now); n != 1 {
+		t.Errorf("removed = %d, want 1", n)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale work dir was not removed")
+	}
+	for _, dir := range []string{fresh, other} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s should be kept: %v", filepath.Base(dir), err)
+		}
+	}
+}
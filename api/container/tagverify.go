@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ---------- Tag Verification ----------
+//
+// Tags are written by the encode itself, but an output that ships untagged
+// is only noticed once it's in a feed. After the encode each MP3 output is
+// read back with ffprobe and compared with the requested metadata. If tags
+// are missing or altered, a metadata-only remux (-c copy, so no re-encode)
+// rewrites them and the file is checked again. Tags that still don't read
+// back become a warning; the audio itself is fine, so the job succeeds.
+//
+// This runs before hash naming and upload, since a remux changes the bytes.
+// The tags finally read back from the first file are returned to the client
+// as written_metadata, so it can diff them against what it asked for. All
+// files of a split output carry the same tags.
+
+// expectedTags returns the tags metadataArgs writes, keyed in lower case
+// the way ffprobe is compared
+func expectedTags(m ConcatMetadata) map[string]string {
+	args := metadataArgs(m)
+	tags := make(map[string]string, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		key, value, _ := strings.Cut(args[i], "=")
+		tags[strings.ToLower(key)] = value
+	}
+	return tags
+}
+
+// probeTags reads the container tags of path, keyed in lower case
+func probeTags(ctx context.Context, path string) (map[string]string, error) {
+	output, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format_tags", "-of", "json", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	var probe struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+	tags := make(map[string]string, len(probe.Format.Tags))
+	for k, v := range probe.Format.Tags {
+		tags[strings.ToLower(k)] = v
+	}
+	return tags, nil
+}
+
+// missingTags lists the expected tags that got lacks or holds a different
+// value for, sorted
+func missingTags(expected, got map[string]string) []string {
+	var missing []string
+	for key, want := range expected {
+		if got[key] != want {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// remuxMetadata rewrites path's tags without re-encoding
+func remuxMetadata(ctx context.Context, path string, m ConcatMetadata, id3Version int, deterministic bool) error {
+	tmp := path + ".tags"
+	args := []string{"-v", "error", "-i", path, "-map", "0", "-c", "copy", "-map_metadata", "-1"}
+	args = append(args, metadataArgs(m)...)
+	if deterministic {
+		args = append(args, deterministicArgs()...)
+	}
+	args = append(args, id3Args(id3Version, false)...)
+	args = append(args, "-f", "mp3", "-y", tmp)
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("remux failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(tmp, path)
+}
+
+// ensureMetadata verifies the tags of every output file, remuxing files
+// whose tags didn't survive. It returns the tags read back from the first
+// file and warnings for files it couldn't fix.
+func ensureMetadata(ctx context.Context, req ConcatRequest, paths []string) (map[string]string, []string) {
+	expected := expectedTags(req.Metadata)
+	var written map[string]string
+	var warnings []string
+	for i, path := range paths {
+		name := filepath.Base(path)
+		got, err := probeTags(ctx, path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("tag check skipped for %s: %v", name, err))
+			continue
+		}
+		if i == 0 {
+			written = got
+		}
+		missing := missingTags(expected, got)
+		if len(missing) == 0 {
+			continue
+		}
+
+		fmt.Printf("[%s] %s is missing tags %v; remuxing metadata\n", req.EpisodeID, name, missing)
+		if err := remuxMetadata(ctx, path, req.Metadata, req.ID3Version, req.Deterministic); err != nil {
+			warnings = append(warnings, fmt.Sprintf("metadata could not be applied to %s: %v", name, err))
+			continue
+		}
+		if got, err = probeTags(ctx, path); err == nil {
+			missing = missingTags(expected, got)
+			if i == 0 {
+				written = got
+			}
+		}
+		if err != nil || len(missing) > 0 {
+			warnings = append(warnings, fmt.Sprintf("metadata could not be applied to %s: tags %v missing after remux", name, missing))
+		}
+	}
+	return written, warnings
+}
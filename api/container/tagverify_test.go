@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpectedTags(t *testing.T) {
+	clean := false
+	got := expectedTags(ConcatMetadata{Title: "Ep 3", Season: 2, Explicit: &clean})
+	want := map[string]string{"title": "Ep 3", "disc": "2", "itunesseason": "2", "itunesadvisory": "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expectedTags = %v, want %v", got, want)
+	}
+	if got := expectedTags(ConcatMetadata{}); len(got) != 0 {
+		t.Errorf("empty metadata = %v", got)
+	}
+}
+
+func TestMissingTags(t *testing.T) {
+	expected := map[string]string{"title": "Ep 3", "artist": "Host", "track": "3"}
+	got := map[string]string{"title": "Ep 3", "track": "3/10", "encoder": "Lavf"}
+	if missing := missingTags(expected, got); !reflect.DeepEqual(missing, []string{"artist", "track"}) {
+		t.Errorf("missingTags = %v", missing)
+	}
+}
+
+// TestEnsureMetadataRemux strips an output's tags and checks they are
+// restored; it is skipped without FFmpeg
+func TestEnsureMetadataRemux(t *testing.T) {
+	requireFFmpegTools(t)
+	path := filepath.Join(t.TempDir(), "output.mp3")
+	if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=duration=1",
+		"-c:a", "libmp3lame", "-map_metadata", "-1", "-y", path).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+
+	req := ConcatRequest{EpisodeID: "ep-tags", ID3Version: 4, Metadata: ConcatMetadata{Title: "Ep 9", Artist: "Host", Episode: 9}}
+	written, warnings := ensureMetadata(context.Background(), req, []string{path})
+	if len(warnings) != 0 {
+		t.Fatalf("warnings = %v", warnings)
+	}
+	got, err := probeTags(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing := missingTags(expectedTags(req.Metadata), got); len(missing) != 0 {
+		t.Errorf("tags still missing after remux: %v (got %v)", missing, got)
+	}
+	if !reflect.DeepEqual(written, got) {
+		t.Errorf("written = %v, want the remuxed file's tags %v", written, got)
+	}
+}
+
+// TestTagsSurvivePipeline runs a full /concat job and checks the uploaded
+// file's tags; it is skipped without FFmpeg
+func TestTagsSurvivePipeline(t *testing.T) {
+	requireFFmpegTools(t)
+	defer func(available bool) { ffprobeAvailable.Store(available) }(ffprobeAvailable.Load())
+	ffprobeAvailable.Store(true)
+
+	dir := t.TempDir()
+	segment := filepath.Join(dir, "segment.mp3")
+	if out, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=duration=2",
+		"-c:a", "libmp3lame", "-ar", "44100", "-y", segment).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+	segmentData, _ := os.ReadFile(segment)
+
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			uploaded, _ = io.ReadAll(r.Body)
+			return
+		}
+		w.Write(segmentData)
+	}))
+	defer server.Close()
+
+	explicit := true
+	for _, tt := range []struct {
+		name       string
+		id3Version int
+		metadata   ConcatMetadata
+	}{
+		{"ascii", 4, ConcatMetadata{Title: "Pipeline", Artist: "Host", Album: "Show", Genre: "Podcast", Season: 1, Episode: 4, Explicit: &explicit}},
+		{"unicode v2.4", 4, ConcatMetadata{Title: "第3話 – Café ☕", Artist: "Zoë Ångström"}},
+		{"unicode v2.3", 3, ConcatMetadata{Title: "第3話 – Café", Artist: "Zoë Ångström"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(ConcatRequest{
+				EpisodeID:  "ep-pipeline",
+				Segments:   segmentURLs(server.URL+"/a.mp3", server.URL+"/b.mp3"),
+				OutputURL:  server.URL + "/out.mp3",
+				Metadata:   tt.metadata,
+				ID3Version: tt.id3Version,
+			})
+			rec := httptest.NewRecorder()
+			handleConcat(rec, httptest.NewRequest(http.MethodPost, "/concat", bytes.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("code = %d: %s", rec.Code, rec.Body.String())
+			}
+
+			out := filepath.Join(dir, "uploaded.mp3")
+			os.WriteFile(out, uploaded, 0644)
+			got, err := probeTags(context.Background(), out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := expectedTags(tt.metadata)
+			if missing := missingTags(expected, got); len(missing) != 0 {
+				t.Errorf("uploaded output is missing tags %v (got %v)", missing, got)
+			}
+
+			// written_metadata reports what the client asked for, unmangled
+			var resp ConcatResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if mismatched := missingTags(expected, resp.WrittenMetadata); len(mismatched) != 0 {
+				t.Errorf("written_metadata differs from the request in %v: %v", mismatched, resp.WrittenMetadata)
+			}
+			if !reflect.DeepEqual(resp.WrittenMetadata, got) {
+				t.Errorf("written_metadata = %v, uploaded file has %v", resp.WrittenMetadata, got)
+			}
+		})
+	}
+}
+
+// requireFFmpegTools skips tests that need both FFmpeg binaries
+func requireFFmpegTools(t *testing.T) {
+	t.Helper()
+	for _, bin := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not installed", bin)
+		}
+	}
+}
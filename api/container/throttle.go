@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ---------- Download Throttling ----------
+//
+// MAX_DOWNLOAD_BPS caps how fast segment bodies are read so bursts of
+// downloads don't trip origin rate limits. With DOWNLOAD_THROTTLE_SCOPE
+// "connection" (default) each download gets the full rate; "aggregate"
+// shares one rate across every download in the process.
+
+const (
+	throttleConnection = "connection"
+	throttleAggregate  = "aggregate"
+)
+
+// throttleChunk bounds a single read so pacing stays smooth
+const throttleChunk = 32 * 1024
+
+// downloadLimiter is the shared limiter in aggregate scope, nil otherwise
+var downloadLimiter *rateLimiter
+
+// rateLimiter paces byte consumption to bps
+type rateLimiter struct {
+	mu   sync.Mutex
+	bps  int64
+	next time.Time // When the bytes consumed so far are paid for
+}
+
+func newRateLimiter(bps int64) *rateLimiter {
+	return &rateLimiter{bps: bps}
+}
+
+// take accounts for n bytes just read and returns how long to wait before
+// reading more. Idle time isn't banked, so there is no burst after a pause.
+func (l *rateLimiter) take(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bps))
+	return l.next.Sub(now)
+}
+
+// throttledReader delays reads so they average no more than the limiter's
+// rate. A wait ends early with ctx's error once the job is done.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+	chunk   int
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.chunk {
+		p = p[:t.chunk]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		timer := time.NewTimer(t.limiter.take(n))
+		defer timer.Stop()
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
+
+// setupDownloadThrottle validates the throttle config at startup
+func setupDownloadThrottle() {
+	if config.MaxDownloadBPS <= 0 {
+		return
+	}
+	switch config.DownloadThrottleScope {
+	case throttleConnection:
+	case throttleAggregate:
+		downloadLimiter = newRateLimiter(config.MaxDownloadBPS)
+	default:
+		fmt.Printf("Warning: unknown DOWNLOAD_THROTTLE_SCOPE=%q, using %q\n", config.DownloadThrottleScope, throttleConnection)
+		config.DownloadThrottleScope = throttleConnection
+	}
+}
+
+// throttleDownload wraps a response body in the configured rate limit
+func throttleDownload(ctx context.Context, r io.Reader) io.Reader {
+	if config.MaxDownloadBPS <= 0 {
+		return r
+	}
+	limiter := downloadLimiter
+	if limiter == nil {
+		limiter = newRateLimiter(config.MaxDownloadBPS)
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: limiter, chunk: int(min(throttleChunk, max(config.MaxDownloadBPS, 1)))}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottledReaderRate(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxDownloadBPS = 1 << 20 // 1 MiB/s
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, throttleDownload(context.Background(), bytes.NewReader(make([]byte, 200*1024))))
+	elapsed := time.Since(start)
+	if err != nil || n != 200*1024 {
+		t.Fatalf("copied %d bytes, err %v", n, err)
+	}
+	// 200 KiB at 1 MiB/s is ~195ms
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("elapsed %v, want throttled to ~195ms", elapsed)
+	}
+}
+
+func TestThrottleScope(t *testing.T) {
+	defer func(c Config, l *rateLimiter) { config, downloadLimiter = c, l }(config, downloadLimiter)
+	config.MaxDownloadBPS = 1 << 20
+
+	// Two concurrent 100 KiB downloads: ~98ms each per connection, ~195ms
+	// together when the rate is shared
+	run := func() time.Duration {
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				io.Copy(io.Discard, throttleDownload(context.Background(), bytes.NewReader(make([]byte, 100*1024))))
+			}()
+		}
+		wg.Wait()
+		return time.Since(start)
+	}
+
+	config.DownloadThrottleScope = throttleAggregate
+	setupDownloadThrottle()
+	if d := run(); d < 150*time.Millisecond {
+		t.Errorf("aggregate: elapsed %v, want ~195ms", d)
+	}
+
+	downloadLimiter = nil
+	config.DownloadThrottleScope = "bogus"
+	setupDownloadThrottle()
+	if config.DownloadThrottleScope != throttleConnection || downloadLimiter != nil {
+		t.Errorf("scope = %q, want fallback to %q", config.DownloadThrottleScope, throttleConnection)
+	}
+	if d := run(); d > 180*time.Millisecond {
+		t.Errorf("per connection: elapsed %v, want ~98ms", d)
+	}
+}
+
+func TestThrottleDisabled(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxDownloadBPS = 0
+	r := bytes.NewReader(nil)
+	if throttleDownload(context.Background(), r) != io.Reader(r) {
+		t.Error("expected the reader unchanged when unlimited")
+	}
+}
+
+func TestThrottledReaderCancelled(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.MaxDownloadBPS = 1024 // 1 MiB would take ~17 minutes
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := io.Copy(io.Discard, throttleDownload(ctx, bytes.NewReader(make([]byte, 1<<20))))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("read returned after %v, want it cut off by the context", elapsed)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Tracing ----------
+//
+// Each /concat job is exported as an OpenTelemetry trace: a server span for
+// the job with child spans for the download, encode, probe, analysis, and
+// upload phases. An incoming W3C traceparent header makes the job span a
+// child of the caller's span, so container time shows up inside the
+// end-to-end trace. Spans are sent as OTLP/HTTP JSON to
+// OTEL_EXPORTER_OTLP_ENDPOINT once the job finishes; without an endpoint
+// tracing is a no-op. This speaks the wire format directly rather than
+// pulling in the OpenTelemetry SDK.
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+// otlpExportTimeout bounds a single export request
+const otlpExportTimeout = 10 * time.Second
+
+// jobTrace collects the spans of one job. A nil *jobTrace is a no-op.
+type jobTrace struct {
+	mu      sync.Mutex
+	traceID string
+	root    *span
+	spans   []*span
+}
+
+// span is one timed operation within a trace. A nil *span is a no-op.
+type span struct {
+	trace    *jobTrace
+	name     string
+	kind     int
+	spanID   string
+	parentID string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	errMsg   string
+}
+
+// startTrace begins the job span for r, or returns nil when no OTLP
+// endpoint is configured
+func startTrace(r *http.Request, name string) *jobTrace {
+	if config.OTLPEndpoint == "" {
+		return nil
+	}
+
+	t := &jobTrace{}
+	parentID := ""
+	if traceID, spanID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		t.traceID, parentID = traceID, spanID
+	} else {
+		t.traceID = randomHex(16)
+	}
+	t.root = t.newSpan(name, spanKindServer, parentID)
+	return t
+}
+
+// startSpan begins a child of the job span
+func (t *jobTrace) startSpan(name string) *span {
+	if t == nil {
+		return nil
+	}
+	return t.newSpan(name, spanKindInternal, t.root.spanID)
+}
+
+func (t *jobTrace) newSpan(name string, kind int, parentID string) *span {
+	s := &span{
+		trace:    t,
+		name:     name,
+		kind:     kind,
+		spanID:   randomHex(8),
+		parentID: parentID,
+		start:    time.Now(),
+		attrs:    map[string]any{},
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+// setAttr records an attribute on the job span
+func (t *jobTrace) setAttr(key string, value any) {
+	if t == nil {
+		return
+	}
+	t.root.setAttr(key, value)
+}
+
+// setAttr records an attribute on the span
+func (s *span) setAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	s.attrs[key] = value
+	s.trace.mu.Unlock()
+}
+
+// finish ends the span; it is safe to call more than once
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	s.trace.mu.Unlock()
+}
+
+// finish ends every open span, marking them and the job span failed when
+// errMsg is set, and exports the trace in the background
+func (t *jobTrace) finish(errMsg string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	for _, s := range t.spans {
+		if s.end.IsZero() {
+			s.end = now
+			// A span still open at a failure is where the job failed
+			s.errMsg = errMsg
+		}
+	}
+	t.root.errMsg = errMsg
+	body, err := json.Marshal(t.otlpLocked())
+	t.mu.Unlock()
+	if err != nil {
+		fmt.Printf("Warning: failed to encode trace %s: %v\n", t.traceID, err)
+		return
+	}
+
+	go exportTrace(config.OTLPEndpoint, body)
+}
+
+// exportTrace posts an OTLP/HTTP JSON payload to the collector
+func exportTrace(endpoint string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("Warning: trace export failed: %v\n", err)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err = fmt.Errorf("collector returned %d", resp.StatusCode)
+		fmt.Printf("Warning: trace export failed: %v\n", err)
+	}
+	return err
+}
+
+// otlpLocked renders the trace as an OTLP ExportTraceServiceRequest
+func (t *jobTrace) otlpLocked() map[string]any {
+	spans := make([]map[string]any, 0, len(t.spans))
+	for _, s := range t.spans {
+		out := map[string]any{
+			"traceId":           t.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            map[string]any{"code": statusCodeOK},
+		}
+		if s.parentID != "" {
+			out["parentSpanId"] = s.parentID
+		}
+		if s.errMsg != "" {
+			out["status"] = map[string]any{"code": statusCodeError, "message": s.errMsg}
+		}
+		spans = append(spans, out)
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes(map[string]any{"service.name": config.OTelServiceName}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/strollcast/ffmpeg-container"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes converts attrs to OTLP KeyValue form
+func otlpAttributes(attrs map[string]any) []map[string]any {
+	out := make([]map[string]any, 0, len(attrs))
+	for key, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": key, "value": value})
+	}
+	return out
+}
+
+// parseTraceparent extracts the trace and parent span IDs from a W3C
+// traceparent header ("00-<32 hex>-<16 hex>-<2 hex>")
+func parseTraceparent(header string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", false
+	}
+	for _, p := range parts {
+		if _, err := hex.DecodeString(p); err != nil || strings.ToLower(p) != p {
+			return "", "", false
+		}
+	}
+	// All-zero IDs are invalid per the spec
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// randomHex returns n random bytes hex-encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", false},
+	}
+	for _, tt := range tests {
+		traceID, spanID, ok := parseTraceparent(tt.header)
+		if ok != tt.ok {
+			t.Errorf("parseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+		}
+		if ok && (traceID != "4bf92f3577b34da6a3ce929d0e0e4736" || spanID != "00f067aa0ba902b7") {
+			t.Errorf("parseTraceparent(%q) = %s, %s", tt.header, traceID, spanID)
+		}
+	}
+}
+
+func TestTraceDisabledIsNoop(t *testing.T) {
+	trace := startTrace(httptest.NewRequest(http.MethodPost, "/concat", nil), "concat")
+	if trace != nil {
+		t.Fatal("expected nil trace without OTLP endpoint")
+	}
+	// Every method must be safe on the nil trace
+	span := trace.startSpan("download")
+	span.setAttr("bytes", 1)
+	span.finish()
+	trace.setAttr("episode_id", "ep-1")
+	trace.finish("")
+}
+
+func TestTraceExport(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("export path = %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]any
+		json.Unmarshal(body, &payload)
+		received <- payload
+	}))
+	defer collector.Close()
+
+	config.OTLPEndpoint = collector.URL
+	config.OTelServiceName = "ffmpeg-container"
+	defer func() { config.OTLPEndpoint = "" }()
+
+	r := httptest.NewRequest(http.MethodPost, "/concat", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	trace := startTrace(r, "concat")
+	download := trace.startSpan("download")
+	download.finish()
+	trace.startSpan("ffmpeg") // Left open: the phase that failed
+	trace.finish("FFmpeg failed")
+
+	var payload map[string]any
+	select {
+	case payload = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("trace was not exported")
+	}
+
+	spans := payload["resourceSpans"].([]any)[0].(map[string]any)["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(spans))
+	}
+	byName := map[string]map[string]any{}
+	for _, s := range spans {
+		span := s.(map[string]any)
+		byName[span["name"].(string)] = span
+		if span["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s traceId = %v", span["name"], span["traceId"])
+		}
+	}
+
+	root := byName["concat"]
+	if root["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Errorf("job span parent = %v, want caller's span", root["parentSpanId"])
+	}
+	if byName["download"]["parentSpanId"] != root["spanId"] {
+		t.Error("download span is not a child of the job span")
+	}
+	code := func(name string) float64 {
+		return byName[name]["status"].(map[string]any)["code"].(float64)
+	}
+	if code("download") != statusCodeOK || code("ffmpeg") != statusCodeError || code("concat") != statusCodeError {
+		t.Errorf("status codes: download=%v ffmpeg=%v concat=%v", code("download"), code("ffmpeg"), code("concat"))
+	}
+}
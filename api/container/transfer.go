@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ---------- Transfer Error Classification ----------
+//
+// Download and upload failures are classified so retries are principled:
+// DNS hiccups, dropped connections, 5xx, and 429 are worth another attempt;
+// other 4xx responses (expired signature, missing object) and local errors
+// will fail the same way every time.
+
+const (
+	kindDNS         = "dns"
+	kindNetwork     = "network"
+	kindServer      = "server_error"
+	kindRateLimited = "rate_limited"
+	kindClient      = "client_error"
+	kindLocal       = "local"
+)
+
+// transferRetryBase is the first retry delay; it doubles per attempt
+var transferRetryBase = 500 * time.Millisecond
+
+// TransferError is a classified download or upload failure
+type TransferError struct {
+	Kind       string
+	StatusCode int // HTTP status, 0 when no response was received
+	Err        error
+}
+
+func (e *TransferError) Error() string { return fmt.Sprintf("%v (%s)", e.Err, e.Kind) }
+func (e *TransferError) Unwrap() error { return e.Err }
+
+// Retryable reports whether another attempt may succeed
+func (e *TransferError) Retryable() bool {
+	switch e.Kind {
+	case kindDNS, kindNetwork, kindServer, kindRateLimited:
+		return true
+	}
+	return false
+}
+
+// isRetryable reports whether err is a retryable TransferError
+func isRetryable(err error) bool {
+	var te *TransferError
+	return errors.As(err, &te) && te.Retryable()
+}
+
+// statusError classifies a non-success HTTP response
+func statusError(method string, code int, body []byte) *TransferError {
+	kind := kindClient
+	switch {
+	case code == http.StatusTooManyRequests:
+		kind = kindRateLimited
+	case code >= 500:
+		kind = kindServer
+	}
+	return &TransferError{
+		Kind:       kind,
+		StatusCode: code,
+		Err:        fmt.Errorf("%s returned %d: %s", method, code, string(body)),
+	}
+}
+
+// networkError classifies an error from sending a request or reading a body
+func networkError(context string, err error) *TransferError {
+	wrapped := fmt.Errorf("%s: %w", context, err)
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return &TransferError{Kind: kindDNS, Err: wrapped}
+	}
+
+	// *url.Error satisfies net.Error for every failure, so look for the
+	// underlying socket error or a timeout instead
+	var opErr *net.OpError
+	var netErr net.Error
+	if errors.As(err, &opErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return &TransferError{Kind: kindNetwork, Err: wrapped}
+	}
+
+	// Anything else (bad URL scheme, local write failure) won't improve on retry
+	return &TransferError{Kind: kindLocal, Err: wrapped}
+}
+
+// retryTransfer runs op, retrying retryable failures up to TRANSFER_RETRIES
+// times with exponential backoff. It stops early when ctx is done.
+func retryTransfer[T any](ctx context.Context, label string, op func() (T, error)) (T, error) {
+	delay := transferRetryBase
+	for attempt := 0; ; attempt++ {
+		result, err := op()
+		// A request cut off by ctx isn't worth another attempt either
+		if err == nil || ctx.Err() != nil || !isRetryable(err) || attempt >= config.TransferRetries {
+			return result, err
+		}
+
+		fmt.Printf("%s: attempt %d failed (retryable): %v; retrying in %s\n", label, attempt+1, err, delay)
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// uploadWithRetry is uploadFile with retries for transient failures
+func uploadWithRetry(ctx context.Context, srcPath, url, contentType string) error {
+	_, err := retryTransfer(ctx, "upload "+redactURL(url), func() (struct{}, error) {
+		return struct{}{}, uploadFile(ctx, srcPath, url, contentType)
+	})
+	if ctx.Err() == nil {
+		recordUpload(url, err, time.Now())
+	}
+	return err
+}
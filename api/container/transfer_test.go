@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadErrorClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		kind      string
+		retryable bool
+	}{
+		{"not found", http.StatusNotFound, kindClient, false},
+		{"forbidden", http.StatusForbidden, kindClient, false},
+		{"rate limited", http.StatusTooManyRequests, kindRateLimited, true},
+		{"server error", http.StatusBadGateway, kindServer, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			_, err := downloadFile(context.Background(), server.URL, filepath.Join(t.TempDir(), "s.mp3"))
+			te, ok := err.(*TransferError)
+			if !ok {
+				t.Fatalf("err = %T %v, want *TransferError", err, err)
+			}
+			if te.Kind != tt.kind || te.StatusCode != tt.status || te.Retryable() != tt.retryable {
+				t.Errorf("got kind=%s status=%d retryable=%v", te.Kind, te.StatusCode, te.Retryable())
+			}
+		})
+	}
+}
+
+func TestDownloadDNSFailureIsRetryable(t *testing.T) {
+	// .invalid is reserved and never resolves (RFC 2606)
+	_, err := downloadFile(context.Background(), "http://segments.invalid/a.mp3", filepath.Join(t.TempDir(), "s.mp3"))
+	if !isRetryable(err) {
+		t.Errorf("DNS failure should be retryable: %v", err)
+	}
+}
+
+func TestDownloadConnectionRefusedIsRetryable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	_, err := downloadFile(context.Background(), url, filepath.Join(t.TempDir(), "s.mp3"))
+	if te, ok := err.(*TransferError); !ok || te.Kind != kindNetwork {
+		t.Errorf("err = %v, want network TransferError", err)
+	}
+}
+
+func TestUnsupportedSchemeIsTerminal(t *testing.T) {
+	_, err := downloadFile(context.Background(), "ftp://example.com/a.mp3", filepath.Join(t.TempDir(), "s.mp3"))
+	if err == nil || isRetryable(err) {
+		t.Errorf("unsupported scheme should be terminal: %v", err)
+	}
+}
+
+func TestUploadRetriesTransientFailures(t *testing.T) {
+	config.TransferRetries = 2
+	transferRetryBase = time.Millisecond
+	defer func() { config.TransferRetries = 0; transferRetryBase = 500 * time.Millisecond }()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+
+	if err := uploadWithRetry(context.Background(), src, server.URL, "audio/mpeg"); err != nil {
+		t.Fatalf("upload should succeed on third attempt: %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("attempts = %d, want 3", attempts.Load())
+	}
+}
+
+func TestUploadDoesNotRetryClientErrors(t *testing.T) {
+	config.TransferRetries = 2
+	transferRetryBase = time.Millisecond
+	defer func() { config.TransferRetries = 0; transferRetryBase = 500 * time.Millisecond }()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+
+	if err := uploadWithRetry(context.Background(), src, server.URL, "audio/mpeg"); err == nil {
+		t.Fatal("expected error")
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("attempts = %d, want 1", attempts.Load())
+	}
+}
+
+func TestUploadCancelledInFlight(t *testing.T) {
+	config.TransferRetries = 2
+	transferRetryBase = time.Millisecond
+	defer func() { config.TransferRetries = 0; transferRetryBase = 500 * time.Millisecond }()
+
+	var attempts atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release) // Before Close, which waits for the handler
+
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := uploadWithRetry(ctx, src, server.URL, "audio/mpeg"); err == nil {
+		t.Fatal("expected the timeout to fail the upload")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("upload returned after %s, want it cut off by the context", elapsed)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("attempts = %d, want 1", attempts.Load())
+	}
+}
+
+func TestDownloadCancelledInFlight(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte{0xff, 0xfb, 0x90, 0x00})
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release) // Before Close, which waits for the handler
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := downloadFile(ctx, server.URL, filepath.Join(t.TempDir(), "s.mp3")); err == nil {
+		t.Fatal("expected the timeout to fail the download")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("download returned after %s, want it cut off by the context", elapsed)
+	}
+}
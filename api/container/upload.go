@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ---------- Multi-Destination Upload ----------
+//
+// Each destination uploads in its own goroutine with its own retry loop, so
+// a slow or failing mirror never holds up the others. UPLOAD_CONCURRENCY
+// caps the attempts in flight across all jobs. A slot is held only while an
+// attempt runs, not during backoff, so a mirror waiting to retry doesn't
+// starve the rest.
+
+// UploadResult is the outcome of publishing the output to one destination
+type UploadResult struct {
+	URL        string `json:"url"`
+	Primary    bool   `json:"primary"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	Attempts   int    `json:"attempts"`    // PUTs sent, including retries
+	DurationMs int64  `json:"duration_ms"` // Wall time including backoff and waits for a slot
+}
+
+// uploadSlots limits concurrent destination uploads; nil = unlimited
+var uploadSlots chan struct{}
+
+// acquireUploadSlot waits for an upload slot, giving up when ctx ends
+func acquireUploadSlot(ctx context.Context) (func(), error) {
+	if uploadSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case uploadSlots <- struct{}{}:
+		return func() { <-uploadSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// uploadToDestinations PUTs srcPath to every URL concurrently. Results keep
+// the order of urls; the first is the primary.
+func uploadToDestinations(ctx context.Context, srcPath string, urls []string, contentType string) []UploadResult {
+	results := make([]UploadResult, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		results[i] = UploadResult{URL: u, Primary: i == 0}
+		wg.Add(1)
+		go func(r *UploadResult) {
+			defer wg.Done()
+			uploadDestination(ctx, srcPath, contentType, r)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// uploadDestination runs one destination's retry loop and fills in r
+func uploadDestination(ctx context.Context, srcPath, contentType string, r *UploadResult) {
+	start := time.Now()
+	_, err := retryTransfer(ctx, "upload "+redactURL(r.URL), func() (struct{}, error) {
+		release, err := acquireUploadSlot(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		defer release()
+		r.Attempts++
+		return struct{}{}, uploadFile(ctx, srcPath, r.URL, contentType)
+	})
+	if ctx.Err() == nil {
+		recordUpload(r.URL, err, time.Now())
+	}
+	r.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	r.Success = true
+}
+
+// checkUploads decides whether the job succeeded: the primary must always
+// succeed, and mirrors too when requireAll is set
+func checkUploads(results []UploadResult, requireAll bool) error {
+	failed := 0
+	for _, r := range results {
+		if r.Success {
+			continue
+		}
+		if r.Primary {
+			return fmt.Errorf("primary destination: %s", r.Error)
+		}
+		failed++
+	}
+	if requireAll && failed > 0 {
+		return fmt.Errorf("%d of %d mirror destinations failed", failed, len(results)-1)
+	}
+	return nil
+}
+
+// failedUploadURLs returns the URLs of the destinations that failed, in
+// order, ready to send to /reupload
+func failedUploadURLs(results []UploadResult) []string {
+	var failed []string
+	for _, r := range results {
+		if !r.Success {
+			failed = append(failed, r.URL)
+		}
+	}
+	return failed
+}
+
+// redactURL strips the query string (presigned signatures) for messages
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.RawQuery = ""
+	return u.String()
+}
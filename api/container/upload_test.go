@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUploadToDestinations(t *testing.T) {
+	var received sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		received.Store(r.URL.Path, r.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+
+	urls := []string{server.URL + "/primary", server.URL + "/broken", server.URL + "/mirror"}
+	results := uploadToDestinations(context.Background(), src, urls, "audio/mpeg")
+
+	if !results[0].Primary || !results[0].Success {
+		t.Errorf("primary result = %+v", results[0])
+	}
+	if results[1].Success || results[1].Error == "" {
+		t.Errorf("broken mirror result = %+v", results[1])
+	}
+	if !results[2].Success {
+		t.Errorf("mirror result = %+v", results[2])
+	}
+	if ct, _ := received.Load("/mirror"); ct != "audio/mpeg" {
+		t.Errorf("mirror Content-Type = %v", ct)
+	}
+
+	if err := checkUploads(results, false); err != nil {
+		t.Errorf("mirror failure should not fail the job by default: %v", err)
+	}
+	if err := checkUploads(results, true); err == nil {
+		t.Error("mirror failure should fail the job with require_all_uploads")
+	}
+	if failed := failedUploadURLs(results); len(failed) != 1 || failed[0] != urls[1] {
+		t.Errorf("failedUploadURLs = %v, want [%s]", failed, urls[1])
+	}
+}
+
+func TestUploadDestinationsRetryIndependently(t *testing.T) {
+	defer func(c Config, base time.Duration) { config, transferRetryBase = c, base }(config, transferRetryBase)
+	config.TransferRetries = 2
+	transferRetryBase = 20 * time.Millisecond
+
+	var flakyCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if flakyCalls.Add(1) == 1 {
+				http.Error(w, "try again", http.StatusServiceUnavailable)
+				return
+			}
+		case "/down":
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		case "/expired":
+			http.Error(w, "expired", http.StatusForbidden)
+			return
+		}
+	}))
+	defer server.Close()
+
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+
+	urls := []string{server.URL + "/fast", server.URL + "/flaky", server.URL + "/down", server.URL + "/expired"}
+	results := uploadToDestinations(context.Background(), src, urls, "audio/mpeg")
+
+	want := []struct {
+		success  bool
+		attempts int
+	}{{true, 1}, {true, 2}, {false, 3}, {false, 1}}
+	for i, w := range want {
+		if results[i].Success != w.success || results[i].Attempts != w.attempts {
+			t.Errorf("%s: success = %v, attempts = %d; want %v, %d",
+				urls[i], results[i].Success, results[i].Attempts, w.success, w.attempts)
+		}
+	}
+	// The fast destination finishes without waiting on the others' backoff
+	if results[0].DurationMs >= results[2].DurationMs {
+		t.Errorf("fast took %dms, failing mirror %dms", results[0].DurationMs, results[2].DurationMs)
+	}
+}
+
+func TestUploadConcurrencyCap(t *testing.T) {
+	defer func(slots chan struct{}) { uploadSlots = slots }(uploadSlots)
+	uploadSlots = make(chan struct{}, 2)
+
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	src := filepath.Join(t.TempDir(), "output.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+
+	urls := make([]string, 6)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/mirror-%d", server.URL, i)
+	}
+	for _, r := range uploadToDestinations(context.Background(), src, urls, "audio/mpeg") {
+		if !r.Success {
+			t.Errorf("%s: %s", r.URL, r.Error)
+		}
+	}
+	if got := peak.Load(); got > 2 {
+		t.Errorf("peak concurrent uploads = %d, want at most 2", got)
+	}
+}
+
+func TestAcquireUploadSlotCancelled(t *testing.T) {
+	defer func(slots chan struct{}) { uploadSlots = slots }(uploadSlots)
+	uploadSlots = make(chan struct{}, 1)
+	release, err := acquireUploadSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := acquireUploadSlot(ctx); err == nil {
+		t.Error("expected an error while the only slot is held and ctx is done")
+	}
+}
+
+func TestCheckUploadsPrimaryFailure(t *testing.T) {
+	results := []UploadResult{
+		{URL: "a", Primary: true, Error: "PUT returned 500"},
+		{URL: "b", Success: true},
+	}
+	if err := checkUploads(results, false); err == nil {
+		t.Error("primary failure must fail the job")
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	got := redactURL("https://r2.example/ep/ep.mp3?X-Amz-Signature=secret")
+	if got != "https://r2.example/ep/ep.mp3" {
+		t.Errorf("redactURL = %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ---------- Waveform Peaks ----------
+//
+// The output is decoded to 8 kHz mono 16-bit PCM and reduced in two steps:
+// a streaming pass keeps the min/max of each 10 ms block (so memory scales
+// with duration/100, not sample count), then blocks are merged into the
+// requested number of buckets. Peaks are scaled to 8 bits, matching the
+// compact format web players already accept.
+
+const (
+	defaultWaveformBuckets = 1000
+	maxWaveformBuckets     = 20000
+
+	waveformSampleRate   = 8000
+	waveformBlockSamples = waveformSampleRate / 100
+)
+
+// Waveform is a downsampled peaks array for visualization
+type Waveform struct {
+	Buckets int    `json:"buckets"`
+	Peaks   []int8 `json:"peaks"` // Interleaved min,max per bucket in -128..127
+}
+
+// peak is the min and max sample of one block
+type peak struct {
+	min, max int16
+}
+
+// generateWaveform decodes path with FFmpeg and returns its peaks
+func generateWaveform(ctx context.Context, path string, buckets int) (*Waveform, error) {
+	cmd := ffmpegCommand(ctx,
+		"-v", "error",
+		"-i", path,
+		"-ac", "1",
+		"-ar", fmt.Sprint(waveformSampleRate),
+		"-f", "s16le",
+		"-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start ffmpeg: %w", err)
+	}
+
+	blocks, readErr := blockPeaks(stdout, waveformBlockSamples)
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("decode failed: %v: %s", err, stderr.String())
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(blocks) == 0 {
+		return nil, errors.New("no audio decoded")
+	}
+
+	return bucketPeaks(blocks, buckets), nil
+}
+
+// blockPeaks reads little-endian s16 samples and returns the min/max of
+// every blockSamples-long block; a trailing partial block is kept
+func blockPeaks(r io.Reader, blockSamples int) ([]peak, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var blocks []peak
+	var cur peak
+	n := 0
+	buf := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, fmt.Errorf("read PCM: %w", err)
+		}
+		v := int16(binary.LittleEndian.Uint16(buf))
+		if n == 0 || v < cur.min {
+			cur.min = v
+		}
+		if n == 0 || v > cur.max {
+			cur.max = v
+		}
+		n++
+		if n == blockSamples {
+			blocks = append(blocks, cur)
+			n = 0
+		}
+	}
+	if n > 0 {
+		blocks = append(blocks, cur)
+	}
+	return blocks, nil
+}
+
+// bucketPeaks merges blocks into at most buckets min/max pairs
+func bucketPeaks(blocks []peak, buckets int) *Waveform {
+	if buckets > len(blocks) {
+		buckets = len(blocks)
+	}
+	peaks := make([]int8, 0, buckets*2)
+	for b := 0; b < buckets; b++ {
+		start := b * len(blocks) / buckets
+		end := (b + 1) * len(blocks) / buckets
+		merged := blocks[start]
+		for _, p := range blocks[start+1 : end] {
+			merged.min = min(merged.min, p.min)
+			merged.max = max(merged.max, p.max)
+		}
+		peaks = append(peaks, int8(merged.min>>8), int8(merged.max>>8))
+	}
+	return &Waveform{Buckets: buckets, Peaks: peaks}
+}
+
+// uploadWaveform writes the peaks JSON to path and PUTs it to url
+func uploadWaveform(ctx context.Context, waveform *Waveform, path, url string) error {
+	data, err := json.Marshal(waveform)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	return uploadWithRetry(ctx, path, url, "application/json")
+}
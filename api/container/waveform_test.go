@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func pcm(samples ...int16) *bytes.Reader {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestBlockPeaks(t *testing.T) {
+	blocks, err := blockPeaks(pcm(1, -5, 3, 10, -2, 4, 7), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []peak{{-5, 3}, {-2, 10}, {7, 7}}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("blocks = %v, want %v", blocks, want)
+	}
+}
+
+func TestBucketPeaks(t *testing.T) {
+	blocks := []peak{
+		{-256, 256}, {-512, 1024},
+		{-32768, 32767}, {0, 0},
+	}
+
+	got := bucketPeaks(blocks, 2)
+	want := &Waveform{Buckets: 2, Peaks: []int8{-2, 4, -128, 127}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bucketPeaks = %+v, want %+v", got, want)
+	}
+
+	// More buckets than blocks collapses to one bucket per block
+	if got := bucketPeaks(blocks, 10); got.Buckets != len(blocks) {
+		t.Errorf("Buckets = %d, want %d", got.Buckets, len(blocks))
+	}
+}
+
+func TestValidateRequestWaveform(t *testing.T) {
+	req := &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", GenerateWaveform: true}
+	if err := validateRequest(req); err != nil || req.WaveformBuckets != defaultWaveformBuckets {
+		t.Errorf("default buckets: err = %v, buckets = %d", err, req.WaveformBuckets)
+	}
+
+	req = &ConcatRequest{Segments: segmentURLs("a"), OutputURL: "b", GenerateWaveform: true, WaveformBuckets: maxWaveformBuckets + 1}
+	if err := validateRequest(req); err == nil {
+		t.Error("expected error for too many buckets")
+	}
+}